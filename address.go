@@ -0,0 +1,247 @@
+package mime
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+)
+
+// addressHeaders are the header fields containing address lists, per RFC 5322 section 3.6
+var addressHeaders = map[string]bool{
+	"From":          true,
+	"Sender":        true,
+	"Reply-To":      true,
+	"To":            true,
+	"Cc":            true,
+	"Bcc":           true,
+	"Resent-From":   true,
+	"Resent-Sender": true,
+	"Resent-To":     true,
+	"Resent-Cc":     true,
+	"Resent-Bcc":    true,
+}
+
+// WithIDNA converts internationalized domain names in address header fields to their ASCII
+// (punycode) form, for delivery through servers without SMTPUTF8 support.  Addresses whose local
+// part is not ASCII cannot be downgraded and are rejected.
+func WithIDNA() BuilderOption {
+	return func(b *Builder) {
+		b.idna = true
+	}
+}
+
+// SetAddressHeader sets the top level address header field name, e.g. "To", to addrs.  Display
+// names containing non-ASCII characters are RFC 2047 encoded; addr-specs are left as they are
+// unless the Builder was configured WithIDNA.
+func (b *Builder) SetAddressHeader(name string, addrs ...*mail.Address) error {
+	value, err := b.formatAddressList(addrs)
+	if err != nil {
+		return err
+	}
+	return b.SetHeader(name, value)
+}
+
+// encodeAddressHeader re-formats non-ASCII values of address header fields so that display names
+// are RFC 2047 encoded.  Values that are ASCII, or cannot be parsed as an address list, are
+// returned unmodified.
+func (b *Builder) encodeAddressHeader(name, value string) (string, error) {
+	if !addressHeaders[textproto.CanonicalMIMEHeaderKey(name)] || isASCII(value) {
+		return value, nil
+	}
+	addrs, err := mail.ParseAddressList(value)
+	if err != nil {
+		return value, nil
+	}
+	return b.formatAddressList(addrs)
+}
+
+func (b *Builder) formatAddressList(addrs []*mail.Address) (string, error) {
+	formatted := make([]string, len(addrs))
+	for i, a := range addrs {
+		s, err := b.formatAddress(a)
+		if err != nil {
+			return "", err
+		}
+		formatted[i] = s
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+// formatAddress renders a, RFC 2047 encoding its display name if needed.
+func (b *Builder) formatAddress(a *mail.Address) (string, error) {
+	addr := a.Address
+	if b.idna {
+		var err error
+		if addr, err = addressToASCII(addr); err != nil {
+			return "", err
+		}
+	}
+	spec := (&mail.Address{Address: addr}).String()
+	if a.Name == "" {
+		return spec, nil
+	}
+	if isASCII(a.Name) {
+		return (&mail.Address{Name: a.Name, Address: addr}).String(), nil
+	}
+	return encodeDisplayName(a.Name) + " " + spec, nil
+}
+
+// encodeDisplayName RFC 2047 encodes a non-ASCII display name.  The Q encoding keeps names that
+// are mostly ASCII legible, so it is used unless more than a third of the name's characters need
+// encoding, when the shorter of the Q and B encodings is used.
+func encodeDisplayName(name string) string {
+	qname := mime.QEncoding.Encode("utf-8", name)
+	runes, nonASCII := 0, 0
+	for _, r := range name {
+		runes++
+		if r >= utf8.RuneSelf {
+			nonASCII++
+		}
+	}
+	if nonASCII*3 <= runes {
+		return qname
+	}
+	if bname := mime.BEncoding.Encode("utf-8", name); len(bname) < len(qname) {
+		return bname
+	}
+	return qname
+}
+
+// addressToASCII converts the domain of addr to its ASCII form.
+func addressToASCII(addr string) (string, error) {
+	at := strings.LastIndex(addr, "@")
+	if at == -1 {
+		return addr, nil
+	}
+	local, domain := addr[:at], addr[at+1:]
+	if !isASCII(local) {
+		return "", fmt.Errorf("address %q has a non-ASCII local part", addr)
+	}
+	domain, err := domainToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("address %q: %w", addr, err)
+	}
+	return local + "@" + domain, nil
+}
+
+// domainToASCII converts each non-ASCII label of domain to an IDNA A-label, per RFC 5891.  Labels
+// are lowercased but no further mapping is done.
+func domainToASCII(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycodeEncode(strings.ToLower(label))
+		if err != nil {
+			return "", err
+		}
+		labels[i] = "xn--" + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Punycode parameters, per RFC 3492 section 5
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycodeEncode encodes s with the Punycode algorithm of RFC 3492 section 6.3.
+func punycodeEncode(s string) (string, error) {
+	runes := []rune(s)
+	out := make([]byte, 0, len(s)+8)
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for handled < len(runes) {
+		m := rune(utf8.MaxRune + 1)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (1<<31-1-delta)/(handled+1) {
+			return "", fmt.Errorf("punycode overflow encoding %q", s)
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,89 @@
+package mime
+
+import (
+	"net/mail"
+	"testing"
+)
+
+func TestPunycodeEncode(t *testing.T) {
+	ttable := []struct {
+		in, want string
+	}{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"ü", "tda"},
+		{"例え", "r8jz45g"},
+		{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+	}
+	for _, tt := range ttable {
+		got, err := punycodeEncode(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("punycodeEncode(%q) == %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuilderAddressHeaders(t *testing.T) {
+	ttable := []struct {
+		desc  string
+		opts  []BuilderOption
+		name  string
+		value string
+		want  string
+	}{
+		{"ascii", nil, "To", `"Doe, Jane" <jane@example.com>`, `"Doe, Jane" <jane@example.com>`},
+		{
+			"short name uses Q", nil, "From", "José <jose@example.com>",
+			"=?utf-8?q?Jos=C3=A9?= <jose@example.com>",
+		},
+		{
+			"mostly non-ASCII name uses B", nil, "To", "日本語 <nihongo@example.com>",
+			"=?utf-8?b?5pel5pys6Kqe?= <nihongo@example.com>",
+		},
+		{
+			"list", nil, "cc", "José <jose@example.com>, bob@example.com",
+			"=?utf-8?q?Jos=C3=A9?= <jose@example.com>, <bob@example.com>",
+		},
+		{
+			"addr-spec intact", nil, "To", "Zoë <zoe@bücher.example>",
+			"=?utf-8?q?Zo=C3=AB?= <zoe@bücher.example>",
+		},
+		{
+			"idna", []BuilderOption{WithIDNA()}, "To", "Zoë <zoe@Bücher.example>",
+			"=?utf-8?q?Zo=C3=AB?= <zoe@xn--bcher-kva.example>",
+		},
+		{"not an address field", nil, "Subject", "José", "José"},
+		{"unparsable", nil, "To", "José <<broken", "José <<broken"},
+	}
+	for _, tt := range ttable {
+		b := NewBuilder(tt.opts...)
+		if err := b.SetHeader(tt.name, tt.value); err != nil {
+			t.Fatalf("%s: %v", tt.desc, err)
+		}
+		if got := b.header.Get(tt.name); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestBuilderSetAddressHeader(t *testing.T) {
+	b := NewBuilder(WithIDNA())
+	err := b.SetAddressHeader("To",
+		&mail.Address{Name: "Jörg", Address: "joerg@münchen.example"},
+		&mail.Address{Address: "ops@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "=?utf-8?q?J=C3=B6rg?= <joerg@xn--mnchen-3ya.example>, <ops@example.com>"
+	if got := b.header.Get("To"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	err = b.SetAddressHeader("To", &mail.Address{Address: "jörg@example.com"})
+	if err == nil {
+		t.Error("non-ASCII local part downgraded, want error")
+	}
+}
@@ -0,0 +1,156 @@
+package mime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// sniffLen is the number of bytes of content examined to detect its type, as for
+// http.DetectContentType.
+const sniffLen = 512
+
+// AttachmentInfo describes an attachment Part, holding the fields a message list displays.
+type AttachmentInfo struct {
+	Descriptor   string // Descriptor of the Part
+	Filename     string // Filename of the Part, or a name suggested by SuggestedFilename
+	ContentType  string // ContentType declared in the Part's header
+	DetectedType string // Media type sniffed from the decoded content, "" if it was unavailable
+	ContentID    string // ContentID of the Part
+	EncodedSize  int    // Size of the transfer encoded content
+	DecodedSize  int64  // Size of the decoded content, -1 if it was unavailable
+	Part         *Part
+}
+
+// Attachments returns information about each attachment in the Part tree rooted at root, in tree
+// order.  A Part is an attachment if it is not multipart and either has a Content-Disposition of
+// attachment, or is not marked inline and has a filename, or is neither text nor referenced by a
+// Content-ID.  The content of attached messages is not searched for further attachments.
+//
+// Each attachment is decoded to measure its DecodedSize and detect its type.
+func Attachments(root *Part) []AttachmentInfo {
+	var infos []AttachmentInfo
+	classifyParts(root, func(p *Part, kind partKind) {
+		if kind == partAttachment {
+			infos = append(infos, p.attachmentInfo())
+		}
+	})
+	return infos
+}
+
+// attachmentInfo decodes the Part to build its AttachmentInfo.
+func (p *Part) attachmentInfo() AttachmentInfo {
+	info := AttachmentInfo{
+		Descriptor:  p.Descriptor,
+		Filename:    p.SuggestedFilename(),
+		ContentType: p.ContentType,
+		ContentID:   p.ContentID,
+		EncodedSize: p.Size,
+		DecodedSize: -1,
+		Part:        p,
+	}
+	r, err := p.DecodeRaw()
+	if err != nil {
+		return info
+	}
+	sw := &sniffWriter{}
+	if _, err := io.Copy(sw, r); err != nil {
+		return info
+	}
+	info.DecodedSize = sw.n
+	info.DetectedType = detectContentType(info.Filename, sw.head)
+	return info
+}
+
+// sniffWriter counts the bytes written to it, keeping the first sniffLen.
+type sniffWriter struct {
+	head []byte
+	n    int64
+}
+
+func (w *sniffWriter) Write(b []byte) (int, error) {
+	if room := sniffLen - len(w.head); room > 0 {
+		if room > len(b) {
+			room = len(b)
+		}
+		w.head = append(w.head, b[:room]...)
+	}
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+// DecodeAll calls fn with the decoded content of each attachment in the Part tree rooted at root,
+// see Attachments, running up to workers calls at once, or GOMAXPROCS if workers is not positive.
+// fn is called from multiple goroutines and must not modify the tree.  The first error from
+// decoding or fn cancels the remaining work and is returned, as is the context's error if it is
+// cancelled first; reads from the decoded content fail once the context is done.
+func DecodeAll(ctx context.Context, root *Part, workers int,
+	fn func(p *Part, r io.Reader) error) error {
+	var parts []*Part
+	classifyParts(root, func(p *Part, kind partKind) {
+		if kind == partAttachment {
+			parts = append(parts, p)
+		}
+	})
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	sem := make(chan struct{}, workers)
+dispatch:
+	for _, p := range parts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+		wg.Add(1)
+		go func(p *Part) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r, err := p.Decode()
+			if err != nil {
+				fail(fmt.Errorf("%s: %w", p.Descriptor, err))
+				return
+			}
+			if err := fn(p, &contextReader{ctx: ctx, r: r}); err != nil {
+				fail(fmt.Errorf("%s: %w", p.Descriptor, err))
+			}
+		}(p)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// contextReader fails reads from r once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(b []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(b)
+}
@@ -0,0 +1,164 @@
+package mime
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAttachments(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+	pdf := "%PDF-1.4\n" + strings.Repeat("x", 100)
+	raw := "Content-Type: multipart/mixed; boundary=mixed\r\n\r\n" +
+		"--mixed\r\nContent-Type: multipart/related; boundary=rel\r\n\r\n" +
+		"--rel\r\nContent-Type: text/html\r\n\r\n<img src=\"cid:logo@x\">\r\n" +
+		"--rel\r\nContent-Type: image/png\r\nContent-ID: <logo@x>\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(png)) + "\r\n" +
+		"--rel--\r\n" +
+		"\r\n--mixed\r\nContent-Type: application/octet-stream; name=\"report.pdf\"\r\n" +
+		"Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(pdf)) + "\r\n" +
+		"--mixed\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment\r\n\r\n" +
+		"Content-Type: multipart/mixed; boundary=inner\r\n\r\n" +
+		"--inner\r\nContent-Type: application/zip; name=\"nested.zip\"\r\n\r\nPK\r\n" +
+		"--inner--\r\n" +
+		"\r\n--mixed\r\nContent-Type: application/x-unnamed\r\n\r\ndata\r\n" +
+		"--mixed--\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AttachmentInfo{
+		{
+			Descriptor:   "2",
+			Filename:     "report.pdf",
+			ContentType:  ctAppOctetStream,
+			DetectedType: "application/pdf",
+			DecodedSize:  int64(len(pdf)),
+		},
+		{
+			Descriptor:   "3",
+			Filename:     "attachment-3.eml",
+			ContentType:  ContentTypeMessageRfc822,
+			DetectedType: ContentTypeMessageRfc822,
+		},
+		{
+			Descriptor:   "4",
+			ContentType:  "application/x-unnamed",
+			DetectedType: "text/plain; charset=utf-8",
+			DecodedSize:  4,
+		},
+	}
+	got := Attachments(p)
+	if len(got) != len(want) {
+		t.Fatalf("got %d attachments, want %d: %+v", len(got), len(want), got)
+	}
+	for i, g := range got {
+		w := want[i]
+		if g.Descriptor != w.Descriptor || g.Filename != w.Filename ||
+			g.ContentType != w.ContentType || g.DetectedType != w.DetectedType {
+			t.Errorf("got %+v, want %+v", g, w)
+		}
+		if g.Part == nil || g.EncodedSize != g.Part.Size {
+			t.Errorf("%s: EncodedSize %d, Part %v", g.Descriptor, g.EncodedSize, g.Part)
+		}
+		if w.DecodedSize != 0 && g.DecodedSize != w.DecodedSize {
+			t.Errorf("%s: DecodedSize %d, want %d", g.Descriptor, g.DecodedSize, w.DecodedSize)
+		}
+	}
+
+	structure, err := ReadStructure(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range Attachments(structure) {
+		if a.DecodedSize != -1 || a.DetectedType != "" {
+			t.Errorf("%s: from ReadStructure got DecodedSize %d, DetectedType %q", a.Descriptor,
+				a.DecodedSize, a.DetectedType)
+		}
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	buf := &strings.Builder{}
+	buf.WriteString("Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nbody\r\n")
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(buf, "--b\r\nContent-Type: application/octet-stream; name=\"%d.bin\"\r\n"+
+			"Content-Transfer-Encoding: base64\r\n\r\n%s\r\n", i,
+			base64.StdEncoding.EncodeToString([]byte(fmt.Sprint("content ", i))))
+	}
+	buf.WriteString("--b--\r\n")
+	p, err := ReadParts(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu               sync.Mutex
+		got              []string
+		running, maxSeen int32
+	)
+	err = DecodeAll(context.Background(), p, 2, func(s *Part, r io.Reader) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxSeen)
+			if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		got = append(got, string(b))
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if len(got) != 6 || got[0] != "content 0" || got[5] != "content 5" {
+		t.Errorf("decoded %q", got)
+	}
+	if maxSeen > 2 {
+		t.Errorf("ran %d calls at once, want at most 2", maxSeen)
+	}
+
+	// The first error is returned and stops further calls
+	wantErr := errors.New("scan failed")
+	var calls int32
+	err = DecodeAll(context.Background(), p, 1, func(s *Part, r io.Reader) error {
+		atomic.AddInt32(&calls, 1)
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) || calls != 1 {
+		t.Errorf("got error %v after %d calls, want %v after 1", err, calls, wantErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = DecodeAll(ctx, p, 0, func(s *Part, r io.Reader) error {
+		_, err := ioutil.ReadAll(r)
+		return err
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,113 @@
+package mime
+
+import (
+	"io"
+)
+
+// maxLineLen is the hard limit on line length, excluding CRLF, per RFC 5322 section 2.1.1
+const maxLineLen = 998
+
+// LineLengthAudit reports the line lengths of a single Part, measured in octets excluding the line
+// ending.  Header lines are measured as they appear in the header block, so folded fields count as
+// multiple lines.  Content is measured in its transfer encoded form, and only for leaf Parts.
+type LineLengthAudit struct {
+	Descriptor   string
+	MaxLen       int // Length of the longest line
+	Long         int // Number of lines exceeding the 78 octet recommended limit
+	TooLong      int // Number of lines exceeding the 998 octet hard limit
+	FirstLong    int // Line number of the first line exceeding 78 octets, from 1, or 0 if none
+	FirstTooLong int // Line number of the first line exceeding 998 octets, from 1, or 0 if none
+}
+
+// Valid returns true if no line exceeds the hard limit of 998 octets.
+func (a *LineLengthAudit) Valid() bool {
+	return a.TooLong == 0
+}
+
+// AuditLineLengths measures the lines of the Part and its descendants, returning an audit for each
+// in tree order.  Outbound messages with lines exceeding 998 octets may be rejected or altered in
+// transit, and should be re-encoded before sending.  Parts read with ReadStructure return
+// ErrNoContent.
+func (p *Part) AuditLineLengths() ([]*LineLengthAudit, error) {
+	var audits []*LineLengthAudit
+	err := p.Walk(func(p *Part) error {
+		a := &LineLengthAudit{Descriptor: p.Descriptor}
+		header, err := p.HeaderAt()
+		if err != nil {
+			return err
+		}
+		ln := &lineAuditor{audit: a}
+		if err := ln.scan(header); err != nil {
+			return err
+		}
+		if p.boundary == "" && len(p.Subparts) == 0 {
+			if err := ln.scan(p.encodedBody()); err != nil {
+				return err
+			}
+		}
+		audits = append(audits, a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+// lineAuditor accumulates line lengths into a LineLengthAudit across successive scans.
+type lineAuditor struct {
+	audit *LineLengthAudit
+	line  int
+}
+
+// scan measures each line of r, treating both CRLF and bare LF as line endings.
+func (la *lineAuditor) scan(r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	n := 0
+	prevCR := false
+	for {
+		m, err := r.Read(buf)
+		for _, b := range buf[:m] {
+			if b == '\n' {
+				if prevCR {
+					n--
+				}
+				la.add(n)
+				n = 0
+				prevCR = false
+				continue
+			}
+			n++
+			prevCR = b == '\r'
+		}
+		if err == io.EOF {
+			if n > 0 {
+				la.add(n)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (la *lineAuditor) add(n int) {
+	la.line++
+	a := la.audit
+	if n > a.MaxLen {
+		a.MaxLen = n
+	}
+	if n > maxHeaderLineLen {
+		a.Long++
+		if a.FirstLong == 0 {
+			a.FirstLong = la.line
+		}
+	}
+	if n > maxLineLen {
+		a.TooLong++
+		if a.FirstTooLong == 0 {
+			a.FirstTooLong = la.line
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package mime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuditLineLengths(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	tooLong := strings.Repeat("y", 1000)
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n" +
+		"Subject: " + long + "\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"short\r\n" + long + "\r\n" + tooLong + "\n" + long + "\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"fine\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	audits, err := p.AuditLineLengths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LineLengthAudit{
+		{Descriptor: "0", MaxLen: 109, Long: 1, FirstLong: 2},
+		{Descriptor: "1", MaxLen: 1000, Long: 3, TooLong: 1, FirstLong: 4, FirstTooLong: 5},
+		{Descriptor: "2", MaxLen: 24},
+	}
+	if len(audits) != len(want) {
+		t.Fatalf("got %d audits, want %d", len(audits), len(want))
+	}
+	for i, a := range audits {
+		if *a != want[i] {
+			t.Errorf("audit %d == %+v, want %+v", i, *a, want[i])
+		}
+		if a.Valid() != (want[i].TooLong == 0) {
+			t.Errorf("audit %d Valid() == %v", i, a.Valid())
+		}
+	}
+
+	s, err := ReadStructure(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AuditLineLengths(); err != ErrNoContent {
+		t.Errorf("got error %v, want %v", err, ErrNoContent)
+	}
+}
@@ -0,0 +1,107 @@
+package mime
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+const (
+	// Automatic and bulk mail header names, RFC 3834, Microsoft Exchange and Google
+	hnAutoSubmitted        = "Auto-Submitted"
+	hnPrecedence           = "Precedence"
+	hnAutoResponseSuppress = "X-Auto-Response-Suppress"
+	hnFeedbackID           = "Feedback-Id"
+
+	// autoSubmittedNo is the Auto-Submitted keyword of a message sent by a person
+	autoSubmittedNo = "no"
+)
+
+// AutoHeaders holds the fields of a message signalling that it was sent automatically or in bulk,
+// for autoresponders and suppression lists.
+type AutoHeaders struct {
+	// AutoSubmitted is the lowercase RFC 3834 keyword without parameters, e.g. "auto-replied" or
+	// "auto-generated", or "" if the field is absent.  "no" marks a message sent by a person.
+	AutoSubmitted string
+	// Precedence is the lowercase value of the nonstandard Precedence field, e.g. "bulk", "list"
+	// or "junk"
+	Precedence string
+	// SuppressResponses lists the X-Auto-Response-Suppress values, e.g. "OOF" or "DR", naming the
+	// kinds of automatic responses the sender asks not to receive
+	SuppressResponses []string
+	// FeedbackID holds the colon separated fields of the Feedback-ID used for Gmail's feedback
+	// loop, the last of which identifies the sender
+	FeedbackID []string
+}
+
+// ParseAutoHeaders extracts the Auto-Submitted, Precedence, X-Auto-Response-Suppress and
+// Feedback-ID fields from header.  Nil is returned if the header has none of them.
+func ParseAutoHeaders(header textproto.MIMEHeader) *AutoHeaders {
+	found := false
+	for _, k := range []string{hnAutoSubmitted, hnPrecedence, hnAutoResponseSuppress,
+		hnFeedbackID} {
+		if _, ok := header[k]; ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	a := &AutoHeaders{
+		AutoSubmitted: autoHeaderKeyword(header.Get(hnAutoSubmitted)),
+		Precedence:    autoHeaderKeyword(header.Get(hnPrecedence)),
+	}
+	for _, v := range header[hnAutoResponseSuppress] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				a.SuppressResponses = append(a.SuppressResponses, s)
+			}
+		}
+	}
+	if v := strings.TrimSpace(header.Get(hnFeedbackID)); v != "" {
+		a.FeedbackID = strings.Split(v, ":")
+		for i, s := range a.FeedbackID {
+			a.FeedbackID[i] = strings.TrimSpace(s)
+		}
+	}
+	return a
+}
+
+// Automated returns true if the message was sent by a program rather than a person: it has an
+// Auto-Submitted value other than "no", or a Precedence of bulk, list or junk.
+func (a *AutoHeaders) Automated() bool {
+	if a.AutoSubmitted != "" && a.AutoSubmitted != autoSubmittedNo {
+		return true
+	}
+	switch a.Precedence {
+	case "bulk", "list", "junk":
+		return true
+	}
+	return false
+}
+
+// SuppressAutoReply returns true if an autoresponder, such as an out of office notice, must not
+// reply to the message, per RFC 3834 section 2: it is Automated, or X-Auto-Response-Suppress
+// includes All, OOF or AutoReply.
+func (a *AutoHeaders) SuppressAutoReply() bool {
+	if a.Automated() {
+		return true
+	}
+	for _, s := range a.SuppressResponses {
+		if strings.EqualFold(s, "All") || strings.EqualFold(s, "OOF") ||
+			strings.EqualFold(s, "AutoReply") {
+			return true
+		}
+	}
+	return false
+}
+
+// autoHeaderKeyword returns the lowercase keyword of an Auto-Submitted or Precedence value,
+// dropping any parameters and comments, e.g. "auto-replied" from "Auto-Replied; owner-email=x".
+func autoHeaderKeyword(v string) string {
+	if i := strings.IndexAny(v, ";("); i >= 0 {
+		v = v[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
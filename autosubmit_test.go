@@ -0,0 +1,56 @@
+package mime
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestParseAutoHeaders(t *testing.T) {
+	ttable := []struct {
+		header             textproto.MIMEHeader
+		auto, prec         string
+		suppress, feedback string
+		automated, noReply bool
+	}{
+		{
+			textproto.MIMEHeader{
+				"Auto-Submitted": {"Auto-Replied; owner-email=\"a@example.com\""},
+				"Feedback-Id":    {"campaign1:customer2:newsletter:esp"},
+			},
+			"auto-replied", "", "", "campaign1 customer2 newsletter esp", true, true,
+		},
+		{
+			textproto.MIMEHeader{"Auto-Submitted": {"no (typed by a person)"},
+				"X-Auto-Response-Suppress": {"DR, RN", "NRN"}},
+			"no", "", "DR RN NRN", "", false, false,
+		},
+		{
+			textproto.MIMEHeader{"Precedence": {" Bulk "}},
+			"", "bulk", "", "", true, true,
+		},
+		{
+			textproto.MIMEHeader{"Precedence": {"first-class"},
+				"X-Auto-Response-Suppress": {"oof"}},
+			"", "first-class", "oof", "", false, true,
+		},
+	}
+	for _, tt := range ttable {
+		a := ParseAutoHeaders(tt.header)
+		if a == nil {
+			t.Fatalf("ParseAutoHeaders(%v) returned nil", tt.header)
+		}
+		if a.AutoSubmitted != tt.auto || a.Precedence != tt.prec ||
+			strings.Join(a.SuppressResponses, " ") != tt.suppress ||
+			strings.Join(a.FeedbackID, " ") != tt.feedback {
+			t.Errorf("ParseAutoHeaders(%v) == %+v", tt.header, a)
+		}
+		if a.Automated() != tt.automated || a.SuppressAutoReply() != tt.noReply {
+			t.Errorf("%v: Automated() == %v, SuppressAutoReply() == %v, want %v, %v", tt.header,
+				a.Automated(), a.SuppressAutoReply(), tt.automated, tt.noReply)
+		}
+	}
+	if a := ParseAutoHeaders(textproto.MIMEHeader{"Subject": {"hi"}}); a != nil {
+		t.Errorf("ParseAutoHeaders() == %+v, want nil", a)
+	}
+}
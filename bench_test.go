@@ -0,0 +1,291 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchCorpora are synthetic messages of increasing size, each a multipart/mixed alternating
+// quoted-printable text and base64 attachment Parts.
+var benchCorpora = []struct {
+	name     string
+	parts    int
+	partSize int
+}{
+	{"small", 2, 1024},
+	{"medium", 20, 16 * 1024},
+	{"large", 4, 2 * 1024 * 1024},
+}
+
+// syntheticMessage builds a message of parts Parts, each with roughly partSize bytes of decoded
+// content.  The content is pseudo-random but deterministic.
+func syntheticMessage(parts, partSize int) []byte {
+	rnd := rand.New(rand.NewSource(int64(parts * partSize)))
+	words := []string{"café", "lorem", "ipsum", "dolor", "sit", "amet", "naïve", "résumé", "über"}
+	buf := &bytes.Buffer{}
+	buf.WriteString("From: bench@example.com\r\n" +
+		"Subject: =?utf-8?q?Synthetic_m=C3=A9ssage?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=bench-boundary\r\n\r\n")
+	for i := 0; i < parts; i++ {
+		buf.WriteString("--bench-boundary\r\n")
+		if i%2 == 0 {
+			text := &bytes.Buffer{}
+			for text.Len() < partSize {
+				text.WriteString(words[rnd.Intn(len(words))])
+				text.WriteByte(' ')
+			}
+			buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+			qp := quotedprintable.NewWriter(buf)
+			qp.Write(text.Bytes())
+			qp.Close()
+		} else {
+			content := make([]byte, partSize)
+			rnd.Read(content)
+			buf.WriteString("Content-Type: application/octet-stream\r\n" +
+				"Content-Disposition: attachment; filename=\"data.bin\"\r\n" +
+				"Content-Transfer-Encoding: base64\r\n\r\n")
+			enc, _ := encodeContent("base64", content)
+			buf.Write(enc)
+		}
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--bench-boundary--\r\n")
+	return buf.Bytes()
+}
+
+func BenchmarkReadParts(b *testing.B) {
+	for _, corpus := range benchCorpora {
+		raw := syntheticMessage(corpus.parts, corpus.partSize)
+		b.Run(corpus.name, func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p, err := ReadParts(bytes.NewReader(raw))
+				if err != nil {
+					b.Fatal(err)
+				}
+				p.Close()
+			}
+		})
+	}
+}
+
+// tinyPartsMessage builds a multipart/mixed message of parts Parts with zero-length content.
+func tinyPartsMessage(parts int) []byte {
+	return []byte("Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		strings.Repeat("--b\r\nContent-Type: text/plain\r\n\r\n", parts) +
+		"--b--\r\n")
+}
+
+func BenchmarkReadPartsTiny(b *testing.B) {
+	for _, parts := range []int{1000, 10000, 100000} {
+		raw := tinyPartsMessage(parts)
+		b.Run(fmt.Sprint(parts), func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p, err := ReadParts(bytes.NewReader(raw))
+				if err != nil {
+					b.Fatal(err)
+				}
+				p.Close()
+			}
+		})
+	}
+}
+
+// Per-part costs of parsing many tiny parts.  The allocation budget leaves headroom over the 18
+// measured, the rate is a deliberately low floor that only quadratic behavior should fail to reach.
+const (
+	tinyPartAllocBudget = 25
+	tinyPartsPerSecond  = 20000
+)
+
+// skipAllocBudget skips a test of allocation budgets under the race detector, which allocates on
+// its own account, and in short mode.
+func skipAllocBudget(t *testing.T) {
+	t.Helper()
+	if raceEnabled {
+		t.Skip("skipping allocation budget under the race detector")
+	}
+	if testing.Short() {
+		t.Skip("skipping allocation budget in short mode")
+	}
+}
+
+func TestTinyPartsAllocs(t *testing.T) {
+	skipAllocBudget(t)
+	raw := tinyPartsMessage(1000)
+	allocs := testing.AllocsPerRun(5, func() {
+		p, err := ReadParts(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Close()
+	})
+	if perPart := allocs / 1000; perPart > tinyPartAllocBudget {
+		t.Errorf("ReadParts allocated %v times per part, budget is %v", perPart, tinyPartAllocBudget)
+	}
+}
+
+func TestTinyPartsRate(t *testing.T) {
+	if raceEnabled || testing.Short() {
+		t.Skip("skipping parse rate test under the race detector or in short mode")
+	}
+	const parts = 100000
+	raw := tinyPartsMessage(parts)
+	start := time.Now()
+	p, err := ReadParts(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	p.Close()
+	if len(p.Subparts) != parts {
+		t.Fatalf("got %d Subparts, want %d", len(p.Subparts), parts)
+	}
+	if rate := float64(parts) / elapsed.Seconds(); rate < tinyPartsPerSecond {
+		t.Errorf("parsed %.0f parts per second, floor is %v", rate, tinyPartsPerSecond)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, corpus := range benchCorpora {
+		raw := syntheticMessage(corpus.parts, corpus.partSize)
+		root, err := ReadParts(bytes.NewReader(raw))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(corpus.name, func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, p := range root.Subparts {
+					d, err := p.Decode()
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := io.Copy(ioutil.Discard, d); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		root.Close()
+	}
+}
+
+// Allocation budgets for hot paths, chosen with some headroom over the measured values so that
+// only real regressions fail.
+const (
+	readHeaderAllocBudget       = 40
+	decodeHeaderAllocBudget     = 10
+	decodeUTF8HeaderAllocBudget = 20
+)
+
+var benchHeader = "From: Jane Doe <jane@example.com>\r\n" +
+	"To: John Doe <john@example.com>\r\n" +
+	"Subject: =?utf-8?q?Caf=C3=A9?= meeting\r\n" +
+	"Date: Mon, 2 Jan 2006 15:04:05 -0700\r\n" +
+	"Message-ID: <1234@example.com>\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n"
+
+func TestReadHeaderAllocs(t *testing.T) {
+	skipAllocBudget(t)
+	r := strings.NewReader(benchHeader)
+	br := bufio.NewReader(r)
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(benchHeader)
+		br.Reset(r)
+		if _, _, err := readHeader(br); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > readHeaderAllocBudget {
+		t.Errorf("readHeader allocated %v times, budget is %v", allocs, readHeaderAllocBudget)
+	}
+}
+
+func TestDecodeHeaderAllocs(t *testing.T) {
+	skipAllocBudget(t)
+	input := "=?utf-8?q?Caf=C3=A9?= meeting =?iso-8859-1?q?=E0_midi?="
+	allocs := testing.AllocsPerRun(100, func() {
+		decodeHeader(input)
+	})
+	if allocs > decodeHeaderAllocBudget {
+		t.Errorf("decodeHeader allocated %v times, budget is %v", allocs, decodeHeaderAllocBudget)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		decodeToUTF8Base64Header(input)
+	})
+	if allocs > decodeUTF8HeaderAllocBudget {
+		t.Errorf("decodeToUTF8Base64Header allocated %v times, budget is %v", allocs,
+			decodeUTF8HeaderAllocBudget)
+	}
+}
+
+func BenchmarkReadHeader(b *testing.B) {
+	r := strings.NewReader(benchHeader)
+	br := bufio.NewReader(r)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(benchHeader)
+		br.Reset(r)
+		if _, _, err := readHeader(br); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeHeader(b *testing.B) {
+	input := "=?utf-8?q?Caf=C3=A9?= meeting =?iso-8859-1?q?=E0_midi?="
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decodeHeader(input)
+	}
+}
+
+func BenchmarkDecodeToUTF8Base64Header(b *testing.B) {
+	input := "=?utf-8?q?Caf=C3=A9?= meeting =?iso-8859-1?q?=E0_midi?="
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decodeToUTF8Base64Header(input)
+	}
+}
+
+func TestSyntheticMessage(t *testing.T) {
+	raw := syntheticMessage(4, 1000)
+	p, err := ReadParts(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if len(p.Subparts) != 4 {
+		t.Fatalf("got %d Subparts, want 4", len(p.Subparts))
+	}
+	for _, s := range p.Subparts {
+		d, err := s.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) < 1000 {
+			t.Errorf("%v decoded to %d bytes, want at least 1000", s, len(content))
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package mime
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BodyStructure is a body of an IMAP BODYSTRUCTURE response, per RFC 3501 section 7.4.2, as
+// parsed by an IMAP client, see FromBodyStructure.
+type BodyStructure struct {
+	MediaType   string            // Type and subtype, e.g. "text/plain"
+	Params      map[string]string // Body parameters, e.g. charset, or boundary for a multipart
+	ID          string            // Content-ID, with angle brackets
+	Description string
+	Encoding    string // Content-Transfer-Encoding
+	Size        int    // Size of the body in octets
+	Lines       int    // Size of a text or message/rfc822 body in lines
+
+	Parts   []*BodyStructure // Bodies of a multipart
+	Message *BodyStructure   // Body of the message enclosed by a message/rfc822 body
+
+	// Extension data
+	MD5               string
+	Disposition       string
+	DispositionParams map[string]string
+	Language          []string
+	Location          string
+}
+
+// FromBodyStructure builds a skeleton Part tree from bs, so that the structure of a message on an
+// IMAP server may be examined with Walk, Attachments, FetchPlan and the like before any of it is
+// downloaded.  Each Part has a Header synthesized from its body's fields, from which ContentType,
+// Filename and the like are set as when parsing, and its Size, Lines and Descriptor.  The Parts
+// have no content, so Read returns io.EOF and Decode returns ErrNoContent, until it is attached
+// with BindContent or BindReaderAt; their offsets are zero.  A multipart body without a boundary
+// parameter is given a generated boundary.
+func FromBodyStructure(bs *BodyStructure) (*Part, error) {
+	root, err := bodyStructurePart(nil, bs)
+	if err != nil {
+		return nil, err
+	}
+	setBodyStructureDescriptors(root, "")
+	return root, nil
+}
+
+// BindContent attaches the Part's transfer encoded content, read in full from r, such as the body
+// of a FETCH BODY[section] response for a Part of a FromBodyStructure skeleton.  Read, Decode and
+// the other readers then return the content as for a parsed Part, removing its
+// Content-Transfer-Encoding and converting its charset per its header.  Size and Lines are set
+// from the content.  The content of a multipart is its Subparts, so binding it is an error.
+func (p *Part) BindContent(r io.Reader) error {
+	if p.boundary != "" {
+		return fmt.Errorf("%s: cannot bind %s content", p.Descriptor, p.ContentType)
+	}
+	encoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("%s: error reading content: %w", p.Descriptor, err)
+	}
+	p.setEncoded(encoded)
+	return nil
+}
+
+// BindReaderAt is BindContent for the size bytes of transfer encoded content in r, which is read
+// as needed rather than copied, e.g. from a file the content was downloaded to.  Size is set, but
+// Lines is left as it was.  r must remain readable while the Part is used; Close does not close
+// it.
+func (p *Part) BindReaderAt(r io.ReaderAt, size int64) error {
+	if p.boundary != "" {
+		return fmt.Errorf("%s: cannot bind %s content", p.Descriptor, p.ContentType)
+	}
+	p.content, p.encoded = nil, nil
+	p.bound = io.NewSectionReader(r, 0, size)
+	p.reader = io.NewSectionReader(r, 0, size)
+	p.Size = int(size)
+	return nil
+}
+
+// bodyStructurePart returns the skeleton Part of bs, a Subpart of parent.
+func bodyStructurePart(parent *Part, bs *BodyStructure) (*Part, error) {
+	mediatype := strings.ToLower(bs.MediaType)
+	params := lowerParams(bs.Params)
+	if strings.HasPrefix(mediatype, ctMultipartPrefix) && params[hpBoundary] == "" {
+		boundary, err := randomBoundary()
+		if err != nil {
+			return nil, err
+		}
+		params[hpBoundary] = boundary
+	}
+	ctype := mime.FormatMediaType(mediatype, params)
+	if ctype == "" || !strings.Contains(mediatype, "/") {
+		return nil, fmt.Errorf("unable to format content type %q", bs.MediaType)
+	}
+
+	header := make(textproto.MIMEHeader)
+	if parent == nil || parent.ContentType == ContentTypeMessageRfc822 {
+		header.Set(hnMIMEVersion, "1.0")
+	}
+	header.Set(hnContentType, ctype)
+	if bs.Disposition != "" {
+		cdisp := mime.FormatMediaType(strings.ToLower(bs.Disposition), bs.DispositionParams)
+		if cdisp == "" {
+			return nil, fmt.Errorf("unable to format content disposition %q", bs.Disposition)
+		}
+		header.Set(hnContentDisposition, cdisp)
+	}
+	for k, v := range map[string]string{
+		hnContentID:          bs.ID,
+		hnContentDescription: bs.Description,
+		hnContentEncoding:    strings.ToLower(bs.Encoding),
+		hnContentMD5:         bs.MD5,
+		"Content-Language":   strings.Join(bs.Language, ", "),
+		"Content-Location":   bs.Location,
+	} {
+		if v != "" {
+			header.Set(k, v)
+		}
+	}
+
+	p := NewPart(parent)
+	if err := p.setupHeader(header); err != nil {
+		return nil, err
+	}
+	p.Size, p.Lines = bs.Size, bs.Lines
+	children := bs.Parts
+	if bs.Message != nil && p.ContentType == ContentTypeMessageRfc822 {
+		children = []*BodyStructure{bs.Message}
+	}
+	for _, c := range children {
+		s, err := bodyStructurePart(p, c)
+		if err != nil {
+			return nil, err
+		}
+		p.Subparts = append(p.Subparts, s)
+	}
+	return p, nil
+}
+
+// setBodyStructureDescriptors sets the Descriptors of the Part tree rooted at p, numbered num, as
+// parseParts does.
+func setBodyStructureDescriptors(p *Part, num string) {
+	if p.boundary != "" {
+		for i, s := range p.Subparts {
+			setBodyStructureDescriptors(s, joinSection(num, strconv.Itoa(i+1)))
+		}
+		if p.Parent == nil {
+			p.Descriptor = "0"
+		} else {
+			p.Descriptor = num + ".0"
+		}
+		return
+	}
+	if num == "" && len(p.Subparts) > 0 {
+		// A message/rfc822 root
+		num = "1"
+	}
+	p.Descriptor = num
+	for _, s := range p.Subparts {
+		setBodyStructureDescriptors(s, num)
+	}
+}
+
+// BodyStructure returns the Part's body as an RFC 3501 section 7.4.2 BODYSTRUCTURE, for an IMAP
+// server's FETCH response, or as a BODY, without extension data, if extended is false.  It is
+// formed from the Part's ContentType, parameters, Size and Lines, and the header fields of the
+// Part and of any message/rfc822 Part's embedded message, which supplies the ENVELOPE.  Since
+// Descriptors number Parts as IMAP sections are numbered, section n of the response is the Part
+// with Descriptor n.  Values that cannot be quoted are sent as literals.
+func (p *Part) BodyStructure(extended bool) string {
+	b := &strings.Builder{}
+	writeBody(b, p, extended)
+	return b.String()
+}
+
+// writeBody writes the body of p, see Part.BodyStructure.
+func writeBody(b *strings.Builder, p *Part, extended bool) {
+	mediatype, subtype := p.ContentType, ""
+	if i := strings.IndexByte(mediatype, '/'); i >= 0 {
+		mediatype, subtype = mediatype[:i], mediatype[i+1:]
+	}
+	b.WriteByte('(')
+	if p.boundary != "" && len(p.Subparts) > 0 {
+		for _, s := range p.Subparts {
+			writeBody(b, s, extended)
+		}
+		b.WriteByte(' ')
+		writeIMAPString(b, subtype)
+		if extended {
+			b.WriteByte(' ')
+			writeIMAPParams(b, p.ContentParams)
+			writeBodyExtension(b, p)
+		}
+		b.WriteByte(')')
+		return
+	}
+
+	writeIMAPString(b, mediatype)
+	b.WriteByte(' ')
+	writeIMAPString(b, subtype)
+	b.WriteByte(' ')
+	writeIMAPParams(b, p.ContentParams)
+	b.WriteByte(' ')
+	writeIMAPNString(b, p.Header.Get(hnContentID))
+	b.WriteByte(' ')
+	writeIMAPNString(b, p.Header.Get(hnContentDescription))
+	b.WriteByte(' ')
+	encoding := strings.TrimSpace(p.Header.Get(hnContentEncoding))
+	if encoding == "" {
+		encoding = "7bit"
+	}
+	writeIMAPString(b, encoding)
+	b.WriteByte(' ')
+	b.WriteString(strconv.Itoa(p.Size))
+	if m := p.Message(); m != nil {
+		b.WriteByte(' ')
+		writeEnvelope(b, m.Header)
+		b.WriteByte(' ')
+		writeBody(b, m, extended)
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(p.Lines))
+	} else if mediatype == "text" {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(p.Lines))
+	}
+	if extended {
+		b.WriteByte(' ')
+		writeIMAPNString(b, p.Header.Get(hnContentMD5))
+		writeBodyExtension(b, p)
+	}
+	b.WriteByte(')')
+}
+
+// writeBodyExtension writes the disposition, language and location extension data common to
+// single and multipart bodies, each preceded by a space.
+func writeBodyExtension(b *strings.Builder, p *Part) {
+	b.WriteByte(' ')
+	if p.Disposition != "" {
+		b.WriteByte('(')
+		writeIMAPString(b, p.Disposition)
+		b.WriteByte(' ')
+		writeIMAPParams(b, p.DispositionParams)
+		b.WriteByte(')')
+	} else {
+		b.WriteString("NIL")
+	}
+
+	b.WriteByte(' ')
+	var langs []string
+	for _, l := range strings.Split(p.Header.Get("Content-Language"), ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			langs = append(langs, l)
+		}
+	}
+	switch len(langs) {
+	case 0:
+		b.WriteString("NIL")
+	case 1:
+		writeIMAPString(b, langs[0])
+	default:
+		writeIMAPList(b, langs)
+	}
+
+	b.WriteByte(' ')
+	writeIMAPNString(b, p.Header.Get("Content-Location"))
+}
+
+// writeEnvelope writes the ENVELOPE of the message with header.  Sender and Reply-To default to
+// From, per RFC 3501.
+func writeEnvelope(b *strings.Builder, header textproto.MIMEHeader) {
+	from, sender, replyTo := header.Get("From"), header.Get("Sender"), header.Get("Reply-To")
+	if sender == "" {
+		sender = from
+	}
+	if replyTo == "" {
+		replyTo = from
+	}
+	b.WriteByte('(')
+	writeIMAPNString(b, header.Get("Date"))
+	b.WriteByte(' ')
+	writeIMAPNString(b, header.Get("Subject"))
+	for _, v := range []string{
+		from,
+		sender,
+		replyTo,
+		header.Get("To"),
+		header.Get("Cc"),
+		header.Get("Bcc"),
+	} {
+		b.WriteByte(' ')
+		writeEnvelopeAddresses(b, v)
+	}
+	b.WriteByte(' ')
+	writeIMAPNString(b, header.Get("In-Reply-To"))
+	b.WriteByte(' ')
+	writeIMAPNString(b, header.Get("Message-Id"))
+	b.WriteByte(')')
+}
+
+// writeEnvelopeAddresses writes the address list v as a list of ENVELOPE addresses, or NIL if it
+// is empty or cannot be parsed.  Display names are RFC 2047 encoded if they are not ASCII.
+func writeEnvelopeAddresses(b *strings.Builder, v string) {
+	addrs, err := addressParser.ParseList(v)
+	if err != nil || len(addrs) == 0 {
+		b.WriteString("NIL")
+		return
+	}
+	b.WriteByte('(')
+	for _, a := range addrs {
+		mailbox, host := a.Address, ""
+		if i := strings.LastIndexByte(mailbox, '@'); i >= 0 {
+			mailbox, host = mailbox[:i], mailbox[i+1:]
+		}
+		b.WriteByte('(')
+		writeIMAPNString(b, mime.QEncoding.Encode("utf-8", a.Name))
+		b.WriteString(" NIL ")
+		writeIMAPNString(b, mailbox)
+		b.WriteByte(' ')
+		writeIMAPNString(b, host)
+		b.WriteByte(')')
+	}
+	b.WriteByte(')')
+}
+
+// writeIMAPParams writes params as a body parameter list, sorted by name, or NIL if it is empty.
+func writeIMAPParams(b *strings.Builder, params map[string]string) {
+	if len(params) == 0 {
+		b.WriteString("NIL")
+		return
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		list = append(list, k, params[k])
+	}
+	writeIMAPList(b, list)
+}
+
+// writeIMAPList writes ss as a parenthesized list of strings.
+func writeIMAPList(b *strings.Builder, ss []string) {
+	b.WriteByte('(')
+	for i, s := range ss {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		writeIMAPString(b, s)
+	}
+	b.WriteByte(')')
+}
+
+// writeIMAPNString writes s as an IMAP nstring, NIL if it is empty.
+func writeIMAPNString(b *strings.Builder, s string) {
+	if s == "" {
+		b.WriteString("NIL")
+		return
+	}
+	writeIMAPString(b, s)
+}
+
+// writeIMAPString writes s as an IMAP quoted string, or as a literal if it contains 8-bit or
+// control characters, which a quoted string cannot.
+func writeIMAPString(b *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' {
+			fmt.Fprintf(b, "{%d}\r\n%s", len(s), s)
+			return
+		}
+	}
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+}
@@ -0,0 +1,218 @@
+package mime
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFromBodyStructure(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: multipart/alternative; boundary=c\r\n\r\n" +
+		"--c\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nplain\r\n" +
+		"--c\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+		"--c--\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=report.pdf\r\n\r\nJVBERi0=\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" +
+		"Subject: inner\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=d\r\n\r\n" +
+		"--d\r\nContent-Type: text/plain\r\n\r\ninner plain\r\n" +
+		"--d--\r\n" +
+		"--b--\r\n"
+	bs := &BodyStructure{
+		MediaType: "MULTIPART/MIXED",
+		Parts: []*BodyStructure{
+			{
+				MediaType: "multipart/alternative",
+				Params:    map[string]string{"BOUNDARY": "c"},
+				Parts: []*BodyStructure{
+					{MediaType: "text/plain", Params: map[string]string{"charset": "UTF-8"},
+						Encoding: "7BIT", Size: 5, Lines: 1},
+					{MediaType: "text/html", Encoding: "7BIT", Size: 11, Lines: 1},
+				},
+			},
+			{MediaType: "application/pdf", Encoding: "BASE64", Size: 8,
+				Disposition: "ATTACHMENT", DispositionParams: map[string]string{"filename": "report.pdf"}},
+			{
+				MediaType: "message/rfc822",
+				Size:      140,
+				Lines:     7,
+				Message: &BodyStructure{
+					MediaType: "multipart/mixed",
+					Parts: []*BodyStructure{
+						{MediaType: "text/plain", Size: 11, Lines: 1},
+					},
+				},
+			},
+		},
+	}
+
+	skeleton, err := FromBodyStructure(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	describe := func(root *Part) string {
+		var d []string
+		root.Walk(func(p *Part) error {
+			d = append(d, fmt.Sprintf("%s %s %q %q %q %d", p.Descriptor, p.ContentType, p.Charset,
+				p.Disposition, p.Filename, len(p.Errors)))
+			return nil
+		})
+		return strings.Join(d, "\n")
+	}
+	if got, want := describe(skeleton), describe(parsed); got != want {
+		t.Errorf("skeleton tree:\n%s\nwant:\n%s", got, want)
+	}
+
+	pdf := skeleton.Subparts[1]
+	if pdf.Size != 8 || pdf.Header.Get(hnContentEncoding) != "base64" {
+		t.Errorf("got Size %d, header %v", pdf.Size, pdf.Header)
+	}
+	if _, err := pdf.Decode(); err != ErrNoContent {
+		t.Errorf("Decode() error %v, want %v", err, ErrNoContent)
+	}
+	if a := Attachments(skeleton); len(a) != 1 || a[0].Filename != "report.pdf" {
+		t.Errorf("Attachments() == %+v", a)
+	}
+	var sections []string
+	for _, f := range FetchPlan(skeleton, []string{"text/plain"}) {
+		sections = append(sections, f.Section)
+	}
+	if got := strings.Join(sections, " "); got != "1.1 3.TEXT" {
+		t.Errorf("FetchPlan() sections %q, want %q", got, "1.1 3.TEXT")
+	}
+
+	if _, err := FromBodyStructure(&BodyStructure{MediaType: "text"}); err == nil {
+		t.Error("FromBodyStructure() succeeded without a subtype")
+	}
+}
+
+func TestBindContent(t *testing.T) {
+	bs := &BodyStructure{
+		MediaType: "multipart/mixed",
+		Parts: []*BodyStructure{
+			{MediaType: "text/plain", Params: map[string]string{"charset": "iso-8859-1"},
+				Encoding: "quoted-printable", Size: 7, Lines: 1},
+			{MediaType: "application/octet-stream", Encoding: "base64", Size: 8},
+		},
+	}
+	root, err := FromBodyStructure(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, bin := root.Subparts[0], root.Subparts[1]
+	if err := text.BindContent(strings.NewReader("caf=E9\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bin.BindReaderAt(strings.NewReader("aGVsbG8=trailing"), 8); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		p    *Part
+		want string
+	}{
+		{text, "café\r\n"},
+		{bin, "hello"},
+	} {
+		// Decode starts from the beginning of bound content each time
+		for i := 0; i < 2; i++ {
+			r, err := tt.p.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := ioutil.ReadAll(r); string(got) != tt.want {
+				t.Errorf("%s: Decode() == %q, want %q", tt.p.Descriptor, got, tt.want)
+			}
+		}
+	}
+	if text.Size != 8 || text.Lines != 1 || bin.Size != 8 {
+		t.Errorf("got Sizes %d and %d, Lines %d", text.Size, bin.Size, text.Lines)
+	}
+
+	b := &bytes.Buffer{}
+	if err := root.Encode(b); err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := ReadParts(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := reparsed.Subparts[1].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(r); string(got) != "hello" {
+		t.Errorf("Decode() of encoded bound content == %q, want %q", got, "hello")
+	}
+
+	if err := root.BindContent(strings.NewReader("")); err == nil {
+		t.Error("BindContent() succeeded on a multipart")
+	}
+}
+
+func TestPartBodyStructure(t *testing.T) {
+	raw := "From: =?utf-8?q?Ren=C3=A9?= <rene@example.com>\r\nTo: a@example.com, b@example.org\r\n" +
+		"Subject: report\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Language: en, fr\r\n\r\n" +
+		"line 1\r\nline 2\r\n" +
+		"--b\r\nContent-Type: application/pdf; name=\"r\\\"1.pdf\"\r\nContent-ID: <r1@x>\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=\"café.pdf\"\r\n\r\nJVBERg==\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" +
+		"Date: Mon, 1 Jan 2024 00:00:00 +0000\r\nFrom: x@example.com\r\nSubject: fwd\r\n" +
+		"Message-ID: <m@x>\r\n\r\nforwarded\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := `("text" "plain" ("charset" "utf-8") NIL NIL "7bit" 14 1`
+	pdf := `("application" "pdf" ("name" "r\"1.pdf") "<r1@x>" NIL "base64" 8`
+	msg := `("message" "rfc822" NIL NIL NIL "7bit" 103 ("Mon, 1 Jan 2024 00:00:00 +0000" "fwd" ` +
+		`((NIL NIL "x" "example.com")) ((NIL NIL "x" "example.com")) ` +
+		`((NIL NIL "x" "example.com")) NIL NIL NIL NIL "<m@x>") ` +
+		`("text" "plain" ("charset" "us-ascii") NIL NIL "7bit" 9 0`
+	ttable := []struct {
+		extended bool
+		want     string
+	}{
+		{false, "(" + text + ")" + pdf + ")" + msg + ") 5) \"mixed\")"},
+		{true, "(" + text + ` NIL NIL ("en" "fr") NIL)` +
+			pdf + ` NIL ("attachment" ("filename" {9}` + "\r\ncafé.pdf)) NIL NIL)" +
+			msg + " NIL NIL NIL NIL) 5 NIL NIL NIL NIL)" +
+			` "mixed" ("boundary" "b") NIL NIL NIL)`},
+	}
+	for _, tt := range ttable {
+		if got := p.BodyStructure(tt.extended); got != tt.want {
+			t.Errorf("BodyStructure(%v) ==\n%s\nwant\n%s", tt.extended, got, tt.want)
+		}
+	}
+	want := `("text" "plain" ("charset" "us-ascii") NIL NIL "7bit" 9 0)`
+	if got := p.Subparts[2].Message().BodyStructure(false); got != want {
+		t.Errorf("BodyStructure(false) == %s, want %s", got, want)
+	}
+
+	// Structure read without content, and the sender's envelope
+	s, err := ReadStructure(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.BodyStructure(true), p.BodyStructure(true); got != want {
+		t.Errorf("BodyStructure(true) from ReadStructure ==\n%s\nwant\n%s", got, want)
+	}
+	b := &strings.Builder{}
+	writeEnvelope(b, p.Header)
+	want = `(NIL "report" (("=?utf-8?q?Ren=C3=A9?=" NIL "rene" "example.com")) ` +
+		`(("=?utf-8?q?Ren=C3=A9?=" NIL "rene" "example.com")) ` +
+		`(("=?utf-8?q?Ren=C3=A9?=" NIL "rene" "example.com")) ` +
+		`((NIL NIL "a" "example.com")(NIL NIL "b" "example.org")) NIL NIL NIL NIL)`
+	if b.String() != want {
+		t.Errorf("writeEnvelope() ==\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -6,50 +6,77 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 )
 
 // This constant needs to be at least 76 for this package to work correctly.  This is because
 // \r\n--separator_of_len_70- would fill the buffer and it wouldn't be safe to consume a single byte
-// from it.
+// from it.  It is the default read-ahead, see WithReadAhead.
 const peekBufferSize = 4096
 
 type boundaryReader struct {
 	finished  bool          // No parts remain when finished
 	partsRead int           // Number of parts read thus far
 	r         *bufio.Reader // Source reader
+	peekSize  int           // Bytes to peek at when searching for the boundary
+	safe      int           // Buffered bytes already known to precede the next boundary
 	nlPrefix  []byte        // NL + MIME boundary prefix
 	prefix    []byte        // MIME boundary prefix
 	final     []byte        // Final boundary prefix
-	buffer    *bytes.Buffer // Content waiting to be read
+	preamble  io.Writer     // Receives content preceding the first delimiter, if not nil
+	partStart bool          // Nothing of the current part has been read
+	tolerant  bool          // Input ending before the boundary ends the part, see truncated
+	truncated bool          // The input ended before the boundary, only set if tolerant
+	closeEOL  bool          // The close delimiter line ended with a line break
+	closeLen  int           // Length of the close delimiter line
+	closeJunk []byte        // Text following the close delimiter, e.g. "-->", see matchBoundaryTail
 }
 
-// newBoundaryReader returns an initialized boundaryReader
+// newBoundaryReader returns an initialized boundaryReader.  It searches for the boundary within
+// as much of reader as its buffer holds.
 func newBoundaryReader(reader *bufio.Reader, boundary string) *boundaryReader {
 	fullBoundary := []byte("\n--" + boundary + "--")
+	peekSize := reader.Size()
+	if peekSize < peekBufferSize {
+		peekSize = peekBufferSize
+	}
 	return &boundaryReader{
 		r:        reader,
+		peekSize: peekSize,
 		nlPrefix: fullBoundary[:len(fullBoundary)-2],
 		prefix:   fullBoundary[1 : len(fullBoundary)-2],
 		final:    fullBoundary[1:],
-		buffer:   new(bytes.Buffer),
 	}
 }
 
-// readUntilBoundary returns a buffer containing the content up until boundary
+// Read reads content up until the next boundary directly from the source reader's buffer.
 func (b *boundaryReader) Read(dest []byte) (n int, err error) {
-	if b.buffer.Len() >= len(dest) {
-		// This read request can be satisfied entirely by the buffer
-		return b.buffer.Read(dest)
+	if len(dest) == 0 {
+		return 0, nil
+	}
+	if b.safe > 0 {
+		// Serve from the region searched by an earlier Read
+		return b.readSafe(dest)
 	}
 
-	peek, err := b.r.Peek(peekBufferSize)
+	peek, err := b.r.Peek(b.peekSize)
 	peekEOF := (err == io.EOF)
 	if err != nil && !peekEOF && err != bufio.ErrBufferFull {
 		// Unexpected error
 		return 0, err
 	}
+	if b.partStart {
+		// A part with no content has its delimiter line followed directly by the next, without
+		// the newline locateBoundary looks for
+		if bytes.HasPrefix(peek, b.prefix) {
+			if match, _, _ := matchBoundaryTail(peek[len(b.prefix):], peekEOF); match {
+				return 0, io.EOF
+			}
+		}
+		b.partStart = false
+	}
 	var nCopy int
-	idx, complete := locateBoundary(peek, b.nlPrefix)
+	idx, complete := locateBoundary(peek, b.nlPrefix, peekEOF)
 	if idx != -1 {
 		// Peeked boundary prefix, read until that point
 		nCopy = idx
@@ -59,7 +86,13 @@ func (b *boundaryReader) Read(dest []byte) (n int, err error) {
 		}
 	} else {
 		// No boundary found, move forward a safe distance
-		if nCopy = len(peek) - len(b.nlPrefix) - 1; nCopy <= 0 {
+		if peekEOF && b.tolerant {
+			// Nothing follows that could complete a boundary
+			if nCopy = len(peek); nCopy == 0 {
+				b.truncated = true
+				return 0, io.EOF
+			}
+		} else if nCopy = len(peek) - len(b.nlPrefix) - 1; nCopy <= 0 {
 			nCopy = 0
 			if peekEOF {
 				// No more peek space remaining and no boundary found
@@ -67,18 +100,25 @@ func (b *boundaryReader) Read(dest []byte) (n int, err error) {
 			}
 		}
 	}
-	if nCopy > 0 {
-		if _, err = io.CopyN(b.buffer, b.r, int64(nCopy)); err != nil {
-			return 0, err
+	if nCopy == 0 {
+		if complete {
+			return 0, io.EOF
 		}
+		return 0, nil
 	}
+	b.safe = nCopy
+	return b.readSafe(dest)
+}
 
-	n, err = b.buffer.Read(dest)
-	if err == io.EOF && !complete {
-		// Only the buffer is empty, not the boundaryReader
-		return n, nil
+// readSafe reads up to b.safe bytes into dest.  The bytes have been peeked and so are buffered,
+// making this a copy that cannot fail.
+func (b *boundaryReader) readSafe(dest []byte) (int, error) {
+	if len(dest) > b.safe {
+		dest = dest[:b.safe]
 	}
-	return
+	n, err := b.r.Read(dest)
+	b.safe -= n
+	return n, err
 }
 
 // Next moves over the boundary to the next part, returns true if there is another part to be read.
@@ -90,30 +130,55 @@ func (b *boundaryReader) Next() (bool, error) {
 		// Exhaust the current part to prevent errors when moving to the next part
 		_, _ = io.Copy(ioutil.Discard, b)
 	}
+	midLine := false
 	for {
 		line, err := b.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull && b.partsRead == 0 {
+			// Overlong preamble line, no boundary can start before its end
+			b.writePreamble(line)
+			midLine = true
+			continue
+		}
 		if err != nil && err != io.EOF {
 			return false, err
 		}
+		if midLine {
+			b.writePreamble(line)
+			midLine = false
+			continue
+		}
 		if b.isTerminator(line) {
 			b.finished = true
+			b.closeEOL = bytes.HasSuffix(line, []byte{'\n'})
+			b.closeLen = len(line)
+			if junk := bytes.TrimSpace(line[len(b.final):]); len(junk) > 0 {
+				b.closeJunk = append([]byte(nil), junk...)
+			}
 			return false, nil
 		}
 		if len(line) > 0 && (line[0] == '\r' || line[0] == '\n') {
 			// Blank line
+			if b.partsRead == 0 {
+				b.writePreamble(line)
+			}
 			continue
 		}
 		if err != io.EOF && b.isDelimiter(line) {
 			// Start of a new part
 			b.partsRead++
+			b.partStart = true
 			return true, nil
 		}
 		if err == io.EOF {
+			if b.partsRead == 0 {
+				b.writePreamble(line)
+			}
 			return false, io.EOF
 		}
 		if b.partsRead == 0 {
 			// The first part didn't find the starting delimiter, burn off any preamble in front of
 			// the boundary
+			b.writePreamble(line)
 			continue
 		}
 		b.finished = true
@@ -121,66 +186,90 @@ func (b *boundaryReader) Next() (bool, error) {
 	}
 }
 
-// isDelimiter returns true for --BOUNDARY\r\n but not --BOUNDARY--
-func (b *boundaryReader) isDelimiter(buf []byte) bool {
-	idx := bytes.Index(buf, b.prefix)
-	if idx == -1 {
-		return false
+// writePreamble passes a line of preamble to b.preamble.
+func (b *boundaryReader) writePreamble(line []byte) {
+	if b.preamble != nil {
+		_, _ = b.preamble.Write(line)
 	}
+}
 
-	// Fast forward to the end of the boundary prefix
-	buf = buf[idx+len(b.prefix):]
-	buf = bytes.TrimLeft(buf, " \t")
-	if len(buf) > 0 {
-		if buf[0] == '\r' || buf[0] == '\n' {
-			return true
-		}
+// isDelimiter returns true for --BOUNDARY\r\n but not --BOUNDARY--
+func (b *boundaryReader) isDelimiter(line []byte) bool {
+	if !bytes.HasPrefix(line, b.prefix) {
+		return false
 	}
-
-	return false
+	match, final, _ := matchBoundaryTail(line[len(b.prefix):], true)
+	return match && !final
 }
 
 // isTerminator returns true for --BOUNDARY--
-func (b *boundaryReader) isTerminator(buf []byte) bool {
-	idx := bytes.Index(buf, b.final)
-	return idx != -1
+func (b *boundaryReader) isTerminator(line []byte) bool {
+	if !bytes.HasPrefix(line, b.prefix) {
+		return false
+	}
+	match, final, _ := matchBoundaryTail(line[len(b.prefix):], true)
+	return match && final
 }
 
 // Locate boundaryPrefix in buf, returning its starting idx. If complete is true, the boundary
-// is terminated properly in buf, otherwise it could be false due to running out of buffer, or
-// because it is not the actual boundary.
+// is terminated properly in buf, otherwise more bytes are needed to tell whether it is a boundary.
+// Occurrences of boundaryPrefix that cannot be a boundary, such as a content line beginning
+// "--BOUNDARYxyz" or "--BOUNDARY--xyz", are skipped.  atEOF indicates buf holds all remaining
+// input.
 //
-// Complete boundaries end in "--" or a newline
-func locateBoundary(buf, boundaryPrefix []byte) (idx int, complete bool) {
-	bpLen := len(boundaryPrefix)
-	idx = bytes.Index(buf, boundaryPrefix)
-	if idx == -1 {
-		return
-	}
+// Complete boundaries end in "--" or a newline, optionally preceded by linear whitespace
+func locateBoundary(buf, boundaryPrefix []byte, atEOF bool) (idx int, complete bool) {
+	for searched := 0; ; {
+		i := bytes.Index(buf[searched:], boundaryPrefix)
+		if i == -1 {
+			return -1, false
+		}
+		idx = searched + i
+		searched = idx + len(boundaryPrefix)
 
-	// Handle CR if present
-	if idx > 0 && buf[idx-1] == '\r' {
-		idx--
-		bpLen++
+		match, _, more := matchBoundaryTail(buf[searched:], atEOF)
+		if match || more {
+			// Handle CR if present
+			if idx > 0 && buf[idx-1] == '\r' {
+				idx--
+			}
+			return idx, match
+		}
 	}
+}
 
-	// Fast forward to the end of the boundary prefix
-	buf = buf[idx+bpLen:]
-	if len(buf) == 0 {
-		// Need more bytes to verify completeness
-		return
-	}
-	if len(buf) > 1 {
-		if buf[0] == '-' && buf[1] == '-' {
-			return idx, true
+// matchBoundaryTail checks the bytes following "--BOUNDARY" for the remainder of a delimiter line;
+// optional "--" marking the final boundary, linear whitespace, then a newline.  more is true if
+// tail ends before a decision can be made and is not atEOF.  Real world mailers follow the final
+// boundary with junk such as "-->", which is tolerated unless it starts with a character that
+// could continue a longer boundary, as in "--BOUNDARY--A".
+func matchBoundaryTail(tail []byte, atEOF bool) (match, final, more bool) {
+	if len(tail) > 0 && tail[0] == '-' {
+		if len(tail) == 1 {
+			return false, false, !atEOF
 		}
-	}
-	buf = bytes.TrimLeft(buf, " \t")
-	if len(buf) > 0 {
-		if buf[0] == '\r' || buf[0] == '\n' {
-			return idx, true
+		if tail[1] != '-' {
+			return false, false, false
 		}
+		final = true
+		tail = tail[2:]
+		if len(tail) > 0 && !isBoundaryChar(tail[0]) {
+			return true, true, false
+		}
+	}
+	tail = bytes.TrimLeft(tail, " \t")
+	if len(tail) == 0 {
+		// Tolerate a missing newline at the end of input
+		return atEOF, final, !atEOF
 	}
+	if tail[0] == '\r' || tail[0] == '\n' {
+		return true, final, false
+	}
+	return false, false, false
+}
 
-	return
+// isBoundaryChar returns true for the characters RFC 2046 allows in a boundary other than space.
+func isBoundaryChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("'()+_,-./:=?", c) != -1
 }
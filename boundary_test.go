@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -43,6 +44,26 @@ func TestBoundaryReader(t *testing.T) {
 			boundary: "STOPHERE",
 			want:     "good\r\n--STOPHERE-A",
 		},
+		{
+			input:    "good\r\n--STOPHERE--A\r\n--STOPHERE--\r\nafter",
+			boundary: "STOPHERE",
+			want:     "good\r\n--STOPHERE--A",
+		},
+		{
+			input:    "good\r\n--STOPHERE=3D\r\n--STOPHERE--A=\r\n--STOPHERE\r\nafter",
+			boundary: "STOPHERE",
+			want:     "good\r\n--STOPHERE=3D\r\n--STOPHERE--A=",
+		},
+		{
+			input:    "good\r\n--STOPHERE--",
+			boundary: "STOPHERE",
+			want:     "good",
+		},
+		{
+			input:    "good\r\n--STOPHERE-->\r\nafter",
+			boundary: "STOPHERE",
+			want:     "good",
+		},
 		{
 			input:    "good\n--STOPHERE\nafter",
 			boundary: "STOPHERE",
@@ -92,6 +113,32 @@ func TestBoundaryReader(t *testing.T) {
 	}
 }
 
+func TestBoundaryReaderNext(t *testing.T) {
+	input := "preamble mentioning --STOPHERE\r\n" +
+		"and --STOPHERE-- too\r\n" +
+		"--STOPHERE--A\r\n" +
+		"--STOPHERE \r\n" +
+		"first\r\n" +
+		"--STOPHERE--\r\n"
+
+	br := newBoundaryReader(bufio.NewReader(strings.NewReader(input)), "STOPHERE")
+	next, err := br.Next()
+	if !next || err != nil {
+		t.Fatalf("Next() == %v, %v, want true, nil", next, err)
+	}
+	output, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(output), "first"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	next, err = br.Next()
+	if next || err != nil {
+		t.Errorf("Next() == %v, %v, want false, nil", next, err)
+	}
+}
+
 func TestBoundaryReaderBuffer(t *testing.T) {
 	// Check that Read() can serve accurately from its buffer
 	input := "good\r\n--STOPHERE\r\nafter"
@@ -415,3 +462,79 @@ func TestBoundaryReaderBufferBoundaryCross(t *testing.T) {
 		t.Errorf("ReadAll() got: %q, want: %q", got, want)
 	}
 }
+
+func TestBoundaryContinuations(t *testing.T) {
+	body := "\r\n\r\n--abc def\r\nContent-Type: text/plain\r\n\r\nx\r\n--abc def--\r\n"
+	ttable := []struct {
+		ctype string
+		opts  []Option
+	}{
+		{`multipart/mixed; boundary*0="abc "; boundary*1="def"`, nil},
+		{`multipart/mixed; boundary*1=def; boundary*0="abc "`, nil},
+		{`multipart/mixed; BOUNDARY*0*=us-ascii''abc%20; Boundary*1=def`, nil},
+		{`multipart/mixed; boundary*=us-ascii''abc%20def`, nil},
+		{`multipart/mixed boundary*0="abc " boundary*1=def`, nil},
+		{"", []Option{WithDefaultContentType("multipart/mixed",
+			map[string]string{"Boundary*0": "abc ", "boundary*1": "def"})}},
+	}
+	for _, tt := range ttable {
+		header := "MIME-Version: 1.0"
+		if tt.ctype != "" {
+			header += "\r\nContent-Type: " + tt.ctype
+		}
+		p, err := ReadParts(strings.NewReader(header+body), tt.opts...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.ctype, err)
+			continue
+		}
+		if len(p.Subparts) != 1 || p.Subparts[0].ContentType != ctTextPlain {
+			t.Errorf("%s: got Subparts %v", tt.ctype, p.Subparts)
+		}
+	}
+}
+
+func BenchmarkBoundaryReader(b *testing.B) {
+	content := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ+/\r\n"), 64*1024)
+	input := append(append([]byte("--b\r\n"), content...), "\r\n--b--\r\n"...)
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		br := newBoundaryReader(bufio.NewReader(bytes.NewReader(input)), "b")
+		if next, err := br.Next(); !next || err != nil {
+			b.Fatalf("Next() == %v, %v", next, err)
+		}
+		n, err := io.Copy(ioutil.Discard, br)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n != int64(len(content)) {
+			b.Fatalf("read %d bytes, want %d", n, len(content))
+		}
+	}
+}
+
+func BenchmarkReadPartsReadAhead(b *testing.B) {
+	content := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ+/\r\n"), 64*1024)
+	input := append([]byte("Content-Type: multipart/mixed; boundary=b\r\n\r\n"+
+		"--b\r\nContent-Type: application/octet-stream\r\n\r\n"), content...)
+	input = append(input, "\r\n--b--\r\n"...)
+
+	for _, size := range []int{0, 64 * 1024, 1024 * 1024} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			ps := NewParser(WithReadAhead(size))
+			b.SetBytes(int64(len(input)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p, err := ps.ReadStructure(bytes.NewReader(input))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if p.Subparts[0].Size != len(content) {
+					b.Fatalf("Size == %d, want %d", p.Subparts[0].Size, len(content))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+const (
+	// minBufSize is the smallest buffer allocated for a decoding reader; transformers need room
+	// for at least a few runes, and qpCleaner must be able to peek past maxSoftBreakPadding.
+	minBufSize = 128
+	// maxBufSize is the largest buffer allocated for a decoding reader, the bufio default.
+	maxBufSize = 4096
+	// copyBufSize is the size of the buffers decodedReader copies content with, as for io.Copy.
+	copyBufSize = 32 * 1024
+)
+
+// bufSize returns the buffer size for reading sizeHint bytes, so that the many small Parts of a
+// typical message do not each allocate maxBufSize buffers.  A sizeHint of 0 means unknown.
+func bufSize(sizeHint int) int {
+	switch {
+	case sizeHint <= 0 || sizeHint >= maxBufSize:
+		return maxBufSize
+	case sizeHint < minBufSize:
+		return minBufSize
+	default:
+		return sizeHint
+	}
+}
+
+// peekReaderPool holds the bufio.Readers readPart uses at the default read-ahead, so that messages
+// with many small parts do not allocate a peekBufferSize buffer for each.
+var peekReaderPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, peekBufferSize)
+	},
+}
+
+// getPeekReader returns a bufio.Reader over r buffering at least size bytes, release it with
+// putPeekReader once it is no longer used.
+func getPeekReader(r io.Reader, size int) *bufio.Reader {
+	if size > peekBufferSize {
+		return bufio.NewReaderSize(r, size)
+	}
+	br := peekReaderPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+// putPeekReader releases a bufio.Reader returned by getPeekReader.
+func putPeekReader(br *bufio.Reader) {
+	if br.Size() != peekBufferSize {
+		return
+	}
+	br.Reset(nil)
+	peekReaderPool.Put(br)
+}
+
+// copyBufPool holds copyBufSize buffers for decodedReader.WriteTo.
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufSize)
+		return &b
+	},
+}
+
+// decodedReader is the reader returned by Part.Decode.  It implements io.WriterTo, so that io.Copy
+// hands the decoding chain to the destination's io.ReaderFrom if it has one, or otherwise writes
+// in chunks of up to copyBufSize, even though decoders such as base64 return far less per Read.
+type decodedReader struct {
+	r io.Reader
+}
+
+// Read method for io.Reader interface.
+func (d *decodedReader) Read(b []byte) (int, error) {
+	return d.r.Read(b)
+}
+
+// WriteTo method for io.WriterTo interface.
+func (d *decodedReader) WriteTo(w io.Writer) (n int64, err error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(d.r)
+	}
+	bp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bp)
+	buf := *bp
+	for {
+		// Fill buf before writing, to make fewer and larger writes
+		var nr int
+		var rerr error
+		for nr < len(buf) && rerr == nil {
+			var m int
+			m, rerr = d.r.Read(buf[nr:])
+			nr += m
+		}
+		if nr > 0 {
+			nw, werr := w.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+			if nw != nr {
+				return n, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// retainBuffer is an io.Writer keeping the first limit bytes written to it, and counting all of
+// them.  A limit of zero or less means no limit.
+type retainBuffer struct {
+	buf   []byte
+	limit int
+	n     int
+}
+
+func (b *retainBuffer) Write(p []byte) (int, error) {
+	b.n += len(p)
+	keep := p
+	if b.limit > 0 {
+		if room := b.limit - len(b.buf); room < len(keep) {
+			if room < 0 {
+				room = 0
+			}
+			keep = keep[:room]
+		}
+	}
+	b.buf = append(b.buf, keep...)
+	return len(p), nil
+}
+
+// memoryBuffer holds a message entirely in memory, see WithInMemoryBuffering.
+type memoryBuffer struct {
+	*bytes.Reader
+}
+
+// Close method for io.Closer interface; there is nothing to release.
+func (memoryBuffer) Close() error {
+	return nil
+}
+
+// bufferMessageInMemory reads the message from r, through tr, into a memoryBuffer, returning it
+// and its size.
+func (ps *Parser) bufferMessageInMemory(r io.Reader, tr *truncatingReader) (
+	ReaderAtCloser, int64, error) {
+	tr.r = r
+	content, err := ioutil.ReadAll(ps.limitMessageSize(tr))
+	if err != nil {
+		return nil, 0, err
+	}
+	return memoryBuffer{bytes.NewReader(content)}, int64(len(content)), nil
+}
+
+// readerAtBuffer holds a message in a caller's io.ReaderAt, see ReadPartsFromReaderAt.
+type readerAtBuffer struct {
+	io.ReaderAt
+}
+
+// Close method for io.Closer interface; the caller owns the ReaderAt.
+func (readerAtBuffer) Close() error {
+	return nil
+}
@@ -0,0 +1,593 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ctMultipartMixed   = "multipart/mixed"
+	ctMultipartRelated = "multipart/related"
+
+	// Header names only used when composing
+	hnMIMEVersion = "MIME-Version"
+
+	// contentIDDomain is the right hand side of generated Content-IDs
+	contentIDDomain = "mime.local"
+)
+
+// Builder assembles a new message from header fields, a text body and attachments, producing a
+// Part tree which can be serialized with Part.Encode.  Create Builders with NewBuilder.
+type Builder struct {
+	header       textproto.MIMEHeader
+	contentMD5   bool
+	textEncoding string
+	idna         bool
+	text         []byte
+	html         []byte
+	attachments  []*attachment
+	inlines      []*attachment
+}
+
+// BuilderOption configures optional Builder behavior.
+type BuilderOption func(*Builder)
+
+// WithContentMD5 adds an RFC 1864 Content-MD5 header to each leaf Part built.
+func WithContentMD5() BuilderOption {
+	return func(b *Builder) {
+		b.contentMD5 = true
+	}
+}
+
+// WithTextEncoding forces the Content-Transfer-Encoding used for text bodies, one of 7bit, 8bit,
+// quoted-printable or base64, rather than choosing one to suit their content.  Build and
+// NewAlternative return an error wrapping ErrorContentEncoding for any other encoding, or for one
+// that cannot represent a body.
+func WithTextEncoding(encoding string) BuilderOption {
+	return func(b *Builder) {
+		b.textEncoding = strings.ToLower(encoding)
+	}
+}
+
+// attachment holds a file added to a Builder until the message is built.
+type attachment struct {
+	filename    string
+	contentType string
+	disposition string
+	contentID   string
+	content     []byte
+}
+
+// NewBuilder returns an empty Builder configured by opts.
+func NewBuilder(opts ...BuilderOption) *Builder {
+	b := &Builder{
+		header: make(textproto.MIMEHeader),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// NewAlternative returns a multipart/alternative Part containing text and html bodies, with the
+// plain text first as RFC 2046 requires.  Charsets and transfer encodings are chosen to suit the
+// content of each body unless overridden by opts.
+func NewAlternative(text, html string, opts ...BuilderOption) (*Part, error) {
+	b := NewBuilder(opts...)
+	tp, err := b.newTextPart(ctTextPlain, []byte(text))
+	if err != nil {
+		return nil, err
+	}
+	hp, err := b.newTextPart(ctTextHTML, []byte(html))
+	if err != nil {
+		return nil, err
+	}
+	root, err := newMultipart(ctMultipartAltern, tp, hp)
+	if err != nil {
+		return nil, err
+	}
+	root.Header.Set(hnMIMEVersion, "1.0")
+	root.Descriptor = "0"
+	setDescriptors(root, "")
+	if err := root.finishBuilt(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// SetHeader sets the top level header field name to value, replacing any existing values.  Names
+// and values containing CR, LF or other control characters are rejected with a *HeaderFieldError.
+// Non-ASCII display names in address fields such as From and To are RFC 2047 encoded, see
+// SetAddressHeader.
+func (b *Builder) SetHeader(name, value string) error {
+	if err := ValidateHeaderField(name, value); err != nil {
+		return err
+	}
+	value, err := b.encodeAddressHeader(name, value)
+	if err != nil {
+		return err
+	}
+	b.header.Set(name, value)
+	return nil
+}
+
+// AddHeader appends value to the top level header field name, see SetHeader for validation and
+// encoding rules.
+func (b *Builder) AddHeader(name, value string) error {
+	if err := ValidateHeaderField(name, value); err != nil {
+		return err
+	}
+	value, err := b.encodeAddressHeader(name, value)
+	if err != nil {
+		return err
+	}
+	b.header.Add(name, value)
+	return nil
+}
+
+// SetText sets the text/plain body of the message, which must be UTF-8 for Build to succeed.
+func (b *Builder) SetText(text string) {
+	b.text = []byte(text)
+}
+
+// SetHTML sets the text/html body of the message, which must be UTF-8.  When a text body is also
+// set the two are combined into a multipart/alternative.
+func (b *Builder) SetHTML(html string) {
+	b.html = []byte(html)
+}
+
+// Attach reads r to completion and adds its content to the message as an attachment named
+// filename.  When contentType is empty it is detected from the content and filename extension.
+// Text attachments without a declared charset are labeled us-ascii or utf-8 to suit their
+// content, and are rejected if they are neither.  Attachments are always base64 encoded.
+func (b *Builder) Attach(r io.Reader, filename, contentType string) error {
+	a, err := newAttachment(r, filename, contentType, cdAttachment)
+	if err != nil {
+		return err
+	}
+	b.attachments = append(b.attachments, a)
+	return nil
+}
+
+// Inline reads r to completion and adds its content to the message as an inline part, typically
+// an image, returning the generated Content-ID.  Reference it from the HTML body with a
+// "cid:" URL, such as <img src="cid:...">.  Inline parts are grouped with the HTML body in a
+// multipart/related, or follow the text if there is no HTML body.
+func (b *Builder) Inline(r io.Reader, filename, contentType string) (cid string, err error) {
+	a, err := newAttachment(r, filename, contentType, cdInline)
+	if err != nil {
+		return "", err
+	}
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	a.contentID = id + "@" + contentIDDomain
+	b.inlines = append(b.inlines, a)
+	return a.contentID, nil
+}
+
+// newAttachment reads r into an attachment with the given disposition.
+func newAttachment(r io.Reader, filename, contentType, disposition string) (*attachment, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading attachment: %w", err)
+	}
+	detected := contentType == ""
+	if detected {
+		contentType = detectContentType(filename, content)
+	}
+	mediatype, params, err := parseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	if strings.HasPrefix(mediatype, "text/") && (detected || params[hpCharset] == "") {
+		// A detected charset is only a guess, e.g. utf-8 for any .txt file
+		charset, err := textCharset(content)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %q: %w", filename, err)
+		}
+		if params[hpCharset] == "" {
+			params[hpCharset] = charset
+			contentType = mime.FormatMediaType(mediatype, params)
+		}
+	}
+	return &attachment{
+		filename:    filename,
+		contentType: contentType,
+		disposition: disposition,
+		content:     content,
+	}, nil
+}
+
+// AttachFile adds the file at path to the message as an attachment, see Attach.
+func (b *Builder) AttachFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return b.Attach(f, filepath.Base(path), "")
+}
+
+// Build assembles the message into a Part tree.  The Builder may continue to be used afterwards,
+// each call to Build returns a new tree.
+//
+// The resulting structure depends on the content added, the most complete form being:
+//
+//	multipart/mixed
+//	├── multipart/alternative
+//	│   ├── text/plain
+//	│   └── multipart/related
+//	│       ├── text/html
+//	│       └── inline parts
+//	└── attachments
+//
+// Inline parts added without an HTML body follow the text in the multipart/mixed, rather than
+// forming a multipart/related with no HTML root for the text to be an alternative to.
+func (b *Builder) Build() (*Part, error) {
+	root, err := b.assemble()
+	if err != nil {
+		return nil, err
+	}
+	if err := root.finishBuilt(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// EstimateSize returns the number of bytes the message would occupy if built and encoded now,
+// including transfer encoding expansion and header overhead, without encoding any content.
+func (b *Builder) EstimateSize() (int64, error) {
+	root, err := b.assemble()
+	if err != nil {
+		return 0, err
+	}
+	return root.encodedSize()
+}
+
+// assemble arranges the content added to the Builder into a Part tree, see Build.  Leaf content
+// is not transfer encoded until finishBuilt is called.
+func (b *Builder) assemble() (*Part, error) {
+	var alternatives []*Part
+	if len(b.text) > 0 || (len(b.html) == 0 && len(b.attachments) == 0 && len(b.inlines) == 0) {
+		p, err := b.newTextPart(ctTextPlain, b.text)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, p)
+	}
+	var inlines []*Part
+	for _, a := range b.inlines {
+		p, err := b.attachmentPart(a)
+		if err != nil {
+			return nil, err
+		}
+		inlines = append(inlines, p)
+	}
+	if len(b.html) > 0 {
+		p, err := b.newTextPart(ctTextHTML, b.html)
+		if err != nil {
+			return nil, err
+		}
+		if p, err = wrapParts(ctMultipartRelated, append([]*Part{p}, inlines...)); err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, p)
+		inlines = nil
+	}
+
+	var parts []*Part
+	if len(alternatives) > 0 {
+		p, err := wrapParts(ctMultipartAltern, alternatives)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	// Without an HTML body to refer to them, inline parts follow the text in the multipart/mixed
+	parts = append(parts, inlines...)
+	for _, a := range b.attachments {
+		p, err := b.attachmentPart(a)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	root, err := wrapParts(ctMultipartMixed, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range b.header {
+		root.Header[k] = append([]string(nil), v...)
+	}
+	root.Header.Set(hnMIMEVersion, "1.0")
+
+	if root.boundary != "" {
+		root.Descriptor = "0"
+		setDescriptors(root, "")
+	}
+	return root, nil
+}
+
+// wrapParts returns the only element of parts, or a new multipart of mediatype containing them.
+func wrapParts(mediatype string, parts []*Part) (*Part, error) {
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return newMultipart(mediatype, parts...)
+}
+
+// attachmentPart renders the attachment as a leaf Part.
+func (b *Builder) attachmentPart(a *attachment) (*Part, error) {
+	mediatype, params, err := parseMediaType(a.contentType)
+	if err != nil {
+		return nil, err
+	}
+	p := NewPart(nil)
+	if err := p.setContentType(mediatype, params); err != nil {
+		return nil, err
+	}
+	if err := p.setDisposition(a.disposition, map[string]string{hpFilename: a.filename}); err != nil {
+		return nil, err
+	}
+	if a.contentID != "" {
+		p.ContentID = a.contentID
+		if err := p.SetHeader(hnContentID, "<"+a.contentID+">"); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.setPartContent(p, "base64", a.content); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newTextPart returns a text Part, choosing the charset and transfer encoding to suit content,
+// which must be UTF-8.
+func (b *Builder) newTextPart(mediatype string, content []byte) (*Part, error) {
+	content = normalizeNewlines(content)
+	if _, err := textCharset(content); err != nil {
+		return nil, fmt.Errorf("%s body: %w", mediatype, err)
+	}
+	charset, encoding := chooseTextEncoding(content)
+	switch b.textEncoding {
+	case "":
+	case "7bit", "8bit", "quoted-printable", "base64":
+		encoding = b.textEncoding
+		if !representable(encoding, content) {
+			return nil, fmt.Errorf("%w: %s body cannot be represented as %s",
+				ErrorContentEncoding, mediatype, encoding)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported text Content-Transfer-Encoding %q",
+			ErrorContentEncoding, b.textEncoding)
+	}
+
+	p := NewPart(nil)
+	if err := p.setContentType(mediatype, map[string]string{hpCharset: charset}); err != nil {
+		return nil, err
+	}
+	if err := b.setPartContent(p, encoding, content); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// setPartContent sets the content of the leaf Part p, adding a Content-MD5 header if configured.
+func (b *Builder) setPartContent(p *Part, encoding string, content []byte) error {
+	if b.contentMD5 {
+		if err := p.SetHeader(hnContentMD5, contentMD5(content)); err != nil {
+			return err
+		}
+	}
+	return p.setContent(encoding, content)
+}
+
+// chooseTextEncoding picks the charset and Content-Transfer-Encoding for UTF-8 text.  ASCII text
+// with reasonable line lengths is sent as 7bit, text that is mostly 8-bit (such as CJK scripts)
+// as base64, and everything else as quoted-printable.
+func chooseTextEncoding(content []byte) (charset, encoding string) {
+	var high int
+	for _, c := range content {
+		if c > 0x7f {
+			high++
+		}
+	}
+	switch {
+	case high == 0 && !hasLongLines(content, 998):
+		return "us-ascii", "7bit"
+	case high == 0:
+		return "us-ascii", "quoted-printable"
+	case high > len(content)/2:
+		return "utf-8", "base64"
+	default:
+		return "utf-8", "quoted-printable"
+	}
+}
+
+// textCharset returns the charset of text content declaring none: us-ascii if it is ASCII, or
+// utf-8 if it is valid UTF-8.  Other 8-bit text is an error, as labeling it either way would
+// leave recipients to guess at, and likely garble, its characters.
+func textCharset(content []byte) (string, error) {
+	for _, c := range content {
+		if c >= utf8.RuneSelf {
+			if !utf8.Valid(content) {
+				return "", fmt.Errorf("8-bit text is not UTF-8 and declares no charset")
+			}
+			return "utf-8", nil
+		}
+	}
+	return "us-ascii", nil
+}
+
+// newMultipart returns a Part of the multipart mediatype containing parts, with a generated
+// boundary.
+func newMultipart(mediatype string, parts ...*Part) (*Part, error) {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+	p := NewPart(nil)
+	if err := p.setContentType(mediatype, map[string]string{hpBoundary: boundary}); err != nil {
+		return nil, err
+	}
+	p.boundary = boundary
+	for _, s := range parts {
+		s.Parent = p
+		p.Subparts = append(p.Subparts, s)
+	}
+	return p, nil
+}
+
+// setContentType sets the Content-Type header and the fields derived from it.
+func (p *Part) setContentType(mediatype string, params map[string]string) error {
+	value := mime.FormatMediaType(mediatype, params)
+	if value == "" {
+		return fmt.Errorf("unable to format content type %q", mediatype)
+	}
+	if err := p.SetHeader(hnContentType, value); err != nil {
+		return err
+	}
+	p.ContentType = mediatype
+	p.ContentParams = params
+	p.Charset = params[hpCharset]
+	return nil
+}
+
+// setDisposition sets the Content-Disposition header and the fields derived from it.
+func (p *Part) setDisposition(disposition string, params map[string]string) error {
+	value := mime.FormatMediaType(disposition, params)
+	if value == "" {
+		return fmt.Errorf("unable to format content disposition %q", disposition)
+	}
+	if err := p.SetHeader(hnContentDisposition, value); err != nil {
+		return err
+	}
+	p.Disposition = disposition
+	p.DispositionParams = params
+	p.Filename = params[hpFilename]
+	return nil
+}
+
+// setContent stores content as the body of a leaf Part, to be transfer encoded with encoding by
+// finishBuilt, and sets the Content-Transfer-Encoding header to match.
+func (p *Part) setContent(encoding string, content []byte) error {
+	if err := p.SetHeader(hnContentEncoding, encoding); err != nil {
+		return err
+	}
+	p.Encoding = encoding
+	p.content = content
+	p.encoded = nil
+	return nil
+}
+
+// finishBuilt renders a built Part tree so that lengths, Read, RawReader and Decode behave as
+// they would for a parsed message.
+func (p *Part) finishBuilt() error {
+	for _, s := range p.Subparts {
+		if err := s.finishBuilt(); err != nil {
+			return err
+		}
+	}
+	if p.content != nil {
+		encoded, err := encodeContent(p.Encoding, p.content)
+		if err != nil {
+			return err
+		}
+		p.encoded = encoded
+		p.content = nil
+	}
+
+	header := &bytes.Buffer{}
+	w := bufio.NewWriter(header)
+	if err := writeHeader(w, p.Header, p.fieldOrder); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	body := &bytes.Buffer{}
+	w = bufio.NewWriter(body)
+	if err := p.encodeBody(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	p.HeaderLen = header.Len()
+	p.PartLen = header.Len() + body.Len()
+	p.Size = body.Len()
+	p.Lines = bytes.Count(body.Bytes(), []byte{'\n'})
+	p.HeaderReader = bytes.NewReader(header.Bytes())
+	p.reader = bytes.NewReader(body.Bytes())
+	return nil
+}
+
+// setDescriptors numbers the Subparts of a built multipart the same way parseParts does.
+func setDescriptors(p *Part, prefix string) {
+	for i, s := range p.Subparts {
+		d := strconv.Itoa(i + 1)
+		if prefix != "" {
+			d = prefix + "." + d
+		}
+		s.Descriptor = d
+		if s.boundary != "" {
+			setDescriptors(s, d)
+			s.Descriptor += ".0"
+		}
+	}
+}
+
+// randomBoundary generates a multipart boundary that is exceedingly unlikely to appear in content.
+func randomBoundary() (string, error) {
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	return "mime-" + id, nil
+}
+
+// randomID returns 128 random bits, hex encoded.
+func randomID() (string, error) {
+	var buf [16]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		return "", fmt.Errorf("error generating random identifier: %w", err)
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// normalizeNewlines converts bare LF line endings to CRLF.
+func normalizeNewlines(b []byte) []byte {
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1)
+}
+
+// hasLongLines returns true if any line in b is longer than max octets, excluding the newline.
+func hasLongLines(b []byte, max int) bool {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i == -1 {
+			return len(b) > max
+		}
+		if len(bytes.TrimSuffix(b[:i], []byte{'\r'})) > max {
+			return true
+		}
+		b = b[i+1:]
+	}
+	return false
+}
@@ -0,0 +1,415 @@
+package mime_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cardamaro/mime"
+	"github.com/cardamaro/mime/internal/test"
+)
+
+func TestBuilderTextOnly(t *testing.T) {
+	b := mime.NewBuilder()
+	if err := b.SetHeader("Subject", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	b.SetText("Hello world\n")
+
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ComparePart(t, root, &mime.Part{
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+	})
+	if got, want := root.Header.Get("Content-Transfer-Encoding"), "7bit"; got != want {
+		t.Errorf("Content-Transfer-Encoding == %q, want: %q", got, want)
+	}
+	if got, want := root.Header.Get("MIME-Version"), "1.0"; got != want {
+		t.Errorf("MIME-Version == %q, want: %q", got, want)
+	}
+	test.ContentEqualsString(t, root, "Hello world\r\n")
+}
+
+func TestBuilderAttach(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	b := mime.NewBuilder()
+	b.SetText("See attached")
+	if err := b.Attach(bytes.NewReader(png), "pixel.png", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Attach(strings.NewReader("a,b\n1,2\n"), "résumé.csv", "text/csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "filename*=utf-8''r%C3%A9sum%C3%A9.csv") {
+		t.Errorf("RFC 2231 filename missing from:\n%s", buf.String())
+	}
+
+	// Parse our own output
+	p, err := mime.ReadParts(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ComparePart(t, p, &mime.Part{
+		Subparts:    []*mime.Part{test.PartExists, test.PartExists, test.PartExists},
+		ContentType: "multipart/mixed",
+		Descriptor:  "0",
+	})
+	test.ComparePart(t, p.Subparts[0], &mime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		Descriptor:  "1",
+	})
+	test.ComparePart(t, p.Subparts[1], &mime.Part{
+		Parent:      test.PartExists,
+		ContentType: "image/png",
+		Disposition: "attachment",
+		Filename:    "pixel.png",
+		Descriptor:  "2",
+	})
+	if got, want := p.Subparts[1].Header.Get("Content-Transfer-Encoding"), "base64"; got != want {
+		t.Errorf("Content-Transfer-Encoding == %q, want: %q", got, want)
+	}
+	d, err := p.Subparts[1].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ContentEqualsBytes(t, d, png)
+
+	test.ComparePart(t, p.Subparts[2], &mime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/csv",
+		Charset:     "us-ascii",
+		Disposition: "attachment",
+		Filename:    "résumé.csv",
+		Descriptor:  "3",
+	})
+}
+
+func TestBuilderAttachFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mime-builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(path, []byte("some notes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := mime.NewBuilder()
+	if err := b.AttachFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AttachFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("AttachFile of a missing file should fail")
+	}
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No text body was set, so the attachment is the entire message
+	test.ComparePart(t, root, &mime.Part{
+		ContentType: "text/plain",
+		Charset:     "utf-8",
+		Disposition: "attachment",
+		Filename:    "notes.txt",
+	})
+	d, err := root.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ContentEqualsString(t, d, "some notes")
+}
+
+func TestBuilderTextCharset(t *testing.T) {
+	b := mime.NewBuilder()
+	b.SetText("Café")
+	if err := b.Attach(strings.NewReader("naïve"), "notes.txt", ""); err != nil {
+		t.Fatal(err)
+	}
+	err := b.Attach(strings.NewReader("na\xefve"), "latin1.txt", "text/plain; charset=iso-8859-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"utf-8", "utf-8", "iso-8859-1"} {
+		if got := root.Subparts[i].Charset; got != want {
+			t.Errorf("Subparts[%d].Charset == %q, want: %q", i, got, want)
+		}
+	}
+
+	// 8-bit text that is not UTF-8 has no charset to label it with
+	b = mime.NewBuilder()
+	b.SetText("Caf\xe9")
+	if _, err := b.Build(); err == nil {
+		t.Error("Build of a Latin-1 text body should fail")
+	}
+	b = mime.NewBuilder()
+	if err := b.Attach(strings.NewReader("na\xefve"), "latin1.txt", ""); err == nil {
+		t.Error("Attach of Latin-1 text without a charset should fail")
+	}
+	if err := b.Attach(strings.NewReader("na\xefve"), "latin1.csv", "text/csv"); err == nil {
+		t.Error("Attach of Latin-1 text/csv without a charset should fail")
+	}
+}
+
+func TestBuilderRejectsHeaderInjection(t *testing.T) {
+	b := mime.NewBuilder()
+	err := b.SetHeader("Subject", "hi\r\nBcc: victim@example.com")
+	if _, ok := err.(*mime.HeaderFieldError); !ok {
+		t.Errorf("SetHeader error == %v, want *HeaderFieldError", err)
+	}
+	err = b.AddHeader("To\r\nBcc", "victim@example.com")
+	if _, ok := err.(*mime.HeaderFieldError); !ok {
+		t.Errorf("AddHeader error == %v, want *HeaderFieldError", err)
+	}
+}
+
+func TestBuilderInline(t *testing.T) {
+	b := mime.NewBuilder()
+	b.SetText("plain")
+	cid, err := b.Inline(strings.NewReader("GIF89a"), "logo.gif", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cid == "" || strings.ContainsAny(cid, "<>") {
+		t.Fatalf("Inline returned Content-ID %q, want an unbracketed id", cid)
+	}
+	b.SetHTML(`<img src="cid:` + cid + `">`)
+	if err := b.Attach(strings.NewReader("data"), "data.bin", "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := mime.ReadParts(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	p.Walk(func(p *mime.Part) error {
+		got = append(got, p.String())
+		return nil
+	})
+	want := []string{
+		"0 <multipart/mixed>",
+		"1.0 <multipart/alternative>",
+		"1.1 <text/plain>",
+		"1.2.0 <multipart/related>",
+		"1.2.1 <text/html>",
+		"1.2.2 <image/gif>",
+		"2 <application/octet-stream>",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("structure:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	img := p.Subparts[0].Subparts[1].Subparts[1]
+	if got, want := img.Header.Get("Content-Id"), "<"+cid+">"; got != want {
+		t.Errorf("Content-ID == %q, want: %q", got, want)
+	}
+	if img.ContentID != cid {
+		t.Errorf("ContentID == %q, want: %q", img.ContentID, cid)
+	}
+	if img.Disposition != "inline" {
+		t.Errorf("Disposition == %q, want: inline", img.Disposition)
+	}
+}
+
+func TestBuilderInlineWithoutHTML(t *testing.T) {
+	b := mime.NewBuilder()
+	b.SetText("plain")
+	if _, err := b.Inline(strings.NewReader("GIF89a"), "logo.gif", ""); err != nil {
+		t.Fatal(err)
+	}
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	root.Walk(func(p *mime.Part) error {
+		got = append(got, p.String())
+		return nil
+	})
+	want := []string{"0 <multipart/mixed>", "1 <text/plain>", "2 <image/gif>"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("structure:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNewAlternative(t *testing.T) {
+	ttable := []struct {
+		name, text, html     string
+		opts                 []mime.BuilderOption
+		textCharset, textCTE string
+		htmlCharset, htmlCTE string
+	}{
+		{
+			name: "ascii", text: "Hello", html: "<p>Hello</p>",
+			textCharset: "us-ascii", textCTE: "7bit",
+			htmlCharset: "us-ascii", htmlCTE: "7bit",
+		},
+		{
+			name: "latin", text: "Grüße aus Köln", html: "<p>Grüße</p>",
+			textCharset: "utf-8", textCTE: "quoted-printable",
+			htmlCharset: "utf-8", htmlCTE: "quoted-printable",
+		},
+		{
+			name: "cjk", text: "你好，世界", html: "<p>Hello</p>",
+			textCharset: "utf-8", textCTE: "base64",
+			htmlCharset: "us-ascii", htmlCTE: "7bit",
+		},
+		{
+			name: "forced", text: "Hello", html: "<p>Hello</p>",
+			opts:        []mime.BuilderOption{mime.WithTextEncoding("base64")},
+			textCharset: "us-ascii", textCTE: "base64",
+			htmlCharset: "us-ascii", htmlCTE: "base64",
+		},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := mime.NewAlternative(tt.text, tt.html, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			if err := root.Encode(buf); err != nil {
+				t.Fatal(err)
+			}
+			p, err := mime.ReadParts(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.ComparePart(t, p, &mime.Part{
+				Subparts:    []*mime.Part{test.PartExists, test.PartExists},
+				ContentType: "multipart/alternative",
+				Descriptor:  "0",
+			})
+			test.ComparePart(t, p.Subparts[0], &mime.Part{
+				Parent:      test.PartExists,
+				ContentType: "text/plain",
+				Charset:     tt.textCharset,
+				Descriptor:  "1",
+			})
+			test.ComparePart(t, p.Subparts[1], &mime.Part{
+				Parent:      test.PartExists,
+				ContentType: "text/html",
+				Charset:     tt.htmlCharset,
+				Descriptor:  "2",
+			})
+			if got := p.Subparts[0].Header.Get("Content-Transfer-Encoding"); got != tt.textCTE {
+				t.Errorf("text Content-Transfer-Encoding == %q, want: %q", got, tt.textCTE)
+			}
+			if got := p.Subparts[1].Header.Get("Content-Transfer-Encoding"); got != tt.htmlCTE {
+				t.Errorf("html Content-Transfer-Encoding == %q, want: %q", got, tt.htmlCTE)
+			}
+
+			d, err := p.Subparts[0].Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.ContentEqualsString(t, d, tt.text)
+			d, err = p.Subparts[1].Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.ContentEqualsString(t, d, tt.html)
+		})
+	}
+}
+
+func TestNewAlternativeInvalidTextEncoding(t *testing.T) {
+	for _, tt := range []struct{ text, encoding string }{
+		{"Hello", "uuencode"},
+		{"Hello", "binary"},
+		{"Grüße", "7bit"},
+	} {
+		_, err := mime.NewAlternative(tt.text, "<p>Hello</p>", mime.WithTextEncoding(tt.encoding))
+		if !errors.Is(err, mime.ErrorContentEncoding) {
+			t.Errorf("NewAlternative(%q) WithTextEncoding(%q) error %v, want %v", tt.text,
+				tt.encoding, err, mime.ErrorContentEncoding)
+		}
+	}
+
+	b := mime.NewBuilder(mime.WithTextEncoding("x-unknown"))
+	b.SetText("Hello")
+	if _, err := b.Build(); !errors.Is(err, mime.ErrorContentEncoding) {
+		t.Errorf("Build() WithTextEncoding(%q) error %v, want %v", "x-unknown", err,
+			mime.ErrorContentEncoding)
+	}
+}
+
+func TestBuilderEstimateSize(t *testing.T) {
+	ttable := []struct {
+		name  string
+		setup func(b *mime.Builder)
+	}{
+		{"empty", func(b *mime.Builder) {}},
+		{"text", func(b *mime.Builder) {
+			b.SetHeader("Subject", "Estimate "+strings.Repeat("long subject ", 20))
+			b.SetText("Hello\n")
+		}},
+		{"qp", func(b *mime.Builder) {
+			b.SetText(strings.Repeat("Grüße = ", 100))
+		}},
+		{"everything", func(b *mime.Builder) {
+			b.SetText("plain")
+			b.SetHTML("<p>html</p>")
+			b.Inline(bytes.NewReader(make([]byte, 1000)), "a.gif", "image/gif")
+			for _, n := range []int{0, 1, 2, 3, 57, 58, 4000} {
+				b.Attach(bytes.NewReader(make([]byte, n)), "x.bin", "application/octet-stream")
+			}
+		}},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			b := mime.NewBuilder(mime.WithContentMD5())
+			tt.setup(b)
+			est, err := b.EstimateSize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, err := b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			if err := root.Encode(buf); err != nil {
+				t.Fatal(err)
+			}
+			if est != int64(buf.Len()) {
+				t.Errorf("EstimateSize() == %d, encoded %d bytes", est, buf.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package mime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	ctMultipartByteranges = "multipart/byteranges"
+	hnContentRange        = "Content-Range"
+)
+
+// ByteRange is a parsed Content-Range header value, per RFC 7233 section 4.2.
+type ByteRange struct {
+	Unit        string // The range unit, normally "bytes"
+	First, Last int64  // The positions of the first and last bytes in the range, inclusive
+	Length      int64  // The complete length of the representation, -1 if unknown
+}
+
+// Size returns the number of bytes in the range.
+func (br *ByteRange) Size() int64 {
+	return br.Last - br.First + 1
+}
+
+func (br *ByteRange) String() string {
+	length := "*"
+	if br.Length >= 0 {
+		length = strconv.FormatInt(br.Length, 10)
+	}
+	return fmt.Sprintf("%s %d-%d/%s", br.Unit, br.First, br.Last, length)
+}
+
+// ParseContentRange parses a Content-Range header value such as "bytes 500-999/8000".  Unsatisfied
+// ranges, "bytes */8000", are rejected as they carry no content.
+func ParseContentRange(value string) (*ByteRange, error) {
+	unit, spec := consumeToken(strings.TrimSpace(value))
+	if unit == "" || !strings.HasPrefix(spec, " ") {
+		return nil, fmt.Errorf("malformed Content-Range %q", value)
+	}
+	spec = strings.TrimSpace(spec)
+	slash := strings.Index(spec, "/")
+	dash := strings.Index(spec, "-")
+	if slash == -1 || dash == -1 || dash > slash {
+		return nil, fmt.Errorf("malformed Content-Range %q", value)
+	}
+	br := &ByteRange{Unit: strings.ToLower(unit), Length: -1}
+	var err error
+	if br.First, err = strconv.ParseInt(spec[:dash], 10, 64); err != nil {
+		return nil, fmt.Errorf("malformed Content-Range %q: %w", value, err)
+	}
+	if br.Last, err = strconv.ParseInt(spec[dash+1:slash], 10, 64); err != nil {
+		return nil, fmt.Errorf("malformed Content-Range %q: %w", value, err)
+	}
+	if length := spec[slash+1:]; length != "*" {
+		if br.Length, err = strconv.ParseInt(length, 10, 64); err != nil {
+			return nil, fmt.Errorf("malformed Content-Range %q: %w", value, err)
+		}
+	}
+	if br.First < 0 || br.Last < br.First || (br.Length >= 0 && br.Last >= br.Length) {
+		return nil, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	return br, nil
+}
+
+// ContentRange returns the parsed Content-Range header of the Part, or nil if it has none.
+func (p *Part) ContentRange() (*ByteRange, error) {
+	value := p.Header.Get(hnContentRange)
+	if value == "" {
+		return nil, nil
+	}
+	return ParseContentRange(value)
+}
+
+// ByteRanges returns the range of each Subpart of a multipart/byteranges Part, in order.  Every
+// Subpart must have a valid Content-Range header.
+func (p *Part) ByteRanges() ([]*ByteRange, error) {
+	if p.ContentType != ctMultipartByteranges {
+		return nil, fmt.Errorf("%s is not %s", p.ContentType, ctMultipartByteranges)
+	}
+	ranges := make([]*ByteRange, len(p.Subparts))
+	for i, s := range p.Subparts {
+		br, err := s.ContentRange()
+		if err != nil {
+			return nil, fmt.Errorf("part %s: %w", s.Descriptor, err)
+		}
+		if br == nil {
+			return nil, fmt.Errorf("part %s has no %s", s.Descriptor, hnContentRange)
+		}
+		ranges[i] = br
+	}
+	return ranges, nil
+}
+
+// ReadByteRanges reads a multipart/byteranges HTTP response body from r, where contentType is
+// the value of the response's Content-Type header.  The body is parsed as if preceded by a
+// header block holding only that Content-Type.  Offsets count from the start of the body, so the
+// root's synthetic header block lies before it, at a negative PartOffset, and its ContentExtent
+// starts at 0.
+func (ps *Parser) ReadByteRanges(r io.Reader, contentType string) (*Part, error) {
+	if err := ValidateHeaderField(hnContentType, contentType); err != nil {
+		return nil, err
+	}
+	header := hnContentType + ": " + contentType + "\r\n\r\n"
+	root, err := ps.ReadParts(io.MultiReader(strings.NewReader(header), r))
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			perr.Offset -= len(header)
+			perr.Line -= strings.Count(header, "\n")
+			return nil, fmt.Errorf("error reading part: %w", perr)
+		}
+		return nil, err
+	}
+	if root.ContentType != ctMultipartByteranges {
+		root.Close()
+		return nil, fmt.Errorf("%s is not %s", root.ContentType, ctMultipartByteranges)
+	}
+	root.shiftOffsets(len(header))
+	return root, nil
+}
+
+// shiftOffsets moves the origin of the offsets of the Part tree rooted at p n bytes into its
+// input, so that they count from there.
+func (p *Part) shiftOffsets(n int) {
+	raw := &offsetReaderAt{p.rawReader, int64(n)}
+	p.Walk(func(q *Part) error {
+		q.PartOffset -= n
+		q.AbsoluteHeaderOffset -= n
+		q.AbsoluteOffset -= n
+		if q.rawReader != nil {
+			q.rawReader = raw
+		}
+		for _, e := range q.Errors {
+			if e, ok := e.(*Error); ok {
+				e.Offset -= n
+			}
+		}
+		for i := range q.SkippedRegions {
+			q.SkippedRegions[i].Offset -= n
+		}
+		return nil
+	})
+}
+
+// offsetReaderAt reads its ReaderAtCloser from off bytes into it.
+type offsetReaderAt struct {
+	ReaderAtCloser
+	off int64
+}
+
+func (r *offsetReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	return r.ReaderAtCloser.ReadAt(b, off+r.off)
+}
+
+// ReadByteRanges reads a multipart/byteranges HTTP response body, see Parser.ReadByteRanges.
+func ReadByteRanges(r io.Reader, contentType string, opts ...Option) (*Part, error) {
+	return NewParser(opts...).ReadByteRanges(r, contentType)
+}
@@ -0,0 +1,119 @@
+package mime
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	ttable := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"bytes 0-499/1234", "bytes 0-499/1234", false},
+		{" Bytes 500-1233/1234 ", "bytes 500-1233/1234", false},
+		{"bytes 42-1233/*", "bytes 42-1233/*", false},
+		{"bytes */1234", "", true},
+		{"bytes 500-499/1234", "", true},
+		{"bytes 0-1234/1234", "", true},
+		{"bytes 0-x/1234", "", true},
+		{"0-499/1234", "", true},
+		{"", "", true},
+	}
+	for _, tt := range ttable {
+		br, err := ParseContentRange(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseContentRange(%q) error == %v, want error: %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && br.String() != tt.want {
+			t.Errorf("ParseContentRange(%q) == %q, want %q", tt.in, br, tt.want)
+		}
+	}
+}
+
+func TestReadByteRanges(t *testing.T) {
+	body := "--THIS_STRING_SEPARATES\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Range: bytes 500-509/8000\r\n" +
+		"\r\n" +
+		"0123456789\r\n" +
+		"--THIS_STRING_SEPARATES\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"Content-Range: bytes 7000-7004/8000\r\n" +
+		"\r\n" +
+		"abcde\r\n" +
+		"--THIS_STRING_SEPARATES--\r\n"
+	root, err := ReadByteRanges(strings.NewReader(body),
+		"multipart/byteranges; boundary=THIS_STRING_SEPARATES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	ranges, err := root.ByteRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"bytes 500-509/8000", "bytes 7000-7004/8000"}
+	contents := []string{"0123456789", "abcde"}
+	if len(ranges) != len(want) {
+		t.Fatalf("got %d ranges, want %d", len(ranges), len(want))
+	}
+	for i, br := range ranges {
+		if br.String() != want[i] {
+			t.Errorf("range %d == %q, want %q", i, br, want[i])
+		}
+		content, err := ioutil.ReadAll(root.Subparts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(content)) != br.Size() || string(content) != contents[i] {
+			t.Errorf("range %d content == %q, want %q", i, content, contents[i])
+		}
+	}
+
+	// Offsets count from the start of the body
+	if ce := root.ContentExtent(); ce.Offset != 0 || ce.Len != len(body) {
+		t.Errorf("root ContentExtent() == %+v, want {0 %d}", ce, len(body))
+	}
+	for i, s := range root.Subparts {
+		ce := s.ContentExtent()
+		if want := strings.Index(body, contents[i]); ce.Offset != want {
+			t.Errorf("range %d ContentExtent() == %+v, want Offset %d", i, ce, want)
+		}
+		if got := body[ce.Offset:ce.End()]; got != contents[i] {
+			t.Errorf("range %d body at ContentExtent() == %q, want %q", i, got, contents[i])
+		}
+	}
+	header, err := root.Subparts[1].HeaderAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(header); !strings.HasPrefix(string(got), "Content-Type") {
+		t.Errorf("HeaderAt() of range 1 == %q", got)
+	}
+	if err := root.Reparse(); err != nil || root.Subparts[1].ContentExtent().Offset !=
+		strings.Index(body, "abcde") {
+		t.Errorf("Reparse() == %v, range 1 at %+v", err, root.Subparts[1].ContentExtent())
+	}
+
+	_, err = ReadByteRanges(strings.NewReader(body),
+		"multipart/byteranges; boundary=THIS_STRING_SEPARATES", WithMaxParts(2))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Offset < 0 || perr.Offset > len(body) || perr.Line < 6 ||
+		perr.Line > 11 {
+		t.Errorf("ReadByteRanges() error %#v, want a ParseError in the second range", err)
+	}
+
+	if _, err := ReadByteRanges(strings.NewReader(body), "text/plain"); err == nil {
+		t.Error("ReadByteRanges accepted text/plain")
+	}
+	root.Subparts[1].Header.Del(hnContentRange)
+	if _, err := root.ByteRanges(); err == nil {
+		t.Error("ByteRanges accepted a part without Content-Range")
+	}
+}
@@ -0,0 +1,131 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ctTextCalendar = "text/calendar"
+
+	hpMethod = "method"
+
+	// maxCalendarLine limits the length of calendar content lines read while searching for the
+	// METHOD property
+	maxCalendarLine = 64 * 1024
+)
+
+// calendarTypes are the media types other than text/calendar that calendar clients and servers
+// label iCalendar objects with.
+var calendarTypes = map[string]bool{
+	"application/ics":  true,
+	"text/x-vcalendar": true,
+}
+
+// IsCalendar returns true for a Part holding an iCalendar object, such as an invitation: a
+// text/calendar Part, an application/ics or text/x-vcalendar Part, a generic
+// application/octet-stream or text/plain Part whose filename ends with .ics, or an
+// application/octet-stream Part whose content is detected as text/calendar, as for
+// AttachmentInfo.DetectedType.  Text bodies are not sniffed.
+func (p *Part) IsCalendar() bool {
+	switch {
+	case p.ContentType == ctTextCalendar || calendarTypes[p.ContentType]:
+		return true
+	case strings.EqualFold(filepath.Ext(p.Filename), ".ics"):
+		return p.ContentType == ctAppOctetStream || p.ContentType == ctTextPlain
+	case p.ContentType == ctAppOctetStream:
+		r, err := p.DecodeRaw()
+		if err != nil {
+			return false
+		}
+		head := make([]byte, sniffLen)
+		n, _ := io.ReadFull(r, head)
+		return detectCalendar(head[:n])
+	}
+	return false
+}
+
+// detectCalendar returns true if content begins with an iCalendar object, ignoring any byte order
+// mark and leading white space.
+func detectCalendar(content []byte) bool {
+	content = bytes.TrimLeft(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")), " \t\r\n")
+	const begin = "BEGIN:VCALENDAR"
+	return len(content) >= len(begin) && strings.EqualFold(string(content[:len(begin)]), begin)
+}
+
+// CalendarMethod is the iTIP method of a calendar Part, per RFC 5546, which determines what an
+// invitation message asks of its recipient.
+type CalendarMethod string
+
+// iTIP methods
+const (
+	CalendarPublish        CalendarMethod = "PUBLISH"        // Informational, no reply expected
+	CalendarRequest        CalendarMethod = "REQUEST"        // New invitation or an update to one
+	CalendarReply          CalendarMethod = "REPLY"          // Attendee's accept, decline, etc.
+	CalendarAdd            CalendarMethod = "ADD"            // Adds instances to a recurring event
+	CalendarCancel         CalendarMethod = "CANCEL"         // Event or attendance is cancelled
+	CalendarRefresh        CalendarMethod = "REFRESH"        // Attendee asks for the latest version
+	CalendarCounter        CalendarMethod = "COUNTER"        // Attendee proposes a change
+	CalendarDeclineCounter CalendarMethod = "DECLINECOUNTER" // Organizer rejects a COUNTER
+)
+
+// IsInvite returns true for methods sent by an organizer that recipients act upon as an
+// invitation: REQUEST and ADD.
+func (m CalendarMethod) IsInvite() bool {
+	return m == CalendarRequest || m == CalendarAdd
+}
+
+// IsResponse returns true for methods sent by an attendee back to the organizer: REPLY, REFRESH
+// and COUNTER.
+func (m CalendarMethod) IsResponse() bool {
+	return m == CalendarReply || m == CalendarRefresh || m == CalendarCounter
+}
+
+// CalendarMethod returns the iTIP method of a calendar Part, see IsCalendar, uppercased.  The
+// method parameter of the Content-Type is used if present, otherwise the METHOD property of the
+// VCALENDAR object in the content.  Other Parts, and calendars without a method, return "".
+func (p *Part) CalendarMethod() CalendarMethod {
+	if !p.IsCalendar() {
+		return ""
+	}
+	if m := strings.TrimSpace(p.ContentParams[hpMethod]); m != "" {
+		return CalendarMethod(strings.ToUpper(m))
+	}
+
+	r, err := p.Decode()
+	if err != nil {
+		return ""
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxCalendarLine)
+	inCalendar := false
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			// Skip folded continuations, METHOD values are short
+			continue
+		}
+		name, value := line, ""
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			name, value = line[:i], line[i+1:]
+		}
+		if i := strings.IndexByte(name, ';'); i != -1 {
+			// Drop property parameters
+			name = name[:i]
+		}
+		name = strings.ToUpper(strings.TrimSpace(name))
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			inCalendar = true
+		case name == "BEGIN" || name == "END":
+			// Calendar properties precede any component
+			return ""
+		case name == "METHOD" && inCalendar:
+			return CalendarMethod(strings.ToUpper(strings.TrimSpace(value)))
+		}
+	}
+	return ""
+}
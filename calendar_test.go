@@ -0,0 +1,62 @@
+package mime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalendarMethod(t *testing.T) {
+	ttable := []struct {
+		ctype, body string
+		want        CalendarMethod
+	}{
+		{"text/calendar; method=request", "BEGIN:VCALENDAR\r\nMETHOD:CANCEL\r\n", CalendarRequest},
+		{"text/calendar", "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:Reply\r\nEND:VCALENDAR\r\n",
+			CalendarReply},
+		{"text/calendar; charset=utf-8", "BEGIN:VCALENDAR\nMETHOD;X-P=1:CANCEL\nEND:VCALENDAR\n",
+			CalendarCancel},
+		{"text/calendar", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nMETHOD:REQUEST\r\n", ""},
+		{"text/calendar", "METHOD:REQUEST\r\n", ""},
+		{"text/plain; method=REQUEST", "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\n", ""},
+		{"application/ics", "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\n", CalendarRequest},
+		{"application/octet-stream\r\nContent-Disposition: attachment; filename=Invite.ICS",
+			"BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\n", CalendarRequest},
+		{"application/octet-stream; name=invite.txt", "METHOD:REQUEST\r\n", ""},
+	}
+	for _, tt := range ttable {
+		raw := "Content-Type: " + tt.ctype + "\r\n\r\n" + tt.body
+		p, err := ReadParts(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.CalendarMethod(); got != tt.want {
+			t.Errorf("%q: CalendarMethod() == %q, want %q", raw, got, tt.want)
+		}
+	}
+
+	if !CalendarRequest.IsInvite() || CalendarReply.IsInvite() || CalendarCancel.IsInvite() {
+		t.Error("IsInvite() is only true for invitations")
+	}
+	if !CalendarCounter.IsResponse() || CalendarRequest.IsResponse() {
+		t.Error("IsResponse() is only true for attendee responses")
+	}
+}
+
+func TestDetectCalendarAttachment(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=meeting\r\n\r\n" +
+		"\xef\xbb\xbf\r\nbegin:vcalendar\r\nMETHOD:REQUEST\r\nEND:VCALENDAR\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Attachments(p)
+	if len(a) != 1 || a[0].DetectedType != ctTextCalendar {
+		t.Fatalf("Attachments() == %+v, want a %s attachment", a, ctTextCalendar)
+	}
+	if m := a[0].Part.CalendarMethod(); m != CalendarRequest {
+		t.Errorf("CalendarMethod() == %q, want %q", m, CalendarRequest)
+	}
+}
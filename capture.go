@@ -0,0 +1,215 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"regexp"
+)
+
+// CaptureLevel selects the parse problems for which WithCorpusCapture saves a message.
+type CaptureLevel int
+
+// Capture levels, each including the problems of those before it
+const (
+	// CaptureFailures saves messages that ReadParts returns an error for
+	CaptureFailures CaptureLevel = iota
+	// CaptureErrors also saves messages with a severe Error in any Part
+	CaptureErrors
+	// CaptureWarnings also saves messages with any Error in any Part
+	CaptureWarnings
+)
+
+// capturedFields are the header fields whose values are kept when anonymizing a captured message,
+// since the parse depends upon them.
+var capturedFields = map[string]bool{
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+	"Content-Disposition":       true,
+	"Mime-Version":              true,
+}
+
+// filenameParamRegexp matches name and filename parameters, including RFC 2231 continuations, in a
+// header line.  The value is the second submatch.
+var filenameParamRegexp = regexp.MustCompile(
+	`(?i)((?:^|[;\s])(?:file)?name(?:\*[0-9]*)?\*?\s*=\s*)("(?:[^"\\]|\\.)*"|[^;\s]*)`)
+
+// shouldCapture returns true if a message read with error err into the Part tree rooted at root
+// has problems at the Parser's capture level.
+func (ps *Parser) shouldCapture(root *Part, err error) bool {
+	if err != nil {
+		return true
+	}
+	if ps.captureLevel == CaptureFailures {
+		return false
+	}
+	found := false
+	root.Walk(func(p *Part) error {
+		for _, e := range p.Errors {
+			if pe, ok := e.(*Error); ps.captureLevel == CaptureWarnings || ok && pe.Severe {
+				found = true
+				return io.EOF
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// captureFailed passes err, a failure to save a captured message, to the Parser's capture error
+// handler, see WithCaptureErrorHandler.
+func (ps *Parser) captureFailed(err error) {
+	if ps.captureErrors != nil {
+		ps.captureErrors(fmt.Errorf("corpus capture: %w", err))
+	}
+}
+
+// dumpStructure describes the Part tree rooted at root, and the error reading it if any, one Part
+// per line followed by its Errors.
+func dumpStructure(root *Part, perr error) []byte {
+	buf := &bytes.Buffer{}
+	if perr != nil {
+		fmt.Fprintf(buf, "error: %v\n", perr)
+	}
+	root.Walk(func(p *Part) error {
+		fmt.Fprintf(buf, "%v offset %d header %d len %d size %d encoding %q\n", p, p.PartOffset,
+			p.HeaderLen, p.PartLen, p.Size, p.Encoding)
+		for _, e := range p.Errors {
+			fmt.Fprintf(buf, "\t%v\n", e)
+		}
+		for _, s := range p.SkippedRegions {
+			fmt.Fprintf(buf, "\tskipped %d bytes at %d: %v\n", s.Len, s.Offset, s.Reason)
+		}
+		return nil
+	})
+	return buf.Bytes()
+}
+
+// anonymize copies r to w, masking everything the parse does not depend upon while keeping the
+// length and line structure of the input.  Header field names, the values of capturedFields
+// other than filenames, and the delimiters of the boundaries declared by the Content-Type fields
+// read so far are kept.  In everything else letters and non-ASCII bytes become x or X and digits
+// 0, except that quoted-printable escapes are kept so that content still decodes.
+func anonymize(w *bufio.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	var keepValue, midLine bool
+	var ctype []byte        // The unfolded value of the Content-Type field being read, if any
+	var boundaries []string // The boundaries declared by the Content-Type fields read
+	declare := func() {
+		if ctype == nil {
+			return
+		}
+		_, params, _, err := ParseMediaType(string(ctype))
+		if b, _ := Params(params).Param(hpBoundary); err == nil && b != "" {
+			boundaries = append(boundaries, b)
+		}
+		ctype = nil
+	}
+	for {
+		line, err := br.ReadSlice('\n')
+		switch {
+		case midLine:
+			// The rest of an overlong line is treated like its start
+			if ctype != nil {
+				ctype = append(ctype, bytes.TrimRight(line, "\r\n")...)
+			}
+			maskValue(line, keepValue)
+		case len(line) > 0 && (line[0] == ' ' || line[0] == '\t'):
+			if ctype != nil {
+				ctype = append(ctype, bytes.TrimRight(line, "\r\n")...)
+			}
+			maskValue(line, keepValue)
+		default:
+			declare()
+			keepValue = false
+			i := bytes.IndexByte(line, ':')
+			if n := delimiterLen(line, boundaries); n > 0 {
+				mask(line[n:])
+			} else if i > 0 && isFieldName(line[:i]) {
+				name := textproto.CanonicalMIMEHeaderKey(string(line[:i]))
+				if name == hnContentType {
+					ctype = append([]byte{}, bytes.TrimRight(line[i+1:], "\r\n")...)
+				}
+				keepValue = capturedFields[name]
+				maskValue(line[i+1:], keepValue)
+			} else {
+				mask(line)
+			}
+		}
+		if _, werr := w.Write(line); werr != nil {
+			return werr
+		}
+		midLine = err == bufio.ErrBufferFull
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !midLine {
+			return err
+		}
+	}
+}
+
+// delimiterLen returns the length of the delimiter or close delimiter of one of boundaries that
+// line starts with, or 0 if it starts with none.
+func delimiterLen(line []byte, boundaries []string) int {
+	longest := -1
+	for _, b := range boundaries {
+		if len(b) > longest && bytes.HasPrefix(line, []byte("--"+b)) {
+			longest = len(b)
+		}
+	}
+	if longest < 0 {
+		return 0
+	}
+	n := 2 + longest
+	if bytes.HasPrefix(line[n:], []byte("--")) {
+		n += 2
+	}
+	return n
+}
+
+// maskValue masks a header field value, only masking its filenames if keep is true.
+func maskValue(b []byte, keep bool) {
+	if !keep {
+		mask(b)
+		return
+	}
+	for _, m := range filenameParamRegexp.FindAllSubmatchIndex(b, -1) {
+		mask(b[m[4]:m[5]])
+	}
+}
+
+// isFieldName returns true if b is a plausible header field name.
+func isFieldName(b []byte) bool {
+	for _, c := range b {
+		if c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// mask overwrites letters and non-ASCII bytes of b with x or X, and digits with 0, keeping
+// quoted-printable escapes and line endings.
+func mask(b []byte) {
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '=' && i+2 < len(b) && isHex(b[i+1]) && isHex(b[i+2]):
+			i += 2
+		case c >= 'a' && c <= 'z', c >= 0x80:
+			b[i] = 'x'
+		case c >= 'A' && c <= 'Z':
+			b[i] = 'X'
+		case c >= '0' && c <= '9':
+			b[i] = '0'
+		}
+	}
+}
+
+// isHex returns true for upper case hexadecimal digits, as used in quoted-printable escapes.
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'F'
+}
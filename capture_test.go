@@ -0,0 +1,167 @@
+package mime
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// capturedFiles returns the contents of the files in dir by extension, failing unless there is
+// exactly one of each or, if want is false, none.
+func capturedFiles(t *testing.T, dir string, want bool) (eml, txt []byte) {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !want {
+		if len(names) != 0 {
+			t.Fatalf("captured %v, want nothing", names)
+		}
+		return nil, nil
+	}
+	if len(names) != 2 {
+		t.Fatalf("captured %v, want .eml and .txt files", names)
+	}
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch filepath.Ext(name) {
+		case ".eml":
+			eml = b
+		case ".txt":
+			txt = b
+		default:
+			t.Errorf("captured unexpected file %s", name)
+		}
+	}
+	return eml, txt
+}
+
+func TestCorpusCapture(t *testing.T) {
+	clean := "MIME-Version: 1.0\r\nContent-Type: text/plain\r\n\r\nhello"
+	warning := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed\r\n\r\nbody"
+
+	ttable := []struct {
+		raw   string
+		level CaptureLevel
+		want  bool
+	}{
+		{clean, CaptureWarnings, false},
+		{warning, CaptureWarnings, true},
+		{warning, CaptureErrors, false},
+		{warning, CaptureFailures, false},
+	}
+	for _, tt := range ttable {
+		dir, err := ioutil.TempDir("", "mime-capture")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		opt := WithCorpusCapture(dir, tt.level, false)
+		for i := 0; i < 2; i++ {
+			p, err := ReadParts(strings.NewReader(tt.raw), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Close()
+		}
+		eml, txt := capturedFiles(t, dir, tt.want)
+		if !tt.want {
+			continue
+		}
+		if string(eml) != tt.raw {
+			t.Errorf("captured %q, want %q", eml, tt.raw)
+		}
+		if !strings.Contains(string(txt), " <multipart/mixed> offset 0") ||
+			!strings.Contains(string(txt), ErrorMissingBoundary.Error()) {
+			t.Errorf("structure dump:\n%s", txt)
+		}
+	}
+}
+
+func TestCorpusCaptureAnonymize(t *testing.T) {
+	raw := "From: Jane Doe <jane@example.com>\r\n" +
+		"Subject: Salary 2024\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"Sep-1\"\r\n" +
+		"\r\n" +
+		"--Sep-1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=C3=A9 at 10am\r\n" +
+		"--Jane\r\n" + // A signature separator, not a delimiter
+		"--Sep-1\r\n" +
+		"Content-Type: application/pdf;\r\n" +
+		" name=\"payslip.pdf\"\r\n" +
+		"Content-Disposition: attachment; filename*=utf-8''payslip%20Jane.pdf\r\n" +
+		"\r\n" +
+		"%PDF-1.4\r\n" +
+		"--Sep-1\r\n" +
+		"Content-Type: application/\r\n" + // No subtype, which fails to parse
+		"\r\n" +
+		"--Sep-1--\r\n"
+
+	dir, err := ioutil.TempDir("", "mime-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, perr := ReadParts(strings.NewReader(raw), WithCorpusCapture(dir, CaptureFailures, true))
+	if perr == nil {
+		t.Fatal("ReadParts succeeded, want an error")
+	}
+	eml, txt := capturedFiles(t, dir, true)
+
+	if len(eml) != len(raw) {
+		t.Errorf("anonymized to %d bytes, want %d", len(eml), len(raw))
+	}
+	for _, secret := range []string{"Jane", "example", "Salary", "2024", "Caf", "payslip", "10am"} {
+		if bytes.Contains(eml, []byte(secret)) {
+			t.Errorf("anonymized message contains %q:\n%s", secret, eml)
+		}
+	}
+	for _, kept := range []string{"From:", "--Sep-1\r\n", "--Sep-1--\r\n", "quoted-printable",
+		"=C3=A9", "--Xxxx\r\n"} {
+		if !bytes.Contains(eml, []byte(kept)) {
+			t.Errorf("anonymized message lacks %q:\n%s", kept, eml)
+		}
+	}
+
+	// The anonymized message fails to parse in the same way
+	first := strings.SplitN(string(txt), "\n", 2)[0]
+	if !strings.HasPrefix(first, "error: ") || !strings.HasSuffix(perr.Error(), first[7:]) {
+		t.Errorf("structure dump:\n%s\nwant error %v", txt, perr)
+	}
+	if _, err := ReadParts(bytes.NewReader(eml)); err == nil || err.Error() != perr.Error() {
+		t.Errorf("anonymized message read with error %v, want %v", err, perr)
+	}
+}
+
+func TestCorpusCaptureErrorHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mime-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var errs []error
+	missing := filepath.Join(dir, "missing")
+	p, err := ReadParts(strings.NewReader("Content-Type: multipart/mixed\r\n\r\nbody"),
+		WithCorpusCapture(missing, CaptureWarnings, false),
+		WithCaptureErrorHandler(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	if len(errs) != 1 || !os.IsNotExist(errors.Unwrap(errs[0])) {
+		t.Errorf("capture errors %v, want one for the missing directory", errs)
+	}
+}
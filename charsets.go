@@ -1,10 +1,8 @@
 package mime
 
 import (
-	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"regexp"
 	"strings"
 
@@ -15,7 +13,6 @@ import (
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/traditionalchinese"
 	"golang.org/x/text/encoding/unicode"
-	"golang.org/x/text/transform"
 )
 
 /* copy from golang.org/x/net/html/charset/table.go */
@@ -275,9 +272,7 @@ func convertToUTF8String(charset string, textBytes []byte) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("Unsupported charset %q", charset)
 	}
-	input := bytes.NewReader(textBytes)
-	reader := transform.NewReader(input, csentry.e.NewDecoder())
-	output, err := ioutil.ReadAll(reader)
+	output, err := csentry.e.NewDecoder().Bytes(textBytes)
 	if err != nil {
 		return "", err
 	}
@@ -289,6 +284,12 @@ func convertToUTF8String(charset string, textBytes []byte) (string, error) {
 //
 // This function is similar to: https://godoc.org/golang.org/x/net/html/charset#NewReaderLabel
 func newCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	return newCharsetReaderSize(charset, input, 0)
+}
+
+// newCharsetReaderSize is newCharsetReader with buffers sized for sizeHint bytes of input, or the
+// default size if sizeHint is 0.
+func newCharsetReaderSize(charset string, input io.Reader, sizeHint int) (io.Reader, error) {
 	if strings.ToLower(charset) == "utf-8" {
 		return input, nil
 	}
@@ -296,7 +297,7 @@ func newCharsetReader(charset string, input io.Reader) (io.Reader, error) {
 	if !ok {
 		return nil, fmt.Errorf("Unsupported charset %q", charset)
 	}
-	return transform.NewReader(input, csentry.e.NewDecoder()), nil
+	return newTransformReader(input, csentry.e.NewDecoder(), sizeHint), nil
 }
 
 // Look for charset in the html meta tag (v4.01 and v5)
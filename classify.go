@@ -0,0 +1,213 @@
+package mime
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// partKind is the role a leaf Part plays in its message, see classifyParts.
+type partKind int
+
+const (
+	partBody       partKind = iota // The text/plain or text/html body of the message
+	partInline                     // Displayed within, or referenced by, the body
+	partAttachment                 // Offered to the reader separately from the body
+	partOther                      // Anything else, e.g. signatures or calendar control parts
+)
+
+// classifyParts calls fn for each leaf Part of the tree rooted at root, in tree order, with its
+// partKind.  Attachments are classified as a whole; the content of an attached message is not
+// visited.  The first text/plain and first text/html Parts that are not attachments are the body.
+func classifyParts(root *Part, fn func(p *Part, kind partKind)) {
+	var plain, html bool
+	var walk func(p *Part)
+	walk = func(p *Part) {
+		switch {
+		case p.isAttachment():
+			fn(p, partAttachment)
+		case len(p.Subparts) > 0:
+			for _, s := range p.Subparts {
+				walk(s)
+			}
+		case p.isSignature():
+			fn(p, partOther)
+		case p.ContentType == ctTextPlain && !plain:
+			plain = true
+			fn(p, partBody)
+		case p.ContentType == ctTextHTML && !html:
+			html = true
+			fn(p, partBody)
+		case p.Disposition == cdInline || p.ContentID != "":
+			fn(p, partInline)
+		default:
+			fn(p, partOther)
+		}
+	}
+	walk(root)
+}
+
+// isAttachment implements the attachment test described by Attachments.  The signature of a
+// multipart/signed Part is never an attachment.
+func (p *Part) isAttachment() bool {
+	if p.boundary != "" || strings.HasPrefix(p.ContentType, ctMultipartPrefix) || p.isSignature() {
+		return false
+	}
+	switch {
+	case p.Disposition == cdAttachment:
+		return true
+	case p.Disposition == cdInline:
+		return false
+	case p.Filename != "":
+		return true
+	}
+	return p.ContentID == "" && !strings.HasPrefix(p.ContentType, "text/") &&
+		p.ContentType != ContentTypeMessageRfc822
+}
+
+// isSignature returns true for the second, signature, Part of a multipart/signed Part.
+func (p *Part) isSignature() bool {
+	return p.Parent != nil && p.Parent.ContentType == ctMultipartSigned &&
+		len(p.Parent.Subparts) > 1 && p.Parent.Subparts[1] == p
+}
+
+// Body returns the decoded content of the body of the message rooted at root with the media type
+// mediatype, such as "text/html", or nil if it has none.  Attachments and attached messages are
+// not searched.  Of the alternatives of a multipart/alternative Part the last with a match is
+// chosen, as RFC 2046 orders them by preference, and of a multipart/related Part only its root
+// per RFC 2387 is searched.  A body that cannot be decoded is nil unless the Parser was configured
+// with WithBestEffortDecode.
+func Body(root *Part, mediatype string) io.Reader {
+	p := findBody(root, strings.ToLower(mediatype))
+	if p == nil {
+		return nil
+	}
+	r, _ := p.Decode()
+	return r
+}
+
+// findBody returns the body Part with the lowercase media type mediatype in the tree rooted at p,
+// see Body.
+func findBody(p *Part, mediatype string) *Part {
+	if p.isAttachment() || p.isSignature() ||
+		p.Parent != nil && p.ContentType == ContentTypeMessageRfc822 {
+		return nil
+	}
+	switch {
+	case len(p.Subparts) == 0:
+		if p.ContentType == mediatype {
+			return p
+		}
+		return nil
+	case p.ContentType == ctMultipartAltern:
+		for i := len(p.Subparts) - 1; i >= 0; i-- {
+			if b := findBody(p.Subparts[i], mediatype); b != nil {
+				return b
+			}
+		}
+		return nil
+	case p.ContentType == ctMultipartRelated:
+		return findBody(p.relatedRoot(), mediatype)
+	}
+	for _, s := range p.Subparts {
+		if b := findBody(s, mediatype); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// relatedRoot returns the root of a multipart/related Part: the Subpart with the Content-ID
+// named by its start parameter, otherwise the first Subpart.
+func (p *Part) relatedRoot() *Part {
+	if start, ok := p.ContentParam("start"); ok {
+		id := parseContentID(start)
+		for _, s := range p.Subparts {
+			if s.ContentID == id {
+				return s
+			}
+		}
+	}
+	return p.Subparts[0]
+}
+
+// OtherParts returns the leaf Parts of the tree rooted at root that are neither a body, inline nor
+// an attachment, such as the signature of a multipart/signed Part, calendar control parts or
+// further text, so that high level consumers need not drop them silently.
+func OtherParts(root *Part) []*Part {
+	var parts []*Part
+	classifyParts(root, func(p *Part, kind partKind) {
+		if kind == partOther {
+			parts = append(parts, p)
+		}
+	})
+	return parts
+}
+
+// InlineInfo describes an inline Part.
+type InlineInfo struct {
+	Part       *Part
+	ContentID  string // ContentID of the Part, "" if it has none
+	Referenced bool   // The HTML body refers to the Part with a cid: URL, per RFC 2392
+}
+
+// Inlines returns the inline Parts of the tree rooted at root, in tree order.  A Part is inline if
+// it is not the body nor an attachment, and either has a Content-Disposition of inline or a
+// Content-ID.  Referenced is found by scanning the decoded HTML body, so inline Parts the body
+// does not display, often left behind by editing a message, can be cleaned up.
+func Inlines(root *Part) []InlineInfo {
+	var inlines []InlineInfo
+	var html *Part
+	classifyParts(root, func(p *Part, kind partKind) {
+		switch {
+		case kind == partInline:
+			inlines = append(inlines, InlineInfo{Part: p, ContentID: p.ContentID})
+		case kind == partBody && p.ContentType == ctTextHTML:
+			html = p
+		}
+	})
+	if html == nil || len(inlines) == 0 {
+		return inlines
+	}
+
+	refs := html.cidReferences()
+	for i := range inlines {
+		if id := inlines[i].ContentID; id != "" {
+			inlines[i].Referenced = refs[strings.ToLower(id)]
+		}
+	}
+	return inlines
+}
+
+// cidReferences returns the set of Content-IDs referred to by cid: URLs in the Part's decoded
+// content, lowercased.
+func (p *Part) cidReferences() map[string]bool {
+	refs := make(map[string]bool)
+	r, err := p.Decode()
+	if err != nil {
+		return refs
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return refs
+	}
+	lower := strings.ToLower(string(content))
+	for {
+		i := strings.Index(lower, "cid:")
+		if i == -1 {
+			break
+		}
+		lower = lower[i+len("cid:"):]
+		end := strings.IndexAny(lower, "\"'<>() \t\r\n;,")
+		if end == -1 {
+			end = len(lower)
+		}
+		id := lower[:end]
+		if unescaped, err := url.PathUnescape(id); err == nil {
+			id = unescaped
+		}
+		refs[parseContentID(id)] = true
+	}
+	return refs
+}
@@ -0,0 +1,145 @@
+package mime
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestClassifyParts(t *testing.T) {
+	raw := "Content-Type: multipart/signed; boundary=s; protocol=\"application/pgp-signature\"\r\n\r\n" +
+		"--s\r\nContent-Type: multipart/mixed; boundary=m\r\n\r\n" +
+		"--m\r\nContent-Type: multipart/alternative; boundary=a\r\n\r\n" +
+		"--a\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--a\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+		"--a\r\nContent-Type: text/calendar; method=REQUEST\r\n\r\nBEGIN:VCALENDAR\r\n" +
+		"--a--\r\n" +
+		"\r\n--m\r\nContent-Type: image/png\r\nContent-ID: <img@x>\r\n\r\npng\r\n" +
+		"--m\r\nContent-Type: text/plain\r\nContent-Disposition: inline\r\n\r\nfooter\r\n" +
+		"--m\r\nContent-Type: application/pdf; name=a.pdf\r\n\r\npdf\r\n" +
+		"--m\r\nContent-Type: message/delivery-status\r\n\r\nStatus: 5.0.0\r\n" +
+		"--m\r\nContent-Type: text/x-vcard\r\n\r\nBEGIN:VCARD\r\n" +
+		"--m--\r\n" +
+		"\r\n--s\r\nContent-Type: application/pgp-signature; name=signature.asc\r\n\r\nsig\r\n" +
+		"--s--\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"1.1.1 body",
+		"1.1.2 body",
+		"1.1.3 other",
+		"1.2 inline",
+		"1.3 inline",
+		"1.4 attachment",
+		"1.5 attachment",
+		"1.6 other",
+		"2 other",
+	}
+	names := map[partKind]string{
+		partBody:       "body",
+		partInline:     "inline",
+		partAttachment: "attachment",
+		partOther:      "other",
+	}
+	var got []string
+	classifyParts(p, func(p *Part, kind partKind) {
+		got = append(got, p.Descriptor+" "+names[kind])
+	})
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("classified:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var others []string
+	for _, o := range OtherParts(p) {
+		others = append(others, o.Descriptor)
+	}
+	if got, want := strings.Join(others, " "), "1.1.3 1.6 2"; got != want {
+		t.Errorf("OtherParts() == %s, want %s", got, want)
+	}
+}
+
+func TestInlines(t *testing.T) {
+	raw := "Content-Type: multipart/related; boundary=r\r\n\r\n" +
+		"--r\r\nContent-Type: text/html\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"<img src=3D\"cid:Logo@Example.com\"><img src=3D'CID:chart%40example.com'>\r\n" +
+		"--r\r\nContent-Type: image/png\r\nContent-ID: <logo@example.com>\r\n\r\nlogo\r\n" +
+		"--r\r\nContent-Type: image/png\r\nContent-ID: <chart@example.com>\r\n\r\nchart\r\n" +
+		"--r\r\nContent-Type: image/png\r\nContent-ID: <orphan@example.com>\r\n\r\norphan\r\n" +
+		"--r\r\nContent-Type: image/gif\r\nContent-Disposition: inline\r\n\r\nspacer\r\n" +
+		"--r--\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InlineInfo{
+		{ContentID: "logo@example.com", Referenced: true},
+		{ContentID: "chart@example.com", Referenced: true},
+		{ContentID: "orphan@example.com"},
+		{},
+	}
+	got := Inlines(p)
+	if len(got) != len(want) {
+		t.Fatalf("got %d inlines, want %d: %+v", len(got), len(want), got)
+	}
+	for i, g := range got {
+		if g.ContentID != want[i].ContentID || g.Referenced != want[i].Referenced {
+			t.Errorf("%v: got ContentID %q, Referenced %v, want %q, %v", g.Part, g.ContentID,
+				g.Referenced, want[i].ContentID, want[i].Referenced)
+		}
+		if g.Part != p.Subparts[i+1] {
+			t.Errorf("got Part %v, want %v", g.Part, p.Subparts[i+1])
+		}
+	}
+}
+
+func TestBody(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=m\r\n\r\n" +
+		"--m\r\nContent-Type: multipart/alternative; boundary=a\r\n\r\n" +
+		"--a\r\nContent-Type: text/plain\r\n\r\nfirst plain\r\n" +
+		"--a\r\nContent-Type: multipart/related; boundary=r; start=\"<body@x>\"\r\n\r\n" +
+		"--r\r\nContent-Type: text/html\r\nContent-ID: <fragment@x>\r\n\r\n<p>fragment</p>\r\n" +
+		"--r\r\nContent-Type: text/html\r\nContent-ID: <body@x>\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n<p>caf=C3=A9</p>\r\n" +
+		"--r--\r\n" +
+		"\r\n--a\r\nContent-Type: text/plain\r\n\r\npreferred plain\r\n" +
+		"--a--\r\n" +
+		"\r\n--m\r\nContent-Type: text/html; name=page.html\r\n\r\n<p>attached</p>\r\n" +
+		"--m\r\nContent-Type: message/rfc822\r\n\r\n" +
+		"Content-Type: text/calendar\r\n\r\nBEGIN:VCALENDAR\r\n" +
+		"--m--\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttable := []struct {
+		mediatype, want string
+		found           bool
+	}{
+		{"text/html", "<p>café</p>", true},
+		{"TEXT/PLAIN", "preferred plain", true},
+		{"text/calendar", "", false},
+		{"image/png", "", false},
+	}
+	for _, tt := range ttable {
+		r := Body(p, tt.mediatype)
+		if r == nil {
+			if tt.found {
+				t.Errorf("Body(%q) == nil", tt.mediatype)
+			}
+			continue
+		}
+		if !tt.found {
+			t.Errorf("Body(%q) != nil", tt.mediatype)
+			continue
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil || string(b) != tt.want {
+			t.Errorf("Body(%q) read %q, %v, want %q", tt.mediatype, b, err, tt.want)
+		}
+	}
+}
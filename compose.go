@@ -0,0 +1,129 @@
+package mime
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NewLeafPart returns a Part with content, for composing a Part tree by hand where the layout
+// Builder chooses does not suit, such as a multipart/report, see Compose.  contentType is the
+// value of its Content-Type header, e.g. "text/plain; charset=iso-8859-1", and content is in the
+// charset that names; text has its line endings converted to CRLF.  Text without a charset
+// parameter is labeled us-ascii or utf-8 to suit its content, and is an error if it is neither.
+// encoding is the Content-Transfer-Encoding, one of 7bit, 8bit, binary, quoted-printable or
+// base64, or "" to send the content as 7bit if possible, otherwise as quoted-printable for text
+// and base64 for anything else.  Content that 7bit or 8bit cannot represent is an error wrapping
+// ErrorContentEncoding.  Further header fields may be set with SetHeader.
+func NewLeafPart(contentType string, content []byte, encoding string) (*Part, error) {
+	mediatype, params, err := parseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	if strings.HasPrefix(mediatype, ctMultipartPrefix) {
+		return nil, fmt.Errorf("content type %q is not a leaf type", contentType)
+	}
+	if strings.HasPrefix(mediatype, "text/") {
+		content = normalizeNewlines(content)
+		if params[hpCharset] == "" {
+			if params[hpCharset], err = textCharset(content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	encoding = strings.ToLower(encoding)
+	switch encoding {
+	case "":
+		switch {
+		case representable("7bit", content):
+			encoding = "7bit"
+		case strings.HasPrefix(mediatype, "text/"):
+			encoding = "quoted-printable"
+		default:
+			encoding = "base64"
+		}
+	case "7bit", "8bit", "binary", "quoted-printable", "base64":
+		if !representable(encoding, content) {
+			return nil, fmt.Errorf("%w: content cannot be represented as %s",
+				ErrorContentEncoding, encoding)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unrecognized Content-Transfer-Encoding type %q",
+			ErrorContentEncoding, encoding)
+	}
+
+	p := NewPart(nil)
+	if err := p.setContentType(mediatype, params); err != nil {
+		return nil, err
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	if err := p.setContent(encoding, content); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewMultipartPart returns a multipart Part containing parts, see Compose.  contentType is the
+// value of its Content-Type header, e.g. "multipart/report; report-type=delivery-status", to which
+// a generated boundary is added unless it has one.
+func NewMultipartPart(contentType string, parts ...*Part) (*Part, error) {
+	mediatype, params, err := parseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	if !strings.HasPrefix(mediatype, ctMultipartPrefix) {
+		return nil, fmt.Errorf("content type %q is not a multipart type", contentType)
+	}
+	if params[hpBoundary] == "" {
+		if params[hpBoundary], err = randomBoundary(); err != nil {
+			return nil, err
+		}
+	}
+
+	p := NewPart(nil)
+	if err := p.setContentType(mediatype, params); err != nil {
+		return nil, err
+	}
+	p.boundary = params[hpBoundary]
+	for _, s := range parts {
+		s.Parent = p
+		p.Subparts = append(p.Subparts, s)
+	}
+	return p, nil
+}
+
+// NewAttachmentPart reads r to completion, returning a Part holding its content as an attachment
+// named filename, see Compose.  When contentType is empty it is detected from the content and
+// filename extension.  Attachments are always base64 encoded.
+func NewAttachmentPart(r io.Reader, filename, contentType string) (*Part, error) {
+	a, err := newAttachment(r, filename, contentType, cdAttachment)
+	if err != nil {
+		return nil, err
+	}
+	return NewBuilder().attachmentPart(a)
+}
+
+// Compose finishes the Part tree rooted at root, assembled from Parts made with NewLeafPart,
+// NewMultipartPart and NewAttachmentPart, as a message: MIME-Version is added to the root's header
+// if it is missing, Descriptors are numbered as when parsing, and content is transfer encoded.
+// Encode then writes the message with its header fields folded, and Read, Decode and the like
+// behave as for a parsed message.  Parts changed afterwards must be composed again.
+func Compose(root *Part) error {
+	if root.Header.Get(hnMIMEVersion) == "" {
+		if err := root.SetHeader(hnMIMEVersion, "1.0"); err != nil {
+			return err
+		}
+	}
+	root.MIMEVersion, root.HasMIMEVersion = parseMIMEVersion(root.Header)
+	if root.boundary != "" {
+		root.Descriptor = "0"
+		setDescriptors(root, "")
+	}
+	root.Walk(func(p *Part) error {
+		p.InvalidateIndex()
+		return nil
+	})
+	return root.finishBuilt()
+}
@@ -0,0 +1,96 @@
+package mime
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	text, err := NewLeafPart("text/plain; charset=iso-8859-1", []byte("Caf\xe9\nclosed"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := NewLeafPart("message/delivery-status",
+		[]byte("Reporting-MTA: dns; mx.example.com\r\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachment, err := NewAttachmentPart(strings.NewReader("%PDF-1.4"), "report.pdf", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := NewMultipartPart("multipart/report; report-type=delivery-status",
+		text, status, attachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.SetHeader("Subject", "Undelivered Mail"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Compose(root); err != nil {
+		t.Fatal(err)
+	}
+	if !root.HasMIMEVersion || root.Descriptor != "0" || attachment.Descriptor != "3" {
+		t.Errorf("got MIME-Version %v, Descriptors %q and %q", root.HasMIMEVersion,
+			root.Descriptor, attachment.Descriptor)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadParts(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	p.Walk(func(s *Part) error {
+		got = append(got, s.Descriptor+" "+s.ContentType+" "+s.Header.Get(hnContentEncoding)+" "+
+			s.Filename)
+		return nil
+	})
+	want := []string{
+		"0 multipart/report  ",
+		"1 text/plain quoted-printable ",
+		"2 message/delivery-status 7bit ",
+		"3 application/pdf base64 report.pdf",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("composed message:\n%s\nwant:\n%s", strings.Join(got, "\n"),
+			strings.Join(want, "\n"))
+	}
+	if v, _ := p.ContentParam("report-type"); v != "delivery-status" || len(p.Errors) != 0 {
+		t.Errorf("got report-type %q, Errors %v", v, p.Errors)
+	}
+	r, err := p.Subparts[0].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(r); string(content) != "Café\r\nclosed" {
+		t.Errorf("decoded text %q, want %q", content, "Café\r\nclosed")
+	}
+
+	if _, err := NewLeafPart("text/plain", []byte("a\x00b"), "8bit"); !errors.Is(
+		err, ErrorContentEncoding) {
+		t.Errorf("NewLeafPart() error %v, want %v", err, ErrorContentEncoding)
+	}
+	utf8Text, err := NewLeafPart("text/plain", []byte("Café"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utf8Text.Charset != "utf-8" {
+		t.Errorf("NewLeafPart() got charset %q, want utf-8", utf8Text.Charset)
+	}
+	if _, err := NewLeafPart("text/plain", []byte("Caf\xe9"), ""); err == nil {
+		t.Error("NewLeafPart() succeeded for 8-bit text without a charset")
+	}
+	if _, err := NewLeafPart("multipart/mixed", nil, ""); err == nil {
+		t.Error("NewLeafPart() succeeded for a multipart type")
+	}
+	if _, err := NewMultipartPart("text/plain"); err == nil {
+		t.Error("NewMultipartPart() succeeded for a leaf type")
+	}
+}
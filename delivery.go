@@ -0,0 +1,76 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+)
+
+// deliveryFields are the trace and envelope fields MTAs and delivery agents prepend to a message
+// in transit, as opposed to those its author's client wrote.
+var deliveryFields = map[string]bool{
+	"Return-Path":            true, // RFC 5321
+	"Received":               true,
+	hnReceivedSPF:            true, // RFC 7208
+	"Authentication-Results": true, // RFC 8601
+	"Delivered-To":           true, // Postfix, qmail, Dovecot
+	"X-Original-To":          true, // Postfix
+	"Envelope-To":            true, // Exim
+	"X-Envelope-From":        true,
+	"X-Envelope-To":          true,
+}
+
+// DeliveryHeaders is the block of delivery fields at the top of a message, see
+// SplitDeliveryHeaders.
+type DeliveryHeaders struct {
+	Fields []HeaderField // Topmost, and so most recently added, first
+	Raw    []byte        // The block exactly as it appeared, folding and line endings included
+}
+
+// SplitDeliveryHeaders separates the delivery fields prepended to the message in r by the servers
+// that transported it, Return-Path, Received, Delivered-To and the like, from the header fields of
+// the original message, so that a queue processor may strip or rewrite one without disturbing the
+// other.  The delivery block is the run of such fields at the top of the message; delivery fields
+// below the first other field, e.g. Received fields added before the message was re-sent, belong
+// to the message.  The returned reader yields the rest of r from the first field of the original
+// message, unmodified.
+func SplitDeliveryHeaders(r io.Reader) (*DeliveryHeaders, io.Reader, error) {
+	br := bufio.NewReader(r)
+	d := &DeliveryHeaders{}
+	var next []byte // First line of the message, read past the end of the block
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, fmt.Errorf("error reading delivery headers: %w", err)
+		}
+		if len(line) == 0 {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(d.Raw) > 0 {
+				// Continuation of a delivery field
+				d.Raw = append(d.Raw, line...)
+				continue
+			}
+		} else if i := bytes.IndexByte(line, ':'); i > 0 {
+			name := textproto.CanonicalMIMEHeaderKey(string(textproto.TrimBytes(line[:i])))
+			if deliveryFields[name] {
+				d.Raw = append(d.Raw, line...)
+				continue
+			}
+		}
+		next = line
+		break
+	}
+
+	if len(d.Raw) > 0 {
+		fields, _, err := ReadHeader(bytes.NewReader(d.Raw))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading delivery headers: %w", err)
+		}
+		d.Fields = fields
+	}
+	return d, io.MultiReader(bytes.NewReader(next), br), nil
+}
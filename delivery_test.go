@@ -0,0 +1,47 @@
+package mime
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSplitDeliveryHeaders(t *testing.T) {
+	delivery := "Return-Path: <a@example.com>\r\nDelivered-To: b@example.org\r\n" +
+		"Received: from mta.example.com\r\n\tby mx.example.org; Mon, 2 Jan 2006 15:04:05 +0000\r\n" +
+		"received-spf: pass client-ip=192.0.2.1\r\n"
+	message := "From: a@example.com\r\nReceived: from client\r\nSubject: hi\r\n\r\nbody\r\n"
+	ttable := []struct {
+		name, delivery, message string
+		fields                  []string
+	}{
+		{"both", delivery, message, []string{
+			"Return-Path: <a@example.com>",
+			"Delivered-To: b@example.org",
+			"Received: from mta.example.com by mx.example.org; Mon, 2 Jan 2006 15:04:05 +0000",
+			"Received-Spf: pass client-ip=192.0.2.1",
+		}},
+		{"no delivery headers", "", message, nil},
+		{"only delivery headers", "Received: from mta\n", "", []string{"Received: from mta"}},
+		{"leading continuation", "", " folded\r\nSubject: hi\r\n\r\n", nil},
+	}
+	for _, tt := range ttable {
+		d, r, err := SplitDeliveryHeaders(strings.NewReader(tt.delivery + tt.message))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(d.Raw) != tt.delivery {
+			t.Errorf("%s: got Raw %q, want %q", tt.name, d.Raw, tt.delivery)
+		}
+		var fields []string
+		for _, f := range d.Fields {
+			fields = append(fields, f.Name+": "+f.Value)
+		}
+		if strings.Join(fields, "\n") != strings.Join(tt.fields, "\n") {
+			t.Errorf("%s: got Fields %q, want %q", tt.name, fields, tt.fields)
+		}
+		if rest, _ := ioutil.ReadAll(r); string(rest) != tt.message {
+			t.Errorf("%s: got message %q, want %q", tt.name, rest, tt.message)
+		}
+	}
+}
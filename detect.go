@@ -1,7 +1,11 @@
 package mime
 
 import (
+	"encoding/binary"
+	"mime"
+	"net/http"
 	"net/textproto"
+	"path/filepath"
 	"strings"
 )
 
@@ -81,3 +85,52 @@ func detectBinaryBody(root *Part) bool {
 
 	return isBin
 }
+
+// executableMagic maps the leading bytes of executable formats http.DetectContentType does not
+// recognize to their media types.  Windows executables are checked by detectPE.
+var executableMagic = []struct {
+	magic, ctype string
+}{
+	{"\x7fELF", "application/x-executable"},
+	{"\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{"\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{"\xca\xfe\xba\xbe", "application/x-mach-binary"},
+	{"#!", ctTextScript},
+}
+
+// detectPE returns true if content begins with an MZ header whose PE header offset is plausible,
+// and points at a PE signature if that lies within content.
+func detectPE(content []byte) bool {
+	if len(content) < 0x40 || content[0] != 'M' || content[1] != 'Z' {
+		return false
+	}
+	off := int(binary.LittleEndian.Uint32(content[0x3c:]))
+	if off < 0x40 || off > 0x1000 {
+		// Text that happens to start with "MZ" gives huge offsets
+		return false
+	}
+	return off+4 > len(content) || string(content[off:off+4]) == "PE\x00\x00"
+}
+
+// detectContentType sniffs the media type of content, preferring the type registered for the
+// filename extension when sniffing only yields a generic result.
+func detectContentType(filename string, content []byte) string {
+	if detectPE(content) {
+		return ctAppExecutable
+	}
+	for _, e := range executableMagic {
+		if strings.HasPrefix(string(content), e.magic) {
+			return e.ctype
+		}
+	}
+	if detectCalendar(content) {
+		return ctTextCalendar
+	}
+	ctype := http.DetectContentType(content)
+	if strings.HasPrefix(ctype, ctAppOctetStream) || strings.HasPrefix(ctype, ctTextPlain) {
+		if t := mime.TypeByExtension(filepath.Ext(filename)); t != "" {
+			return t
+		}
+	}
+	return ctype
+}
@@ -167,3 +167,26 @@ func TestDetectTextHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestDetectExecutableContent(t *testing.T) {
+	notPE := peExecutable()
+	notPE[0x3c] = 0xff
+	notPE[0x3d] = 0xff
+	ttable := []struct {
+		filename, content, want string
+	}{
+		{"a.pdf", string(peExecutable()), ctAppExecutable},
+		{"a.bin", string(peExecutable()[:0x40]), ctAppExecutable},
+		{"a.bin", string(notPE), ctAppOctetStream},
+		{"a", "\x7fELF\x02\x01\x01", "application/x-executable"},
+		{"a", "\xcf\xfa\xed\xfe\x07\x00", "application/x-mach-binary"},
+		{"a", "#!/usr/bin/env python\n", "text/x-script"},
+		{"a", "MZ is a text file", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range ttable {
+		if got := detectContentType(tt.filename, []byte(tt.content)); got != tt.want {
+			t.Errorf("detectContentType(%q, %q) == %q, want %q", tt.filename, tt.content[:4], got,
+				tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package mime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+)
+
+// Downgrade converts the Part tree rooted at root to a 7bit message, for relaying through SMTP
+// servers without 8BITMIME or SMTPUTF8 support.  Leaf Parts whose content is not 7bit are recoded,
+// see Recode: text as quoted-printable or, when mostly 8-bit, base64, and everything else as
+// base64.  Multipart and message Parts are relabeled 7bit, their content being downgraded in turn.
+// Raw UTF-8 in header fields is encoded: display names in address fields and unstructured text
+// per RFC 2047, and Content-Type and Content-Disposition parameters per RFC 2231.  Domains are
+// converted to IDNA A-labels, and an address with a non-ASCII local part is an error, as it cannot
+// be downgraded.  A preamble or epilogue that is not 7bit is discarded.
+func Downgrade(root *Part) error {
+	err := root.Walk(func(p *Part) error {
+		if err := downgradeHeader(p.Header); err != nil {
+			return fmt.Errorf("%s: %w", p.Descriptor, err)
+		}
+		if p.boundary != "" || len(p.Subparts) > 0 {
+			if !isASCII(string(p.Preamble)) {
+				p.Preamble = nil
+			}
+			if !isASCII(string(p.Epilogue)) {
+				p.Epilogue = nil
+			}
+			if encoding := p.Header.Get(hnContentEncoding); encoding != "" &&
+				!isBinaryToTextEncoding(encoding) {
+				p.Header.Set(hnContentEncoding, "7bit")
+			}
+			return nil
+		}
+		return p.downgradeContent()
+	})
+	if err != nil {
+		return err
+	}
+	if root.Header.Get(hnContentEncoding) != "" && root.Header.Get(hnMIMEVersion) == "" {
+		root.Header.Set(hnMIMEVersion, "1.0")
+	}
+	return nil
+}
+
+// downgradeContent recodes the content of a leaf Part that is not 7bit.
+func (p *Part) downgradeContent() error {
+	encoding := strings.ToLower(p.Header.Get(hnContentEncoding))
+	if isBinaryToTextEncoding(encoding) {
+		return nil
+	}
+	r, err := p.DecodeRaw()
+	if err == ErrNoContent {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.Descriptor, err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.Descriptor, err)
+	}
+
+	switch {
+	case representable("7bit", content):
+		if encoding == "" || encoding == "7bit" {
+			return nil
+		}
+		encoding = "7bit"
+	case strings.HasPrefix(p.ContentType, "text/"):
+		_, encoding = chooseTextEncoding(content)
+	default:
+		encoding = "base64"
+	}
+	return Recode(p, encoding)
+}
+
+// downgradeHeader encodes the raw 8-bit values in header, see Downgrade.
+func downgradeHeader(header textproto.MIMEHeader) error {
+	b := NewBuilder(WithIDNA())
+	for k, vs := range header {
+		key := textproto.CanonicalMIMEHeaderKey(k)
+		for i, v := range vs {
+			if isASCII(v) {
+				continue
+			}
+			var err error
+			switch {
+			case key == hnContentType || key == hnContentDisposition:
+				v, err = downgradeMediaType(v)
+			case addressHeaders[key]:
+				var addrs []*mail.Address
+				if addrs, err = addressParser.ParseList(v); err == nil {
+					v, err = b.formatAddressList(addrs)
+				}
+			default:
+				v = encodeHeaderText(v)
+			}
+			if err != nil {
+				return fmt.Errorf("downgrading %s: %w", key, err)
+			}
+			vs[i] = v
+		}
+	}
+	return nil
+}
+
+// downgradeMediaType re-formats a Content-Type or Content-Disposition value so that non-ASCII
+// parameter values are RFC 2231 encoded.
+func downgradeMediaType(v string) (string, error) {
+	mtype, params, _, err := ParseMediaType(v)
+	if err != nil {
+		return "", err
+	}
+	formatted := mime.FormatMediaType(mtype, params)
+	if formatted == "" {
+		return "", fmt.Errorf("unable to format media type %q", mtype)
+	}
+	return formatted, nil
+}
+
+// encodeHeaderText RFC 2047 encodes unstructured header text containing raw 8-bit bytes.  Text
+// that is not valid UTF-8 is labeled with the RFC 1428 unknown-8bit charset.
+func encodeHeaderText(v string) string {
+	if !utf8.ValidString(v) {
+		return mime.QEncoding.Encode("unknown-8bit", v)
+	}
+	return encodeDisplayName(v)
+}
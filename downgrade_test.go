@@ -0,0 +1,97 @@
+package mime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDowngrade(t *testing.T) {
+	binary := "\x00\x01\xff\xfe\r\n"
+	raw := "From: Jörg <jorg@bücher.example>\r\nSubject: café\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n\r\n" +
+		"préambule\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n" +
+		"café au lait\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: 8bit\r\n\r\n" +
+		"plain\r\n" +
+		"--b\r\nContent-Type: application/octet-stream; name=\"données.bin\"\r\n" +
+		"Content-Transfer-Encoding: binary\r\n\r\n" + binary +
+		"--b\r\nContent-Type: message/rfc822\r\nContent-Transfer-Encoding: 8bit\r\n\r\n" +
+		"Subject: über\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nßtraße\r\n" +
+		"--b--\r\n"
+	root, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Downgrade(root); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !isASCII(buf.String()) {
+		t.Fatalf("downgraded message is not ASCII:\n%s", buf)
+	}
+	p, err := ReadParts(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeHeader(p.Header.Get("Subject")); got != "café" {
+		t.Errorf("Subject %q, want %q", got, "café")
+	}
+	from, err := addressParser.ParseList(p.Header.Get("From"))
+	if err != nil || len(from) != 1 || from[0].Name != "Jörg" ||
+		from[0].Address != "jorg@xn--bcher-kva.example" {
+		t.Errorf("From %v, %v", from, err)
+	}
+	if got := p.Header.Get(hnContentEncoding); got != "7bit" {
+		t.Errorf("multipart Content-Transfer-Encoding %q, want 7bit", got)
+	}
+	if len(p.Preamble) != 0 {
+		t.Errorf("Preamble %q, want none", p.Preamble)
+	}
+	if len(p.Subparts) != 4 {
+		t.Fatalf("got Subparts %v", p.Subparts)
+	}
+
+	ttable := []struct {
+		p              *Part
+		encoding, want string
+	}{
+		{p.Subparts[0], "quoted-printable", "café au lait"},
+		{p.Subparts[1], "7bit", "plain"},
+		{p.Subparts[2], "base64", binary[:len(binary)-2]},
+		{p.Subparts[3].Message(), "quoted-printable", "ßtraße"},
+	}
+	for _, tt := range ttable {
+		if got := tt.p.Header.Get(hnContentEncoding); got != tt.encoding {
+			t.Errorf("%v: Content-Transfer-Encoding %q, want %q", tt.p, got, tt.encoding)
+		}
+		r, err := tt.p.DecodeRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ioutil.ReadAll(r); string(got) != tt.want {
+			t.Errorf("%v: decoded %q, want %q", tt.p, got, tt.want)
+		}
+	}
+	if got, _ := p.Subparts[2].ContentParams.Param("name"); got != "données.bin" {
+		t.Errorf("name %q, want %q", got, "données.bin")
+	}
+	if got := p.Subparts[3].MessageSubject(); got != "über" {
+		t.Errorf("MessageSubject() %q, want %q", got, "über")
+	}
+
+	root, err = ReadParts(strings.NewReader("To: jörg@example.com\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Downgrade(root); err == nil {
+		t.Error("Downgrade succeeded with a non-ASCII local part")
+	}
+}
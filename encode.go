@@ -0,0 +1,308 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxHeaderLineLen is the line length header folding aims for, per RFC 5322 section 2.1.1
+	maxHeaderLineLen = 78
+	// base64LineLen is the maximum length of a base64 encoded line, per RFC 2045 section 6.8
+	base64LineLen = 76
+)
+
+// EncodeOption configures optional Part.Encode behavior.
+type EncodeOption func(*encoder)
+
+// encoder holds the settings for a single call to Encode.
+type encoder struct {
+	headerSigners []HeaderSigner
+	partSigner    PartSigner
+}
+
+// Encode writes the Part, its header and any Subparts to w as RFC 2045 MIME.  Leaf content is
+// written in its transfer encoded form, either as originally parsed or as generated by a Builder.
+func (p *Part) Encode(w io.Writer, opts ...EncodeOption) error {
+	e := &encoder{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.partSigner != nil || len(e.headerSigners) > 0 {
+		return e.encodeSigned(w, p)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := p.encode(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (p *Part) encode(w *bufio.Writer) error {
+	return p.encodeWithHeader(w, p.Header)
+}
+
+// encodeWithHeader writes the Part as encode does, with header in place of its Header.
+func (p *Part) encodeWithHeader(w *bufio.Writer, header textproto.MIMEHeader) error {
+	if err := writeHeader(w, header, p.fieldOrder); err != nil {
+		return err
+	}
+	return p.encodeBody(w)
+}
+
+// encodeBody writes the content following the Part's header block.
+func (p *Part) encodeBody(w *bufio.Writer) error {
+	switch {
+	case p.boundary != "":
+		w.Write(p.encodedPreamble())
+		for i, s := range p.Subparts {
+			if i > 0 {
+				w.WriteString("\r\n")
+			}
+			w.WriteString("--" + p.boundary + "\r\n")
+			if err := s.encode(w); err != nil {
+				return err
+			}
+		}
+		w.WriteString("\r\n--" + p.boundary + "--")
+		if !p.closeNoEOL {
+			w.WriteString("\r\n")
+		}
+		_, err := w.Write(p.Epilogue)
+		return err
+	case p.hasDecodedMessage():
+		content, err := p.reencodeMessage()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	case p.ContentType == ContentTypeMessageRfc822 && len(p.Subparts) == 1:
+		return p.Subparts[0].encode(w)
+	default:
+		_, err := io.Copy(w, p.encodedBody())
+		return err
+	}
+}
+
+// encodedPreamble returns the Preamble as Encode writes it.  A Preamble not ending with a line
+// break, one truncated WithPreambleEpilogueLimit or set so, is given one lest the first delimiter
+// continue its last line and be lost.
+func (p *Part) encodedPreamble() []byte {
+	n := len(p.Preamble)
+	if n == 0 || p.Preamble[n-1] == '\n' {
+		return p.Preamble
+	}
+	return append(p.Preamble[:n:n], '\r', '\n')
+}
+
+// encodedBody returns a fresh reader over the transfer encoded content of a leaf Part.
+func (p *Part) encodedBody() io.Reader {
+	if p.encoded != nil {
+		return bytes.NewReader(p.encoded)
+	}
+	if p.bound != nil {
+		return io.NewSectionReader(p.bound, 0, p.bound.Size())
+	}
+	if p.rawReader != nil {
+		return io.NewSectionReader(
+			p.rawReader, int64(p.PartOffset+p.HeaderLen), int64(p.PartLen-p.HeaderLen))
+	}
+	return bytes.NewReader(nil)
+}
+
+// encodedSize returns the number of bytes Encode would write for the Part, computing transfer
+// encoded lengths without retaining the output.
+func (p *Part) encodedSize() (int64, error) {
+	var size int64
+	for _, f := range orderHeader(p.Header, p.fieldOrder) {
+		size += int64(len(foldHeaderField(f.Name, f.Value)))
+	}
+	size += 2
+
+	switch {
+	case p.boundary != "":
+		delim := int64(len("--"+p.boundary) + 2)
+		for i, s := range p.Subparts {
+			if i > 0 {
+				size += 2
+			}
+			n, err := s.encodedSize()
+			if err != nil {
+				return 0, err
+			}
+			size += delim + n
+		}
+		size += int64(len(p.encodedPreamble())) + 2 + delim + 2 + int64(len(p.Epilogue))
+		if p.closeNoEOL {
+			size -= 2
+		}
+	case p.hasDecodedMessage():
+		content, err := p.reencodeMessage()
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(content))
+	case p.ContentType == ContentTypeMessageRfc822 && len(p.Subparts) == 1:
+		n, err := p.Subparts[0].encodedSize()
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	case p.content != nil:
+		n, err := encodedLen(p.Encoding, p.content)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	case p.encoded != nil:
+		size += int64(len(p.encoded))
+	case p.bound != nil:
+		size += p.bound.Size()
+	default:
+		size += int64(p.PartLen - p.HeaderLen)
+	}
+	return size, nil
+}
+
+// writeHeader writes the header fields in the order given by orderHeader, followed by the blank
+// line terminating the header block.  Fields set directly in the header map, bypassing SetHeader,
+// are checked with checkHeaderInjection before anything is written.
+func writeHeader(w *bufio.Writer, header textproto.MIMEHeader, read []headerField) error {
+	for k, vs := range header {
+		for _, v := range vs {
+			if err := checkHeaderInjection(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range orderHeader(header, read) {
+		w.WriteString(foldHeaderField(f.Name, f.Value))
+	}
+	_, err := w.WriteString("\r\n")
+	return err
+}
+
+// orderHeader returns the fields of header in the order of read, the fields of a parsed Part's
+// header as written, so that trace fields and those covered by DKIM signatures keep their order
+// and spelling.  The values of a name take the places of its fields in turn, and any left over
+// follow sorted by name, as do all the fields of a header that was not parsed.  Values for a
+// repeated field keep their order.
+func orderHeader(header textproto.MIMEHeader, read []headerField) []HeaderField {
+	fields := make([]HeaderField, 0, len(read))
+	used := make(map[string]int, len(header))
+	for _, f := range read {
+		k := textproto.CanonicalMIMEHeaderKey(f.Name)
+		if n := used[k]; n < len(header[k]) {
+			fields = append(fields, HeaderField{Name: f.Name, Value: header[k][n]})
+			used[k] = n + 1
+		}
+	}
+	keys := make([]string, 0, len(header))
+	for k, vs := range header {
+		if used[k] < len(vs) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k][used[k]:] {
+			fields = append(fields, HeaderField{Name: k, Value: v})
+		}
+	}
+	return fields
+}
+
+// foldHeaderField renders a single header field, folding the value at spaces so that lines stay
+// within maxHeaderLineLen where possible.  readHeader unfolds the result back into value.
+func foldHeaderField(name, value string) string {
+	b := &strings.Builder{}
+	b.WriteString(name)
+	b.WriteByte(':')
+	lineLen := len(name) + 1
+	lineHasWord := false
+	for _, word := range strings.Split(value, " ") {
+		if word != "" && lineHasWord && lineLen+1+len(word) > maxHeaderLineLen {
+			b.WriteString("\r\n")
+			lineLen = 0
+		}
+		b.WriteByte(' ')
+		b.WriteString(word)
+		lineLen += 1 + len(word)
+		if word != "" {
+			lineHasWord = true
+		}
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// encodedLen returns the length encodeContent would produce for content.
+func encodedLen(encoding string, content []byte) (int64, error) {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		n := base64.StdEncoding.EncodedLen(len(content))
+		if n == 0 {
+			return 0, nil
+		}
+		// CRLF between each full line
+		return int64(n + 2*((n-1)/base64LineLen)), nil
+	case "quoted-printable":
+		cw := &countingWriter{}
+		qp := quotedprintable.NewWriter(cw)
+		if _, err := qp.Write(content); err != nil {
+			return 0, err
+		}
+		if err := qp.Close(); err != nil {
+			return 0, err
+		}
+		return cw.N, nil
+	default:
+		return int64(len(content)), nil
+	}
+}
+
+// countingWriter discards its input, counting the bytes written.
+type countingWriter struct {
+	N int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.N += int64(len(p))
+	return len(p), nil
+}
+
+// encodeContent applies the named Content-Transfer-Encoding to content.  Identity encodings
+// return content unmodified.
+func encodeContent(encoding string, content []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	switch strings.ToLower(encoding) {
+	case "base64":
+		enc := make([]byte, base64.StdEncoding.EncodedLen(len(content)))
+		base64.StdEncoding.Encode(enc, content)
+		for len(enc) > base64LineLen {
+			buf.Write(enc[:base64LineLen])
+			buf.WriteString("\r\n")
+			enc = enc[base64LineLen:]
+		}
+		buf.Write(enc)
+	case "quoted-printable":
+		qp := quotedprintable.NewWriter(buf)
+		if _, err := qp.Write(content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return content, nil
+	}
+	return buf.Bytes(), nil
+}
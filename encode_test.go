@@ -0,0 +1,202 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFoldHeaderField(t *testing.T) {
+	long := strings.Repeat("word ", 30) + "end"
+	got := foldHeaderField("X-Long", long)
+	for _, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+		if len(line) > maxHeaderLineLen {
+			t.Errorf("line %q exceeds %d characters", line, maxHeaderLineLen)
+		}
+	}
+
+	// readHeader must unfold it back to the original value
+	header, _, err := readHeader(bufio.NewReader(strings.NewReader(got + "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("X-Long") != long {
+		t.Errorf("unfolded == %q, want: %q", header.Get("X-Long"), long)
+	}
+
+	want := "Subject: short\r\n"
+	if got := foldHeaderField("Subject", "short"); got != want {
+		t.Errorf("foldHeaderField == %q, want: %q", got, want)
+	}
+}
+
+func TestEncodeContentBase64LineLength(t *testing.T) {
+	got, err := encodeContent("base64", bytes.Repeat([]byte{0xff}, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(got), "\r\n") {
+		if len(line) > base64LineLen {
+			t.Errorf("line %q exceeds %d characters", line, base64LineLen)
+		}
+	}
+}
+
+// TestEncodeParsedRoundTrip re-encodes parsed messages and checks the structure and content
+// survive a second parse.
+func TestEncodeParsedRoundTrip(t *testing.T) {
+	files := []string{"nestedmulti.raw", "multirfc822.raw", "bin-attach.raw", "textplain.raw"}
+	for _, name := range files {
+		t.Run(name, func(t *testing.T) {
+			raw, err := ioutil.ReadFile(filepath.Join("testdata", "parts", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := ReadParts(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			if err := p.Encode(buf); err != nil {
+				t.Fatal(err)
+			}
+			q, err := ReadParts(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want, got []string
+			walkContent := func(dest *[]string) PartVisitor {
+				return func(p *Part) error {
+					b, err := ioutil.ReadAll(p.encodedBody())
+					if err != nil {
+						return err
+					}
+					if len(p.Subparts) > 0 {
+						b = []byte(string(p.Preamble) + string(p.Epilogue))
+					}
+					*dest = append(*dest, p.Descriptor+" "+p.ContentType+" "+string(b))
+					return nil
+				}
+			}
+			if err := p.Walk(walkContent(&want)); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Walk(walkContent(&got)); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("re-encoded tree:\n%s\nwant:\n%s", strings.Join(got, "\n"),
+					strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestEncodeTruncatedPreambleEpilogue(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=out\r\n\r\n" +
+		"outer preamble\r\n" +
+		"--out\r\nContent-Type: multipart/alternative; boundary=in\r\n\r\n" +
+		"inner preamble\r\n" +
+		"--in\r\nContent-Type: text/plain\r\n\r\nplain\r\n--in--\r\n" +
+		"inner epilogue\r\n" +
+		"--out\r\nContent-Type: text/plain\r\n\r\nattached\r\n--out--\r\n" +
+		"outer epilogue\r\n"
+	p, err := ReadParts(strings.NewReader(raw), WithPreambleEpilogueLimit(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	buf := &bytes.Buffer{}
+	if err := p.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := p.encodedSize(); err != nil || size != int64(buf.Len()) {
+		t.Errorf("encodedSize() == %d, %v, want %d", size, err, buf.Len())
+	}
+	q, err := ReadParts(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	alt := q.Subparts[0]
+	if len(q.Subparts) != 2 || len(alt.Subparts) != 1 || len(q.Errors) != 0 {
+		t.Fatalf("reparsed as %d Subparts, %d alternatives, Errors %v, want 2, 1, none:\n%s",
+			len(q.Subparts), len(alt.Subparts), q.Errors, buf)
+	}
+	for _, tt := range []struct{ name, got, want string }{
+		{"outer Preamble", string(q.Preamble), "outer\r\n"},
+		{"inner Preamble", string(alt.Preamble), "inner\r\n"},
+		{"inner Epilogue", string(alt.Epilogue), "inner"},
+		{"outer Epilogue", string(q.Epilogue), "outer"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s == %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+	checkContent := func(p *Part, want string) {
+		t.Helper()
+		b, err := ioutil.ReadAll(p)
+		if err != nil || string(b) != want {
+			t.Errorf("%v content == %q, %v, want %q", p, b, err, want)
+		}
+	}
+	checkContent(alt.Subparts[0], "plain")
+	checkContent(q.Subparts[1], "attached")
+}
+
+func TestEncodeHeaderFieldOrder(t *testing.T) {
+	raw := "Received: from b by c\r\n" +
+		"DKIM-Signature: v=1; h=subject:from\r\n" +
+		"received: from a by b\r\n" +
+		"Subject: hello\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"From: jane@example.com\r\n" +
+		"X-Spam: yes\r\n" +
+		"\r\n" +
+		"body\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	buf := &bytes.Buffer{}
+	if err := p.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != raw {
+		t.Errorf("Encode() ==\n%s\nwant:\n%s", got, raw)
+	}
+
+	// Set values take the place of the fields they replace, added ones follow
+	p.Header.Set("Subject", "changed")
+	p.Header.Del("X-Spam")
+	p.Header.Add("Received", "from x by a")
+	p.Header.Add("Content-Type", "text/plain")
+	want := "Received: from b by c\r\n" +
+		"DKIM-Signature: v=1; h=subject:from\r\n" +
+		"received: from a by b\r\n" +
+		"Subject: changed\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"From: jane@example.com\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Received: from x by a\r\n" +
+		"\r\n" +
+		"body\r\n"
+	buf.Reset()
+	if err := p.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("Encode() ==\n%s\nwant:\n%s", got, want)
+	}
+	if size, err := p.encodedSize(); err != nil || size != int64(buf.Len()) {
+		t.Errorf("encodedSize() == %d, %v, want %d", size, err, buf.Len())
+	}
+}
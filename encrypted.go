@@ -0,0 +1,176 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// ContainerFormat names a file format DetectEncryption recognizes.
+type ContainerFormat string
+
+// Container formats recognized by DetectEncryption
+const (
+	FormatZIP ContainerFormat = "zip"
+	FormatPDF ContainerFormat = "pdf"
+	Format7z  ContainerFormat = "7z"
+	FormatRAR ContainerFormat = "rar"
+)
+
+var (
+	zipLocalHeaderSig   = []byte("PK\x03\x04")
+	zipCentralHeaderSig = []byte("PK\x01\x02")
+	pdfMagic            = []byte("%PDF-")
+	pdfEncrypt          = []byte("/Encrypt")
+	sevenZipMagic       = []byte("7z\xbc\xaf\x27\x1c")
+	sevenZipAESCoder    = []byte("\x06\xf1\x07\x01") // 7zAES coder ID
+	rar4Magic           = []byte("Rar!\x1a\x07\x00")
+	rar5Magic           = []byte("Rar!\x1a\x07\x01\x00")
+)
+
+const (
+	zipFlagEncrypted      = 0x0001 // General purpose bit 0
+	rar4BlockMain         = 0x73
+	rar4BlockFile         = 0x74
+	rar4MainPassword      = 0x0080 // Block headers are encrypted
+	rar4FilePassword      = 0x0004 // File data is encrypted
+	rar5HeaderEncryption  = 4      // Archive encryption header type
+	encryptionScanBufSize = 32 * 1024
+)
+
+// scanRule matches a signature followed by at least after more bytes, which match examines.
+type scanRule struct {
+	sig   []byte
+	after int
+	match func(rec []byte) bool
+}
+
+// DetectEncryption reads r looking for signs that it is an encrypted container: a ZIP archive
+// with password protected entries, a PDF with an /Encrypt dictionary, or a 7z or RAR archive with
+// encrypted headers or, for 7z and RAR 4, content.  The format is "" if r is not one of those
+// recognized.  These are heuristics, intended for flagging attachments that content scanners
+// will be unable to inspect; ZIP and PDF content is scanned in full, in constant memory.
+func DetectEncryption(r io.Reader) (format ContainerFormat, encrypted bool, err error) {
+	br := bufio.NewReaderSize(r, encryptionScanBufSize)
+	head, err := br.Peek(64)
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	switch {
+	case bytes.HasPrefix(head, zipLocalHeaderSig):
+		zipFlags := func(offset int) func([]byte) bool {
+			return func(rec []byte) bool {
+				return binary.LittleEndian.Uint16(rec[offset:])&zipFlagEncrypted != 0
+			}
+		}
+		encrypted, err = scanStream(br, []scanRule{
+			{sig: zipLocalHeaderSig, after: 4, match: zipFlags(6)},
+			{sig: zipCentralHeaderSig, after: 6, match: zipFlags(8)},
+		})
+		return FormatZIP, encrypted, err
+	case bytes.HasPrefix(head, pdfMagic):
+		encrypted, err = scanStream(br, []scanRule{{sig: pdfEncrypt}})
+		return FormatPDF, encrypted, err
+	case bytes.HasPrefix(head, sevenZipMagic):
+		encrypted, err = scanStream(br, []scanRule{{sig: sevenZipAESCoder}})
+		return Format7z, encrypted, err
+	case bytes.HasPrefix(head, rar5Magic):
+		return FormatRAR, rar5Encrypted(head[len(rar5Magic):]), nil
+	case bytes.HasPrefix(head, rar4Magic):
+		return FormatRAR, rar4Encrypted(head[len(rar4Magic):]), nil
+	}
+	return "", false, nil
+}
+
+// DetectEncryption applies DetectEncryption to the Part's decoded content.
+func (p *Part) DetectEncryption() (format ContainerFormat, encrypted bool, err error) {
+	r, err := p.DecodeRaw()
+	if err != nil {
+		return "", false, err
+	}
+	return DetectEncryption(r)
+}
+
+// scanStream reads r until one of rules matches, returning true, or r is exhausted.  Only as many
+// bytes as the longest rule are carried between reads, so occurrences spanning reads are found.
+func scanStream(r io.Reader, rules []scanRule) (bool, error) {
+	keep := 0
+	for _, rule := range rules {
+		if n := len(rule.sig) + rule.after - 1; n > keep {
+			keep = n
+		}
+	}
+	buf := make([]byte, encryptionScanBufSize+keep)
+	n := 0
+	for {
+		m, err := io.ReadFull(r, buf[n:])
+		n += m
+		atEOF := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !atEOF {
+			return false, err
+		}
+
+		// Records starting before limit are complete, later ones are carried to the next read
+		limit := n - keep
+		if atEOF {
+			limit = n
+		}
+		for _, rule := range rules {
+			for i := 0; i < limit; {
+				j := bytes.Index(buf[i:n], rule.sig)
+				if j == -1 || i+j >= limit {
+					break
+				}
+				i += j
+				end := i + len(rule.sig) + rule.after
+				if end <= n && (rule.match == nil || rule.match(buf[i:end])) {
+					return true, nil
+				}
+				i++
+			}
+		}
+		if atEOF {
+			return false, nil
+		}
+		n = copy(buf, buf[limit:n])
+	}
+}
+
+// rar4Encrypted examines the blocks following a RAR 4 signature for the main header's encrypted
+// headers flag, or the first file header's password flag.
+func rar4Encrypted(b []byte) bool {
+	// Block header: CRC (2), type (1), flags (2), size (2)
+	for i := 0; i < 2 && len(b) >= 7; i++ {
+		flags := binary.LittleEndian.Uint16(b[3:])
+		switch b[2] {
+		case rar4BlockMain:
+			if flags&rar4MainPassword != 0 {
+				return true
+			}
+		case rar4BlockFile:
+			return flags&rar4FilePassword != 0
+		}
+		size := int(binary.LittleEndian.Uint16(b[5:]))
+		if size < 7 || size > len(b) {
+			break
+		}
+		b = b[size:]
+	}
+	return false
+}
+
+// rar5Encrypted returns true if the first block following a RAR 5 signature is an archive
+// encryption header.
+func rar5Encrypted(b []byte) bool {
+	// Block header: CRC32 (4), header size (vint), header type (vint)
+	if len(b) < 4 {
+		return false
+	}
+	b = b[4:]
+	if _, n := binary.Uvarint(b); n > 0 {
+		typ, m := binary.Uvarint(b[n:])
+		return m > 0 && typ == rar5HeaderEncryption
+	}
+	return false
+}
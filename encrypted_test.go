@@ -0,0 +1,104 @@
+package mime
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// zipArchive returns a ZIP archive of a file padded to size bytes, with every entry marked
+// encrypted if encrypted is true.
+func zipArchive(t *testing.T, size int, encrypted bool) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes.Repeat([]byte("x"), size))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if encrypted {
+		// Set general purpose bit 0 in the second local and every central directory header
+		second := bytes.Index(b[1:], zipLocalHeaderSig) + 1
+		b[second+6] |= zipFlagEncrypted
+		for i := 0; ; i++ {
+			j := bytes.Index(b[i:], zipCentralHeaderSig)
+			if j == -1 {
+				break
+			}
+			i += j
+			b[i+8] |= zipFlagEncrypted
+		}
+	}
+	return b
+}
+
+func TestDetectEncryption(t *testing.T) {
+	rar4 := func(mainFlags, fileFlags byte) string {
+		return string(rar4Magic) +
+			"\x00\x00\x73" + string([]byte{mainFlags, 0}) + "\x0d\x00" + "\x00\x00\x00\x00\x00\x00" +
+			"\x00\x00\x74" + string([]byte{fileFlags, 0x80}) + "\x20\x00"
+	}
+	ttable := []struct {
+		name      string
+		content   []byte
+		format    ContainerFormat
+		encrypted bool
+	}{
+		{"zip", zipArchive(t, 10, false), FormatZIP, false},
+		{"encrypted zip", zipArchive(t, 10, true), FormatZIP, true},
+		{"large zip", zipArchive(t, 3*encryptionScanBufSize, false), FormatZIP, false},
+		{"large encrypted zip", zipArchive(t, 3*encryptionScanBufSize, true), FormatZIP, true},
+		{"pdf", []byte("%PDF-1.4\n1 0 obj\n<< >>\ntrailer\n<< /Root 1 0 R >>\n"), FormatPDF, false},
+		{
+			"encrypted pdf",
+			[]byte("%PDF-1.4\n" + strings.Repeat("x", 2*encryptionScanBufSize-4) +
+				"trailer\n<< /Root 1 0 R /Encrypt 5 0 R >>\n"),
+			FormatPDF, true,
+		},
+		{"7z", []byte(string(sevenZipMagic) + "\x00\x04" + strings.Repeat("\x00", 40)), Format7z,
+			false},
+		{
+			"encrypted 7z",
+			[]byte(string(sevenZipMagic) + "\x00\x04" + strings.Repeat("\x00", 40) + "\x24" +
+				string(sevenZipAESCoder)),
+			Format7z, true,
+		},
+		{"rar4", []byte(rar4(0, 0)), FormatRAR, false},
+		{"rar4 encrypted headers", []byte(rar4(0x80, 0)), FormatRAR, true},
+		{"rar4 encrypted file", []byte(rar4(0, 0x04)), FormatRAR, true},
+		{"rar5", []byte(string(rar5Magic) + "\x00\x00\x00\x00\x0c\x01\x00"), FormatRAR, false},
+		{"rar5 encrypted headers", []byte(string(rar5Magic) + "\x00\x00\x00\x00\x0c\x04\x00"),
+			FormatRAR, true},
+		{"text", []byte("hello"), "", false},
+	}
+	for _, tt := range ttable {
+		format, encrypted, err := DetectEncryption(bytes.NewReader(tt.content))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if format != tt.format || encrypted != tt.encrypted {
+			t.Errorf("%s: DetectEncryption() == %q, %v, want %q, %v", tt.name, format, encrypted,
+				tt.format, tt.encrypted)
+		}
+	}
+
+	raw := "Content-Type: application/zip; name=secret.zip\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(zipArchive(t, 10, true))
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format, encrypted, err := p.DetectEncryption(); format != FormatZIP || !encrypted || err != nil {
+		t.Errorf("Part.DetectEncryption() == %q, %v, %v, want %q, true, nil", format, encrypted, err,
+			FormatZIP)
+	}
+}
@@ -0,0 +1,148 @@
+package mime
+
+import (
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ReturnPath returns the address of the Part's topmost Return-Path field, the envelope sender of
+// the message as recorded by the server that delivered it, or "" for the null reverse-path <> of a
+// delivery status notification or other message that must not be bounced, per RFC 5321 section
+// 4.5.5.  Any source route, e.g. <@relay.example.com:a@example.com>, is dropped.  The error is
+// mail.ErrHeaderNotPresent if there is no such field, or an *Error for ErrorMalformedHeader if the
+// value is not an angle-bracketed path.
+func (p *Part) ReturnPath() (string, error) {
+	vs := p.Header["Return-Path"]
+	if len(vs) == 0 {
+		return "", mail.ErrHeaderNotPresent
+	}
+	v := strings.TrimSpace(vs[0])
+	if len(v) < 2 || v[0] != '<' || v[len(v)-1] != '>' {
+		return "", newWarning(ErrorMalformedHeader, "Return-Path %q is not enclosed in <>", v)
+	}
+	path := strings.TrimSpace(v[1 : len(v)-1])
+	if path == "" {
+		return "", nil
+	}
+	if path[0] == '@' {
+		// Obsolete source route, A-d-l ":" Mailbox
+		i := strings.IndexByte(path, ':')
+		if i < 0 {
+			return "", newWarning(ErrorMalformedHeader,
+				"Return-Path %q has a malformed source route", v)
+		}
+		path = path[i+1:]
+	}
+	a, err := mail.ParseAddress("<" + path + ">")
+	if err != nil {
+		return "", newWarning(ErrorMalformedHeader, "Return-Path %q: %v", v, err)
+	}
+	return a.Address, nil
+}
+
+// Sender returns the mailbox of the Part's Sender field, the agent responsible for transmitting
+// the message when it is not the author named by From, with an RFC 2047 encoded display name
+// decoded.  The error is mail.ErrHeaderNotPresent if there is no such field, or an *Error for
+// ErrorMalformedHeader if the value is not a single valid mailbox.
+func (p *Part) Sender() (*mail.Address, error) {
+	v := p.Header.Get("Sender")
+	if v == "" {
+		return nil, mail.ErrHeaderNotPresent
+	}
+	a, err := addressParser.Parse(v)
+	if err != nil {
+		return nil, newWarning(ErrorMalformedHeader, "Sender %q: %v", v, err)
+	}
+	return a, nil
+}
+
+// Envelope is a message reduced to the parts most consumers need, see ReadEnvelope.
+type Envelope struct {
+	Root *Part // Root of the message's Part tree, for anything else
+
+	Subject      string          // RFC 2047 decoded Subject
+	From, To, Cc []*mail.Address // Addresses with decoded display names, nil if absent
+
+	Text string // Decoded text/plain body, see Body, "" if there is none
+	HTML string // Decoded text/html body, "" if there is none
+
+	Attachments []AttachmentInfo
+	Inlines     []InlineInfo
+	OtherParts  []*Part
+
+	// Errors lists the address fields and bodies that could not be parsed or decoded, which are
+	// left empty
+	Errors []error
+}
+
+// ReadEnvelope reads a MIME message from r, returning its Envelope, see Parser.ReadEnvelope.
+func ReadEnvelope(r io.Reader, opts ...Option) (*Envelope, error) {
+	return NewParser(opts...).ReadEnvelope(r)
+}
+
+// ReadEnvelope reads a MIME message from r with ReadParts, returning its Envelope.  The Envelope
+// must be closed to release the message's buffer.
+func (ps *Parser) ReadEnvelope(r io.Reader) (*Envelope, error) {
+	root, err := ps.ReadParts(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvelope(root), nil
+}
+
+// NewEnvelope returns the Envelope of the message rooted at root, decoding its headers and bodies
+// and classifying its other Parts with Attachments, Inlines and OtherParts.
+func NewEnvelope(root *Part) *Envelope {
+	e := &Envelope{
+		Root:        root,
+		Subject:     decodeHeader(root.Header.Get("Subject")),
+		Attachments: Attachments(root),
+		Inlines:     Inlines(root),
+		OtherParts:  OtherParts(root),
+	}
+	e.From = e.addressList(root.Header, "From")
+	e.To = e.addressList(root.Header, "To")
+	e.Cc = e.addressList(root.Header, "Cc")
+	e.Text = e.body(ctTextPlain)
+	e.HTML = e.body(ctTextHTML)
+	return e
+}
+
+// Close closes the message, see Part.Close.
+func (e *Envelope) Close() error {
+	return e.Root.Close()
+}
+
+// addressList returns the addresses of the header field name, recording any error.
+func (e *Envelope) addressList(header textproto.MIMEHeader, name string) []*mail.Address {
+	v := header.Get(name)
+	if v == "" {
+		return nil
+	}
+	addrs, err := addressParser.ParseList(v)
+	if err != nil {
+		e.Errors = append(e.Errors, newWarning(ErrorMalformedHeader, "%s %q: %v", name, v, err))
+		return nil
+	}
+	return addrs
+}
+
+// body returns the decoded body with the media type mediatype, recording any error.
+func (e *Envelope) body(mediatype string) string {
+	p := findBody(e.Root, mediatype)
+	if p == nil {
+		return ""
+	}
+	r, err := p.Decode()
+	if err == nil {
+		var content []byte
+		if content, err = ioutil.ReadAll(r); err == nil {
+			return string(content)
+		}
+	}
+	e.Errors = append(e.Errors, err)
+	return ""
+}
@@ -0,0 +1,100 @@
+package mime
+
+import (
+	"errors"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestReturnPath(t *testing.T) {
+	ttable := []struct {
+		in, want string
+		err      error
+	}{
+		{"<a@example.com>", "a@example.com", nil},
+		{" <\"a.b\"@example.com> ", "a.b@example.com", nil},
+		{"<>", "", nil},
+		{"< >", "", nil},
+		{"<@relay.example.net,@mx.example.org:a@example.com>", "a@example.com", nil},
+		{"a@example.com", "", ErrorMalformedHeader},
+		{"<a>", "", ErrorMalformedHeader},
+		{"<@relay.example.net>", "", ErrorMalformedHeader},
+	}
+	for _, tt := range ttable {
+		p := &Part{Header: textproto.MIMEHeader{"Return-Path": {tt.in, "<b@example.com>"}}}
+		got, err := p.ReturnPath()
+		if got != tt.want || !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("ReturnPath() of %q == %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+	if _, err := (&Part{}).ReturnPath(); err != mail.ErrHeaderNotPresent {
+		t.Errorf("ReturnPath() error %v, want %v", err, mail.ErrHeaderNotPresent)
+	}
+}
+
+func TestSender(t *testing.T) {
+	p := &Part{Header: textproto.MIMEHeader{"Sender": {"=?utf-8?q?List_Bot?= <bot@example.com>"}}}
+	a, err := p.Sender()
+	if err != nil || a.Name != "List Bot" || a.Address != "bot@example.com" {
+		t.Errorf("Sender() == %v, %v", a, err)
+	}
+	p.Header.Set("Sender", "a@example.com, b@example.com")
+	if _, err := p.Sender(); !errors.Is(err, ErrorMalformedHeader) {
+		t.Errorf("Sender() of two mailboxes error %v, want %v", err, ErrorMalformedHeader)
+	}
+	if _, err := (&Part{}).Sender(); err != mail.ErrHeaderNotPresent {
+		t.Errorf("Sender() error %v, want %v", err, mail.ErrHeaderNotPresent)
+	}
+}
+
+func TestReadEnvelope(t *testing.T) {
+	raw := "From: =?utf-8?q?Ren=C3=A9e?= <renee@example.com>\r\nTo: a@example.com, b@example.com\r\n" +
+		"Cc: not an address\r\nSubject: =?utf-8?q?R=C3=A9union?=\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: multipart/related; boundary=r\r\n\r\n" +
+		"--r\r\nContent-Type: multipart/alternative; boundary=a\r\n\r\n" +
+		"--a\r\nContent-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\nR=E9union\r\n" +
+		"--a\r\nContent-Type: text/html\r\n\r\n<img src=\"cid:logo\">\r\n" +
+		"--a--\r\n" +
+		"--r\r\nContent-Type: image/png\r\nContent-ID: <logo>\r\n\r\npng\r\n" +
+		"--r--\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\n" +
+		"Content-Disposition: attachment; filename=agenda.pdf\r\n\r\n%PDF-\r\n" +
+		"--b\r\nContent-Type: text/x-vcard\r\n\r\nBEGIN:VCARD\r\n" +
+		"--b--\r\n"
+	e, err := ReadEnvelope(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if e.Subject != "Réunion" {
+		t.Errorf("Subject == %q, want %q", e.Subject, "Réunion")
+	}
+	if len(e.From) != 1 || e.From[0].Name != "Renée" || len(e.To) != 2 ||
+		e.To[1].Address != "b@example.com" || e.Cc != nil {
+		t.Errorf("got From %v, To %v, Cc %v", e.From, e.To, e.Cc)
+	}
+	if len(e.Errors) != 1 || !errors.Is(e.Errors[0], ErrorMalformedHeader) {
+		t.Errorf("got Errors %v, want a malformed Cc", e.Errors)
+	}
+	if e.Text != "Réunion" || e.HTML != "<img src=\"cid:logo\">" {
+		t.Errorf("got Text %q, HTML %q", e.Text, e.HTML)
+	}
+	if len(e.Attachments) != 1 || e.Attachments[0].Filename != "agenda.pdf" {
+		t.Errorf("got Attachments %+v", e.Attachments)
+	}
+	if len(e.Inlines) != 1 || !e.Inlines[0].Referenced {
+		t.Errorf("got Inlines %+v", e.Inlines)
+	}
+	if len(e.OtherParts) != 1 || e.OtherParts[0].ContentType != "text/x-vcard" {
+		t.Errorf("got OtherParts %v", e.OtherParts)
+	}
+
+	if _, err := ReadEnvelope(strings.NewReader(raw), WithMaxParts(2)); !errors.Is(err, ErrPartLimit) {
+		t.Errorf("ReadEnvelope() error %v, want %v", err, ErrPartLimit)
+	}
+}
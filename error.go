@@ -0,0 +1,220 @@
+package mime
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"sync"
+)
+
+// The kinds of error this package reports.  Every sentinel error belongs to one kind, so callers
+// can test for a whole class of failure with errors.Is, e.g. errors.Is(err, ErrMalformed) is true
+// for ErrorMalformedHeader.
+var (
+	// ErrMalformed is the kind of errors caused by content violating the MIME standards
+	ErrMalformed = errors.New("malformed MIME content")
+	// ErrUnsupported is the kind of errors caused by valid but unsupported content, such as an
+	// unknown charset
+	ErrUnsupported = errors.New("unsupported MIME content")
+	// ErrLimit is the kind of errors caused by exceeding a limit configured on the Parser
+	ErrLimit = errors.New("limit exceeded")
+)
+
+// kindError is a sentinel error belonging to a kind of error.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func newKindError(msg string, kind error) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the kind of the error, for use with errors.Is.
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// Error describes a problem found while parsing or decoding a Part.  Errors are collected in
+// Part.Errors rather than returned when the problem could be worked around.
+type Error struct {
+	Name   string // The name of the problem, one of the Error* variables, e.g. "malformed header"
+	Detail string // Human readable description of the problem
+	Severe bool   // Indicates that the content may be missing or incorrect as a result
+	// Offset from the start of the input of the Part the problem was found in, or more precisely
+	// of the problem itself where known, such as a skipped delimiter
+	Offset int
+
+	err error // The Error* variable named
+}
+
+func (e *Error) Error() string {
+	sev := "W"
+	if e.Severe {
+		sev = "E"
+	}
+	return fmt.Sprintf("[%s] %s: %s", sev, e.Name, e.Detail)
+}
+
+// Unwrap returns the Error* variable named by the Error, so that errors.Is(e, ErrorMalformedHeader)
+// is true for malformed header warnings.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// DecodeError is returned by Part.Decode when the Part's content cannot be fully decoded.
+type DecodeError struct {
+	Descriptor string // The Descriptor of the Part
+	Err        error  // The kind of failure, ErrorContentEncoding or ErrorCharsetConversion
+	Detail     string // Human readable description of the failure
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: %v: %s", e.Descriptor, e.Err, e.Detail)
+}
+
+// Unwrap returns the kind of failure, for use with errors.Is.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError is returned when a message cannot be parsed, locating where the parse failed.
+// ReadParts, ReadStructure, Stream and Reparse return it wrapped, so use errors.As to find it.
+type ParseError struct {
+	Descriptor string // The Descriptor of the innermost Part being parsed, "" for a single part root
+	// Offset of the failure from the start of the input, that of the bytes the parser had read up
+	// to in the Part
+	Offset int
+	// Line holding Offset, counting from 1.  It is exact for messages parsed from a buffer, but
+	// when streamed, as with ReadStructure, it counts the lines read so far, which may run ahead
+	// of Offset by the parser's read-ahead.
+	Line int
+	Err  error // The failure
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("part %q at offset %d, line %d: %v", e.Descriptor, e.Offset, e.Line, e.Err)
+}
+
+// Unwrap returns the failure, for use with errors.Is.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns err as a *ParseError locating it at offset in the Part, unless it already
+// holds one from a Subpart.
+func (p *Part) parseError(err error, offset int) error {
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		return err
+	}
+	perr = &ParseError{Descriptor: p.Descriptor, Offset: offset, Err: err}
+	if p.rawReader != nil {
+		perr.Line = bufferLine(p.rawReader, offset)
+		return perr
+	}
+	root := p
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	if root.streamLines != nil {
+		perr.Line = root.streamLines.n + 1
+	}
+	return perr
+}
+
+func (p *Part) decodeError(err error, detailFmt string, args ...interface{}) *DecodeError {
+	return &DecodeError{
+		Descriptor: p.Descriptor,
+		Err:        err,
+		Detail:     fmt.Sprintf(detailFmt, args...),
+	}
+}
+
+// addError appends a severe Error to the Part, at the Part's offset.
+func (p *Part) addError(name error, detailFmt string, args ...interface{}) {
+	p.Errors = append(p.Errors, &Error{
+		Name:   name.Error(),
+		Detail: fmt.Sprintf(detailFmt, args...),
+		Severe: true,
+		Offset: p.PartOffset,
+		err:    name,
+	})
+}
+
+// addWarning appends a non-severe Error to the Part, at the Part's offset.
+func (p *Part) addWarning(name error, detailFmt string, args ...interface{}) {
+	p.addWarningAt(p.PartOffset, name, detailFmt, args...)
+}
+
+// addWarningAt appends a non-severe Error to the Part, at offset from the start of the input.
+func (p *Part) addWarningAt(offset int, name error, detailFmt string, args ...interface{}) {
+	w := newWarning(name, detailFmt, args...)
+	w.Offset = offset
+	p.Errors = append(p.Errors, w)
+}
+
+// decodeWarnings guards the warnings added to Parts while their content is decoded, as the readers
+// Decode returns may be drained on different goroutines.
+var decodeWarnings sync.Mutex
+
+// addDecodeWarning appends a non-severe Error found decoding the Part's content, at the start of
+// its content, unless an earlier Decode recorded the same one, so that reading the content again
+// does not add to the Part's Errors.
+func (p *Part) addDecodeWarning(name error, detailFmt string, args ...interface{}) {
+	w := newWarning(name, detailFmt, args...)
+	w.Offset = p.PartOffset + p.HeaderLen
+	decodeWarnings.Lock()
+	defer decodeWarnings.Unlock()
+	for _, err := range p.Errors {
+		if e, ok := err.(*Error); ok && e.Name == w.Name && e.Detail == w.Detail {
+			return
+		}
+	}
+	p.Errors = append(p.Errors, w)
+}
+
+// addWarnings appends warnings, as returned by readHeader for the Part's header block, to the
+// Part, at the offsets of the lines they describe.
+func (p *Part) addWarnings(warnings []error) {
+	for _, w := range warnings {
+		if e, ok := w.(*Error); ok {
+			e.Offset = p.headerOffset(e.Offset)
+		}
+		p.Errors = append(p.Errors, w)
+	}
+}
+
+// headerOffset returns the offset from the start of the input of offset in the Part's header
+// block.  The header of a message decoded from its transfer encoding is not in the input, so all
+// of its offsets are the Part's.
+func (p *Part) headerOffset(offset int) int {
+	if p.decodedHeader {
+		return p.PartOffset
+	}
+	return p.PartOffset + offset
+}
+
+// fieldOffset returns the offset from the start of the input of the first header field of the
+// Part named name, or of the Part if it was not parsed with one.
+func (p *Part) fieldOffset(name string) int {
+	for _, f := range p.fieldOrder {
+		if textproto.CanonicalMIMEHeaderKey(f.Name) == name {
+			return p.headerOffset(f.offset)
+		}
+	}
+	return p.PartOffset
+}
+
+// newWarning returns a non-severe Error.
+func newWarning(name error, detailFmt string, args ...interface{}) *Error {
+	return &Error{
+		Name:   name.Error(),
+		Detail: fmt.Sprintf(detailFmt, args...),
+		err:    name,
+	}
+}
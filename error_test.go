@@ -0,0 +1,197 @@
+package mime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	ttable := []struct {
+		err  error
+		kind error
+	}{
+		{ErrEmptyHeaderBlock, ErrMalformed},
+		{ErrorMalformedBase64, ErrMalformed},
+		{ErrorMalformedQuotedPrintable, ErrMalformed},
+		{ErrorMalformedHeader, ErrMalformed},
+		{ErrorMissingBoundary, ErrMalformed},
+		{ErrorMissingContentType, ErrMalformed},
+		{ErrorContentMD5, ErrMalformed},
+		{ErrorMissingMIMEVersion, ErrMalformed},
+		{ErrorMalformedMediaType, ErrMalformed},
+		{ErrorTruncated, ErrMalformed},
+		{ErrorCharsetConversion, ErrUnsupported},
+		{ErrorContentEncoding, ErrUnsupported},
+		{ErrorThumbnail, ErrUnsupported},
+		{ErrDecodedTooLarge, ErrLimit},
+		{ErrTempFileQuota, ErrLimit},
+		{ErrDepthLimit, ErrLimit},
+		{ErrPartLimit, ErrLimit},
+		{ErrHeaderTooLarge, ErrLimit},
+		{ErrMessageTooLarge, ErrLimit},
+	}
+	kinds := []error{ErrMalformed, ErrUnsupported, ErrLimit}
+	for _, tt := range ttable {
+		wrapped := fmt.Errorf("reading part: %w", tt.err)
+		for _, kind := range kinds {
+			if got, want := errors.Is(wrapped, kind), kind == tt.kind; got != want {
+				t.Errorf("errors.Is(%q, %q) == %v, want %v", wrapped, kind, got, want)
+			}
+		}
+		if !errors.Is(wrapped, tt.err) {
+			t.Errorf("errors.Is(%q, %q) == false, want true", wrapped, tt.err)
+		}
+	}
+}
+
+func TestPartErrorsUnwrap(t *testing.T) {
+	p, err := ReadParts(strings.NewReader(
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed\r\n\r\nbody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Errors) != 1 {
+		t.Fatalf("got Errors %v, want 1", p.Errors)
+	}
+	var e *Error
+	if !errors.As(p.Errors[0], &e) || e.Name != ErrorMissingBoundary.Error() {
+		t.Errorf("errors.As(%v) failed", p.Errors[0])
+	}
+	if !errors.Is(p.Errors[0], ErrorMissingBoundary) || !errors.Is(p.Errors[0], ErrMalformed) {
+		t.Errorf("%v does not wrap %q", p.Errors[0], ErrorMissingBoundary)
+	}
+}
+
+func TestDecodeErrorUnwrap(t *testing.T) {
+	p, err := ReadParts(strings.NewReader("Content-Type: text/plain; charset=x-bogus\r\n\r\nhi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Decode()
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("got error %v, want *DecodeError", err)
+	}
+	if !errors.Is(err, ErrorCharsetConversion) || !errors.Is(err, ErrUnsupported) {
+		t.Errorf("%v does not wrap %q", err, ErrorCharsetConversion)
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	second := "Content-Type: text/plain\r\n: no name\r\nX-Folded: a\r\nnot indented\r\n\r\nbody\r\n"
+	third := "Content-Type: multipart/mixed\r\n\r\nno boundary\r\n"
+	unclosed := "--b\r\n\r\n"
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nX-Other: 1\r\n\r\nno type\r\n" +
+		"--b\r\n" + second +
+		"--b\r\nX-Before: 1\r\n" + third +
+		unclosed
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type warning struct {
+		descriptor string
+		name       error
+		offset     int
+	}
+	want := []warning{
+		{"0", ErrorMissingBoundary, strings.Index(raw, unclosed) + len("--b\r\n")},
+		{"1", ErrorMissingContentType, strings.Index(raw, "X-Other")},
+		{"2", ErrorMalformedHeader, strings.Index(raw, ": no name")},
+		{"2", ErrorMalformedHeader, strings.Index(raw, "not indented")},
+		{"3", ErrorMissingBoundary, strings.Index(raw, third)},
+	}
+	var got []warning
+	p.Walk(func(s *Part) error {
+		for _, err := range s.Errors {
+			e := err.(*Error)
+			if e.Severe {
+				t.Errorf("%s: %v is severe", s.Descriptor, e)
+			}
+			got = append(got, warning{s.Descriptor, e.Unwrap(), e.Offset})
+		}
+		return nil
+	})
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got warnings %v, want %v", got, want)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nfirst\r\n" +
+		"--b\r\nContent-Type: multipart/mixed; boundary=c\r\n\r\n" +
+		"--c\r\nContent-Type: text/plain\r\n\r\nsecond\r\n" +
+		"--c\r\nContent-Type: text/plain\r\n\r\nthird\r\n--c--\r\n--b--\r\n"
+	third := strings.Index(raw, "Content-Type: text/plain\r\n\r\nthird")
+	second := strings.Index(raw, "Content-Type: text/plain\r\n\r\nsecond")
+
+	ttable := []struct {
+		opt        Option
+		err        error
+		descriptor string
+		offset     int
+		line       int
+	}{
+		{WithMaxParts(4), ErrPartLimit, "2.2", third, 15},
+		{WithMaxDepth(1), ErrDepthLimit, "2.1", second, 11},
+		{WithMaxHeaderSize(40), ErrHeaderTooLarge, "", 43, 2},
+	}
+	for _, tt := range ttable {
+		_, err := ReadParts(strings.NewReader(raw), tt.opt)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("ReadParts() error %v, want %v", err, tt.err)
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("ReadParts() error %v is not a *ParseError", err)
+		}
+		if perr.Descriptor != tt.descriptor || perr.Offset != tt.offset || perr.Line != tt.line {
+			t.Errorf("ReadParts() ParseError %q at %d line %d, want %q at %d line %d",
+				perr.Descriptor, perr.Offset, perr.Line, tt.descriptor, tt.offset, tt.line)
+		}
+		want := fmt.Sprintf("part %q at offset %d, line %d", tt.descriptor, tt.offset, tt.line)
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ReadParts() error %q, want it to contain %q", err, want)
+		}
+
+		// Streamed, the line is counted as far as the input was read
+		_, err = ReadStructure(strings.NewReader(raw), tt.opt)
+		if !errors.As(err, &perr) {
+			t.Fatalf("ReadStructure() error %v is not a *ParseError", err)
+		}
+		lines := strings.Count(raw, "\n") + 1
+		if perr.Descriptor != tt.descriptor || perr.Offset != tt.offset ||
+			perr.Line < tt.line || perr.Line > lines {
+			t.Errorf("ReadStructure() ParseError %q at %d line %d, want %q at %d line %d to %d",
+				perr.Descriptor, perr.Offset, perr.Line, tt.descriptor, tt.offset, tt.line, lines)
+		}
+	}
+}
+
+func TestParseErrorReparse(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nfirst\r\n" +
+		"--b\r\nContent-Type: multipart/mixed; boundary=c\r\n\r\n" +
+		"--c\r\nContent-Type: text/plain\r\n\r\nsecond\r\n--c--\r\n--b--\r\n"
+	root, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	// The two Parts outside the reparsed subtree still count against the limit
+	err = root.Subparts[1].Reparse(WithMaxParts(3))
+	var perr *ParseError
+	if !errors.As(err, &perr) || !errors.Is(err, ErrPartLimit) {
+		t.Fatalf("Reparse() error %v, want a *ParseError for %v", err, ErrPartLimit)
+	}
+	if want := strings.Index(raw, "Content-Type: text/plain\r\n\r\nsecond"); perr.Descriptor !=
+		"2.1" || perr.Offset != want || perr.Line != 11 {
+		t.Errorf("Reparse() ParseError %q at %d line %d, want %q at %d line %d",
+			perr.Descriptor, perr.Offset, perr.Line, "2.1", want, 11)
+	}
+}
@@ -0,0 +1,56 @@
+package mime
+
+import "io"
+
+// Extent is a byte range of the input a Part was parsed from: Len bytes at Offset from its start,
+// so that input[e.Offset:e.End()] holds it.  Offsets of a message read with ReadByteRanges count
+// from the start of the body, see ReadByteRanges.
+type Extent struct {
+	Offset int
+	Len    int
+}
+
+// End returns the offset of the first byte following the Extent.
+func (e Extent) End() int {
+	return e.Offset + e.Len
+}
+
+// Extent returns the Part's header block and transfer encoded content together, that is
+// HeaderExtent followed by ContentExtent.  The Part enclosed by a message/rfc822 Part spans that
+// Part's content, while a Subpart of a multipart spans what lies between the delimiter lines
+// around it, the line break preceding the next delimiter belonging to the delimiter.
+//
+// Parts not parsed from an input have no place in one: a built or composed Part's Offset is 0 and
+// its Len that of its own encoding, and a Part found WithUUEncodeDetection has an empty Extent.
+func (p *Part) Extent() Extent {
+	return Extent{Offset: p.PartOffset, Len: p.PartLen}
+}
+
+// HeaderExtent returns the Part's header block, its header fields and the blank line ending them;
+// it is empty for a Part without one, such as the Part enclosed by a transfer encoded
+// message/rfc822 Part whose header was decoded WithDecodedMessageHeaders.
+func (p *Part) HeaderExtent() Extent {
+	return Extent{Offset: p.PartOffset, Len: p.HeaderLen}
+}
+
+// ContentExtent returns the Part's transfer encoded content, from the end of its header block to
+// the end of the Part.  For a multipart Part it holds the preamble, the delimited Subparts and the
+// epilogue.
+func (p *Part) ContentExtent() Extent {
+	return Extent{Offset: p.PartOffset + p.HeaderLen, Len: p.PartLen - p.HeaderLen}
+}
+
+// sectionReader returns a reader over the bytes of the Part's input in e.
+func (p *Part) sectionReader(e Extent) *io.SectionReader {
+	return io.NewSectionReader(p.rawReader, int64(e.Offset), int64(e.Len))
+}
+
+// RelativeOffset returns the offset of the Part from the start of its Parent's content, or from
+// the start of the input for the root Part.  It is 0 for the Part enclosed by a message/rfc822
+// Part, and like Extent only meaningful for parsed Parts.
+func (p *Part) RelativeOffset() int {
+	if p.Parent == nil {
+		return p.PartOffset
+	}
+	return p.PartOffset - p.Parent.ContentExtent().Offset
+}
@@ -0,0 +1,115 @@
+package mime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartExtents(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "parts", "*.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, read := range []func() (*Part, error){
+			func() (*Part, error) { return ReadParts(bytes.NewReader(raw)) },
+			func() (*Part, error) { return ReadStructure(bytes.NewReader(raw)) },
+		} {
+			root, err := read()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if e := root.Extent(); e.Offset != 0 || e.End() > len(raw) {
+				t.Errorf("%s: root Extent() == %+v, want within %d bytes", name, e, len(raw))
+			}
+			root.Walk(func(p *Part) error {
+				checkExtents(t, name, raw, p)
+				return nil
+			})
+			root.Close()
+		}
+	}
+}
+
+func checkExtents(t *testing.T, name string, raw []byte, p *Part) {
+	t.Helper()
+	e, he, ce := p.Extent(), p.HeaderExtent(), p.ContentExtent()
+	if he.Offset != e.Offset || ce.Offset != he.End() || ce.End() != e.End() {
+		t.Errorf("%s %v: Extent() == %+v, HeaderExtent() == %+v, ContentExtent() == %+v, "+
+			"want header then content", name, p, e, he, ce)
+		return
+	}
+	if ce.Len != p.Size {
+		t.Errorf("%s %v: ContentExtent() == %+v, want Len %d", name, p, ce, p.Size)
+	}
+	if header := raw[he.Offset:he.End()]; he.Len > 0 && !bytes.HasSuffix(header, []byte("\n\n")) &&
+		!bytes.HasSuffix(header, []byte("\r\n\r\n")) && !bytes.Equal(header, []byte("\r\n")) &&
+		!bytes.Equal(header, []byte("\n")) {
+		t.Errorf("%s %v: header %q does not end with a blank line", name, p, header)
+	}
+	if p.Parent == nil {
+		if got := p.RelativeOffset(); got != e.Offset {
+			t.Errorf("%s %v: RelativeOffset() == %d, want %d", name, p, got, e.Offset)
+		}
+		return
+	}
+	pe := p.Parent.ContentExtent()
+	if e.Offset < pe.Offset || e.End() > pe.End() {
+		t.Errorf("%s %v: Extent() == %+v, outside Parent's content %+v", name, p, e, pe)
+	}
+	if got, want := p.RelativeOffset(), e.Offset-pe.Offset; got != want {
+		t.Errorf("%s %v: RelativeOffset() == %d, want %d", name, p, got, want)
+	}
+	if p.Parent.ContentType == ContentTypeMessageRfc822 && p.RelativeOffset() != 0 {
+		t.Errorf("%s %v: RelativeOffset() == %d in message/rfc822, want 0", name, p,
+			p.RelativeOffset())
+	}
+}
+
+func TestPartExtentsSiblings(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ReadParts(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	root.Walk(func(p *Part) error {
+		for i := 1; i < len(p.Subparts); i++ {
+			prev, next := p.Subparts[i-1].Extent(), p.Subparts[i].Extent()
+			if prev.End() > next.Offset {
+				t.Errorf("%v: Subpart %d %+v overlaps Subpart %d %+v", p, i-1, prev, i, next)
+			}
+		}
+		return nil
+	})
+}
+
+func TestBuiltPartExtent(t *testing.T) {
+	p, err := NewLeafPart("text/plain", []byte("hello\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Compose(p); err != nil {
+		t.Fatal(err)
+	}
+	encoded := &bytes.Buffer{}
+	if err := p.Encode(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if e := p.Extent(); e.Offset != 0 || e.Len != encoded.Len() {
+		t.Errorf("Extent() == %+v, want {0 %d}", e, encoded.Len())
+	}
+	if got := string(encoded.Bytes()[p.ContentExtent().Offset:]); got != "hello\r\n" {
+		t.Errorf("content at ContentExtent() == %q, want %q", got, "hello\r\n")
+	}
+}
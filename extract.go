@@ -0,0 +1,126 @@
+//go:build !js && !wasip1 && !tinygo
+
+package mime
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ExtractOption configures optional Extract behavior.
+type ExtractOption func(*extractor)
+
+// extractor holds the settings for a single call to Extract.
+type extractor struct {
+	windowsNames bool
+	maxPath      int
+}
+
+// WithWindowsFilenames translates filenames into ones Windows can create: reserved device names
+// such as CON and NUL are prefixed, trailing dots and spaces are trimmed, and characters Windows
+// forbids are replaced.  This is the default when running on Windows.
+func WithWindowsFilenames() ExtractOption {
+	return func(e *extractor) {
+		e.windowsNames = true
+	}
+}
+
+// WithMaxPath shortens filenames, preserving their extensions, so that each extracted path is
+// shorter than n UTF-16 code units.  Pass 260 to fit the Windows MAX_PATH limit.
+func WithMaxPath(n int) ExtractOption {
+	return func(e *extractor) {
+		e.maxPath = n
+	}
+}
+
+// Extract writes the decoded content of each of the Attachments of the Part tree rooted at root
+// to a file in dir, returning the paths written in tree order.  Files are named with
+// SuggestedFilename, sanitized so that they cannot address another directory.  Existing files are
+// never overwritten; a name in use gains a number, e.g. "report (1).pdf".
+func Extract(root *Part, dir string, opts ...ExtractOption) ([]string, error) {
+	e := &extractor{windowsNames: runtime.GOOS == "windows"}
+	for _, opt := range opts {
+		opt(e)
+	}
+	var parts []*Part
+	classifyParts(root, func(p *Part, kind partKind) {
+		if kind == partAttachment {
+			parts = append(parts, p)
+		}
+	})
+
+	var paths []string
+	for _, p := range parts {
+		path, err := e.extract(p, dir)
+		if err != nil {
+			return paths, fmt.Errorf("%s: %w", p.Descriptor, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// extract writes the Part's content to a new file in dir, returning its path.
+func (e *extractor) extract(p *Part, dir string) (string, error) {
+	r, err := p.DecodeRaw()
+	if err != nil {
+		return "", err
+	}
+	f, err := e.create(dir, e.filename(p))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// filename returns the sanitized name to extract the Part to.
+func (e *extractor) filename(p *Part) string {
+	name := sanitizeFilename(p.SuggestedFilename())
+	if e.windowsNames {
+		name = windowsFilename(name)
+	}
+	if name == "" {
+		name = "attachment" + extensionByType(p.ContentType)
+	}
+	return name
+}
+
+// create creates a new file in dir named name, numbering the name if it is already in use and
+// shortening it WithMaxPath.
+func (e *extractor) create(dir, name string) (*os.File, error) {
+	ext := extensionOf(name)
+	base := strings.TrimSuffix(name, ext)
+	// One unit each for the separator and terminating NUL
+	room := e.maxPath - utf16Len(dir) - 2
+	if e.maxPath > 0 && utf16Len(ext) >= room/2 {
+		base, ext = name, ""
+	}
+	for i := 0; ; i++ {
+		suffix := ext
+		if i > 0 {
+			suffix = fmt.Sprintf(" (%d)%s", i, ext)
+		}
+		if e.maxPath > 0 {
+			n := room - utf16Len(suffix)
+			if n < 1 {
+				return nil, fmt.Errorf("directory %q leaves no room for a filename", dir)
+			}
+			base = truncateUTF16(base, n)
+		}
+		path := filepath.Join(dir, base+suffix)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+}
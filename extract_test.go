@@ -0,0 +1,82 @@
+//go:build !js && !wasip1 && !tinygo
+
+package mime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	long := strings.Repeat("x", 300) + ".pdf"
+	attachment := func(filename, content string) string {
+		return "--b\r\nContent-Type: application/octet-stream\r\n" +
+			"Content-Disposition: attachment; filename=\"" + filename + "\"\r\n\r\n" +
+			content + "\r\n"
+	}
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nbody\r\n" +
+		attachment("report.pdf", "one") +
+		attachment("report.pdf", "two") +
+		attachment("../../etc/passwd", "three") +
+		attachment("CON", "four") +
+		attachment("what?.txt. ", "five") +
+		attachment(long, "six") +
+		attachment("...", "seven") +
+		"--b\r\nContent-Type: text/plain; charset=iso-8859-1; name=menu.txt\r\n" +
+		"Content-Disposition: attachment\r\n\r\ncaf\xe9\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw), WithAttachmentCharsetConversion())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "mime-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	paths, err := Extract(p, dir, WithWindowsFilenames(), WithMaxPath(260))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxName := 260 - len(dir) - 2
+	want := []struct {
+		name, content string
+	}{
+		{"report.pdf", "one"},
+		{"report (1).pdf", "two"},
+		{"_._etc_passwd", "three"},
+		{"_CON", "four"},
+		{"what_.txt", "five"},
+		{long[:maxName-4] + ".pdf", "six"},
+		{"attachment" + extensionByType(ctAppOctetStream), "seven"},
+		{"menu.txt", "caf\xe9"},
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("extracted %q, want %d files", paths, len(want))
+	}
+	for i, w := range want {
+		if paths[i] != filepath.Join(dir, w.name) {
+			t.Errorf("extracted %q, want %q", paths[i], w.name)
+			continue
+		}
+		b, err := ioutil.ReadFile(paths[i])
+		if err != nil || string(b) != w.content {
+			t.Errorf("%s contains %q, %v, want %q", w.name, b, err, w.content)
+		}
+	}
+
+	// Extracting again never overwrites
+	again, err := Extract(p, dir, WithMaxPath(260))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := filepath.Base(again[0]), "report (2).pdf"; got != want {
+		t.Errorf("extracted %q again, want %q", got, want)
+	}
+}
@@ -0,0 +1,279 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Fetch is a section of a message to retrieve from an IMAP server, see FetchPlan.
+type Fetch struct {
+	Part *Part
+	// Section is the IMAP section specifier of the Part's content, for BODY.PEEK[Section], e.g.
+	// "1.2", or "2.TEXT" for the multipart body of an embedded message
+	Section string
+	// Offset and Len locate the content within the message, for a partial fetch of BODY.PEEK[]
+	Offset, Len int
+}
+
+// FetchPlan returns the fetches retrieving the content of the Parts in the tree rooted at root
+// whose media types are matched by want, such as "text/plain" or "text/*", so that an IMAP client
+// holding a message's structure, e.g. from ReadStructure, can download only what it needs.  When
+// every Part within a multipart is wanted, the multipart is fetched in their place.  The Part
+// enclosed by a wanted message/rfc822 Part is not fetched separately.  Fetches are in tree order.
+func FetchPlan(root *Part, want []string) []Fetch {
+	fetches, _ := planFetches(root, "", true, want)
+	return fetches
+}
+
+// planFetches returns the fetches for the Part p numbered num, or for the body of a message, the
+// root or enclosed by a message/rfc822 Part, numbered after that message if body is true.  all is
+// true if the whole of p's content is fetched.
+func planFetches(p *Part, num string, body bool, want []string) (fetches []Fetch, all bool) {
+	if p.boundary != "" || strings.HasPrefix(p.ContentType, ctMultipartPrefix) {
+		all = len(p.Subparts) > 0
+		for i, s := range p.Subparts {
+			f, a := planFetches(s, joinSection(num, strconv.Itoa(i+1)), false, want)
+			fetches = append(fetches, f...)
+			all = all && a
+		}
+		if !all {
+			return fetches, false
+		}
+		section := num
+		if body {
+			section = joinSection(num, "TEXT")
+		}
+		return []Fetch{p.fetch(section)}, true
+	}
+
+	if body {
+		num = joinSection(num, "1")
+	}
+	if matchesMediaType(p.ContentType, want) {
+		return []Fetch{p.fetch(num)}, true
+	}
+	if m := p.Message(); m != nil {
+		// The message's header is not fetched
+		fetches, _ = planFetches(m, num, true, want)
+	}
+	return fetches, false
+}
+
+func (p *Part) fetch(section string) Fetch {
+	ce := p.ContentExtent()
+	return Fetch{Part: p, Section: section, Offset: ce.Offset, Len: ce.Len}
+}
+
+// joinSection appends part to the IMAP section specifier prefix.
+func joinSection(prefix, part string) string {
+	if prefix == "" {
+		return part
+	}
+	return prefix + "." + part
+}
+
+// matchesMediaType returns true if mediatype is matched by any of patterns, which may have a
+// wildcard subtype, e.g. "text/*", or be "*/*".
+func matchesMediaType(mediatype string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case pattern == "*/*" || pattern == mediatype:
+			return true
+		case strings.HasSuffix(pattern, "/*") &&
+			strings.HasPrefix(mediatype, pattern[:len(pattern)-1]):
+			return true
+		}
+	}
+	return false
+}
+
+// Section returns the Part numbered num, an IMAP section part specifier such as "2.1", within the
+// message rooted at p, per RFC 3501 section 6.4.5.  The body of a message that is not multipart,
+// the root or one enclosed by a message/rfc822 Part, is its part 1, and num "" is p itself.
+func (p *Part) Section(num string) (*Part, error) {
+	if num == "" {
+		return p, nil
+	}
+	cur, message := p, true
+	for _, s := range strings.Split(num, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || s[0] == '+' {
+			return nil, fmt.Errorf("invalid section %q", num)
+		}
+		if m := cur.Message(); m != nil && !message {
+			cur, message = m, true
+		}
+		switch {
+		case cur.boundary != "" || strings.HasPrefix(cur.ContentType, ctMultipartPrefix):
+			if n > len(cur.Subparts) {
+				return nil, fmt.Errorf("section %q does not exist", num)
+			}
+			cur = cur.Subparts[n-1]
+		case message && n == 1:
+			// The body of a single part message
+		default:
+			return nil, fmt.Errorf("section %q does not exist", num)
+		}
+		message = false
+	}
+	return cur, nil
+}
+
+// SectionReader returns a reader over the section of the message rooted at p named by spec, as
+// an IMAP server returns it for FETCH BODY[spec], per RFC 3501 section 6.4.5: a part specifier
+// such as "2.1" for the content of that Part, optionally followed by MIME for its header block,
+// or HEADER, HEADER.FIELDS (names), HEADER.FIELDS.NOT (names) or TEXT for the header or body of
+// the message it names, the root if there is none, or which a message/rfc822 Part encloses.  An
+// empty spec is the whole message.  A partial range, e.g. "1.TEXT<0.2048>", limits the reader to
+// the octets from origin, fewer if the section ends first.  Content is read from the original
+// input, so Parts without it, such as those built or read with ReadStructure, return ErrNoContent.
+func (p *Part) SectionReader(spec string) (*io.SectionReader, error) {
+	section, origin, octets := spec, int64(0), int64(-1)
+	if strings.HasSuffix(spec, ">") {
+		i := strings.LastIndexByte(spec, '<')
+		ok := false
+		if i >= 0 {
+			origin, octets, ok = parsePartial(spec[i+1 : len(spec)-1])
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid partial range in section %q", spec)
+		}
+		section = spec[:i]
+	}
+
+	// Split the part specifier from the text specifier following it
+	num, text := section, ""
+	for i, s := 0, section; s != ""; {
+		j := strings.IndexByte(s, '.')
+		if j < 0 {
+			j = len(s)
+		}
+		if _, err := strconv.Atoi(s[:j]); err != nil {
+			num, text = strings.TrimSuffix(section[:i], "."), s
+			break
+		}
+		if j == len(s) {
+			break
+		}
+		i, s = i+j+1, s[j+1:]
+	}
+	part, err := p.Section(num)
+	if err != nil {
+		return nil, err
+	}
+	if part.rawReader == nil {
+		return nil, ErrNoContent
+	}
+
+	var r *io.SectionReader
+	keyword := strings.ToUpper(text)
+	switch {
+	case keyword == "" && num == "":
+		r = part.sectionReader(part.Extent())
+	case keyword == "":
+		r = part.sectionReader(part.ContentExtent())
+	case keyword == "MIME" && num != "":
+		r = part.sectionReader(part.HeaderExtent())
+	case keyword == "MIME":
+		return nil, fmt.Errorf("invalid section %q, MIME requires a part specifier", spec)
+	default:
+		m := part
+		if num != "" {
+			if m = part.Message(); m == nil {
+				return nil, fmt.Errorf("section %q is %s, not %s", num, part.ContentType,
+					ContentTypeMessageRfc822)
+			}
+		}
+		if r, err = m.messageSection(text); err != nil {
+			return nil, fmt.Errorf("invalid section %q: %w", spec, err)
+		}
+	}
+	if octets < 0 {
+		return r, nil
+	}
+	if origin > r.Size() {
+		origin = r.Size()
+	}
+	if octets > r.Size()-origin {
+		octets = r.Size() - origin
+	}
+	return io.NewSectionReader(r, origin, octets), nil
+}
+
+// parsePartial parses the origin and octet count of an IMAP partial range, "origin.octets".
+func parsePartial(s string) (origin, octets int64, ok bool) {
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return 0, 0, false
+	}
+	o, err1 := strconv.ParseUint(s[:i], 10, 63)
+	n, err2 := strconv.ParseUint(s[i+1:], 10, 63)
+	return int64(o), int64(n), err1 == nil && err2 == nil
+}
+
+// messageSection returns a reader over the section of the message p named by text, one of the
+// HEADER, HEADER.FIELDS, HEADER.FIELDS.NOT or TEXT section text specifiers.
+func (p *Part) messageSection(text string) (*io.SectionReader, error) {
+	keyword, names := text, ""
+	if i := strings.IndexByte(text, ' '); i >= 0 {
+		keyword, names = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	switch strings.ToUpper(keyword) {
+	case "HEADER":
+		if names == "" {
+			return p.sectionReader(p.HeaderExtent()), nil
+		}
+	case "TEXT":
+		if names == "" {
+			return p.sectionReader(p.ContentExtent()), nil
+		}
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		if len(names) < 2 || names[0] != '(' || names[len(names)-1] != ')' {
+			return nil, fmt.Errorf("expected a parenthesized list of header field names")
+		}
+		want := make(map[string]bool)
+		for _, name := range strings.Fields(names[1 : len(names)-1]) {
+			want[textproto.CanonicalMIMEHeaderKey(strings.Trim(name, `"`))] = true
+		}
+		return p.headerFields(want, len(keyword) > len("HEADER.FIELDS"))
+	}
+	return nil, fmt.Errorf("unrecognized section text %q", text)
+}
+
+// headerFields returns a reader over the fields of the Part's header block named in want, or
+// those not named if not is true, exactly as they appeared and followed by a blank line.
+func (p *Part) headerFields(want map[string]bool, not bool) (*io.SectionReader, error) {
+	br := bufio.NewReader(p.sectionReader(p.HeaderExtent()))
+	fields := &bytes.Buffer{}
+	keep := false
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] == '\r' || line[0] == '\n' {
+			// End of the header block
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			// A new field, rather than the continuation of the last
+			name := line
+			if i := bytes.IndexByte(line, ':'); i >= 0 {
+				name = line[:i]
+			}
+			name = textproto.TrimBytes(name)
+			keep = want[textproto.CanonicalMIMEHeaderKey(string(name))] != not
+		}
+		if keep {
+			fields.Write(line)
+		}
+	}
+	fields.WriteString("\r\n")
+	return io.NewSectionReader(bytes.NewReader(fields.Bytes()), 0, int64(fields.Len())), nil
+}
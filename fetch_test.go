@@ -0,0 +1,131 @@
+package mime
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFetchPlan(t *testing.T) {
+	mixed := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: multipart/alternative; boundary=c\r\n\r\n" +
+		"--c\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--c\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+		"--c--\r\n" +
+		"--b\r\nContent-Type: image/png\r\n\r\npng\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" +
+		"Subject: inner\r\nContent-Type: multipart/mixed; boundary=d\r\n\r\n" +
+		"--d\r\nContent-Type: text/plain\r\n\r\ninner plain\r\n" +
+		"--d\r\nContent-Type: text/calendar\r\n\r\ninner calendar\r\n" +
+		"--d--\r\n" +
+		"--b--\r\n"
+	ttable := []struct {
+		raw  string
+		want []string
+		plan []string
+	}{
+		{mixed, []string{"text/plain"}, []string{"1.1 plain", "3.1 inner plain"}},
+		{mixed, []string{"TEXT/*"}, []string{"1 ", "3.TEXT "}},
+		{mixed, []string{"text/html", "image/png"}, []string{"1.2 <p>html</p>", "2 png"}},
+		{mixed, []string{"message/rfc822"}, []string{"3 "}},
+		{mixed, []string{"*/*"}, []string{"TEXT "}},
+		{mixed, []string{"application/pdf"}, nil},
+		{"Subject: single\r\n\r\nbody", []string{"text/plain"}, []string{"1 body"}},
+		{"Content-Type: message/rfc822\r\n\r\nSubject: inner\r\n\r\ninner body",
+			[]string{"text/*"}, []string{"1.1 inner body"}},
+	}
+	for _, tt := range ttable {
+		root, err := ReadParts(strings.NewReader(tt.raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var plan []string
+		for _, f := range FetchPlan(root, tt.want) {
+			content := tt.raw[f.Offset : f.Offset+f.Len]
+			if f.Part.Subparts != nil {
+				// The content of Parts with Subparts is left out
+				content = ""
+			}
+			plan = append(plan, fmt.Sprintf("%s %s", f.Section, content))
+		}
+		if strings.Join(plan, "\n") != strings.Join(tt.plan, "\n") {
+			t.Errorf("FetchPlan(%q) == %q, want %q", tt.want, plan, tt.plan)
+		}
+	}
+}
+
+func TestPartSection(t *testing.T) {
+	inner := "Subject: inner\r\nContent-Type: multipart/mixed; boundary=d\r\n\r\n" +
+		"--d\r\nContent-Type: text/plain\r\n\r\ninner plain\r\n" +
+		"--d\r\nContent-Type: text/calendar\r\n\r\ninner calendar\r\n" +
+		"--d--\r\n"
+	raw := "From: a@example.com\r\nSubject: outer\r\n folded\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" + inner +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\nSubject: single\r\n\r\nsingle body\r\n" +
+		"--b--\r\n"
+	root, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ttable := []struct {
+		spec, want string
+	}{
+		{"", raw},
+		{"HEADER", raw[:strings.Index(raw, "--b")]},
+		{"TEXT", raw[strings.Index(raw, "--b"):]},
+		{"header.fields (Subject \"FROM\")",
+			"From: a@example.com\r\nSubject: outer\r\n folded\r\n\r\n"},
+		{"HEADER.FIELDS.NOT (From Content-Type)", "Subject: outer\r\n folded\r\n\r\n"},
+		{"1", "plain"},
+		{"1.MIME", "Content-Type: text/plain\r\n\r\n"},
+		{"2", strings.TrimSuffix(inner, "\r\n")},
+		{"2.HEADER", "Subject: inner\r\nContent-Type: multipart/mixed; boundary=d\r\n\r\n"},
+		{"2.HEADER.FIELDS (Subject)", "Subject: inner\r\n\r\n"},
+		{"2.1", "inner plain"},
+		{"2.2.MIME", "Content-Type: text/calendar\r\n\r\n"},
+		{"2.TEXT<2.5>", "d\r\nCo"},
+		{"3.1", "single body"},
+		{"3.TEXT", "single body"},
+		{"1<3.100>", "in"},
+		{"1<10.5>", ""},
+	}
+	for _, tt := range ttable {
+		r, err := root.SectionReader(tt.spec)
+		if err != nil {
+			t.Errorf("SectionReader(%q) error: %v", tt.spec, err)
+			continue
+		}
+		got := make([]byte, r.Size())
+		if _, err := r.ReadAt(got, 0); err != nil && len(got) > 0 {
+			t.Errorf("SectionReader(%q) read error: %v", tt.spec, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("SectionReader(%q) got %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"0", "4", "1.1", "2.3", "1.2.3", "MIME", "1.HEADER", "2.BODY",
+		"2.HEADER.FIELDS Subject", "1<5>", "1<a.5>"} {
+		if _, err := root.SectionReader(spec); err == nil {
+			t.Errorf("SectionReader(%q) got no error", spec)
+		}
+	}
+
+	if p, err := root.Section("2.2"); err != nil || p.ContentType != "text/calendar" {
+		t.Errorf("Section(2.2) got %v, %v, want the text/calendar Part", p, err)
+	}
+	if p, err := root.Section("3.1"); err != nil || p != root.Subparts[2].Message() {
+		t.Errorf("Section(3.1) got %v, %v, want the enclosed message", p, err)
+	}
+
+	structure, err := ReadStructure(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := structure.SectionReader("1"); err != ErrNoContent {
+		t.Errorf("SectionReader of ReadStructure Part got %v, want ErrNoContent", err)
+	}
+}
@@ -0,0 +1,146 @@
+package mime
+
+import (
+	"mime"
+	"strings"
+	"unicode"
+)
+
+// preferredExtensions overrides the first extension mime.ExtensionsByType would return for
+// types where that is not the conventional choice.
+var preferredExtensions = map[string]string{
+	ctAppOctetStream:         ".bin",
+	ctTextPlain:              ".txt",
+	ctTextHTML:               ".html",
+	ContentTypeMessageRfc822: ".eml",
+	"image/jpeg":             ".jpg",
+	"image/tiff":             ".tif",
+	"audio/mpeg":             ".mp3",
+	"text/calendar":          ".ics",
+}
+
+// SuggestedFilename returns a filename for saving the Part's content.  It is the Filename given in
+// the headers when there is one.  Otherwise, for attachments, a name is derived from the
+// Content-Description, the Content-ID, or failing those the Descriptor, e.g.
+// "attachment-2.1.pdf", with an extension matching the ContentType.  Other Parts without a
+// Filename return "".
+func (p *Part) SuggestedFilename() string {
+	if p.Filename != "" || p.Disposition != cdAttachment {
+		return p.Filename
+	}
+	ext := extensionByType(p.ContentType)
+
+	if name := sanitizeFilename(decodeHeader(p.Header.Get(hnContentDescription))); name != "" {
+		if strings.EqualFold(extensionOf(name), ext) {
+			return name
+		}
+		return name + ext
+	}
+
+	id := p.ContentID
+	if i := strings.LastIndex(id, "@"); i != -1 {
+		id = id[:i]
+	}
+	if name := sanitizeFilename(id); name != "" {
+		return name + ext
+	}
+
+	if p.Descriptor == "" {
+		return "attachment" + ext
+	}
+	return "attachment-" + p.Descriptor + ext
+}
+
+// extensionByType returns the filename extension, including the dot, for mediatype.
+func extensionByType(mediatype string) string {
+	if ext, ok := preferredExtensions[mediatype]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediatype); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return preferredExtensions[ctAppOctetStream]
+}
+
+// extensionOf returns the extension of name, or "" if it has none.
+func extensionOf(name string) string {
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return name[i:]
+	}
+	return ""
+}
+
+// sanitizeFilename replaces path separators and control characters in name, and trims leading
+// and trailing dots and spaces so that the result cannot address another directory.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.Trim(name, ". ")
+}
+
+// windowsReservedNames are the device names Windows reserves in every directory, with or without
+// an extension.  Windows also takes the superscript digits ¹, ² and ³ as port numbers.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"COM¹": true, "COM²": true, "COM³": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	"LPT¹": true, "LPT²": true, "LPT³": true,
+}
+
+// windowsFilename translates a sanitized name into one Windows can create: characters Windows
+// forbids in filenames are replaced, trailing dots and spaces Windows would silently strip are
+// trimmed, and reserved device names such as "CON" or "nul.txt" are prefixed with an underscore.
+// A name left empty stays empty, for the caller to substitute its own.
+func windowsFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	base := name
+	if i := strings.IndexByte(base, '.'); i != -1 {
+		base = base[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = "_" + name
+	}
+	return name
+}
+
+// truncateUTF16 truncates s to at most n UTF-16 code units, the unit Windows path limits are
+// measured in, trimming any dots and spaces left at the end.
+func truncateUTF16(s string, n int) string {
+	for i, r := range s {
+		if n -= utf16RuneLen(r); n < 0 {
+			s = s[:i]
+			break
+		}
+	}
+	return strings.TrimRight(s, ". ")
+}
+
+// utf16Len returns the number of UTF-16 code units encoding s.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
+
+// utf16RuneLen returns the number of UTF-16 code units encoding r, 2 for a surrogate pair.
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,115 @@
+package mime
+
+import (
+	"net/textproto"
+	"testing"
+)
+
+func TestSuggestedFilename(t *testing.T) {
+	ttable := []struct {
+		desc        string
+		descriptor  string
+		ctype       string
+		disposition string
+		filename    string
+		header      map[string]string
+		want        string
+	}{
+		{"filename kept", "2", "application/pdf", cdAttachment, "report.pdf", nil, "report.pdf"},
+		{"not attachment", "1", "text/plain", cdInline, "", nil, ""},
+		{
+			"description", "2", "application/pdf", cdAttachment, "",
+			map[string]string{hnContentDescription: "Quarterly report"},
+			"Quarterly report.pdf",
+		},
+		{
+			"description with extension", "2", "application/pdf", cdAttachment, "",
+			map[string]string{hnContentDescription: "q3.PDF"},
+			"q3.PDF",
+		},
+		{
+			"encoded description", "2", "text/plain", cdAttachment, "",
+			map[string]string{hnContentDescription: "=?utf-8?q?caf=C3=A9?="},
+			"café.txt",
+		},
+		{
+			"description path", "2", "text/plain", cdAttachment, "",
+			map[string]string{hnContentDescription: "../../etc/passwd"},
+			"_.._etc_passwd.txt",
+		},
+		{
+			"content id", "2", "image/jpeg", cdAttachment, "",
+			map[string]string{hnContentID: "<logo.123@example.com>"},
+			"logo.123.jpg",
+		},
+		{"descriptor", "2.1", "application/pdf", cdAttachment, "", nil, "attachment-2.1.pdf"},
+		{"unknown type", "3", "application/x-bogus", cdAttachment, "", nil, "attachment-3.bin"},
+		{"root", "", "application/octet-stream", cdAttachment, "", nil, "attachment.bin"},
+	}
+	for _, tt := range ttable {
+		p := &Part{
+			Descriptor:  tt.descriptor,
+			ContentType: tt.ctype,
+			Disposition: tt.disposition,
+			Filename:    tt.filename,
+			Header:      make(textproto.MIMEHeader),
+		}
+		for k, v := range tt.header {
+			p.Header.Set(k, v)
+		}
+		p.ContentID = parseContentID(p.Header.Get(hnContentID))
+		if got := p.SuggestedFilename(); got != tt.want {
+			t.Errorf("%s: SuggestedFilename() == %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestWindowsFilename(t *testing.T) {
+	ttable := []struct {
+		name, want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"CON", "_CON"},
+		{"nul.txt", "_nul.txt"},
+		{"Com1.tar.gz", "_Com1.tar.gz"},
+		{"lpt9 .log", "_lpt9 .log"},
+		{"console.txt", "console.txt"},
+		{"COM10", "COM10"},
+		{"notes. . ", "notes"},
+		{`what?<now>|"x"*.txt`, "what__now___x__.txt"},
+		{"tab\there", "tab_here"},
+		{"...", ""},
+		{"COM0", "_COM0"},
+		{"lpt0.txt", "_lpt0.txt"},
+		{"com\u00b9.txt", "_com\u00b9.txt"},
+		{"LPT\u00b3", "_LPT\u00b3"},
+		{"conin$", "_conin$"},
+		{"CONOUT$.log", "_CONOUT$.log"},
+		{"COM\u2074", "COM\u2074"},
+	}
+	for _, tt := range ttable {
+		if got := windowsFilename(tt.name); got != tt.want {
+			t.Errorf("windowsFilename(%q) == %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateUTF16(t *testing.T) {
+	ttable := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"report", 10, "report"},
+		{"report", 3, "rep"},
+		{"ab. cd", 4, "ab"},
+		{"日本語", 2, "日本"},
+		{"a\U0001F600b", 2, "a"},
+		{"a\U0001F600b", 3, "a\U0001F600"},
+	}
+	for _, tt := range ttable {
+		if got := truncateUTF16(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateUTF16(%q, %d) == %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+//go:build !js && !wasip1 && !tinygo
+
+package mime
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cardamaro/mem_constrained_buffer"
+)
+
+// bufferMessage reads the message from r, through tr, into a buffer that spills to a temporary
+// file once it outgrows memory, unless the Parser was configured WithInMemoryBuffering.  It
+// returns the buffer and the size of the message.
+func (ps *Parser) bufferMessage(r io.Reader, tr *truncatingReader) (ReaderAtCloser, int64, error) {
+	if ps.inMemory {
+		return ps.bufferMessageInMemory(r, tr)
+	}
+	mb := mem_constrained_buffer.New()
+	qr := newTempQuotaReader(ps, r)
+	tr.r = qr
+	if _, err := mb.ReadFrom(ps.limitMessageSize(tr)); err != nil {
+		qr.release()
+		mb.Close()
+		return nil, 0, err
+	}
+	return &tempFileBuffer{ReaderAtCloser: mb, release: qr.release}, mb.Len(), nil
+}
+
+// tempQuotaReader enforces temporary file quotas while a message is being buffered.  Once more
+// than memory bytes have been read the buffer spills to disk, copying what it held in memory to
+// the temporary file too, so everything read counts against the quotas.
+type tempQuotaReader struct {
+	r        io.Reader
+	ps       *Parser
+	memory   int64
+	n        int64
+	reserved int64
+}
+
+// newTempQuotaReader returns a tempQuotaReader for messages buffered with mem_constrained_buffer.
+func newTempQuotaReader(ps *Parser, r io.Reader) *tempQuotaReader {
+	return &tempQuotaReader{
+		r:      r,
+		ps:     ps,
+		memory: mem_constrained_buffer.DefaultMemorySize,
+	}
+}
+
+// Read method for io.Reader interface.
+func (q *tempQuotaReader) Read(b []byte) (int, error) {
+	n, err := q.r.Read(b)
+	q.n += int64(n)
+	if q.n > q.memory {
+		if q.ps.tempFileQuota > 0 && q.n > q.ps.tempFileQuota {
+			return 0, ErrTempFileQuota
+		}
+		if need := q.n - q.reserved; need > 0 {
+			if !q.ps.reserveTempFile(need) {
+				return 0, ErrTempFileQuota
+			}
+			q.reserved += need
+		}
+	}
+	return n, err
+}
+
+// release returns the reservation held by the reader to its Parser.
+func (q *tempQuotaReader) release() {
+	q.ps.releaseTempFile(q.reserved)
+	q.reserved = 0
+}
+
+// tempFileBuffer releases a message's temporary file reservation when its buffer is closed.
+type tempFileBuffer struct {
+	ReaderAtCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the underlying buffer, releasing the temporary file reservation once.
+func (t *tempFileBuffer) Close() error {
+	t.once.Do(t.release)
+	return t.ReaderAtCloser.Close()
+}
+
+// capture saves the size bytes of raw input, anonymized if configured, and a dump of the Part
+// tree rooted at root to the Parser's capture directory.  The files are named for the SHA-256 of
+// the saved input, so capturing the same message repeatedly keeps one copy.  Problems saving them
+// are passed to the capture error handler rather than failing the parse.
+func (ps *Parser) capture(raw io.ReaderAt, size int64, root *Part, perr error) {
+	tmp, err := ioutil.TempFile(ps.captureDir, "capture-")
+	if err != nil {
+		ps.captureFailed(err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(tmp, h))
+	r := io.NewSectionReader(raw, 0, size)
+	if ps.captureAnonymize {
+		err = anonymize(w, r)
+	} else {
+		_, err = io.Copy(w, r)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		ps.captureFailed(err)
+		return
+	}
+
+	name := filepath.Join(ps.captureDir, hex.EncodeToString(h.Sum(nil))[:32])
+	if err := os.Rename(tmp.Name(), name+".eml"); err != nil {
+		ps.captureFailed(err)
+		return
+	}
+	if err := ioutil.WriteFile(name+".txt", dumpStructure(root, perr), 0600); err != nil {
+		ps.captureFailed(err)
+	}
+}
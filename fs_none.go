@@ -0,0 +1,21 @@
+//go:build js || wasip1 || tinygo
+
+package mime
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// bufferMessage reads the message from r, through tr, into memory; browsers and edge runtimes
+// have no usable filesystem to spill large messages to.
+func (ps *Parser) bufferMessage(r io.Reader, tr *truncatingReader) (ReaderAtCloser, int64, error) {
+	return ps.bufferMessageInMemory(r, tr)
+}
+
+// capture is not supported without a filesystem; WithCorpusCapture only reports that fact to the
+// capture error handler.
+func (ps *Parser) capture(raw io.ReaderAt, size int64, root *Part, perr error) {
+	ps.captureFailed(fmt.Errorf("not supported on %s", runtime.GOOS))
+}
@@ -3,9 +3,8 @@ package mime
 import (
 	"bufio"
 	"bytes"
-	"errors"
+	"fmt"
 	"io"
-	"log"
 	"mime"
 	"net/textproto"
 	"strings"
@@ -17,16 +16,22 @@ const (
 	cdInline     = "inline"
 
 	// Standard MIME content types
+	ctAppExecutable   = "application/x-msdownload"
 	ctAppOctetStream  = "application/octet-stream"
+	ctImagePrefix     = "image/"
 	ctMultipartAltern = "multipart/alternative"
 	ctMultipartPrefix = "multipart/"
 	ctTextPlain       = "text/plain"
 	ctTextHTML        = "text/html"
 
 	// Standard MIME header names
+	hnContentDescription = "Content-Description"
+	hnContentID          = "Content-Id"
 	hnContentDisposition = "Content-Disposition"
 	hnContentEncoding    = "Content-Transfer-Encoding"
+	hnContentMD5         = "Content-Md5"
 	hnContentType        = "Content-Type"
+	hnStoreRef           = "X-Mime-Store-Ref"
 
 	// Standard MIME header parameters
 	hpBoundary = "boundary"
@@ -36,152 +41,420 @@ const (
 	hpName     = "name"
 )
 
+// knownMultipartSubtypes are the registered multipart media types, along with the widely used
+// x-mixed-replace, see WithOpaqueUnknownMultipart
+var knownMultipartSubtypes = map[string]bool{
+	"multipart/alternative":       true,
+	"multipart/appledouble":       true,
+	"multipart/byteranges":        true,
+	"multipart/digest":            true,
+	"multipart/encrypted":         true,
+	"multipart/form-data":         true,
+	"multipart/header-set":        true,
+	"multipart/mixed":             true,
+	"multipart/multilingual":      true,
+	"multipart/parallel":          true,
+	"multipart/related":           true,
+	"multipart/report":            true,
+	"multipart/signed":            true,
+	"multipart/vnd.bint.med-plus": true,
+	"multipart/voice-message":     true,
+	"multipart/x-mixed-replace":   true,
+}
+
 var (
-	ErrEmptyHeaderBlock = errors.New("empty header block")
+	// ErrEmptyHeaderBlock is returned when a Part has no header block
+	ErrEmptyHeaderBlock = newKindError("empty header block", ErrMalformed)
 	// ErrorMalformedBase64 name
-	ErrorMalformedBase64 = errors.New("malformed base64")
+	ErrorMalformedBase64 = newKindError("malformed base64", ErrMalformed)
+	// ErrorMalformedQuotedPrintable name
+	ErrorMalformedQuotedPrintable = newKindError("malformed quoted-printable", ErrMalformed)
 	// ErrorMalformedHeader name
-	ErrorMalformedHeader = errors.New("malformed header")
+	ErrorMalformedHeader = newKindError("malformed header", ErrMalformed)
 	// ErrorMissingBoundary name
-	ErrorMissingBoundary = errors.New("missing boundary")
+	ErrorMissingBoundary = newKindError("missing boundary", ErrMalformed)
+	// ErrorNestedBoundary name
+	ErrorNestedBoundary = newKindError("nested boundary reused", ErrMalformed)
 	// ErrorMissingContentType name
-	ErrorMissingContentType = errors.New("missing Content-Type")
+	ErrorMissingContentType = newKindError("missing Content-Type", ErrMalformed)
+	// ErrorMissingMIMEVersion name
+	ErrorMissingMIMEVersion = newKindError("missing MIME-Version", ErrMalformed)
+	// ErrorTruncated name
+	ErrorTruncated = newKindError("truncated", ErrMalformed)
+	// ErrorMalformedMediaType name
+	ErrorMalformedMediaType = newKindError("malformed media type", ErrMalformed)
 	// ErrorCharsetConversion name
-	ErrorCharsetConversion = errors.New("character set conversion")
+	ErrorCharsetConversion = newKindError("character set conversion", ErrUnsupported)
 	// ErrorContentEncoding name
-	ErrorContentEncoding = errors.New("content encoding")
+	ErrorContentEncoding = newKindError("content encoding", ErrUnsupported)
+	// ErrorContentMD5 name
+	ErrorContentMD5 = newKindError("Content-MD5 mismatch", ErrMalformed)
+	// ErrorThumbnail name
+	ErrorThumbnail = newKindError("thumbnail", ErrUnsupported)
 )
 
+// parseMIMEVersion returns the value of the MIME-Version header with RFC 5322 comments and white
+// space removed, and whether the header is present.
+func parseMIMEVersion(header textproto.MIMEHeader) (string, bool) {
+	values, ok := header[textproto.CanonicalMIMEHeaderKey(hnMIMEVersion)]
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(strings.Fields(StripComments(values[0])), ""), true
+}
+
+// StripComments returns the structured header field value v with its RFC 5322 comments, which may
+// be nested, removed, for parsing dates, message IDs, addresses and the like.  Quoted-strings,
+// domain literals and quoted-pairs are kept intact.  A comment between two words is replaced by a
+// single space, and white space is trimmed from both ends of the result.
+func StripComments(v string) string {
+	if strings.IndexByte(v, '(') == -1 {
+		// Don't scan if there is nothing to do here
+		return strings.TrimSpace(v)
+	}
+	b := &strings.Builder{}
+	b.Grow(len(v))
+	var (
+		depth   int  // Nesting depth of comments
+		closing byte // The byte ending the current quoted-string or domain literal, if any
+		escaped bool // The previous byte started a quoted-pair
+		removed bool // A comment was removed since the last byte written
+	)
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if depth > 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '(':
+				depth++
+			case c == ')':
+				depth--
+				removed = depth == 0
+			}
+			continue
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case closing != 0:
+			if c == '\\' {
+				escaped = true
+			} else if c == closing {
+				closing = 0
+			}
+		case c == '(':
+			depth = 1
+			continue
+		case c == '"':
+			closing = '"'
+		case c == '[':
+			closing = ']'
+		}
+		if removed {
+			if isWhiteSpaceByte(c) {
+				continue
+			}
+			if b.Len() > 0 && !isWhiteSpaceByte(b.String()[b.Len()-1]) {
+				b.WriteByte(' ')
+			}
+			removed = false
+		}
+		b.WriteByte(c)
+	}
+	return strings.TrimSpace(b.String())
+}
+
 // Terminology from RFC 2047:
 //  encoded-word: the entire =?charset?encoding?encoded-text?= string
 //  charset: the character set portion of the encoded word
 //  encoding: the character encoding type used for the encoded-text
 //  encoded-text: the text we are decoding
 
-// readHeader reads a block of SMTP or MIME headers and returns a textproto.MIMEHeader.
-// Header parse warnings & errors will be added to p.Errors, io errors will be returned directly.
-func readHeader(r *bufio.Reader) (textproto.MIMEHeader, error) {
-	// buf holds the massaged output for textproto.Reader.ReadMIMEHeader()
-	buf := &bytes.Buffer{}
-	tp := textproto.NewReader(r)
-	firstHeader := true
+// HeaderField is a single field of a header block read by ReadHeader.
+type HeaderField struct {
+	Name  string // Canonical name, e.g. "Content-Type"
+	Value string // Unfolded value, without surrounding white space
+}
+
+// headerField is a HeaderField as read, with its name as written and the offset of its first line
+// from the start of the header block.
+type headerField struct {
+	HeaderField
+	offset int
+}
+
+// ReadHeader reads a bare header block from r, such as an IMAP BODY[HEADER] response or a queue
+// file, with the tolerant rules ReadParts applies to the headers of Parts.  The fields are returned
+// in the order they appeared, and each problem worked around is described by a warning, an *Error
+// as found in Part.Errors with the Offset of the line from the start of r.  The block ends at the
+// first blank line or the end of r.
+func ReadHeader(r io.Reader) ([]HeaderField, []error, error) {
+	read, warnings, err := readHeaderFields(bufio.NewReader(r), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := make([]HeaderField, len(read))
+	for i, f := range read {
+		fields[i] = HeaderField{Name: textproto.CanonicalMIMEHeaderKey(f.Name), Value: f.Value}
+	}
+	return fields, warnings, nil
+}
+
+// readHeader reads a block of SMTP or MIME headers and returns a textproto.MIMEHeader, with
+// warnings describing the problems worked around at offsets from the start of the block.  io
+// errors will be returned directly.
+func readHeader(r *bufio.Reader) (textproto.MIMEHeader, []error, error) {
+	header, _, warnings, err := readHeaderLimit(r, 0)
+	return header, warnings, err
+}
+
+// readHeaderLimit is readHeader, also returning the fields in their original order with their
+// names as written, see writeHeader.  It returns ErrHeaderTooLarge once the lines read exceed
+// limit bytes, unless limit is zero.
+func readHeaderLimit(r *bufio.Reader, limit int) (
+	textproto.MIMEHeader, []headerField, []error, error) {
+	fields, warnings, err := readHeaderFields(r, limit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	header := make(textproto.MIMEHeader, len(fields))
+	for _, f := range fields {
+		key := textproto.CanonicalMIMEHeaderKey(f.Name)
+		header[key] = append(header[key], f.Value)
+	}
+	return header, fields, warnings, nil
+}
+
+// readHeaderFields implements ReadHeader, see readHeaderLimit for limit.
+func readHeaderFields(r *bufio.Reader, limit int) ([]headerField, []error, error) {
+	// lines holds the massaged header lines, with any continuations already unfolded, and offsets
+	// the offsets of their first lines
+	var lines [][]byte
+	var offsets []int
+	var warnings []error
+	warn := func(offset int, name error, detailFmt string, args ...interface{}) {
+		w := newWarning(name, detailFmt, args...)
+		w.Offset = offset
+		warnings = append(warnings, w)
+	}
+	size := 0
 	for {
 		// Pull out each line of the headers as a temporary slice s
-		s, err := tp.ReadLineBytes()
+		offset := size
+		s, n, err := readHeaderLine(r)
 		if err != nil {
-			if err == io.ErrUnexpectedEOF && buf.Len() == 0 {
-				return nil, ErrEmptyHeaderBlock
+			if err == io.ErrUnexpectedEOF && len(lines) == 0 {
+				return nil, nil, ErrEmptyHeaderBlock
 			} else if err == io.EOF {
-				buf.Write([]byte{'\r', '\n'})
 				break
 			}
-			return nil, err
+			return nil, nil, err
+		}
+		if size += n; limit > 0 && size > limit {
+			return nil, nil, ErrHeaderTooLarge
 		}
 		firstColon := bytes.IndexByte(s, ':')
 		firstSpace := bytes.IndexAny(s, " \t\n\r")
 		if firstSpace == 0 {
 			// Starts with space: continuation
-			buf.WriteByte(' ')
-			buf.Write(textproto.TrimBytes(s))
+			if len(lines) > 0 {
+				last := len(lines) - 1
+				lines[last] = append(lines[last], ' ')
+				lines[last] = append(lines[last], textproto.TrimBytes(s)...)
+			}
 			continue
 		}
 		if firstColon == 0 {
 			// Can't parse line starting with colon: skip
-			//p.Errors = append(p.Errors, (ErrorMalformedHeader, "Header line %q started with a colon", s)
-			log.Printf("%v: header line %q started with a colon", ErrorMalformedHeader, s)
+			warn(offset, ErrorMalformedHeader, "header line %q started with a colon", s)
 			continue
 		}
 		if firstColon > 0 {
 			// Contains a colon, treat as a new header line
-			if !firstHeader {
-				// New Header line, end the previous
-				buf.Write([]byte{'\r', '\n'})
-			}
-			s = textproto.TrimBytes(s)
-			buf.Write(s)
-			firstHeader = false
+			lines = append(lines, textproto.TrimBytes(s))
+			offsets = append(offsets, offset)
 		} else {
 			// No colon: potential non-indented continuation
 			if len(s) > 0 {
 				// Attempt to detect and repair a non-indented continuation of previous line
-				buf.WriteByte(' ')
-				buf.Write(s)
-				//p.addWarning(ErrorMalformedHeader, "Continued line %q was not indented", s)
-				log.Printf("%v: continued line %q was not indented", ErrorMalformedHeader, s)
+				if len(lines) > 0 {
+					last := len(lines) - 1
+					lines[last] = append(lines[last], ' ')
+					lines[last] = append(lines[last], s...)
+				}
+				warn(offset, ErrorMalformedHeader, "continued line %q was not indented", s)
 			} else {
 				// Empty line, finish header parsing
-				buf.Write([]byte{'\r', '\n'})
 				break
 			}
 		}
 	}
-	buf.Write([]byte{'\r', '\n'})
-	tr := textproto.NewReader(bufio.NewReader(buf))
-	header, err := tr.ReadMIMEHeader()
-	return header, err
+
+	// Split the repaired lines into fields ourselves; textproto.Reader.ReadMIMEHeader rejects
+	// names such as "Audio Mode" that real world mailers emit and we would rather keep.
+	fields := make([]headerField, 0, len(lines))
+	for j, l := range lines {
+		i := bytes.IndexByte(l, ':')
+		name := string(textproto.TrimBytes(l[:i]))
+		if name == "" {
+			continue
+		}
+		value := string(textproto.TrimBytes(l[i+1:]))
+		fields = append(fields, headerField{HeaderField{Name: name, Value: value}, offsets[j]})
+	}
+	return fields, warnings, nil
 }
 
-// decodeHeader decodes a single line (per RFC 2047) using Golang's mime.WordDecoder
-func decodeHeader(input string) string {
-	if !strings.Contains(input, "=?") {
-		// Don't scan if there is nothing to do here
-		return input
+// readHeaderLine reads a line from r as textproto.Reader.ReadLineBytes does, returning it without
+// its line ending, and n, the number of bytes read including it.
+func readHeaderLine(r *bufio.Reader) (line []byte, n int, err error) {
+	for {
+		s, err := r.ReadSlice('\n')
+		line = append(line, s...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, 0, err
+		}
+		break
+	}
+	n = len(line)
+	if bytes.HasSuffix(line, []byte("\n")) {
+		line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
 	}
+	return line, n, nil
+}
 
-	dec := new(mime.WordDecoder)
-	dec.CharsetReader = newCharsetReader
-	header, err := dec.DecodeHeader(input)
-	if err != nil {
-		return input
+// HeaderFieldError is returned when a header field name or value can not be written into a header
+// block safely, for example because it contains a CR or LF that would inject additional fields.
+type HeaderFieldError struct {
+	Name   string // Header field name as supplied by the caller
+	Value  string // Header field value as supplied by the caller
+	Reason string // Description of the offending content
+}
+
+func (e *HeaderFieldError) Error() string {
+	return fmt.Sprintf("mime: invalid header field %q: %s", e.Name, e.Reason)
+}
+
+// ValidateHeaderField checks that name is a valid RFC 5322 field name, and that value contains no
+// CR, LF or other control characters that would allow it to terminate the field early.  A
+// *HeaderFieldError is returned describing the first problem found.
+func ValidateHeaderField(name, value string) error {
+	if name == "" {
+		return &HeaderFieldError{Name: name, Value: value, Reason: "empty field name"}
+	}
+	for i := 0; i < len(name); i++ {
+		// ftext = %d33-57 / %d59-126
+		if c := name[i]; c < 33 || c > 126 || c == ':' {
+			return &HeaderFieldError{
+				Name:   name,
+				Value:  value,
+				Reason: fmt.Sprintf("illegal character %q in field name", c),
+			}
+		}
 	}
+	for i := 0; i < len(value); i++ {
+		// 8-bit bytes are tolerated for SMTPUTF8 use, but not controls other than tab
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return &HeaderFieldError{
+				Name:   name,
+				Value:  value,
+				Reason: fmt.Sprintf("illegal character %q in field value", c),
+			}
+		}
+	}
+	return nil
+}
+
+// checkHeaderInjection returns a *HeaderFieldError if writing the field name with value would end
+// it early or start another field: a CR or LF anywhere, or a name that is empty or holds a colon.
+// It is laxer than ValidateHeaderField so that parsed fields with names such as "Audio Mode",
+// which the parser accepts, still encode.
+func checkHeaderInjection(name, value string) error {
+	switch {
+	case name == "":
+		return &HeaderFieldError{Name: name, Value: value, Reason: "empty field name"}
+	case strings.ContainsAny(name, ":\r\n"):
+		return &HeaderFieldError{Name: name, Value: value,
+			Reason: "field name holds a colon or line break"}
+	case strings.ContainsAny(value, "\r\n"):
+		return &HeaderFieldError{Name: name, Value: value, Reason: "field value holds a line break"}
+	}
+	return nil
+}
+
+// wordDecoder decodes RFC 2047 encoded-words, it holds no state and is safe for concurrent use
+var wordDecoder = &mime.WordDecoder{CharsetReader: newCharsetReader}
+
+// decodeHeader decodes the RFC 2047 encoded-words of a single line with DecodeRFC2047, leaving any
+// that cannot be decoded as they were.
+func decodeHeader(input string) string {
+	header, _ := DecodeRFC2047(input)
 	return header
 }
 
 // decodeToUTF8Base64Header decodes a MIME header per RFC 2047, reencoding to =?utf-8b?
+// Whitespace separated tokens are scanned in a single pass, runs of linear-white-space are
+// collapsed to a single space.
 func decodeToUTF8Base64Header(input string) string {
 	if !strings.Contains(input, "=?") {
 		// Don't scan if there is nothing to do here
 		return input
 	}
 
-	log.Printf("input = %q", input)
-	tokens := strings.FieldsFunc(input, isWhiteSpaceRune)
-	output := make([]string, len(tokens))
-	for i, token := range tokens {
+	output := &strings.Builder{}
+	output.Grow(len(input))
+	first := true
+	for i := 0; i < len(input); {
+		// Skip linear-white-space
+		for i < len(input) && isWhiteSpaceByte(input[i]) {
+			i++
+		}
+		start := i
+		for i < len(input) && !isWhiteSpaceByte(input[i]) {
+			i++
+		}
+		if start == i {
+			break
+		}
+		token := input[start:i]
+
+		// Return space separated tokens
+		if !first {
+			output.WriteByte(' ')
+		}
+		first = false
 		if len(token) > 4 && strings.Contains(token, "=?") {
 			// Stash parenthesis, they should not be encoded
-			prefix := ""
-			suffix := ""
 			if token[0] == '(' {
-				prefix = "("
+				output.WriteByte('(')
 				token = token[1:]
 			}
-			if token[len(token)-1] == ')' {
-				suffix = ")"
+			suffix := token[len(token)-1] == ')'
+			if suffix {
 				token = token[:len(token)-1]
 			}
 			// Base64 encode token
-			output[i] = prefix + mime.BEncoding.Encode("UTF-8", decodeHeader(token)) + suffix
+			output.WriteString(mime.BEncoding.Encode("UTF-8", decodeHeader(token)))
+			if suffix {
+				output.WriteByte(')')
+			}
 		} else {
-			output[i] = token
+			output.WriteString(token)
 		}
-		log.Printf("%v %q %q", i, token, output[i])
 	}
-
-	// Return space separated tokens
-	return strings.Join(output, " ")
+	return output.String()
 }
 
-// Detects a RFC-822 linear-white-space, passed to strings.FieldsFunc
-func isWhiteSpaceRune(r rune) bool {
-	switch r {
-	case ' ':
-		return true
-	case '\t':
-		return true
-	case '\r':
-		return true
-	case '\n':
+// Detects a RFC-822 linear-white-space byte
+func isWhiteSpaceByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\r', '\n':
 		return true
 	default:
 		return false
@@ -189,39 +462,13 @@ func isWhiteSpaceRune(r rune) bool {
 }
 
 func parseMediaType(ctype string) (string, map[string]string, error) {
-	// Parse Content-Type header
-	mtype, mparams, err := ParseMediaType(ctype)
-	if err != nil {
-		// Small hack to remove harmless charset duplicate params
-		mctype := parseBadContentType(ctype, ";")
-		mtype, mparams, err = ParseMediaType(mctype)
-		if err != nil {
-			// Some badly formed content-types forget to send a ; between fields
-			mctype := parseBadContentType(ctype, " ")
-			if strings.Contains(mctype, `name=""`) {
-				mctype = strings.Replace(mctype, `name=""`, `name=" "`, -1)
-			}
-			mtype, mparams, err = ParseMediaType(mctype)
-			if err != nil {
-				return "", make(map[string]string), err
-			}
-		}
-	}
+	mtype, mparams, _, err := ParseMediaType(ctype)
 	return mtype, mparams, err
 }
 
-func parseBadContentType(ctype, sep string) string {
-	cp := strings.Split(ctype, sep)
-	mctype := ""
-	for _, p := range cp {
-		if strings.Contains(p, "=") {
-			params := strings.Split(p, "=")
-			if !strings.Contains(mctype, params[0]+"=") {
-				mctype += p + ";"
-			}
-		} else {
-			mctype += p + ";"
-		}
-	}
-	return mctype
+// parseContentID returns the msg-id of a Content-ID header value without its angle brackets.
+func parseContentID(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "<")
+	return strings.TrimSpace(strings.TrimSuffix(value, ">"))
 }
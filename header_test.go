@@ -2,6 +2,9 @@ package mime
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"net/textproto"
 	"strings"
 	"testing"
 )
@@ -273,7 +276,7 @@ func TestReadHeader(t *testing.T) {
 		// Reader we will share with readHeader()
 		r := bufio.NewReader(strings.NewReader(prefix + tt.input + suffix))
 
-		header, err := readHeader(r)
+		header, _, err := readHeader(r)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -313,3 +316,240 @@ func TestReadHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestReadHeaderFields(t *testing.T) {
+	raw := "Received: from b\r\nSubject: first\r\n  line\r\n: orphan\r\n" +
+		"Received: from a\r\nX-Note: folded\r\nunindented\r\n\r\nbody\r\n"
+	fields, warnings, err := ReadHeader(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HeaderField{
+		{"Received", "from b"},
+		{"Subject", "first line"},
+		{"Received", "from a"},
+		{"X-Note", "folded unindented"},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("got fields %q, want %q", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("field %d == %q, want %q", i, fields[i], want[i])
+		}
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("got warnings %v, want 2", warnings)
+	}
+	for i, line := range []string{": orphan", "unindented"} {
+		if !errors.Is(warnings[i], ErrorMalformedHeader) {
+			t.Errorf("warning %v is not %v", warnings[i], ErrorMalformedHeader)
+		}
+		if off := warnings[i].(*Error).Offset; off != strings.Index(raw, line) {
+			t.Errorf("warning %v at offset %d, want %d", warnings[i], off, strings.Index(raw, line))
+		}
+	}
+
+	fields, warnings, err = ReadHeader(strings.NewReader("Subject: no blank line"))
+	if err != nil || len(fields) != 1 || fields[0].Value != "no blank line" || len(warnings) != 0 {
+		t.Errorf("got fields %q, warnings %v, error %v", fields, warnings, err)
+	}
+}
+
+func TestValidateHeaderField(t *testing.T) {
+	var ttable = []struct {
+		name, value string
+		valid       bool
+	}{
+		{"Subject", "Hello world", true},
+		{"Subject", "tab\tseparated", true},
+		{"Subject", "caf\xc3\xa9", true},
+		{"X-Empty", "", true},
+		{"", "value", false},
+		{"Sub ject", "value", false},
+		{"Sub:ject", "value", false},
+		{"Subject\r\nBcc", "victim@example.com", false},
+		{"Subject", "hi\r\nBcc: victim@example.com", false},
+		{"Subject", "hi\nBcc: victim@example.com", false},
+		{"Subject", "hi\rthere", false},
+		{"Subject", "nul\x00byte", false},
+		{"Subject", "del\x7f", false},
+	}
+
+	for _, tt := range ttable {
+		err := ValidateHeaderField(tt.name, tt.value)
+		if tt.valid {
+			if err != nil {
+				t.Errorf("ValidateHeaderField(%q, %q) returned error: %v", tt.name, tt.value, err)
+			}
+			continue
+		}
+		if _, ok := err.(*HeaderFieldError); !ok {
+			t.Errorf("ValidateHeaderField(%q, %q) == %v, want *HeaderFieldError",
+				tt.name, tt.value, err)
+		}
+	}
+}
+
+func TestPartSetHeaderInjection(t *testing.T) {
+	p := NewPart(nil)
+	if err := p.SetHeader("Subject", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddHeader("X-Tag", "one"); err != nil {
+		t.Fatal(err)
+	}
+	err := p.SetHeader("Subject", "hi\r\nBcc: victim@example.com")
+	if _, ok := err.(*HeaderFieldError); !ok {
+		t.Errorf("SetHeader error == %v, want *HeaderFieldError", err)
+	}
+	err = p.AddHeader("X-Tag\n", "two")
+	if _, ok := err.(*HeaderFieldError); !ok {
+		t.Errorf("AddHeader error == %v, want *HeaderFieldError", err)
+	}
+
+	if got, want := p.Header.Get("Subject"), "hi"; got != want {
+		t.Errorf("Subject == %q, want: %q", got, want)
+	}
+	if got := p.Header["X-Tag"]; len(got) != 1 {
+		t.Errorf("X-Tag == %q, want a single value", got)
+	}
+	if got := p.Header.Get("Bcc"); got != "" {
+		t.Errorf("Bcc == %q, want it absent", got)
+	}
+}
+
+func TestParseContentID(t *testing.T) {
+	ttable := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"<part1.abc@example.com>", "part1.abc@example.com"},
+		{"  < spaced@example.com >  ", "spaced@example.com"},
+		{"unbracketed@example.com", "unbracketed@example.com"},
+	}
+	for _, tt := range ttable {
+		if got := parseContentID(tt.in); got != tt.want {
+			t.Errorf("parseContentID(%q) == %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMIMEVersion(t *testing.T) {
+	ttable := []struct {
+		header      string
+		wantVersion string
+		wantPresent bool
+		wantWarning bool
+	}{
+		{"MIME-Version: 1.0\r\nContent-Type: text/plain\r\n", "1.0", true, false},
+		{"Mime-version: 1.0 (produced by (nested) mailer)\r\n", "1.0", true, false},
+		{"MIME-Version: (comment) 1. 0\r\n", "1.0", true, false},
+		{"MIME-Version:\r\nContent-Type: text/plain\r\n", "", true, false},
+		{"Content-Type: text/plain\r\n", "", false, true},
+		{"Content-Transfer-Encoding: base64\r\n", "", false, true},
+		{"Subject: plain RFC 5322\r\n", "", false, false},
+	}
+	for _, tt := range ttable {
+		p, err := ReadParts(strings.NewReader(tt.header + "\r\nhello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.MIMEVersion != tt.wantVersion || p.HasMIMEVersion != tt.wantPresent {
+			t.Errorf("%q: got MIMEVersion %q, %v, want %q, %v", tt.header, p.MIMEVersion,
+				p.HasMIMEVersion, tt.wantVersion, tt.wantPresent)
+		}
+		warned := false
+		for _, e := range p.Errors {
+			warned = warned || errors.Is(e, ErrorMissingMIMEVersion)
+		}
+		if warned != tt.wantWarning {
+			t.Errorf("%q: got Errors %v, want warning %v", tt.header, p.Errors, tt.wantWarning)
+		}
+	}
+
+	// Encapsulated messages need their own, but parts of a multipart do not
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nbody\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" +
+		"Subject: inner\r\nContent-Type: text/plain\r\n\r\ninner\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warned []*Part
+	p.Walk(func(p *Part) error {
+		for _, e := range p.Errors {
+			if errors.Is(e, ErrorMissingMIMEVersion) {
+				warned = append(warned, p)
+			}
+		}
+		return nil
+	})
+	if len(warned) != 1 || warned[0].Parent.ContentType != ContentTypeMessageRfc822 {
+		t.Errorf("got warnings for %v, want the encapsulated message", warned)
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	ttable := []struct {
+		input, want string
+	}{
+		{"1.0", "1.0"},
+		{" 1.0 (produced by (nested) mailer) ", "1.0"},
+		{"(comment)1.0", "1.0"},
+		{"Mon, 2 Jan 2006 15:04:05 -0700 (PDT)", "Mon, 2 Jan 2006 15:04:05 -0700"},
+		{"<id@example.com>(generated)", "<id@example.com>"},
+		{"John (the) Smith <j@example.com>", "John Smith <j@example.com>"},
+		{"a(b)c", "a c"},
+		{`"Smith (Sales)" <s@example.com>`, `"Smith (Sales)" <s@example.com>`},
+		{`"a \" (b)" c`, `"a \" (b)" c`},
+		{"user@[1.2.3.4 (x)] (y)", "user@[1.2.3.4 (x)]"},
+		{`a (escaped \) paren) b`, "a b"},
+		{"a (unterminated", "a"},
+		{"a) b", "a) b"},
+	}
+	for _, tt := range ttable {
+		if got := StripComments(tt.input); got != tt.want {
+			t.Errorf("StripComments(%q) == %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	p, err := ReadParts(strings.NewReader(
+		"Content-Type: image/png\r\nContent-ID: <logo@example.com> (company logo)\r\n\r\npng"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ContentID != "logo@example.com" {
+		t.Errorf("ContentID == %q, want %q", p.ContentID, "logo@example.com")
+	}
+}
+
+func TestEncodeHeaderInjection(t *testing.T) {
+	for _, header := range []textproto.MIMEHeader{
+		{"Subject": {"hi\r\nBcc: victim@example.com"}},
+		{"Subject": {"hi\nBcc: victim@example.com"}},
+		{"X-Tag\r\nBcc": {"victim@example.com"}},
+		{"": {"value"}},
+	} {
+		p := NewPart(nil)
+		p.Header = header
+		buf := &bytes.Buffer{}
+		err := p.Encode(buf)
+		if _, ok := err.(*HeaderFieldError); !ok {
+			t.Errorf("Encode() with %q error == %v, want *HeaderFieldError", header, err)
+		}
+		if strings.Contains(buf.String(), "Bcc") {
+			t.Errorf("Encode() with %q wrote %q", header, buf)
+		}
+	}
+
+	// Names the parser accepts still encode
+	p := NewPart(nil)
+	p.Header = textproto.MIMEHeader{"Audio Mode": {"None"}}
+	buf := &bytes.Buffer{}
+	if err := p.Encode(buf); err != nil || buf.String() != "Audio Mode: None\r\n\r\n" {
+		t.Errorf("Encode() == %q, %v, want %q", buf, err, "Audio Mode: None\r\n\r\n")
+	}
+}
@@ -0,0 +1,120 @@
+package mime
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PartIndex locates the Parts of a tree by Descriptor and Content-ID without walking it, see
+// Part.Index.
+type PartIndex struct {
+	parts        []*Part
+	byDescriptor map[string]*Part
+	byContentID  map[string]*Part
+}
+
+// Index returns the PartIndex of the tree rooted at p, building it on first use and caching it
+// until the tree changes.  SetHeader, AddHeader and Compose discard the cached index of the Part
+// and its ancestors themselves; callers changing Subparts, Descriptor or Header directly must call
+// InvalidateIndex.  Index may be called by multiple goroutines at once.
+func (p *Part) Index() *PartIndex {
+	if x, _ := p.index.Load().(*PartIndex); x != nil {
+		return x
+	}
+	x := newPartIndex(p)
+	p.index.Store(x)
+	return x
+}
+
+// InvalidateIndex discards the cached PartIndex of the Part and of each of its ancestors, after
+// the Part or its Subparts have been changed.
+func (p *Part) InvalidateIndex() {
+	for ; p != nil; p = p.Parent {
+		if x, _ := p.index.Load().(*PartIndex); x != nil {
+			p.index.Store((*PartIndex)(nil))
+		}
+	}
+}
+
+// newPartIndex returns the PartIndex of the tree rooted at root.
+func newPartIndex(root *Part) *PartIndex {
+	x := &PartIndex{
+		byDescriptor: make(map[string]*Part),
+		byContentID:  make(map[string]*Part),
+	}
+	root.Walk(func(p *Part) error {
+		x.parts = append(x.parts, p)
+		if _, ok := x.byDescriptor[p.Descriptor]; !ok && p.Descriptor != "" {
+			x.byDescriptor[p.Descriptor] = p
+		}
+		// From the header rather than ContentID, which SetHeader does not update
+		id := parseContentID(StripComments(p.Header.Get(hnContentID)))
+		if _, ok := x.byContentID[id]; !ok && id != "" {
+			x.byContentID[id] = p
+		}
+		return nil
+	})
+	return x
+}
+
+// Parts returns every Part of the tree, in tree order, which is also Descriptor order.  The slice
+// is shared and must not be modified.
+func (x *PartIndex) Parts() []*Part {
+	return x.parts
+}
+
+// Descriptor returns the Part with the Descriptor d, e.g. "2.1", or nil if there is none.  Of a
+// message/rfc822 Part and the Part it encloses, which share a Descriptor, the former is returned.
+func (x *PartIndex) Descriptor(d string) *Part {
+	return x.byDescriptor[d]
+}
+
+// ContentID returns the first Part, in tree order, with the Content-ID id, given with or without
+// angle brackets or as a cid: URL, or nil if there is none.
+func (x *PartIndex) ContentID(id string) *Part {
+	id = strings.TrimSpace(id)
+	if len(id) > 4 && strings.EqualFold(id[:4], "cid:") {
+		id = id[4:]
+	}
+	return x.byContentID[parseContentID(id)]
+}
+
+// SortByDescriptor sorts parts by Descriptor, numerically by each dot separated component, so that
+// "2" precedes "10" and "1.2" precedes "2".  Parts with equal Descriptors keep their order.
+func SortByDescriptor(parts []*Part) {
+	sort.SliceStable(parts, func(i, j int) bool {
+		return compareDescriptors(parts[i].Descriptor, parts[j].Descriptor) < 0
+	})
+}
+
+// compareDescriptors returns -1, 0 or +1 as a is ordered before, with or after b.  Components that
+// are not numbers, such as the empty Descriptor of a single part message, sort first.
+func compareDescriptors(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr != nil && berr == nil:
+			return -1
+		case aerr == nil && berr != nil:
+			return 1
+		case aerr != nil:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
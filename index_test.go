@@ -0,0 +1,101 @@
+package mime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartIndex(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: multipart/related; boundary=r\r\n\r\n" +
+		"--r\r\nContent-Type: text/html\r\n\r\n<img src=\"cid:logo@x\">\r\n" +
+		"--r\r\nContent-Type: image/png\r\nContent-ID: <logo@x>\r\n\r\npng\r\n" +
+		"--r--\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\nContent-ID: <msg@x>\r\n\r\nforwarded\r\n" +
+		"--b--\r\n"
+	root, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := root.Index()
+	if root.Index() != x {
+		t.Error("Index() was not cached")
+	}
+	if len(x.Parts()) != 6 {
+		t.Errorf("Parts() == %v, want 6 Parts", x.Parts())
+	}
+	ttable := []struct {
+		descriptor, ctype string
+	}{
+		{"0", "multipart/mixed"},
+		{"1.0", "multipart/related"},
+		{"1.2", "image/png"},
+		{"2", "message/rfc822"},
+		{"3", ""},
+	}
+	for _, tt := range ttable {
+		p := x.Descriptor(tt.descriptor)
+		if p == nil && tt.ctype != "" || p != nil && p.ContentType != tt.ctype {
+			t.Errorf("Descriptor(%q) == %v, want %v", tt.descriptor, p, tt.ctype)
+		}
+	}
+	for _, id := range []string{"logo@x", "<logo@x>", "cid:logo@x"} {
+		if p := x.ContentID(id); p != root.Subparts[0].Subparts[1] {
+			t.Errorf("ContentID(%q) == %v, want 1.2", id, p)
+		}
+	}
+	if p := x.ContentID("msg@x"); p != root.Subparts[1].Subparts[0] {
+		t.Errorf("ContentID(\"msg@x\") == %v, want the enclosed message", p)
+	}
+
+	// Changing a Part discards the index of the Part and its ancestors
+	html := root.Subparts[0].Subparts[0]
+	related := root.Subparts[0].Index()
+	other := root.Subparts[1].Index()
+	if err := html.SetHeader("Content-ID", "<body@x>"); err != nil {
+		t.Fatal(err)
+	}
+	if root.Index() == x || root.Subparts[0].Index() == related {
+		t.Error("SetHeader() did not invalidate the index")
+	}
+	if root.Subparts[1].Index() != other {
+		t.Error("SetHeader() invalidated the index of an unrelated Part")
+	}
+	if p := root.Index().ContentID("body@x"); p != html {
+		t.Errorf("ContentID(\"body@x\") == %v, want %v", p, html)
+	}
+}
+
+func TestSortByDescriptor(t *testing.T) {
+	var parts []*Part
+	for _, d := range []string{"10", "2.1", "", "1.10", "2", "1.2", "2.0", "1"} {
+		parts = append(parts, &Part{Descriptor: d})
+	}
+	SortByDescriptor(parts)
+	var got []string
+	for _, p := range parts {
+		got = append(got, p.Descriptor)
+	}
+	if want := ",1,1.2,1.10,2,2.0,2.1,10"; strings.Join(got, ",") != want {
+		t.Errorf("SortByDescriptor() == %q, want %q", strings.Join(got, ","), want)
+	}
+
+	f, err := os.Open(filepath.Join("testdata", "parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	root, err := ReadParts(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts = append([]*Part(nil), root.Index().Parts()...)
+	SortByDescriptor(parts)
+	for i, p := range parts {
+		if p != root.Index().Parts()[i] {
+			t.Errorf("Parts()[%d] == %v, which sorts at %v", i, root.Index().Parts()[i], p)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package mime
+
+import (
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Mailing list header names, RFC 2369, RFC 2919 and RFC 8058
+	hnListArchive         = "List-Archive"
+	hnListHelp            = "List-Help"
+	hnListID              = "List-Id"
+	hnListOwner           = "List-Owner"
+	hnListPost            = "List-Post"
+	hnListSubscribe       = "List-Subscribe"
+	hnListUnsubscribe     = "List-Unsubscribe"
+	hnListUnsubscribePost = "List-Unsubscribe-Post"
+
+	// oneClickUnsubscribe is the only value RFC 8058 allows for List-Unsubscribe-Post
+	oneClickUnsubscribe = "List-Unsubscribe=One-Click"
+)
+
+// ListHeaders holds the mailing list fields of a message.  URL lists preserve the order of the
+// header, which RFC 2369 defines as the sender's order of preference.
+type ListHeaders struct {
+	ID   string // List-Id identifier, without angle brackets
+	Name string // Decoded phrase preceding the List-Id identifier, if any
+
+	Archive     []*url.URL
+	Help        []*url.URL
+	Owner       []*url.URL
+	Post        []*url.URL
+	Subscribe   []*url.URL
+	Unsubscribe []*url.URL
+
+	PostDisabled bool // List-Post was "NO", posting to the list is not allowed
+	OneClick     bool // RFC 8058 One-Click unsubscription via HTTPS POST is supported
+}
+
+// ParseListHeaders extracts the mailing list fields from header.  Nil is returned if the header
+// has none of them.  URLs that can not be parsed are skipped.
+func ParseListHeaders(header textproto.MIMEHeader) *ListHeaders {
+	found := false
+	for _, k := range []string{hnListArchive, hnListHelp, hnListID, hnListOwner, hnListPost,
+		hnListSubscribe, hnListUnsubscribe} {
+		if _, ok := header[k]; ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	l := &ListHeaders{
+		Archive:     parseListURLs(header.Get(hnListArchive)),
+		Help:        parseListURLs(header.Get(hnListHelp)),
+		Owner:       parseListURLs(header.Get(hnListOwner)),
+		Post:        parseListURLs(header.Get(hnListPost)),
+		Subscribe:   parseListURLs(header.Get(hnListSubscribe)),
+		Unsubscribe: parseListURLs(header.Get(hnListUnsubscribe)),
+	}
+	l.ID, l.Name = parseListID(header.Get(hnListID))
+	l.PostDisabled = strings.EqualFold(strings.TrimSpace(header.Get(hnListPost)), "NO")
+
+	// RFC 8058 requires both the POST field and an HTTPS unsubscribe URL
+	if strings.EqualFold(strings.TrimSpace(header.Get(hnListUnsubscribePost)), oneClickUnsubscribe) {
+		l.OneClick = l.UnsubscribeURL("https") != nil
+	}
+	return l
+}
+
+// UnsubscribeURL returns the most preferred List-Unsubscribe URL with the given scheme, such as
+// "mailto" or "https", or nil if there is none.
+func (l *ListHeaders) UnsubscribeURL(scheme string) *url.URL {
+	for _, u := range l.Unsubscribe {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return u
+		}
+	}
+	return nil
+}
+
+// parseListID splits a List-Id value such as `Go Nuts <golang-nuts.googlegroups.com>` into its
+// identifier and decoded phrase.
+func parseListID(value string) (id, name string) {
+	value = strings.TrimSpace(value)
+	start := strings.LastIndexByte(value, '<')
+	end := strings.LastIndexByte(value, '>')
+	if start == -1 || end < start {
+		// Some lists omit the angle brackets
+		return value, ""
+	}
+	name = strings.TrimSpace(value[:start])
+	name = strings.Trim(name, `"`)
+	return strings.TrimSpace(value[start+1 : end]), decodeHeader(name)
+}
+
+// parseListURLs returns the angle bracketed URLs from an RFC 2369 field, ignoring comments and any
+// text outside of the brackets.
+func parseListURLs(value string) []*url.URL {
+	var urls []*url.URL
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case '<':
+			if depth > 0 {
+				continue
+			}
+			end := strings.IndexByte(value[i:], '>')
+			if end == -1 {
+				return urls
+			}
+			// Whitespace may have been introduced by folding
+			raw := strings.Join(strings.Fields(value[i+1:i+end]), "")
+			if u, err := url.Parse(raw); err == nil && u.Scheme != "" {
+				urls = append(urls, u)
+			}
+			i += end
+		}
+	}
+	return urls
+}
@@ -0,0 +1,69 @@
+package mime
+
+import (
+	"net/textproto"
+	"testing"
+)
+
+func TestParseListHeaders(t *testing.T) {
+	header := textproto.MIMEHeader{
+		"List-Id": {`"Go Nuts" <golang-nuts.googlegroups.com>`},
+		"List-Unsubscribe": {
+			"<mailto:unsub@example.com?subject=unsubscribe>, " +
+				"(web form) <https://example.com/unsub?id=1 2>"},
+		"List-Unsubscribe-Post": {"List-Unsubscribe=One-Click"},
+		"List-Post":             {"NO"},
+		"List-Archive":          {"<https://example.com/archive> (old: <http://old.example.com>)"},
+	}
+	l := ParseListHeaders(header)
+	if l == nil {
+		t.Fatal("ParseListHeaders returned nil")
+	}
+	if got, want := l.ID, "golang-nuts.googlegroups.com"; got != want {
+		t.Errorf("ID == %q, want: %q", got, want)
+	}
+	if got, want := l.Name, "Go Nuts"; got != want {
+		t.Errorf("Name == %q, want: %q", got, want)
+	}
+	if len(l.Unsubscribe) != 2 {
+		t.Fatalf("Unsubscribe == %v, want 2 URLs", l.Unsubscribe)
+	}
+	if got, want := l.UnsubscribeURL("mailto").Opaque, "unsub@example.com"; got != want {
+		t.Errorf("mailto unsubscribe == %q, want: %q", got, want)
+	}
+	if got, want := l.UnsubscribeURL("HTTPS").String(), "https://example.com/unsub?id=12"; got != want {
+		t.Errorf("https unsubscribe == %q, want: %q", got, want)
+	}
+	if !l.OneClick {
+		t.Error("OneClick == false, want true")
+	}
+	if !l.PostDisabled || len(l.Post) != 0 {
+		t.Errorf("PostDisabled == %v, Post == %v; want true and no URLs", l.PostDisabled, l.Post)
+	}
+	if len(l.Archive) != 1 || l.Archive[0].Host != "example.com" {
+		t.Errorf("Archive == %v, want only the uncommented URL", l.Archive)
+	}
+}
+
+func TestParseListHeadersOneClickRequiresHTTPS(t *testing.T) {
+	header := textproto.MIMEHeader{
+		"List-Unsubscribe":      {"<mailto:unsub@example.com>"},
+		"List-Unsubscribe-Post": {"List-Unsubscribe=One-Click"},
+	}
+	l := ParseListHeaders(header)
+	if l == nil {
+		t.Fatal("ParseListHeaders returned nil")
+	}
+	if l.OneClick {
+		t.Error("OneClick == true without an HTTPS URL")
+	}
+	if l.UnsubscribeURL("https") != nil {
+		t.Error("UnsubscribeURL(https) should be nil")
+	}
+}
+
+func TestParseListHeadersAbsent(t *testing.T) {
+	if l := ParseListHeaders(textproto.MIMEHeader{"Subject": {"hi"}}); l != nil {
+		t.Errorf("ParseListHeaders == %+v, want nil", l)
+	}
+}
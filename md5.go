@@ -0,0 +1,52 @@
+package mime
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"hash"
+	"io"
+	"strings"
+)
+
+// md5Verifier checks transfer decoded content against the RFC 1864 Content-MD5 header as it is
+// read, adding a warning to the Part if they do not match once the content is exhausted, see
+// addDecodeWarning.
+type md5Verifier struct {
+	r    io.Reader
+	part *Part
+	want string
+	hash hash.Hash
+	done bool
+}
+
+// newMD5Verifier returns a reader verifying content read through r against the base64 encoded
+// digest sum.
+func newMD5Verifier(p *Part, r io.Reader, sum string) *md5Verifier {
+	return &md5Verifier{
+		r:    r,
+		part: p,
+		want: strings.TrimSpace(sum),
+		hash: md5.New(),
+	}
+}
+
+// Read method for io.Reader interface.
+func (v *md5Verifier) Read(b []byte) (n int, err error) {
+	n, err = v.r.Read(b)
+	v.hash.Write(b[:n])
+	if err == io.EOF && !v.done {
+		v.done = true
+		got := base64.StdEncoding.EncodeToString(v.hash.Sum(nil))
+		if got != v.want {
+			v.part.addDecodeWarning(
+				ErrorContentMD5, "Content-MD5 header is %q, content digest is %q", v.want, got)
+		}
+	}
+	return n, err
+}
+
+// contentMD5 returns the value of a Content-MD5 header for content.
+func contentMD5(content []byte) string {
+	sum := md5.Sum(content)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package mime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestContentMD5RoundTrip(t *testing.T) {
+	b := NewBuilder(WithContentMD5())
+	b.SetText("Hello MD5\n")
+	if err := b.Attach(strings.NewReader("binary"), "a.bin", "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ReadParts(buf, WithContentMD5Verification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range p.Subparts {
+		if s.Header.Get("Content-MD5") == "" {
+			t.Errorf("%v has no Content-MD5 header", s)
+		}
+		d, err := s.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(d); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Errors) != 0 {
+			t.Errorf("%v has unexpected errors: %v", s, s.Errors)
+		}
+	}
+}
+
+func TestContentMD5Mismatch(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-MD5: " + contentMD5([]byte("original")) + "\r\n" +
+		"\r\n" +
+		"tampered"
+	p, err := ReadParts(strings.NewReader(raw), WithContentMD5Verification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reading the content again, also concurrently, does not repeat the warning
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		d, err := p.Decode()
+		if i%2 == 1 {
+			d, err = p.DecodeRaw()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ioutil.ReadAll(d); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(p.Errors) != 1 {
+		t.Fatalf("got %d errors, want 1: %v", len(p.Errors), p.Errors)
+	}
+	e, ok := p.Errors[0].(*Error)
+	if !ok {
+		t.Fatalf("got %T, want *Error", p.Errors[0])
+	}
+	if e.Name != ErrorContentMD5.Error() || e.Severe {
+		t.Errorf("got %+v, want a %q warning", e, ErrorContentMD5)
+	}
+}
+
+func TestContentMD5NotVerifiedByDefault(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-MD5: " + contentMD5([]byte("original")) + "\r\n" +
+		"\r\n" +
+		"tampered"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := p.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Errors) != 0 {
+		t.Errorf("got errors %v, want none without WithContentMD5Verification", p.Errors)
+	}
+}
@@ -0,0 +1,219 @@
+package mime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Repair describes a modification ParseMediaType made to a malformed media type value in order to
+// parse it.
+type Repair struct {
+	Param  string // Lowercase name of the parameter repaired, or "" if there is none
+	Detail string // Human readable description, e.g. `missing semicolon before "name"`
+}
+
+func (r Repair) String() string {
+	return r.Detail
+}
+
+// ParseMediaType parses a Content-Type or Content-Disposition header value as mime.ParseMediaType
+// does, but works around common malformations with the rules used for the headers of Parts: missing
+// semicolons between parameters, unquoted values containing spaces or semicolons, unescaped or
+// unterminated quotes, duplicate parameters and values repeating their own name.  repairs
+// describes each modification needed to parse the value, and is empty if it was well formed.  The
+// params map is never nil.
+func ParseMediaType(v string) (mtype string, params map[string]string, repairs []Repair,
+	err error) {
+	mtype, params, err = parseStrictMediaType(v)
+	if err == errNoMediaType {
+		// Nothing to repair
+		return "", make(map[string]string), nil, err
+	}
+	if err != nil {
+		var recovered string
+		recovered, repairs = recoverMediaType(v)
+		mtype, params, err = parseStrictMediaType(recovered)
+		if err != nil {
+			return "", make(map[string]string), nil, err
+		}
+	}
+
+	// Values repeating their own name, e.g. charset="charset=utf-8"
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := params[k]
+		if len(value) > len(k) && strings.EqualFold(value[:len(k)+1], k+"=") {
+			params[k] = value[len(k)+1:]
+			repairs = append(repairs, Repair{Param: k,
+				Detail: fmt.Sprintf("stray %q prefix in value of %q", value[:len(k)+1], k)})
+		}
+	}
+	return mtype, params, repairs, nil
+}
+
+// mediaTypeParser is a lenient parser for malformed media type values, recording each repair it
+// makes.
+type mediaTypeParser struct {
+	params  []MediaParam
+	seen    map[string]bool
+	repairs []Repair
+}
+
+// recoverMediaType rewrites a malformed media type value into one parseStrictMediaType accepts, and
+// describes the repairs made.  It tolerates missing semicolons between parameters, unquoted values
+// containing spaces or semicolons, unescaped or unterminated quotes in quoted values, and
+// duplicate parameters, of which the first is kept.
+func recoverMediaType(v string) (string, []Repair) {
+	v = strings.TrimSpace(v)
+	i := strings.IndexFunc(v, isParamSeparator)
+	if i == -1 {
+		return v, nil
+	}
+	mp := &mediaTypeParser{seen: make(map[string]bool)}
+	mediatype := v[:i]
+	v = v[i:]
+
+	// last is the index of the last parameter kept if its value was unquoted, otherwise -1
+	last := -1
+	for {
+		sep := v
+		v = strings.TrimLeftFunc(v, isParamSeparator)
+		sep = sep[:len(sep)-len(v)]
+		if v == "" {
+			break
+		}
+		name, value, quoted, rest := mp.consumeParam(v)
+		if name == "" {
+			// A fragment without a name most likely continues an unquoted value split at a
+			// semicolon, e.g. filename=report; final.pdf
+			end := strings.IndexByte(rest, ';')
+			if end == -1 {
+				end = len(rest)
+			}
+			end += len(v) - len(rest)
+			frag := strings.TrimRightFunc(v[:end], unicode.IsSpace)
+			if last != -1 {
+				name := mp.params[last].Name
+				mp.repair(name, "unquoted value of %q contains a semicolon", name)
+				mp.params[last].Value += sep + frag
+			} else {
+				mp.repair("", "discarded %q", frag)
+			}
+			v = v[end:]
+			continue
+		}
+		if !strings.Contains(sep, ";") {
+			mp.repair(name, "missing semicolon before %q", name)
+		}
+		v = rest
+		last = -1
+		key := strings.ToLower(name)
+		if mp.seen[key] {
+			mp.repair(name, "duplicate parameter %q ignored", name)
+			continue
+		}
+		mp.seen[key] = true
+		mp.params = append(mp.params, MediaParam{Name: name, Value: value})
+		if !quoted {
+			last = len(mp.params) - 1
+		}
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(mediatype)
+	for _, p := range mp.params {
+		b.WriteString("; ")
+		b.WriteString(p.Name)
+		b.WriteByte('=')
+		b.WriteString(quoteParamValue(p.Value))
+	}
+	return b.String(), mp.repairs
+}
+
+func (mp *mediaTypeParser) repair(param, format string, args ...interface{}) {
+	mp.repairs = append(mp.repairs,
+		Repair{Param: strings.ToLower(param), Detail: fmt.Sprintf(format, args...)})
+}
+
+// consumeParam consumes a parameter from the start of v, returning its name, its unquoted value
+// and whether it was quoted.  A quoted value ends at the first quote followed by the end of the
+// value or the next parameter, so unescaped quotes inside it are kept; an unquoted value ends at
+// a semicolon or at white space followed by another parameter.  If v does not start with a
+// parameter, name is "" and rest starts after the leading token.
+func (mp *mediaTypeParser) consumeParam(v string) (name, value string, quoted bool, rest string) {
+	name, rest = consumeToken(v)
+	if name == "" {
+		// Skip a single character that cannot start a token
+		_, n := utf8.DecodeRuneInString(v)
+		return "", "", false, v[n:]
+	}
+	rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	if !strings.HasPrefix(rest, "=") {
+		return "", "", false, rest
+	}
+	rest = strings.TrimLeftFunc(rest[1:], unicode.IsSpace)
+
+	if strings.HasPrefix(rest, `"`) {
+		buf := &strings.Builder{}
+		unescaped := false
+		for i := 1; i < len(rest); i++ {
+			switch c := rest[i]; {
+			case c == '\\' && i+1 < len(rest):
+				i++
+				buf.WriteByte(rest[i])
+			case c == '"' && atParamBoundary(rest[i+1:]):
+				if unescaped {
+					mp.repair(name, "unescaped quote in value of %q", name)
+				}
+				return name, buf.String(), true, rest[i+1:]
+			default:
+				unescaped = unescaped || c == '"'
+				buf.WriteByte(c)
+			}
+		}
+		mp.repair(name, "unterminated quoted value of %q", name)
+		rest = rest[1:]
+	}
+
+	end := len(rest)
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == ';' || isWhiteSpaceByte(rest[i]) && startsParam(rest[i:]) {
+			end = i
+			break
+		}
+	}
+	return name, strings.TrimRightFunc(rest[:end], unicode.IsSpace), false, rest[end:]
+}
+
+// isParamSeparator returns true for the characters that may separate parameters.
+func isParamSeparator(r rune) bool {
+	return r == ';' || unicode.IsSpace(r)
+}
+
+// atParamBoundary returns true if v, following a closing quote, is empty or continues with the
+// next parameter.
+func atParamBoundary(v string) bool {
+	t := strings.TrimLeftFunc(v, unicode.IsSpace)
+	return t == "" || t[0] == ';' || len(t) < len(v) && startsParam(v)
+}
+
+// startsParam returns true if v is white space followed by a token and an equals sign.
+func startsParam(v string) bool {
+	name, rest := consumeToken(strings.TrimLeftFunc(v, unicode.IsSpace))
+	return name != "" && strings.HasPrefix(strings.TrimLeftFunc(rest, unicode.IsSpace), "=")
+}
+
+// quoteParamValue returns value as a token if possible, otherwise as a quoted-string.
+func quoteParamValue(value string) string {
+	if value != "" && strings.IndexFunc(value, isNotTokenChar) == -1 {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,147 @@
+package mime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseMediaTypeRepairs(t *testing.T) {
+	ttable := []struct {
+		in          string
+		wantType    string
+		wantParams  map[string]string
+		wantRepairs []string
+	}{
+		{
+			`attachment; filename="report; final.pdf"`,
+			"attachment", map[string]string{"filename": "report; final.pdf"}, nil,
+		},
+		{
+			`attachment; filename=report; final.pdf`,
+			"attachment", map[string]string{"filename": "report; final.pdf"},
+			[]string{`unquoted value of "filename" contains a semicolon`},
+		},
+		{
+			`application/pdf name="" charset=us-ascii`,
+			"application/pdf", map[string]string{"name": "", "charset": "us-ascii"},
+			[]string{`missing semicolon before "name"`, `missing semicolon before "charset"`},
+		},
+		{
+			`attachment; filename="a;b.pdf" size=3`,
+			"attachment", map[string]string{"filename": "a;b.pdf", "size": "3"},
+			[]string{`missing semicolon before "size"`},
+		},
+		{
+			`attachment; filename="He said "hi".pdf"; size=3`,
+			"attachment", map[string]string{"filename": `He said "hi".pdf`, "size": "3"},
+			[]string{`unescaped quote in value of "filename"`},
+		},
+		{
+			`attachment; filename=my file.pdf; size=10`,
+			"attachment", map[string]string{"filename": "my file.pdf", "size": "10"}, nil,
+		},
+		{
+			`text/plain charset=utf-8 name="a b.txt"`,
+			"text/plain", map[string]string{"charset": "utf-8", "name": "a b.txt"},
+			[]string{`missing semicolon before "charset"`, `missing semicolon before "name"`},
+		},
+		{
+			`text/html; charset="utf-8" format=flowed`,
+			"text/html", map[string]string{"charset": "utf-8", "format": "flowed"},
+			[]string{`missing semicolon before "format"`},
+		},
+		{
+			`text/plain; charset="utf-8"; CHARSET=us-ascii; name=a; b`,
+			"text/plain", map[string]string{"charset": "utf-8", "name": "a; b"},
+			[]string{`duplicate parameter "CHARSET" ignored`,
+				`unquoted value of "name" contains a semicolon`},
+		},
+		{
+			`application/pdf; name="unterminated.pdf`,
+			"application/pdf", map[string]string{"name": "unterminated.pdf"},
+			[]string{`unterminated quoted value of "name"`},
+		},
+		{
+			`image/png; name="a\"b.png"; x`,
+			"image/png", map[string]string{"name": `a"b.png`}, []string{`discarded "x"`},
+		},
+		{
+			`text/plain; charset="charset=utf-8"`,
+			"text/plain", map[string]string{"charset": "utf-8"},
+			[]string{`stray "charset=" prefix in value of "charset"`},
+		},
+	}
+	for _, tt := range ttable {
+		mtype, params, repairs, err := ParseMediaType(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if mtype != tt.wantType {
+			t.Errorf("%s: got type %q, want %q", tt.in, mtype, tt.wantType)
+		}
+		details := make([]string, len(repairs))
+		for i, r := range repairs {
+			details[i] = r.Detail
+		}
+		if strings.Join(details, "\n") != strings.Join(tt.wantRepairs, "\n") {
+			t.Errorf("%s: got repairs %q, want %q", tt.in, repairs, tt.wantRepairs)
+		}
+		if len(params) != len(tt.wantParams) {
+			t.Errorf("%s: got params %q, want %q", tt.in, params, tt.wantParams)
+			continue
+		}
+		for k, v := range tt.wantParams {
+			if params[k] != v {
+				t.Errorf("%s: got params %q, want %q", tt.in, params, tt.wantParams)
+				break
+			}
+		}
+	}
+}
+
+func TestParseMediaTypeRepairParams(t *testing.T) {
+	_, _, repairs, err := ParseMediaType(`text/plain; charset="utf-8"; CHARSET=us-ascii; x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Repair{
+		{"charset", `duplicate parameter "CHARSET" ignored`},
+		{"", `discarded "x"`},
+	}
+	if len(repairs) != len(want) || repairs[0] != want[0] || repairs[1] != want[1] {
+		t.Errorf("got repairs %+v, want %+v", repairs, want)
+	}
+
+	mtype, params, repairs, err := ParseMediaType("")
+	if err == nil || mtype != "" || params == nil || repairs != nil {
+		t.Errorf("ParseMediaType(\"\") == %q, %v, %v, %v", mtype, params, repairs, err)
+	}
+}
+
+func TestMediaTypeRepairWarnings(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain charset=utf-8\r\n" +
+		"Content-Disposition: attachment; filename=report; final.txt\r\n\r\nhello"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Provenance.Has(ContentTypeRepaired) || p.Charset != "utf-8" ||
+		p.Filename != "report; final.txt" {
+		t.Errorf("got provenance %v, charset %q, filename %q", p.Provenance, p.Charset,
+			p.Filename)
+	}
+	var got []string
+	for _, e := range p.Errors {
+		if errors.Is(e, ErrorMalformedMediaType) {
+			got = append(got, e.Error())
+		}
+	}
+	if len(got) != 2 || !strings.Contains(got[0], hnContentType) ||
+		!strings.Contains(got[1], hnContentDisposition) {
+		t.Errorf("got warnings %q, want one each for %s and %s", got, hnContentType,
+			hnContentDisposition)
+	}
+}
@@ -8,44 +8,53 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	errNoMediaType            = errors.New("mime: no media type")
+	errExpectedSlash          = errors.New("mime: expected slash after first token")
+	errExpectedSubtype        = errors.New("mime: expected token after slash")
+	errUnexpectedAfterSubtype = errors.New("mime: unexpected content after media subtype")
 )
 
 func checkMediaTypeDisposition(s string) error {
 	typ, rest := consumeToken(s)
 	if typ == "" {
-		return errors.New("mime: no media type")
+		return errNoMediaType
 	}
 	if rest == "" {
 		return nil
 	}
 	if !strings.HasPrefix(rest, "/") {
-		return errors.New("mime: expected slash after first token")
+		return errExpectedSlash
 	}
 	subtype, rest := consumeToken(rest[1:])
 	if subtype == "" {
-		return errors.New("mime: expected token after slash")
+		return errExpectedSubtype
 	}
 	if rest != "" {
-		return errors.New("mime: unexpected content after media subtype")
+		return errUnexpectedAfterSubtype
 	}
 	return nil
 }
 
-// ErrInvalidMediaParameter is returned by ParseMediaType if
+// ErrInvalidMediaParameter is returned by parseStrictMediaType if
 // the media type value was found but there was an error parsing
 // the optional parameters
 var ErrInvalidMediaParameter = errors.New("mime: invalid media parameter")
 
-// ParseMediaType parses a media type value and any optional
+// parseStrictMediaType parses a media type value and any optional
 // parameters, per RFC 1521.  Media types are the values in
 // Content-Type and Content-Disposition headers (RFC 2183).
-// On success, ParseMediaType returns the media type converted
+// On success, parseStrictMediaType returns the media type converted
 // to lowercase and trimmed of white space and a non-nil map.
 // The returned map, params, maps from the lowercase
 // attribute to the attribute value with its case preserved.
-func ParseMediaType(v string) (mediatype string, params map[string]string, err error) {
+func parseStrictMediaType(v string) (mediatype string, params map[string]string, err error) {
 	i := strings.Index(v, ";")
 	if i == -1 {
 		i = len(v)
@@ -106,60 +115,72 @@ func ParseMediaType(v string) (mediatype string, params map[string]string, err e
 
 	// Stitch together any continuations or things with stars
 	// (i.e. RFC 2231 things with stars: "foo*0" or "foo*")
-	var buf bytes.Buffer
 	for key, pieceMap := range continuation {
-		singlePartKey := key + "*"
-		if v, ok := pieceMap[singlePartKey]; ok {
-			decv := decode2231Enc(v)
-			params[key] = decv
-			continue
+		if v, ok := stitchContinuation(key, pieceMap); ok {
+			params[key] = v
 		}
+	}
 
-		buf.Reset()
-		valid := false
-		for n := 0; ; n++ {
-			simplePart := fmt.Sprintf("%s*%d", key, n)
-			if v, ok := pieceMap[simplePart]; ok {
-				valid = true
-				buf.WriteString(v)
-				continue
-			}
-			encodedPart := simplePart + "*"
-			if v, ok := pieceMap[encodedPart]; ok {
-				valid = true
-				if n == 0 {
-					buf.WriteString(decode2231Enc(v))
-				} else {
-					decv, _ := percentHexUnescape(v)
-					buf.WriteString(decv)
-				}
-			} else {
-				break
-			}
+	return
+}
+
+// stitchContinuation joins the RFC 2231 pieces of parameter key held in pieceMap, keyed "key*",
+// "key*0", "key*1*" and so on, percent-decoding those with stars and converting the result from
+// the charset named by the first to UTF-8.  False is returned if there are no pieces, or if the
+// value is in an unknown charset and is not valid UTF-8.
+func stitchContinuation(key string, pieceMap map[string]string) (string, bool) {
+	if v, ok := pieceMap[key+"*"]; ok {
+		charset, value := split2231Enc(v)
+		return decode2231Charset(charset, percentHexUnescape(value))
+	}
+
+	var buf bytes.Buffer
+	var charset string
+	valid := false
+	for n := 0; ; n++ {
+		simplePart := fmt.Sprintf("%s*%d", key, n)
+		if v, ok := pieceMap[simplePart]; ok {
+			valid = true
+			buf.WriteString(v)
+			continue
 		}
-		if valid {
-			params[key] = buf.String()
+		v, ok := pieceMap[simplePart+"*"]
+		if !ok {
+			break
 		}
+		valid = true
+		if n == 0 {
+			charset, v = split2231Enc(v)
+		}
+		buf.WriteString(percentHexUnescape(v))
 	}
-
-	return
+	if !valid {
+		return "", false
+	}
+	return decode2231Charset(charset, buf.String())
 }
 
-func decode2231Enc(v string) string {
+// split2231Enc splits the value of an RFC 2231 extended parameter, charset'language'value, into
+// its charset and still percent-encoded value.  The language is dropped.  A value without the
+// charset and language is taken to have neither.
+func split2231Enc(v string) (charset, value string) {
 	sv := strings.SplitN(v, "'", 3)
 	if len(sv) != 3 {
-		return ""
-	}
-	// TODO: ignoring lang in sv[1] for now. If anybody needs it we'll
-	// need to decide how to expose it in the API. But I'm not sure
-	// anybody uses it in practice.
-	charset := strings.ToLower(sv[0])
-	if charset != "us-ascii" && charset != "utf-8" {
-		// TODO: unsupported encoding
-		return ""
-	}
-	encv, _ := percentHexUnescape(sv[2])
-	return encv
+		return "", v
+	}
+	return sv[0], sv[2]
+}
+
+// decode2231Charset converts the percent-decoded value of an RFC 2231 extended parameter from
+// charset to UTF-8.  Values without a charset, or in one that is unknown, are kept if they are
+// valid UTF-8.
+func decode2231Charset(charset, value string) (string, bool) {
+	if charset != "" {
+		if s, err := convertToUTF8String(charset, []byte(value)); err == nil {
+			return s, true
+		}
+	}
+	return value, utf8.ValidString(value)
 }
 
 func isNotTokenChar(r rune) bool {
@@ -231,7 +252,87 @@ func consumeValue(v string) (value, rest string) {
 	return "", v
 }
 
+// MediaParam is a media type parameter as it appears in a header, with the case of its name
+// preserved and its value unquoted but otherwise undecoded.
+type MediaParam struct {
+	Name, Value string
+}
+
+// Params holds the parameters of a media type value, such as a Part's ContentParams, by name.
+// Parsed parameters have lowercase names, with RFC 2231 continuations already merged, but Params
+// built by hand may not; Param handles both.
+type Params map[string]string
+
+// Param returns the value of the parameter name, matched case-insensitively, and whether it is
+// present.  Values split into RFC 2231 continuations, e.g. "title*0" and "title*1*", are joined
+// and decoded.
+func (ps Params) Param(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if v, ok := ps[name]; ok {
+		return v, true
+	}
+	var pieces map[string]string
+	for k, v := range lowerParams(ps) {
+		switch {
+		case k == name:
+			return v, true
+		case strings.HasPrefix(k, name+"*"):
+			if pieces == nil {
+				pieces = make(map[string]string)
+			}
+			pieces[k] = v
+		}
+	}
+	return stitchContinuation(name, pieces)
+}
+
+// lowerParams returns a copy of ps with lowercase names.  Of names differing only in case, the
+// value of the lowercase name is kept, otherwise that of the first in sorted order, so that the
+// result does not depend upon the order of map iteration.
+func lowerParams(ps map[string]string) map[string]string {
+	keys := make([]string, 0, len(ps))
+	for k := range ps {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lower := make(map[string]string, len(ps))
+	for _, k := range keys {
+		lk := strings.ToLower(k)
+		if _, ok := lower[lk]; !ok || k == lk {
+			lower[lk] = ps[k]
+		}
+	}
+	return lower
+}
+
+// splitMediaParams returns the parameter portion of the media type value v, starting at its
+// first semicolon, and its parameters in their original order.  Parsing stops at the first
+// malformed parameter.
+func splitMediaParams(v string) (raw string, list []MediaParam) {
+	i := strings.Index(v, ";")
+	if i == -1 {
+		return "", nil
+	}
+	raw = v[i:]
+	v = raw
+	for len(v) > 0 {
+		key, value, rest := consumeRawMediaParam(v)
+		if key == "" {
+			break
+		}
+		list = append(list, MediaParam{Name: key, Value: value})
+		v = rest
+	}
+	return raw, list
+}
+
 func consumeMediaParam(v string) (param, value, rest string) {
+	param, value, rest = consumeRawMediaParam(v)
+	return strings.ToLower(param), value, rest
+}
+
+// consumeRawMediaParam is consumeMediaParam without lowercasing param.
+func consumeRawMediaParam(v string) (param, value, rest string) {
 	rest = strings.TrimLeftFunc(v, unicode.IsSpace)
 	if !strings.HasPrefix(rest, ";") {
 		return "", "", v
@@ -240,7 +341,6 @@ func consumeMediaParam(v string) (param, value, rest string) {
 	rest = rest[1:] // consume semicolon
 	rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
 	param, rest = consumeToken(rest)
-	param = strings.ToLower(param)
 	if param == "" {
 		return "", "", v
 	}
@@ -259,43 +359,22 @@ func consumeMediaParam(v string) (param, value, rest string) {
 	return param, value, rest
 }
 
-func percentHexUnescape(s string) (string, error) {
-	// Count %, check that they're well-formed.
-	percents := 0
-	for i := 0; i < len(s); {
-		if s[i] != '%' {
-			i++
+// percentHexUnescape decodes the %XX escapes of an RFC 2231 extended parameter value.  A % not
+// followed by two hex digits is kept as it is.
+func percentHexUnescape(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	t := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && ishex(s[i+1]) && ishex(s[i+2]) {
+			t = append(t, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
 			continue
 		}
-		percents++
-		if i+2 >= len(s) || !ishex(s[i+1]) || !ishex(s[i+2]) {
-			s = s[i:]
-			if len(s) > 3 {
-				s = s[0:3]
-			}
-			return "", fmt.Errorf("mime: bogus characters after %%: %q", s)
-		}
-		i += 3
-	}
-	if percents == 0 {
-		return s, nil
-	}
-
-	t := make([]byte, len(s)-2*percents)
-	j := 0
-	for i := 0; i < len(s); {
-		switch s[i] {
-		case '%':
-			t[j] = unhex(s[i+1])<<4 | unhex(s[i+2])
-			j++
-			i += 3
-		default:
-			t[j] = s[i]
-			j++
-			i++
-		}
+		t = append(t, s[i])
 	}
-	return string(t), nil
+	return string(t)
 }
 
 func ishex(c byte) bool {
@@ -6,6 +6,7 @@ package mime
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -217,6 +218,34 @@ func TestParseMediaType(t *testing.T) {
 			"attachment",
 			m("filename", "foo-ä.html")},
 
+		{`attachment; filename*=iso-8859-1'en'caf%E9.txt`,
+			"attachment",
+			m("filename", "café.txt")},
+		{`attachment; filename*0*=ISO-8859-1''caf; filename*1*=%E9; filename*2=".txt"`,
+			"attachment",
+			m("filename", "café.txt")},
+		{`attachment; filename*0*=utf-8''%E2%82; filename*1*=%AC.txt`,
+			"attachment",
+			m("filename", "€.txt")},
+		{`attachment; filename*=windows-1252''%80.txt`,
+			"attachment",
+			m("filename", "€.txt")},
+		{`attachment; filename*=''plain.txt`,
+			"attachment",
+			m("filename", "plain.txt")},
+		{`attachment; filename*=plain.txt`,
+			"attachment",
+			m("filename", "plain.txt")},
+		{`attachment; filename*=utf-8''100%.txt`,
+			"attachment",
+			m("filename", "100%.txt")},
+		{`attachment; filename="fallback.txt"; filename*=x-unknown''%FF.txt`,
+			"attachment",
+			m("filename", "fallback.txt")},
+		{`text/plain; charset*=us-ascii'en'utf-8; title*=koi8-r''%F0%D2%C9%D7%C5%D4`,
+			"text/plain",
+			m("charset", "utf-8", "title", "Привет")},
+
 		// Browsers also just send UTF-8 directly without RFC 2231,
 		// at least when the source page is served with UTF-8.
 		{`form-data; firstname="Брэд"; lastname="Фицпатрик"`,
@@ -230,7 +259,7 @@ func TestParseMediaType(t *testing.T) {
 		{`form-data; name="file"; filename="C:\dev\go\robots.txt"`, "form-data", m("name", "file", "filename", `C:\dev\go\robots.txt`)},
 	}
 	for _, test := range tests {
-		mt, params, err := ParseMediaType(test.in)
+		mt, params, err := parseStrictMediaType(test.in)
 		if err != nil {
 			if test.t != "" {
 				t.Errorf("for input %#q, unexpected error: %v", test.in, err)
@@ -273,22 +302,142 @@ var badMediaTypeTests = []badMediaTypeTest{
 
 func TestParseMediaTypeBogus(t *testing.T) {
 	for _, tt := range badMediaTypeTests {
-		mt, params, err := ParseMediaType(tt.in)
+		mt, params, err := parseStrictMediaType(tt.in)
 		if err == nil {
-			t.Errorf("ParseMediaType(%q) = nil error; want parse error", tt.in)
+			t.Errorf("parseStrictMediaType(%q) = nil error; want parse error", tt.in)
 			continue
 		}
 		if err.Error() != tt.err {
-			t.Errorf("ParseMediaType(%q) = err %q; want %q", tt.in, err.Error(), tt.err)
+			t.Errorf("parseStrictMediaType(%q) = err %q; want %q", tt.in, err.Error(), tt.err)
 		}
 		if params != nil {
-			t.Errorf("ParseMediaType(%q): got non-nil params on error", tt.in)
+			t.Errorf("parseStrictMediaType(%q): got non-nil params on error", tt.in)
 		}
 		if err != ErrInvalidMediaParameter && mt != "" {
-			t.Errorf("ParseMediaType(%q): got unexpected non-empty media type string", tt.in)
+			t.Errorf("parseStrictMediaType(%q): got unexpected non-empty media type string", tt.in)
 		}
 		if err == ErrInvalidMediaParameter && mt != tt.mt {
-			t.Errorf("ParseMediaType(%q): in case of invalid parameters: expected type %q, got %q", tt.in, tt.mt, mt)
+			t.Errorf("parseStrictMediaType(%q): in case of invalid parameters: expected type %q, got %q", tt.in, tt.mt, mt)
+		}
+	}
+}
+
+func TestSplitMediaParams(t *testing.T) {
+	tests := []struct {
+		v    string
+		raw  string
+		list []MediaParam
+	}{
+		{"text/plain", "", nil},
+		{
+			`Text/Plain; Format=Flowed;  charset="UTF-8" ;DelSp=yes`,
+			`; Format=Flowed;  charset="UTF-8" ;DelSp=yes`,
+			[]MediaParam{{"Format", "Flowed"}, {"charset", "UTF-8"}, {"DelSp", "yes"}},
+		},
+		{
+			`multipart/mixed; boundary=b; bogus`,
+			`; boundary=b; bogus`,
+			[]MediaParam{{"boundary", "b"}},
+		},
+	}
+	for _, test := range tests {
+		raw, list := splitMediaParams(test.v)
+		if raw != test.raw {
+			t.Errorf("splitMediaParams(%q) raw == %q, want %q", test.v, raw, test.raw)
+		}
+		if !reflect.DeepEqual(list, test.list) {
+			t.Errorf("splitMediaParams(%q) list == %v, want %v", test.v, list, test.list)
+		}
+	}
+}
+
+func TestParamsParam(t *testing.T) {
+	ps := Params{
+		"charset":  "utf-8",
+		"Format":   "flowed",
+		"title*0*": "us-ascii'en'This%20is%20",
+		"TITLE*1":  "split",
+		"name*":    "utf-8''caf%C3%A9.txt",
+		"empty":    "",
+	}
+	ttable := []struct {
+		name, want string
+		wantOK     bool
+	}{
+		{"charset", "utf-8", true},
+		{"CHARSET", "utf-8", true},
+		{"format", "flowed", true},
+		{"title", "This is split", true},
+		{"Name", "café.txt", true},
+		{"empty", "", true},
+		{"missing", "", false},
+	}
+	for _, tt := range ttable {
+		got, ok := ps.Param(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Param(%q) == %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	if _, ok := Params(nil).Param("charset"); ok {
+		t.Error("nil Params has a charset")
+	}
+}
+
+func TestLowerParams(t *testing.T) {
+	ps := map[string]string{"Charset": "a", "charset": "b", "CHARSET": "c", "Name": "d", "NAME": "e",
+		"format": "f"}
+	want := map[string]string{"charset": "b", "name": "e", "format": "f"}
+	for i := 0; i < 20; i++ {
+		if got := lowerParams(ps); !reflect.DeepEqual(got, want) {
+			t.Fatalf("lowerParams() == %v, want %v", got, want)
+		}
+		if got, _ := Params(ps).Param("NaMe"); got != "e" {
+			t.Fatalf("Param(\"NaMe\") == %q, want \"e\"", got)
+		}
+	}
+}
+
+func TestPartParams(t *testing.T) {
+	raw := "Content-Type: text/plain; Charset=\"UTF-8\"; title*0*=us-ascii'en'A%20; title*1=b\r\n" +
+		"Content-Disposition: attachment; FileName*=utf-8''r%C3%A9sum%C3%A9.txt; size=42\r\n" +
+		"\r\nhello"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttable := []struct {
+		get        func(string) (string, bool)
+		name, want string
+	}{
+		{p.ContentParam, "charset", "UTF-8"},
+		{p.ContentParam, "Title", "A b"},
+		{p.DispositionParam, "filename", "résumé.txt"},
+		{p.DispositionParam, "SIZE", "42"},
+	}
+	for _, tt := range ttable {
+		if got, ok := tt.get(tt.name); !ok || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+func TestRFC2231Filename(t *testing.T) {
+	ttable := []struct {
+		header, want string
+	}{
+		{"Content-Disposition: attachment; filename*0*=iso-8859-1'fr'r%E9sum; " +
+			"filename*1*=%E9.pdf\r\n", "résumé.pdf"},
+		{"Content-Type: application/pdf; name*0*=utf-8''%E2%82%AC; name*1=\" rates.pdf\"\r\n",
+			"€ rates.pdf"},
+	}
+	for _, tt := range ttable {
+		p, err := ReadParts(strings.NewReader(tt.header + "\r\ncontent"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Filename != tt.want || p.Provenance&FilenameRFC2231 == 0 {
+			t.Errorf("%q: got Filename %q, Provenance %v, want %q from RFC 2231", tt.header,
+				p.Filename, p.Provenance, tt.want)
 		}
 	}
 }
@@ -0,0 +1,130 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// addressParser parses address lists, decoding RFC 2047 display names in any supported charset
+var addressParser = &mail.AddressParser{WordDecoder: wordDecoder}
+
+// isBinaryToTextEncoding returns true for the Content-Transfer-Encodings that must be decoded to
+// recover the content.
+func isBinaryToTextEncoding(encoding string) bool {
+	return strings.EqualFold(encoding, "base64") || strings.EqualFold(encoding, "quoted-printable")
+}
+
+// readEncodedMessage reads the header of a message embedded in r, decoding it from the base64 or
+// quoted-printable encoding, see WithDecodedMessageHeaders.  The rest of r is discarded.
+func (p *Part) readEncodedMessage(r io.Reader, encoding string) error {
+	if err := p.checkLimits(); err != nil {
+		return err
+	}
+	header, fields, warnings, err := readHeaderLimit(
+		bufio.NewReader(newTransferDecoder(r, encoding)), p.parser().maxHeaderSize)
+	if err == ErrHeaderTooLarge {
+		return err
+	} else if err != nil {
+		p.addWarning(ErrorMalformedHeader, "embedded message header: %v", err)
+		header = make(textproto.MIMEHeader)
+	}
+	p.decodedHeader = true
+	p.addWarnings(warnings)
+	p.fieldOrder = fields
+	if err := p.setupHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+
+	p.Parent.Subparts = append(p.Parent.Subparts, p)
+	p.setPartLen(0)
+	return nil
+}
+
+// newTransferDecoder returns a reader decoding r from the base64 or quoted-printable encoding.
+func newTransferDecoder(r io.Reader, encoding string) io.Reader {
+	if strings.EqualFold(encoding, "base64") {
+		return base64.NewDecoder(base64.RawStdEncoding, newBase64Cleaner(r))
+	}
+	return quotedprintable.NewReader(newQPCleaner(r))
+}
+
+// hasDecodedMessage returns true for a message/rfc822 Part whose enclosed Part's Header was
+// decoded from its transfer encoded content.
+func (p *Part) hasDecodedMessage() bool {
+	return p.ContentType == ContentTypeMessageRfc822 && len(p.Subparts) == 1 &&
+		p.Subparts[0].decodedHeader
+}
+
+// reencodeMessage returns the transfer encoded content of a message/rfc822 Part whose enclosed
+// Part's Header was decoded from it, with the embedded message's header replaced by that Header so
+// that changes to it are encoded.
+func (p *Part) reencodeMessage() ([]byte, error) {
+	encoding := p.Header.Get(hnContentEncoding)
+	br := bufio.NewReader(newTransferDecoder(p.encodedBody(), encoding))
+	// Skip the original header, a malformed one was read as far as it could be
+	_, _, _ = readHeader(br)
+
+	buf := &bytes.Buffer{}
+	w := bufio.NewWriter(buf)
+	if err := writeHeader(w, p.Subparts[0].Header, p.Subparts[0].fieldOrder); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, br); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return encodeContent(encoding, buf.Bytes())
+}
+
+// Message returns the Part enclosed by a message/rfc822 Part, whose Header is the header of the
+// embedded message, or nil if p is not a message/rfc822 Part.
+func (p *Part) Message() *Part {
+	if p.ContentType != ContentTypeMessageRfc822 || len(p.Subparts) == 0 {
+		return nil
+	}
+	return p.Subparts[0]
+}
+
+// messageHeader returns the header of the message embedded in a message/rfc822 Part, or nil.
+func (p *Part) messageHeader() mail.Header {
+	if m := p.Message(); m != nil {
+		return mail.Header(m.Header)
+	}
+	return nil
+}
+
+// MessageFrom returns the addresses in the From header of the message embedded in a
+// message/rfc822 Part, with RFC 2047 encoded display names decoded.  The error is
+// mail.ErrHeaderNotPresent if there is no such header.
+func (p *Part) MessageFrom() ([]*mail.Address, error) {
+	from := p.messageHeader().Get("From")
+	if from == "" {
+		return nil, mail.ErrHeaderNotPresent
+	}
+	return addressParser.ParseList(from)
+}
+
+// MessageSubject returns the RFC 2047 decoded Subject header of the message embedded in a
+// message/rfc822 Part, or "" if there is none.
+func (p *Part) MessageSubject() string {
+	return decodeHeader(p.messageHeader().Get("Subject"))
+}
+
+// MessageDate returns the parsed Date header of the message embedded in a message/rfc822 Part.
+// The error is mail.ErrHeaderNotPresent if there is no such header.
+func (p *Part) MessageDate() (time.Time, error) {
+	return p.messageHeader().Date()
+}
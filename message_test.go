@@ -0,0 +1,132 @@
+package mime
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedMessage(t *testing.T) {
+	inner := "From: =?utf-8?q?J=C3=B6rg?= <jorg@example.com>\r\n" +
+		"Subject: =?utf-8?q?Fwd:_caf=C3=A9?=\r\n" +
+		"Date: Mon, 2 Jan 2006 15:04:05 -0700\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"body\r\n"
+	qp := &strings.Builder{}
+	qw := quotedprintable.NewWriter(qp)
+	qw.Write([]byte(inner))
+	qw.Close()
+	wantDate := time.Date(2006, 1, 2, 15, 4, 5, 0, time.FixedZone("", -7*60*60))
+
+	ttable := []struct {
+		encoding, body string
+		opts           []Option
+		wantHeader     bool
+	}{
+		{"7bit", inner, nil, true},
+		{"base64", base64.StdEncoding.EncodeToString([]byte(inner)), nil, false},
+		{"base64", base64.StdEncoding.EncodeToString([]byte(inner)),
+			[]Option{WithDecodedMessageHeaders()}, true},
+		{"quoted-printable", qp.String(), []Option{WithDecodedMessageHeaders()}, true},
+	}
+	for _, tt := range ttable {
+		raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/plain\r\n\r\nsee attached\r\n" +
+			"--b\r\nContent-Type: message/rfc822\r\nContent-Transfer-Encoding: " + tt.encoding +
+			"\r\n\r\n" + tt.body + "\r\n--b--\r\n"
+		root, err := ReadParts(strings.NewReader(raw), tt.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.encoding, err)
+		}
+		p := root.Subparts[1]
+		m := p.Message()
+		if m == nil {
+			t.Fatalf("%s: Message() == nil", tt.encoding)
+		}
+		if !tt.wantHeader {
+			if subject := p.MessageSubject(); subject != "" {
+				t.Errorf("%s: MessageSubject() == %q, want \"\"", tt.encoding, subject)
+			}
+			continue
+		}
+
+		if m.ContentType != ctTextPlain || m.Charset != "utf-8" || !m.HasMIMEVersion {
+			t.Errorf("%s: got embedded %v, charset %q", tt.encoding, m, m.Charset)
+		}
+		if subject := p.MessageSubject(); subject != "Fwd: café" {
+			t.Errorf("%s: MessageSubject() == %q, want %q", tt.encoding, subject, "Fwd: café")
+		}
+		from, err := p.MessageFrom()
+		if err != nil || len(from) != 1 || from[0].Name != "Jörg" ||
+			from[0].Address != "jorg@example.com" {
+			t.Errorf("%s: MessageFrom() == %v, %v", tt.encoding, from, err)
+		}
+		if date, err := p.MessageDate(); err != nil || !date.Equal(wantDate) {
+			t.Errorf("%s: MessageDate() == %v, %v, want %v", tt.encoding, date, err, wantDate)
+		}
+	}
+
+	root, err := ReadParts(strings.NewReader("MIME-Version: 1.0\r\n\r\nbody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Message() != nil {
+		t.Errorf("Message() == %v, want nil", root.Message())
+	}
+	if _, err := root.MessageFrom(); err != mail.ErrHeaderNotPresent {
+		t.Errorf("MessageFrom() error %v, want %v", err, mail.ErrHeaderNotPresent)
+	}
+	if _, err := root.MessageDate(); err != mail.ErrHeaderNotPresent {
+		t.Errorf("MessageDate() error %v, want %v", err, mail.ErrHeaderNotPresent)
+	}
+}
+
+func TestEncodeDecodedMessage(t *testing.T) {
+	inner := "Subject: =?utf-8?q?caf=C3=A9?=\r\nContent-Type: text/plain\r\n\r\nbody\r\n"
+	qp := &strings.Builder{}
+	qw := quotedprintable.NewWriter(qp)
+	qw.Write([]byte(inner))
+	qw.Close()
+
+	for encoding, body := range map[string]string{
+		"base64":           base64.StdEncoding.EncodeToString([]byte(inner)),
+		"quoted-printable": qp.String(),
+	} {
+		raw := "MIME-Version: 1.0\r\nContent-Type: message/rfc822\r\n" +
+			"Content-Transfer-Encoding: " + encoding + "\r\n\r\n" + body
+		root, err := ReadParts(strings.NewReader(raw), WithDecodedMessageHeaders())
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		encoded := &strings.Builder{}
+		if err := root.Encode(encoded); err != nil {
+			t.Fatalf("%s: Encode() error %v", encoding, err)
+		}
+		root.Close()
+		if encoding == "base64" && strings.Contains(encoded.String(), "Subject:") {
+			t.Errorf("%s: Encode() wrote the embedded header unencoded:\n%s", encoding, encoded)
+		}
+
+		again, err := ReadParts(strings.NewReader(encoded.String()), WithDecodedMessageHeaders())
+		if err != nil {
+			t.Fatalf("%s: reparse: %v", encoding, err)
+		}
+		if subject := again.MessageSubject(); subject != "café" {
+			t.Errorf("%s: reparsed MessageSubject() == %q, want %q", encoding, subject, "café")
+		}
+		r, err := again.Decode()
+		if err != nil {
+			t.Fatalf("%s: reparsed Decode() error %v", encoding, err)
+		}
+		content, _ := ioutil.ReadAll(r)
+		if !strings.HasSuffix(string(content), "\r\n\r\nbody\r\n") {
+			t.Errorf("%s: reparsed content %q, want the embedded body", encoding, content)
+		}
+		again.Close()
+	}
+}
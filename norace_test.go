@@ -0,0 +1,6 @@
+//go:build !race
+
+package mime
+
+// raceEnabled is set when testing under the race detector, see skipAllocBudget and TestTinyPartsRate.
+const raceEnabled = false
@@ -0,0 +1,454 @@
+package mime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrDecodedTooLarge is returned by readers from Part.Decode when the decoded content exceeds
+	// the limit set with WithMaxDecodedPartSize.
+	ErrDecodedTooLarge = newKindError("decoded part exceeds maximum size", ErrLimit)
+	// ErrNoContent is returned by Part.Decode for Parts without content, such as those from
+	// ReadStructure.
+	ErrNoContent = errors.New("part content is not available")
+	// ErrTempFileQuota is returned when buffering a message would exceed the temporary file quota
+	// set with WithTempFileQuota or WithParserTempFileQuota.
+	ErrTempFileQuota = newKindError("temporary file quota exceeded", ErrLimit)
+	// ErrDepthLimit is returned when Parts are nested deeper than the limit set with WithMaxDepth.
+	ErrDepthLimit = newKindError("part nesting exceeds maximum depth", ErrLimit)
+	// ErrPartLimit is returned when a message has more Parts than the limit set with
+	// WithMaxParts.
+	ErrPartLimit = newKindError("message exceeds maximum number of parts", ErrLimit)
+	// ErrHeaderTooLarge is returned when a header block exceeds the limit set with
+	// WithMaxHeaderSize.
+	ErrHeaderTooLarge = newKindError("header block exceeds maximum size", ErrLimit)
+	// ErrMessageTooLarge is returned when a message exceeds the limit set with
+	// WithMaxMessageSize.
+	ErrMessageTooLarge = newKindError("message exceeds maximum size", ErrLimit)
+)
+
+// defaultParser holds the settings used for Parts with no Parser, such as those from a Builder.
+var defaultParser = NewParser()
+
+// Parser reads MIME messages into Part trees.  Its Options apply to every message it reads, and
+// to the Parts of those messages.  A Parser may be used by multiple goroutines at once.
+//
+// Parsing is deterministic: reading the same bytes with the same Options yields the same tree,
+// down to Descriptors, offsets, sizes, parameters and the order of each Part's Errors, so results
+// may be cached by a hash of the message, e.g. across greylisting retries.
+type Parser struct {
+	maxDecodedPartSize     int64
+	tempFileQuota          int64
+	parserTempFileQuota    int64
+	bestEffortDecode       bool
+	defaultMediaType       string
+	defaultParams          map[string]string
+	opaqueUnknownMultipart bool
+	readAhead              int
+	skippedRegions         bool
+	preambleEpilogueLimit  int
+	captureDir             string
+	captureLevel           CaptureLevel
+	captureAnonymize       bool
+	captureErrors          func(error)
+	inMemory               bool
+	decodeMessageHeaders   bool
+	truncationTolerant     bool
+	attachmentCharsets     bool
+	maxDepth               int
+	maxParts               int
+	maxHeaderSize          int
+	maxMessageSize         int64
+	thumbnailer            Thumbnailer
+	uuencode               bool
+	verifyContentMD5       bool
+
+	tempFileUsage int64 // Accessed atomically
+}
+
+// Option configures optional Parser behavior.
+type Option func(*Parser)
+
+// WithMaxDecodedPartSize limits the content readable from Part.Decode to n bytes; reads beyond
+// that return ErrDecodedTooLarge.  This protects callers writing decoded content to disk from
+// parts that expand far beyond the size of the message.  Zero means no limit.
+func WithMaxDecodedPartSize(n int64) Option {
+	return func(p *Parser) {
+		p.maxDecodedPartSize = n
+	}
+}
+
+// WithTempFileQuota limits the bytes a single message may spill to a temporary file while it is
+// buffered for parsing; ReadParts returns ErrTempFileQuota if the message is larger.  Messages
+// small enough to be buffered in memory, up to 128 KiB, are unaffected and count for nothing.  A
+// message that outgrows memory is moved to the temporary file whole, so every byte of it counts,
+// including those first held in memory.  Zero means no limit.
+func WithTempFileQuota(n int64) Option {
+	return func(p *Parser) {
+		p.tempFileQuota = n
+	}
+}
+
+// WithParserTempFileQuota limits the bytes held in temporary files by all messages read with the
+// Parser that have not yet been closed, counted as for WithTempFileQuota; ReadParts returns
+// ErrTempFileQuota rather than exceed it.  Zero means no limit.
+func WithParserTempFileQuota(n int64) Option {
+	return func(p *Parser) {
+		p.parserTempFileQuota = n
+	}
+}
+
+// WithBestEffortDecode makes Part.Decode return a reader alongside any *DecodeError, over the
+// content decoded as far as was possible, e.g. with an unrecognized Content-Transfer-Encoding
+// left in place.
+func WithBestEffortDecode() Option {
+	return func(p *Parser) {
+		p.bestEffortDecode = true
+	}
+}
+
+// WithDefaultContentType sets the media type and parameters assumed for Parts without a
+// Content-Type header, in place of the RFC 2046 default of text/plain; charset=us-ascii.  For
+// example, binary pipelines may prefer application/octet-stream.  Such Parts have
+// ContentTypeDefaulted set.
+func WithDefaultContentType(mediatype string, params map[string]string) Option {
+	return func(p *Parser) {
+		p.defaultMediaType = strings.ToLower(mediatype)
+		p.defaultParams = lowerParams(params)
+	}
+}
+
+// WithOpaqueUnknownMultipart treats multipart Parts with a subtype not listed in
+// knownMultipartSubtypes as leaves, leaving their content unsplit.  By default every multipart
+// subtype with a boundary, including vendor and streaming types, is split into Subparts.
+func WithOpaqueUnknownMultipart() Option {
+	return func(p *Parser) {
+		p.opaqueUnknownMultipart = true
+	}
+}
+
+// WithReadAhead sets the number of bytes buffered ahead of the parse position at each level of
+// the Part tree when searching for multipart boundaries, 4096 by default.  Larger values reduce
+// the number of reads from the source, which helps when reads are costly, such as for messages
+// spilled to a temporary file, at the cost of a buffer of n bytes per level of multipart nesting.
+// For messages held in memory the default is fastest.  Values below the default are ignored.
+func WithReadAhead(n int) Option {
+	return func(p *Parser) {
+		p.readAhead = n
+	}
+}
+
+// WithSkippedRegions records each byte range of a multipart Part that the parser could not
+// represent as a Subpart, such as a part with an empty header block, in the SkippedRegions of that
+// Part.  Forensic tools can combine them with the Part offsets to account for every byte of the
+// input.
+func WithSkippedRegions() Option {
+	return func(p *Parser) {
+		p.skippedRegions = true
+	}
+}
+
+// WithPreambleEpilogueLimit limits the Preamble and Epilogue retained for each multipart Part to
+// their first n bytes, protecting against messages with a huge amount of content outside of any
+// part.  PreambleLen and EpilogueLen still report their full lengths.  Zero means no limit.
+func WithPreambleEpilogueLimit(n int) Option {
+	return func(p *Parser) {
+		p.preambleEpilogueLimit = n
+	}
+}
+
+// WithCorpusCapture saves each message read by ReadParts that has problems at level or above to
+// dir, building a regression corpus from production traffic.  Two files are written, named for a
+// hash of the saved message: the raw input with extension ".eml", and a dump of the Part tree and
+// its Errors with extension ".txt".  If anonymize is true the input is masked first, keeping only
+// the header fields, boundaries and encodings that parsing depends upon, so that most problems
+// still reproduce.  Capturing is best effort; failures are passed to the function set
+// WithCaptureErrorHandler, not returned.  It is not supported when built for js, wasip1 or tinygo.
+func WithCorpusCapture(dir string, level CaptureLevel, anonymize bool) Option {
+	return func(p *Parser) {
+		p.captureDir = dir
+		p.captureLevel = level
+		p.captureAnonymize = anonymize
+	}
+}
+
+// WithCaptureErrorHandler calls fn with each failure to save a message WithCorpusCapture, such as
+// a full disk or an unsupported platform.  fn may be called from concurrent ReadParts calls.
+// Without it such failures are ignored.
+func WithCaptureErrorHandler(fn func(err error)) Option {
+	return func(p *Parser) {
+		p.captureErrors = fn
+	}
+}
+
+// WithInMemoryBuffering buffers each message read by ReadParts entirely in memory, rather than
+// spilling large messages to a temporary file, so that the Parser never touches the filesystem.
+// Temporary file quotas do not apply.  This is always the case when built for js, wasip1 or
+// tinygo, allowing the package to be used in browsers and edge runtimes.
+func WithInMemoryBuffering() Option {
+	return func(p *Parser) {
+		p.inMemory = true
+	}
+}
+
+// WithDecodedMessageHeaders reads the header of a message/rfc822 Part's embedded message through
+// the Part's Content-Transfer-Encoding when that is base64 or quoted-printable, which RFC 2046
+// forbids but some mailers use when forwarding.  The Part enclosed by the message/rfc822 Part then
+// carries the embedded message's Header, though having no content of its own it has no Subparts.
+// Encode writes the embedded message with that Header, encoded again.  Without this option such
+// an embedded message is parsed from its encoded form, yielding an empty Header.
+func WithDecodedMessageHeaders() Option {
+	return func(p *Parser) {
+		p.decodeMessageHeaders = true
+	}
+}
+
+// WithTruncationTolerance parses messages cut off mid-transfer, or by the temporary file quota,
+// into as much of their Part tree as was read, rather than returning an error.  Parts ending with
+// the input rather than a boundary delimiter, and the root Part, are marked Truncated; a Subpart
+// cut off within its header is dropped, and recorded as a SkippedRegion.  A read error or
+// ErrTempFileQuota while buffering the message ends its input, and is reported as an
+// ErrorTruncated warning on the root Part.  This suits ingesting damaged archives.
+func WithTruncationTolerance() Option {
+	return func(p *Parser) {
+		p.truncationTolerant = true
+	}
+}
+
+// WithAttachmentCharsetConversion makes Part.Decode convert the charset of attachments to UTF-8
+// too, as for other Parts; by default the content of Parts for which HasAttachmentHeader returns
+// true is left in its charset.  Text attachments such as CSV or HTML files often need conversion.
+func WithAttachmentCharsetConversion() Option {
+	return func(p *Parser) {
+		p.attachmentCharsets = true
+	}
+}
+
+// WithMaxDepth limits the nesting of a message's Parts to n levels below its root Part, each
+// multipart or message/rfc822 Part's Subparts being a level deeper than it; ReadParts returns
+// ErrDepthLimit for more deeply nested messages.  Zero means no limit.
+func WithMaxDepth(n int) Option {
+	return func(p *Parser) {
+		p.maxDepth = n
+	}
+}
+
+// WithMaxParts limits the number of Parts in a message, counting the root, every Subpart and those
+// skipped for an empty header block, to n; ReadParts returns ErrPartLimit for messages with more.
+// Zero means no limit.
+func WithMaxParts(n int) Option {
+	return func(p *Parser) {
+		p.maxParts = n
+	}
+}
+
+// WithMaxHeaderSize limits each header block of a message, including the blank line ending it, to
+// n bytes; ReadParts returns ErrHeaderTooLarge for messages with larger ones.  Zero means no limit.
+func WithMaxHeaderSize(n int) Option {
+	return func(p *Parser) {
+		p.maxHeaderSize = n
+	}
+}
+
+// WithMaxMessageSize limits the messages read by ReadParts and ReadStructure to n bytes, stopping
+// as soon as more is read, so that a message larger than n is never buffered in full; they return
+// ErrMessageTooLarge for larger messages, even WithTruncationTolerance.  Zero means no limit.
+func WithMaxMessageSize(n int64) Option {
+	return func(p *Parser) {
+		p.maxMessageSize = n
+	}
+}
+
+// WithThumbnailer has ReadParts pass the decoded content of each image Part, as it is parsed, to
+// fn, setting the Part's Thumbnail to the result, so that previews are made without walking the
+// tree afterwards.  An error decoding the image or from fn is recorded as an ErrorThumbnail
+// warning in the Part's Errors.  Parts read with ReadStructure have no content to preview.
+func WithThumbnailer(fn Thumbnailer) Option {
+	return func(p *Parser) {
+		p.thumbnailer = fn
+	}
+}
+
+// WithUUEncodeDetection has ReadParts look for files uuencoded within the content of text/plain
+// Parts, as old mailers attached them without MIME structure, setting each Part's UUEncoded.  The
+// text is left as it is.  Parts read with ReadStructure have no content to search.
+func WithUUEncodeDetection() Option {
+	return func(p *Parser) {
+		p.uuencode = true
+	}
+}
+
+// WithContentMD5Verification has Decode check the decoded content of Parts carrying an RFC 1864
+// Content-MD5 header against it, once read to the end, recording an ErrorContentMD5 warning in the
+// Part's Errors on a mismatch.  Without it the header is ignored.
+func WithContentMD5Verification() Option {
+	return func(p *Parser) {
+		p.verifyContentMD5 = true
+	}
+}
+
+// NewParser returns a Parser configured by opts.
+func NewParser(opts ...Option) *Parser {
+	p := &Parser{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// ReadParts reads a MIME message from r, returning the root of its Part tree.
+func (ps *Parser) ReadParts(r io.Reader) (*Part, error) {
+	return readParts(ps, r)
+}
+
+// ReadPartsFromReaderAt reads the MIME message of size bytes held in r, such as an open file or a
+// memory mapped one, returning the root of its Part tree.  Unlike ReadParts it does not copy the
+// message: Parts read their content from r, which must remain valid and unchanged until the tree
+// is no longer used.  Closing the tree does not close r.
+func (ps *Parser) ReadPartsFromReaderAt(r io.ReaderAt, size int64) (*Part, error) {
+	if ps.maxMessageSize > 0 && size > ps.maxMessageSize {
+		return nil, fmt.Errorf("error reading part: %w", ErrMessageTooLarge)
+	}
+	return readBufferedParts(ps, readerAtBuffer{r}, size, nil)
+}
+
+// ReadStructure reads the MIME message from r into a Part tree like ReadParts, but without
+// buffering it.  Headers, content types, descriptors, sizes and offsets are populated, but Part
+// content is discarded as it is read; Read returns io.EOF and Decode returns ErrNoContent.  This
+// is suitable for generating IMAP BODYSTRUCTURE responses and triaging large messages.
+func (ps *Parser) ReadStructure(r io.Reader) (*Part, error) {
+	root := NewPart(nil)
+	root.ps = ps
+	tr := &truncatingReader{r: r, tolerant: ps.truncationTolerant}
+	root.streamLines = &lineCountingReader{r: ps.limitMessageSize(tr)}
+	if err := root.readPart(root.streamLines, 0); err != nil {
+		return nil, fmt.Errorf("error reading part: %w", err)
+	}
+	root.streamLines = nil
+	root.markTruncated(tr.err)
+	return root, nil
+}
+
+// TempFileUsage returns the number of bytes currently held in temporary files by messages read
+// with this Parser.  Closing a message releases its share.
+func (ps *Parser) TempFileUsage() int64 {
+	return atomic.LoadInt64(&ps.tempFileUsage)
+}
+
+// reserveTempFile accounts for n more bytes of temporary file usage, returning false if that would
+// exceed the Parser's quota.
+func (ps *Parser) reserveTempFile(n int64) bool {
+	for {
+		used := atomic.LoadInt64(&ps.tempFileUsage)
+		if ps.parserTempFileQuota > 0 && used+n > ps.parserTempFileQuota {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&ps.tempFileUsage, used, used+n) {
+			return true
+		}
+	}
+}
+
+// releaseTempFile returns n bytes reserved with reserveTempFile.
+func (ps *Parser) releaseTempFile(n int64) {
+	atomic.AddInt64(&ps.tempFileUsage, -n)
+}
+
+// truncatingReader, if tolerant, ends its input at the first error reading r, recording it in
+// err, see WithTruncationTolerance.  Once r has returned io.EOF along with its last bytes, as
+// chunked network readers do, it is not read again: bufio.Readers retry after an error, which such
+// sources may fail.  An io.EOF without data is passed on but may be retried.
+type truncatingReader struct {
+	r        io.Reader
+	tolerant bool
+	eof      bool
+	err      error
+}
+
+// Read method for io.Reader interface.
+func (t *truncatingReader) Read(b []byte) (int, error) {
+	if t.eof || t.err != nil {
+		return 0, io.EOF
+	}
+	n, err := t.r.Read(b)
+	if err == io.EOF {
+		t.eof = n > 0
+	} else if err != nil && t.tolerant {
+		t.err, err = err, io.EOF
+	}
+	return n, err
+}
+
+// parser returns the Parser that produced p, or the default Parser.
+func (p *Part) parser() *Parser {
+	if p.ps != nil {
+		return p.ps
+	}
+	return defaultParser
+}
+
+// limitMessageSize returns r, limited to the Parser's maximum message size if one is set.
+func (ps *Parser) limitMessageSize(r io.Reader) io.Reader {
+	if ps.maxMessageSize <= 0 {
+		return r
+	}
+	return &limitReader{r: r, n: ps.maxMessageSize, err: ErrMessageTooLarge}
+}
+
+// checkLimits counts the Part, which is about to be read, against the Parser's limits on the
+// number of Parts in a message and their nesting.
+func (p *Part) checkLimits() error {
+	if p.parts == nil {
+		p.parts = new(int)
+	}
+	*p.parts++
+	ps := p.parser()
+	if ps.maxParts > 0 && *p.parts > ps.maxParts {
+		return ErrPartLimit
+	}
+	if ps.maxDepth > 0 {
+		depth := 0
+		for q := p.Parent; q != nil; q = q.Parent {
+			depth++
+		}
+		if depth > ps.maxDepth {
+			return ErrDepthLimit
+		}
+	}
+	return nil
+}
+
+// limitReader returns err, such as ErrDecodedTooLarge, instead of reading more than n bytes from
+// r.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+// Read method for io.Reader interface.
+func (l *limitReader) Read(b []byte) (int, error) {
+	if l.n <= 0 {
+		// Only fail if there really is more content
+		var one [1]byte
+		for {
+			n, err := l.r.Read(one[:])
+			if n > 0 {
+				return 0, l.err
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if int64(len(b)) > l.n {
+		b = b[:l.n]
+	}
+	n, err := l.r.Read(b)
+	l.n -= int64(n)
+	return n, err
+}
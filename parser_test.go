@@ -0,0 +1,991 @@
+package mime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestMaxDecodedPartSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	raw := "Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(content)
+
+	ttable := []struct {
+		limit   int64
+		wantErr error
+	}{
+		{0, nil},
+		{1000, nil},
+		{2000, nil},
+		{999, ErrDecodedTooLarge},
+		{1, ErrDecodedTooLarge},
+	}
+	for _, tt := range ttable {
+		p, err := ReadParts(strings.NewReader(raw), WithMaxDecodedPartSize(tt.limit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := p.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(d)
+		if err != tt.wantErr {
+			t.Errorf("limit %d: got error %v, want: %v", tt.limit, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && !bytes.Equal(got, content) {
+			t.Errorf("limit %d: content was altered", tt.limit)
+		}
+		if tt.wantErr != nil && int64(len(got)) > tt.limit {
+			t.Errorf("limit %d: read %d bytes", tt.limit, len(got))
+		}
+	}
+}
+
+func TestParserAppliesToSubparts(t *testing.T) {
+	ps := NewParser(WithMaxDecodedPartSize(4))
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n--b--\r\n"
+	p, err := ps.ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := p.Subparts[0].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(d); err != ErrDecodedTooLarge {
+		t.Errorf("got error %v, want: %v", err, ErrDecodedTooLarge)
+	}
+}
+
+// bigMessage returns a message too large to be buffered in memory.
+func bigMessage() string {
+	return "Content-Type: text/plain\r\n\r\n" + strings.Repeat("x", 300*1024)
+}
+
+func TestTempFileQuota(t *testing.T) {
+	_, err := ReadParts(strings.NewReader(bigMessage()), WithTempFileQuota(200*1024))
+	if !errors.Is(err, ErrTempFileQuota) {
+		t.Errorf("got error %v, want: %v", err, ErrTempFileQuota)
+	}
+
+	p, err := ReadParts(strings.NewReader(bigMessage()), WithTempFileQuota(400*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	// Small messages never touch the disk
+	p, err = ReadParts(strings.NewReader("Subject: hi\r\n\r\nhi"), WithTempFileQuota(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+}
+
+func TestParserTempFileQuota(t *testing.T) {
+	ps := NewParser(WithParserTempFileQuota(500 * 1024))
+
+	first, err := ps.ReadParts(strings.NewReader(bigMessage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The whole message is in the temporary file, the bytes first buffered in memory included
+	if got, want := ps.TempFileUsage(), int64(len(bigMessage())); got != want {
+		t.Errorf("TempFileUsage() == %d while a large message is open, want %d", got, want)
+	}
+	if _, err := ps.ReadParts(strings.NewReader(bigMessage())); !errors.Is(err, ErrTempFileQuota) {
+		t.Errorf("got error %v, want: %v", err, ErrTempFileQuota)
+	}
+
+	// Closing any Part of the first message releases its share, exactly once
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	if got := ps.TempFileUsage(); got != 0 {
+		t.Errorf("TempFileUsage() == %d after Close, want 0", got)
+	}
+
+	second, err := ps.ReadParts(strings.NewReader(bigMessage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+}
+
+func TestInMemoryBuffering(t *testing.T) {
+	ps := NewParser(WithInMemoryBuffering(), WithTempFileQuota(1), WithParserTempFileQuota(1))
+	p, err := ps.ReadParts(strings.NewReader(bigMessage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if got := ps.TempFileUsage(); got != 0 {
+		t.Errorf("TempFileUsage() == %d, want 0", got)
+	}
+	if _, ok := p.rawReader.(memoryBuffer); !ok {
+		t.Errorf("message buffered in %T, want memoryBuffer", p.rawReader)
+	}
+	d, err := p.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(d)
+	if err != nil || len(got) != 300*1024 {
+		t.Errorf("decoded %d bytes, %v, want %d", len(got), err, 300*1024)
+	}
+}
+
+func TestReadStructure(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ReadParts(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadStructure(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wantParts, gotParts []*Part
+	want.Walk(func(p *Part) error {
+		wantParts = append(wantParts, p)
+		return nil
+	})
+	got.Walk(func(p *Part) error {
+		gotParts = append(gotParts, p)
+		return nil
+	})
+	if len(gotParts) != len(wantParts) {
+		t.Fatalf("got %d parts, want %d", len(gotParts), len(wantParts))
+	}
+	for i, g := range gotParts {
+		w := wantParts[i]
+		if g.Descriptor != w.Descriptor || g.ContentType != w.ContentType ||
+			g.Filename != w.Filename || g.Size != w.Size || g.PartOffset != w.PartOffset ||
+			g.HeaderLen != w.HeaderLen || g.PartLen != w.PartLen {
+			t.Errorf("structure part %+v, want %+v", g, w)
+		}
+		if n, _ := g.Read(make([]byte, 10)); n != 0 {
+			t.Errorf("%v: Read returned content", g)
+		}
+		if _, err := g.Decode(); err != ErrNoContent {
+			t.Errorf("%v: Decode error == %v, want %v", g, err, ErrNoContent)
+		}
+	}
+	if err := got.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	ttable := []struct {
+		header  string
+		wantErr error
+	}{
+		{"Content-Type: text/plain\r\nContent-Transfer-Encoding: x-bogus\r\n", ErrorContentEncoding},
+		{"Content-Type: text/plain; charset=x-bogus\r\n", ErrorCharsetConversion},
+	}
+	for _, tt := range ttable {
+		raw := tt.header + "\r\nhello"
+
+		p, err := ReadParts(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := p.Decode()
+		derr, ok := err.(*DecodeError)
+		if !ok {
+			t.Fatalf("%q: got error %v, want *DecodeError", tt.header, err)
+		}
+		if !errors.Is(derr, tt.wantErr) {
+			t.Errorf("%q: got error %v, want: %v", tt.header, derr, tt.wantErr)
+		}
+		if d != nil {
+			t.Errorf("%q: got reader without WithBestEffortDecode", tt.header)
+		}
+
+		p, err = ReadParts(strings.NewReader(raw), WithBestEffortDecode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err = p.Decode()
+		if _, ok := err.(*DecodeError); !ok {
+			t.Errorf("%q: got error %v, want *DecodeError", tt.header, err)
+		}
+		if d == nil {
+			t.Fatalf("%q: got no reader with WithBestEffortDecode", tt.header)
+		}
+		got, err := ioutil.ReadAll(d)
+		if err != nil || string(got) != "hello" {
+			t.Errorf("%q: best effort content %q, %v, want %q", tt.header, got, err, "hello")
+		}
+	}
+}
+
+func TestDefaultContentType(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nX-Part: 1\r\n\r\nfirst\r\n" +
+		"--b\r\nContent-Type: text/html\r\n\r\nsecond\r\n--b--\r\n"
+
+	ttable := []struct {
+		opts        []Option
+		wantType    string
+		wantCharset string
+	}{
+		{nil, ctTextPlain, "us-ascii"},
+		{[]Option{WithDefaultContentType("Application/Octet-Stream", nil)}, ctAppOctetStream, ""},
+		{
+			[]Option{WithDefaultContentType(ctTextPlain, map[string]string{"Charset": "UTF-8"})},
+			ctTextPlain, "utf-8",
+		},
+	}
+	for _, tt := range ttable {
+		p, err := ReadParts(strings.NewReader(raw), tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ContentTypeDefaulted {
+			t.Error("root ContentTypeDefaulted == true, want false")
+		}
+		first, second := p.Subparts[0], p.Subparts[1]
+		if first.ContentType != tt.wantType || first.Charset != tt.wantCharset {
+			t.Errorf("defaulted to %q, charset %q, want %q, charset %q",
+				first.ContentType, first.Charset, tt.wantType, tt.wantCharset)
+		}
+		if !first.ContentTypeDefaulted {
+			t.Error("ContentTypeDefaulted == false, want true")
+		}
+		if second.ContentType != ctTextHTML || second.ContentTypeDefaulted {
+			t.Errorf("declared part %q, ContentTypeDefaulted %v", second.ContentType,
+				second.ContentTypeDefaulted)
+		}
+	}
+}
+
+func TestMultipartSubtypes(t *testing.T) {
+	raw := "Content-Type: multipart/x-mixed-replace; boundary=frame\r\n\r\n" +
+		"--frame\r\nContent-Type: image/jpeg\r\n\r\none\r\n" +
+		"--frame\r\nContent-Type: multipart/x-vendor; boundary=v\r\n\r\n" +
+		"--v\r\nContent-Type: text/plain\r\n\r\ninner\r\n--v--\r\n" +
+		"\r\n--frame\r\nContent-Type: text/plain; boundary=notmultipart\r\n\r\n" +
+		"--notmultipart\r\n" +
+		"--frame--\r\n"
+
+	ttable := []struct {
+		opts []Option
+		want []string
+	}{
+		{nil, []string{
+			"0 <multipart/x-mixed-replace>",
+			"1 <image/jpeg>",
+			"2.0 <multipart/x-vendor>",
+			"2.1 <text/plain>",
+			"3 <text/plain>",
+		}},
+		{[]Option{WithOpaqueUnknownMultipart()}, []string{
+			"0 <multipart/x-mixed-replace>",
+			"1 <image/jpeg>",
+			"2 <multipart/x-vendor>",
+			"3 <text/plain>",
+		}},
+	}
+	for _, tt := range ttable {
+		p, err := ReadParts(strings.NewReader(raw), tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		p.Walk(func(p *Part) error {
+			got = append(got, p.String())
+			return nil
+		})
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("structure:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestMultipartMissingBoundary(t *testing.T) {
+	p, err := ReadParts(strings.NewReader(
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed\r\n\r\nbody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Subparts) != 0 {
+		t.Errorf("got %d Subparts, want 0", len(p.Subparts))
+	}
+	if len(p.Errors) != 1 || p.Errors[0].(*Error).Name != ErrorMissingBoundary.Error() {
+		t.Errorf("got Errors %v, want %q warning", p.Errors, ErrorMissingBoundary)
+	}
+}
+
+func TestSkippedRegions(t *testing.T) {
+	inner := "Content-Type: multipart/mixed; boundary=in\r\n\r\n" +
+		"--in\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--in\r\nxyz"
+	raw := "Content-Type: multipart/mixed; boundary=out\r\n\r\n" +
+		"--out\r\n" + inner + "\r\n" +
+		"--out\r\nContent-Type: text/plain\r\n\r\nlast\r\n" +
+		"--out\r\nabc"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SkippedRegions != nil || p.Subparts[0].SkippedRegions != nil {
+		t.Errorf("got SkippedRegions without WithSkippedRegions")
+	}
+
+	p, err = ReadParts(strings.NewReader(raw), WithSkippedRegions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttable := []struct {
+		part *Part
+		want string
+	}{
+		{p.Subparts[0], "xyz"},
+		{p, "abc"},
+	}
+	for _, tt := range ttable {
+		if len(tt.part.SkippedRegions) != 1 {
+			t.Errorf("%v: got SkippedRegions %+v, want 1", tt.part, tt.part.SkippedRegions)
+			continue
+		}
+		r := tt.part.SkippedRegions[0]
+		if got := raw[r.Offset : r.Offset+r.Len]; got != tt.want {
+			t.Errorf("%v: skipped %q, want %q", tt.part, got, tt.want)
+		}
+		if r.Reason != ErrEmptyHeaderBlock {
+			t.Errorf("%v: got Reason %v, want %v", tt.part, r.Reason, ErrEmptyHeaderBlock)
+		}
+	}
+}
+
+func TestBoundaryPrefixOfNested(t *testing.T) {
+	// The inner boundary starts with the outer close delimiter, "--b--"
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: multipart/alternative; boundary=\"b--x\"\r\n\r\n" +
+		"--b--x\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--b--x\r\nContent-Type: text/html\r\n\r\nhtml\r\n" +
+		"--b--x--\r\n" +
+		"\r\n--b\r\nContent-Type: text/plain\r\n\r\nlast\r\n--b--\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	p.Walk(func(p *Part) error {
+		got = append(got, p.String())
+		return nil
+	})
+	want := []string{
+		"0 <multipart/mixed>",
+		"1.0 <multipart/alternative>",
+		"1.1 <text/plain>",
+		"1.2 <text/html>",
+		"2 <text/plain>",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("structure:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNestedIdenticalBoundary(t *testing.T) {
+	inner := "Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--b\r\nContent-Type: text/html\r\n\r\nhtml\r\n" +
+		"--b--\r\ninner epilogue\r\n"
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\n" + inner +
+		"\r\n--b\r\nContent-Type: image/png\r\n\r\nimage\r\n--b--\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	p.Walk(func(p *Part) error {
+		got = append(got, p.String())
+		return nil
+	})
+	want := []string{
+		"0 <multipart/mixed>",
+		"1.0 <multipart/alternative>",
+		"1.1 <text/plain>",
+		"1.2 <text/html>",
+		"2 <image/png>",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("structure:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	alt := p.Subparts[0]
+	if len(alt.Errors) != 1 || !errors.Is(alt.Errors[0], ErrorNestedBoundary) {
+		t.Errorf("got Errors %v, want %q warning", alt.Errors, ErrorNestedBoundary)
+	}
+	if got := raw[alt.PartOffset : alt.PartOffset+alt.PartLen]; got != inner {
+		t.Errorf("multipart/alternative part:\n%q\nwant:\n%q", got, inner)
+	}
+	if got, want := string(alt.Epilogue), "inner epilogue\r\n"; got != want {
+		t.Errorf("got Epilogue %q, want %q", got, want)
+	}
+	if got, want := string(p.Epilogue), ""; got != want {
+		t.Errorf("got root Epilogue %q, want %q", got, want)
+	}
+	html := alt.Subparts[1]
+	if ce := html.ContentExtent(); raw[ce.Offset:ce.End()] != "html" {
+		t.Errorf("text/html content %q, want %q", raw[ce.Offset:ce.End()], "html")
+	}
+
+	// Reparsing the Part alone needs no recovery
+	if err := alt.Reparse(); err != nil {
+		t.Fatal(err)
+	}
+	if len(alt.Subparts) != 2 || alt.Descriptor != "1.0" {
+		t.Errorf("reparsed %v with %d Subparts, want 1.0 with 2", alt, len(alt.Subparts))
+	}
+}
+
+func TestPreambleEpilogue(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"This is a multi-part message in MIME format.\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n--b--\r\n" +
+		"trailing junk\r\n"
+	preamble := "This is a multi-part message in MIME format.\r\n\r\n"
+	epilogue := "trailing junk\r\n"
+
+	ttable := []struct {
+		limit                      int
+		wantPreamble, wantEpilogue string
+	}{
+		{0, preamble, epilogue},
+		{100, preamble, epilogue},
+		{4, preamble[:4], epilogue[:4]},
+	}
+	for _, tt := range ttable {
+		p, err := ReadParts(strings.NewReader(raw), WithPreambleEpilogueLimit(tt.limit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(p.Preamble) != tt.wantPreamble || p.PreambleLen != len(preamble) {
+			t.Errorf("limit %d: got Preamble %q (%d), want %q (%d)", tt.limit, p.Preamble,
+				p.PreambleLen, tt.wantPreamble, len(preamble))
+		}
+		if string(p.Epilogue) != tt.wantEpilogue || p.EpilogueLen != len(epilogue) {
+			t.Errorf("limit %d: got Epilogue %q (%d), want %q (%d)", tt.limit, p.Epilogue,
+				p.EpilogueLen, tt.wantEpilogue, len(epilogue))
+		}
+		if len(p.Subparts) != 1 {
+			t.Errorf("limit %d: got %d Subparts, want 1", tt.limit, len(p.Subparts))
+		}
+	}
+
+	// An overlong preamble line does not prevent the boundary being found
+	long := strings.Repeat("x", 3*peekBufferSize) + "\r\n"
+	p, err := ReadParts(strings.NewReader(strings.Replace(raw, preamble, long, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Preamble) != long || len(p.Subparts) != 1 {
+		t.Errorf("got %d byte Preamble, %d Subparts, want %d, 1", len(p.Preamble),
+			len(p.Subparts), len(long))
+	}
+}
+
+func TestCloseDelimiterJunk(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "mail", "epilogue-sample.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadParts(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if len(p.Subparts) != 2 {
+		t.Errorf("got %d Subparts, want 2", len(p.Subparts))
+	}
+	if got, want := string(p.Epilogue), "Potentially malicious content\n"; got != want {
+		t.Errorf("got Epilogue %q, want %q", got, want)
+	}
+	close := bytes.Index(raw, []byte("--Enmime-Test-100-->"))
+	if len(p.Errors) != 1 || !errors.Is(p.Errors[0], ErrorMissingBoundary) ||
+		p.Errors[0].(*Error).Offset != close {
+		t.Errorf("got Errors %v, want one %v at offset %d", p.Errors, ErrorMissingBoundary, close)
+	}
+}
+
+func TestNestedPreambleEpilogue(t *testing.T) {
+	msg := "Content-Type: multipart/mixed; boundary=m\r\n\r\n" +
+		"msg pre\r\n--m\r\nContent-Type: text/plain\r\n\r\nattached\r\n--m--"
+	raw := "Content-Type: multipart/mixed; boundary=out\r\n\r\n" +
+		"out pre\r\n" +
+		"--out\r\nContent-Type: multipart/alternative; boundary=in\r\n\r\n" +
+		"in pre\r\n--in\r\nContent-Type: text/plain\r\n\r\nplain\r\n--in--" +
+		"\r\n--out\r\nContent-Type: multipart/related; boundary=out\r\n\r\n" +
+		"shared pre\r\n--out\r\nContent-Type: text/html\r\n\r\nhtml\r\n--out--\r\n" +
+		"shared epi\r\n" +
+		"\r\n--out\r\nContent-Type: message/rfc822\r\n\r\n" + msg +
+		"\r\n--out--\r\nout epi\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]string{
+		"0":     {"out pre\r\n", "out epi\r\n"},
+		"1":     {"in pre\r\n", ""},
+		"2":     {"shared pre\r\n", "shared epi\r\n"},
+		"3.0":   {"msg pre\r\n", ""},
+		"3.0.1": {"", ""},
+	}
+	p.Walk(func(p *Part) error {
+		w, ok := want[p.Descriptor]
+		if ok && (string(p.Preamble) != w[0] || string(p.Epilogue) != w[1]) {
+			t.Errorf("%s: got Preamble %q, Epilogue %q, want %q, %q", p.Descriptor, p.Preamble,
+				p.Epilogue, w[0], w[1])
+		}
+		return nil
+	})
+
+	// Each level reproduces its own delimiters, preamble and epilogue
+	buf := &bytes.Buffer{}
+	if err := p.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != raw {
+		t.Errorf("Encode got:\n%q\nwant:\n%q", buf.String(), raw)
+	}
+	if n, err := p.encodedSize(); err != nil || n != int64(len(raw)) {
+		t.Errorf("got encodedSize %d, %v, want %d", n, err, len(raw))
+	}
+}
+
+func TestTruncationTolerance(t *testing.T) {
+	pdf := base64.StdEncoding.EncodeToString([]byte("%PDF-1.4 and some more content"))
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: multipart/alternative; boundary=c\r\n\r\n" +
+		"--c\r\nContent-Type: text/plain\r\n\r\nalt\r\n" +
+		"--c\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		pdf + "\r\n" +
+		"--c--\r\n" +
+		"--b--\r\n"
+	// Cut after the base64 encoding of "%PDF-1.4"
+	cut := strings.Index(raw, pdf) + 12
+	if _, err := ReadParts(strings.NewReader(raw[:cut])); err == nil {
+		t.Error("got no error parsing a truncated message without WithTruncationTolerance")
+	}
+
+	p, err := ReadParts(strings.NewReader(raw[:cut]), WithTruncationTolerance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	p.Walk(func(s *Part) error {
+		got = append(got, fmt.Sprintf("%s %v", s.Descriptor, s.Truncated))
+		return nil
+	})
+	want := "0 true, 1 false, 2.0 true, 2.1 false, 2.2 true"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, ", "), want)
+	}
+	r, err := p.Subparts[1].Subparts[1].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(r); string(b) != "%PDF-1.4 " {
+		t.Errorf("decoded truncated part %q, want %q", b, "%PDF-1.4 ")
+	}
+
+	// Every prefix of the message with a complete header yields a tree, the complete message is
+	// not truncated
+	for n := strings.Index(raw, "\r\n\r\n"); n <= len(raw); n++ {
+		p, err := ReadParts(strings.NewReader(raw[:n]), WithTruncationTolerance())
+		if err != nil {
+			t.Fatalf("cut at %d: %v", n, err)
+		}
+		if n == len(raw) && p.Truncated {
+			t.Error("complete message is Truncated")
+		}
+	}
+
+	// Errors buffering the input end it
+	reset := errors.New("connection reset")
+	p, err = ReadParts(io.MultiReader(strings.NewReader(raw[:cut]), iotest.ErrReader(reset)),
+		WithTruncationTolerance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Truncated || len(p.Errors) == 0 || !errors.Is(p.Errors[len(p.Errors)-1], ErrorTruncated) {
+		t.Errorf("got Truncated %v, Errors %v", p.Truncated, p.Errors)
+	}
+	p, err = ReadParts(strings.NewReader(bigMessage()), WithTempFileQuota(200*1024),
+		WithTruncationTolerance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if !p.Truncated || p.Size > 200*1024 {
+		t.Errorf("got Truncated %v, Size %d", p.Truncated, p.Size)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	// nested returns a message with depth multiparts nested within one another
+	nested := func(depth int) string {
+		var b strings.Builder
+		for i := 0; i < depth; i++ {
+			fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=b%d\r\n\r\n--b%d\r\n", i, i)
+		}
+		b.WriteString("Content-Type: text/plain\r\n\r\nleaf\r\n")
+		for i := depth - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "--b%d--\r\n", i)
+		}
+		return b.String()
+	}
+	wide := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		strings.Repeat("--b\r\nContent-Type: text/plain\r\n\r\npart\r\n", 10) + "--b--\r\n"
+	embedded := "Content-Type: message/rfc822\r\n\r\nSubject: inner\r\n\r\nbody\r\n"
+	longHeader := "Subject: " + strings.Repeat("x", 100) + "\r\n\r\nbody\r\n"
+
+	ttable := []struct {
+		name string
+		raw  string
+		opt  Option
+		want error
+	}{
+		{"depth within limit", nested(3), WithMaxDepth(3), nil},
+		{"depth", nested(4), WithMaxDepth(3), ErrDepthLimit},
+		{"embedded message depth", embedded, WithMaxDepth(1), nil},
+		{"embedded message in a multipart", "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+			"--b\r\n" + embedded + "--b--\r\n", WithMaxDepth(1), ErrDepthLimit},
+		{"embedded message parts", embedded, WithMaxParts(1), ErrPartLimit},
+		{"parts within limit", wide, WithMaxParts(11), nil},
+		{"parts", wide, WithMaxParts(10), ErrPartLimit},
+		{"header within limit", longHeader, WithMaxHeaderSize(len(longHeader) - 6), nil},
+		{"header", longHeader, WithMaxHeaderSize(len(longHeader) - 7), ErrHeaderTooLarge},
+		{"header of a subpart", wide, WithMaxHeaderSize(30), ErrHeaderTooLarge},
+		{"message within limit", wide, WithMaxMessageSize(int64(len(wide))), nil},
+		{"message", wide, WithMaxMessageSize(int64(len(wide) - 1)), ErrMessageTooLarge},
+	}
+	for _, tt := range ttable {
+		for _, read := range []func(io.Reader, ...Option) (*Part, error){ReadParts, ReadStructure} {
+			_, err := read(strings.NewReader(tt.raw), tt.opt, WithTruncationTolerance())
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+			}
+			if tt.want != nil && !errors.Is(err, ErrLimit) {
+				t.Errorf("%s: %v is not an ErrLimit", tt.name, err)
+			}
+		}
+	}
+}
+
+// parseSnapshot describes the Part tree rooted at root in more detail than dumpStructure, for
+// comparing parses.
+func parseSnapshot(root *Part, perr error) string {
+	if root == nil {
+		return fmt.Sprintf("error: %v\n", perr)
+	}
+	buf := bytes.NewBuffer(dumpStructure(root, perr))
+	root.Walk(func(p *Part) error {
+		fmt.Fprintf(buf, "%s %v %v %v %q %q %q %v\n", p.Descriptor, p.Header, p.ContentParams,
+			p.DispositionParams, p.Disposition, p.Filename, p.Charset, p.Provenance)
+		for _, e := range p.Errors {
+			if pe, ok := e.(*Error); ok {
+				fmt.Fprintf(buf, "\t%d\n", pe.Offset)
+			}
+		}
+		return nil
+	})
+	return buf.String()
+}
+
+func TestParseDeterministic(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*", "*.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, "")
+	ps := NewParser(WithDefaultContentType("application/octet-stream",
+		map[string]string{"Name": "a", "name": "b", "NAME": "c", "X-Type": "d", "x-TYPE": "e"}))
+	for _, name := range files {
+		raw := []byte("Content-Type: multipart/mixed; boundary=b; Title*1=x; title*0*=''y; a=b c\r\n" +
+			"\r\n--b\r\n\r\nno header\r\n--b\r\nContent-Type: text/plain; charset=\"charset=utf-8\"; " +
+			"name=x name=y\r\n\r\nbody\r\n--b")
+		if name != "" {
+			if raw, err = ioutil.ReadFile(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var want string
+		for i := 0; i < 10; i++ {
+			root, err := ps.ReadParts(bytes.NewReader(raw))
+			got := parseSnapshot(root, err)
+			if i == 0 {
+				want = got
+			} else if got != want {
+				t.Fatalf("%s: parse %d differs:\n%s\nwant:\n%s", name, i, got, want)
+			}
+			if root != nil {
+				root.Close()
+			}
+		}
+	}
+}
+
+// countingReaderAt counts the bytes read from a ReaderAt.
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int
+}
+
+func (c *countingReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(b, off)
+	c.n += n
+	return n, err
+}
+
+func TestReadPartsFromReaderAt(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*", "*.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, werr := ReadParts(bytes.NewReader(raw))
+		got, gerr := ReadPartsFromReaderAt(bytes.NewReader(raw), int64(len(raw)))
+		if g, w := parseSnapshot(got, gerr), parseSnapshot(want, werr); g != w {
+			t.Errorf("%s: ReadPartsFromReaderAt() read\n%s\nwant\n%s", name, g, w)
+		}
+		if want != nil {
+			want.Close()
+		}
+		if got != nil {
+			got.Close()
+		}
+	}
+
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nfirst\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n" +
+		"\r\naGVsbG8gd29ybGQ=\r\n" +
+		"--b--\r\n"
+	cr := &countingReaderAt{r: strings.NewReader(raw)}
+	root, err := ReadPartsFromReaderAt(cr, int64(len(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := cr.n
+	r, err := root.Subparts[1].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil || string(content) != "hello world" {
+		t.Errorf("Decode() read %q, %v", content, err)
+	}
+	if cr.n-n != root.Subparts[1].Size {
+		t.Errorf("Decode() read %d bytes from the ReaderAt, want %d", cr.n-n, root.Subparts[1].Size)
+	}
+	root.Close()
+
+	_, err = ReadPartsFromReaderAt(cr, int64(len(raw)), WithMaxMessageSize(int64(len(raw)-1)))
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("ReadPartsFromReaderAt() error %v, want %v", err, ErrMessageTooLarge)
+	}
+}
+
+// pausingReader returns io.EOF the given number of times after reading up to pause, as a network
+// reader may when data is late, then continues.
+type pausingReader struct {
+	r     io.Reader
+	pause int
+	times int
+}
+
+func (p *pausingReader) Read(b []byte) (int, error) {
+	if p.pause == 0 && p.times > 0 {
+		p.times--
+		return 0, io.EOF
+	}
+	if p.pause > 0 && len(b) > p.pause {
+		b = b[:p.pause]
+	}
+	n, err := p.r.Read(b)
+	p.pause -= n
+	return n, err
+}
+
+func TestEmptyHeaderSiblings(t *testing.T) {
+	head := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nfirst\r\n" +
+		"--b\r\nx"
+	raw := head + "\r\n--b\r\nContent-Type: text/plain\r\n\r\nsecond\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nthird\r\n--b--\r\n"
+	// The pauses leave part 2 without a header block, as if it were the last
+	p, err := ReadStructure(&pausingReader{r: strings.NewReader(raw), pause: len(head),
+		times: 4}, WithSkippedRegions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	p.Walk(func(p *Part) error {
+		got = append(got, p.String())
+		return nil
+	})
+	want := "0 <multipart/mixed>, 1 <text/plain>, 3 <text/plain>, 4 <text/plain>"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, ", "), want)
+	}
+	if len(p.Errors) != 1 || !errors.Is(p.Errors[0], ErrEmptyHeaderBlock) ||
+		p.Errors[0].(*Error).Offset != len(head)-1 {
+		t.Errorf("got Errors %v, want %v at %d", p.Errors, ErrEmptyHeaderBlock, len(head)-1)
+	}
+	if want := []SkippedRegion{{len(head) - 1, 1, ErrEmptyHeaderBlock}}; !reflect.DeepEqual(
+		p.SkippedRegions, want) {
+		t.Errorf("got SkippedRegions %v, want %v", p.SkippedRegions, want)
+	}
+}
+
+// errReadAfterEOF is returned by an eofChunkReader read again after it returned io.EOF.
+var errReadAfterEOF = errors.New("read after EOF")
+
+// eofChunkReader returns r in chunks of n bytes, the last with io.EOF, as chunked network readers
+// do, and fails if read again once it has.
+type eofChunkReader struct {
+	r   *strings.Reader
+	n   int
+	eof bool
+}
+
+func (c *eofChunkReader) Read(b []byte) (int, error) {
+	if c.eof {
+		return 0, errReadAfterEOF
+	}
+	if len(b) > c.n {
+		b = b[:c.n]
+	}
+	n, _ := c.r.Read(b)
+	if c.r.Len() == 0 {
+		c.eof = true
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// eofReaders wrap a message in readers returning its last bytes with io.EOF.
+var eofReaders = []struct {
+	name string
+	wrap func(raw string) io.Reader
+}{
+	{"DataErrReader", func(raw string) io.Reader {
+		return iotest.DataErrReader(strings.NewReader(raw))
+	}},
+	{"OneByteDataErrReader", func(raw string) io.Reader {
+		return iotest.DataErrReader(iotest.OneByteReader(strings.NewReader(raw)))
+	}},
+	{"HalfDataErrReader", func(raw string) io.Reader {
+		return iotest.DataErrReader(iotest.HalfReader(strings.NewReader(raw)))
+	}},
+	{"eofChunkReader", func(raw string) io.Reader {
+		return &eofChunkReader{r: strings.NewReader(raw), n: 7}
+	}},
+	{"eofChunkReaderLarge", func(raw string) io.Reader {
+		return &eofChunkReader{r: strings.NewReader(raw), n: 1 << 16}
+	}},
+}
+
+// partLayout describes the tree rooted at root, one line per Part, for comparing parses.
+func partLayout(root *Part, content bool) string {
+	b := &strings.Builder{}
+	root.Walk(func(p *Part) error {
+		fmt.Fprintf(b, "%s %s offset=%d header=%d len=%d size=%d lines=%d errors=%d "+
+			"truncated=%v\n", p.Descriptor, p.ContentType, p.PartOffset, p.HeaderLen, p.PartLen,
+			p.Size, p.Lines, len(p.Errors), p.Truncated)
+		if content {
+			raw, err := ioutil.ReadAll(p)
+			fmt.Fprintf(b, "%q %v\n", raw, err)
+		}
+		return nil
+	})
+	return b.String()
+}
+
+func TestReadPartsEOFWithData(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "parts", "*.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type parse func(r io.Reader, opts ...Option) (*Part, error)
+	parses := []struct {
+		name    string
+		parse   parse
+		content bool
+	}{
+		{"ReadParts", ReadParts, true},
+		{"ReadStructure", ReadStructure, false},
+		{"Stream", func(r io.Reader, opts ...Option) (*Part, error) {
+			return Stream(r, func(*Part, io.Reader) error { return nil }, opts...)
+		}, false},
+	}
+	options := [][]Option{
+		nil,
+		{WithTruncationTolerance()},
+		{WithInMemoryBuffering(), WithMaxMessageSize(1 << 20)},
+	}
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw := string(b)
+		for _, ps := range parses {
+			for _, opts := range options {
+				root, err := ps.parse(strings.NewReader(raw), opts...)
+				if err != nil {
+					t.Fatalf("%s %s: %v", name, ps.name, err)
+				}
+				want := partLayout(root, ps.content)
+				root.Close()
+
+				for _, er := range eofReaders {
+					root, err := ps.parse(er.wrap(raw), opts...)
+					if err != nil {
+						t.Errorf("%s %s %s: %v", name, ps.name, er.name, err)
+						continue
+					}
+					if got := partLayout(root, ps.content); got != want {
+						t.Errorf("%s %s %s with %d options:\n%s\nwant:\n%s", name, ps.name,
+							er.name, len(opts), got, want)
+					}
+					root.Close()
+				}
+			}
+		}
+	}
+}
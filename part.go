@@ -4,38 +4,66 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"mime/quotedprintable"
 	"net/textproto"
 	"strconv"
 	"strings"
-
-	"github.com/cardamaro/mem_constrained_buffer"
-	"github.com/pkg/errors"
+	"sync/atomic"
 )
 
 const (
 	ContentTypeMessageRfc822 = "message/rfc822"
 )
 
+// ReaderAtCloser holds a parsed message.  As for any io.ReaderAt, ReadAt must be safe to call from
+// multiple goroutines at once.
 type ReaderAtCloser interface {
 	io.ReaderAt
 	io.Closer
 }
 
+// Part is a node of a MIME message's Part tree.  Every Part of a parsed message reads its content
+// from the message's shared ReaderAtCloser with ReadAt, so different Parts of the same message may
+// be read and decoded by different goroutines at once.  A single Part must not be used from
+// multiple goroutines without synchronization, nor may the tree be modified, e.g. with Reparse,
+// SetHeader or Deduplicate, while other goroutines use it.
+//
+// A multipart Part has a Subpart for every delimiter, including those followed by nothing, or only
+// a blank line, before the next delimiter.  Such a Subpart is empty: it has no Header fields, a
+// Size of zero and the default ContentType, and records no Errors.
 type Part struct {
 	Descriptor string
 
 	ContentType       string
-	ContentParams     map[string]string
+	ContentParams     Params
 	Disposition       string
-	DispositionParams map[string]string
+	DispositionParams Params
 	Encoding          string
 	Charset           string
 	Filename          string
+	ContentID         string // Content-ID without angle brackets, per RFC 2392
+
+	// MIMEVersion is the value of the MIME-Version header with any comments removed, e.g. "1.0",
+	// and HasMIMEVersion is set when the header is present.  RFC 2045 requires it in the header of
+	// every message using MIME, that of the root Part or the Part enclosed by a message/rfc822.
+	MIMEVersion    string
+	HasMIMEVersion bool
+
+	// ContentTypeDefaulted is set when the Part had no Content-Type header, and ContentType holds
+	// the default rather than a declared type.
+	ContentTypeDefaulted bool
+	// Provenance records which fields came from defaults, repairs or parameter decoding rather
+	// than verbatim from the headers.
+	Provenance Provenance
+
+	// ContentParamsRaw is the unmodified parameter portion of the Content-Type header, from its
+	// first semicolon, and ContentParamList its parameters in their original order and case.
+	ContentParamsRaw string
+	ContentParamList []MediaParam
 
 	Size  int
 	Lines int
@@ -45,29 +73,127 @@ type Part struct {
 	Header       textproto.MIMEHeader
 	HeaderReader io.Reader
 
+	// PartOffset is the offset of the Part from the start of the input, HeaderLen the length of
+	// its header block including the blank line ending it, and PartLen that of its header block
+	// and content together.  Prefer Extent, HeaderExtent and ContentExtent, which define them.
 	PartOffset, HeaderLen, PartLen int
-	Epilogue                       []byte
-	Errors                         []error
 
+	// AbsoluteHeaderOffset is the offset of the Part's header block from the start of the
+	// original input, and AbsoluteOffset that of its content.
+	//
+	// Deprecated: Use HeaderExtent and ContentExtent, which give the lengths too.
+	AbsoluteHeaderOffset, AbsoluteOffset int
+
+	// Preamble is the content of a multipart Part preceding its first delimiter, and Epilogue
+	// that following its close delimiter.  Each multipart Part holds its own, nested Parts and
+	// those sharing their parent's boundary included, and Encode writes them back in place.  They
+	// are truncated WithPreambleEpilogueLimit, while PreambleLen and EpilogueLen hold their full
+	// lengths.
+	Preamble                 []byte
+	Epilogue                 []byte
+	PreambleLen, EpilogueLen int
+
+	// Errors lists the problems found and worked around while parsing the Part, such as malformed
+	// header lines or a missing Content-Type, each an *Error locating it in the input.
+	Errors []error
+
+	// SkippedRegions lists the content of a multipart Part the parser gave up on, and which is
+	// not represented by any of its Subparts.  It is only recorded WithSkippedRegions.
+	SkippedRegions []SkippedRegion
+
+	// Thumbnail is the preview of an image Part made WithThumbnailer, nil if there is none.
+	Thumbnail *Thumbnail
+
+	// UUEncoded lists the files found uuencoded, from a "begin 644 filename" line to the "end"
+	// line, in the content of a text/plain Part WithUUEncodeDetection.  Each is an attachment
+	// Part whose Parent is this Part but which is not among its Subparts, so that this Part
+	// remains a text body.  They have their Filename, a ContentType detected from it and their
+	// content, and Decode returns the decoded file.
+	UUEncoded []*Part
+
+	// Truncated is set, when parsing WithTruncationTolerance, on a Part whose content or Subparts
+	// end with the input rather than a boundary delimiter, and on the root Part of a truncated
+	// message.
+	Truncated bool
+
+	ps        *Parser
 	boundary  string
 	reader    io.Reader
 	rawReader ReaderAtCloser
+	content   []byte            // Content of a built Part waiting to be transfer encoded
+	encoded   []byte            // Transfer encoded content of a built Part
+	bound     *io.SectionReader // Transfer encoded content attached with BindReaderAt
+	parts     *int              // Number of Parts of the message read so far, see WithMaxParts
+	stream    StreamHandler     // Receives the content of leaf Parts as they are read, see Stream
+	index     atomic.Value      // Cached *PartIndex of the tree rooted at the Part, see Index
+	// closeNoEOL is set for a parsed multipart Part whose close delimiter was not followed by a
+	// line break, e.g. where the input or an enclosing part ended, so that Encode omits it too
+	closeNoEOL bool
+	// decodedHeader is set for the Part enclosed by a transfer encoded message/rfc822 Part, see
+	// WithDecodedMessageHeaders
+	decodedHeader bool
+	// streamLines counts the lines of a message read without buffering it, held by the root Part
+	// while it is parsed to locate ParseErrors
+	streamLines *lineCountingReader
+	// storeRef is the StoreRef Deduplicate set, telling it apart from one in the input
+	storeRef string
+	// fieldOrder holds the fields of a parsed Part's header in their original order, with their
+	// names as written, so that Encode keeps both, see writeHeader
+	fieldOrder []headerField
+}
+
+// SkippedRegion is a byte range of the input the parser skipped over.
+type SkippedRegion struct {
+	Offset int   // Offset of the region from the start of the input
+	Len    int   // Length of the region in bytes
+	Reason error // Why the region was skipped, e.g. ErrEmptyHeaderBlock
+}
+
+// ReadParts reads a MIME message from r, returning the root of its Part tree, see Parser.
+func ReadParts(r io.Reader, opts ...Option) (*Part, error) {
+	return NewParser(opts...).ReadParts(r)
+}
+
+// ReadPartsFromReaderAt reads the MIME message of size bytes held in r, returning the root of its
+// Part tree, see Parser.ReadPartsFromReaderAt.
+func ReadPartsFromReaderAt(r io.ReaderAt, size int64, opts ...Option) (*Part, error) {
+	return NewParser(opts...).ReadPartsFromReaderAt(r, size)
 }
 
-func ReadParts(r io.Reader) (*Part, error) {
-	b := mem_constrained_buffer.New()
-	_, err := b.ReadFrom(r)
+// ReadStructure reads the structure of a MIME message from r without retaining its content, see
+// Parser.ReadStructure.
+func ReadStructure(r io.Reader, opts ...Option) (*Part, error) {
+	return NewParser(opts...).ReadStructure(r)
+}
+
+func readParts(ps *Parser, r io.Reader) (*Part, error) {
+	tr := &truncatingReader{tolerant: ps.truncationTolerant}
+	b, size, err := ps.bufferMessage(r, tr)
 	if err != nil {
-		return nil, errors.Wrap(err, "error filling buffer")
+		return nil, fmt.Errorf("error filling buffer: %w", err)
 	}
+	return readBufferedParts(ps, b, size, tr.err)
+}
 
+// readBufferedParts reads the message of size bytes held in b, whose input ended early with
+// truncated if not nil, returning the root of its Part tree.  b is closed on error.
+func readBufferedParts(ps *Parser, b ReaderAtCloser, size int64, truncated error) (*Part, error) {
 	root := NewPart(nil)
-	// this rawReader will be copied to subparts in NewPart via the Parent pointer
+	// this rawReader and Parser will be copied to subparts in NewPart via the Parent pointer
 	root.rawReader = b
+	root.ps = ps
 
-	err = root.readPart(b, 0)
+	// Reading b opens its underlying file, so concurrent ReadAt calls never race to do so later
+	err := root.readPart(io.NewSectionReader(b, 0, size), 0)
+	if err == nil {
+		root.markTruncated(truncated)
+	}
+	if ps.captureDir != "" && ps.shouldCapture(root, err) {
+		ps.capture(b, size, root, err)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading part")
+		root.Close()
+		return nil, fmt.Errorf("error reading part: %w", err)
 	}
 
 	return root, nil
@@ -79,50 +205,267 @@ func NewPart(parent *Part) *Part {
 	}
 	if parent != nil {
 		part.rawReader = parent.rawReader
+		part.ps = parent.ps
+		part.parts = parent.parts
+		part.stream = parent.stream
 	}
 	return part
 }
 
 func (p *Part) Close() error {
+	if p.rawReader == nil {
+		// Built Parts hold their content in memory
+		return nil
+	}
 	return p.rawReader.Close()
 }
 
+// Reparse parses the Part again from its byte range in the original message, replacing its
+// header, content fields and Subparts.  If opts are given, a new Parser configured with them is
+// used for the Part and its descendants, otherwise the Part's existing Parser is reused.  Either
+// way the Parts of the whole message count against WithMaxParts, and the Index of the Part and its
+// ancestors is rebuilt.  Parts without the original message, such as those built or read with
+// ReadStructure, return ErrNoContent.
+func (p *Part) Reparse(opts ...Option) (err error) {
+	if p.rawReader == nil {
+		return ErrNoContent
+	}
+	ps := p.parser()
+	if len(opts) > 0 {
+		ps = NewParser(opts...)
+	}
+
+	q := &Part{
+		PartOffset: p.PartOffset,
+		ps:         ps,
+		rawReader:  p.rawReader,
+		parts:      p.parts,
+		stream:     p.stream,
+	}
+	if p.parts != nil {
+		// The Parts replaced no longer count against WithMaxParts, unless reparsing fails
+		counted := *p.parts
+		defer func() {
+			if err != nil {
+				*p.parts = counted
+			}
+		}()
+		p.Walk(func(*Part) error {
+			*p.parts--
+			return nil
+		})
+	}
+	if p.Parent != nil {
+		// Collect q in a placeholder parent; readPart derives subpart Descriptors from the
+		// Descriptor as it was before any multipart ".0" suffix was added.
+		q.Parent = &Part{}
+		q.Descriptor = strings.TrimSuffix(p.Descriptor, ".0")
+	}
+	r := io.NewSectionReader(p.rawReader, int64(p.PartOffset), int64(p.PartLen))
+	if err = q.readPart(r, p.PartOffset); err != nil {
+		return fmt.Errorf("error reparsing part: %w", err)
+	}
+
+	// Take q's fields one by one, copying q would copy its index
+	p.Descriptor = q.Descriptor
+	p.ContentType, p.ContentParams = q.ContentType, q.ContentParams
+	p.Disposition, p.DispositionParams = q.Disposition, q.DispositionParams
+	p.Encoding, p.Charset, p.Filename, p.ContentID = q.Encoding, q.Charset, q.Filename, q.ContentID
+	p.MIMEVersion, p.HasMIMEVersion = q.MIMEVersion, q.HasMIMEVersion
+	p.ContentTypeDefaulted, p.Provenance = q.ContentTypeDefaulted, q.Provenance
+	p.ContentParamsRaw, p.ContentParamList = q.ContentParamsRaw, q.ContentParamList
+	p.Size, p.Lines = q.Size, q.Lines
+	p.Subparts, p.Header, p.HeaderReader = q.Subparts, q.Header, q.HeaderReader
+	p.PartOffset, p.HeaderLen, p.PartLen = q.PartOffset, q.HeaderLen, q.PartLen
+	p.AbsoluteHeaderOffset, p.AbsoluteOffset = q.AbsoluteHeaderOffset, q.AbsoluteOffset
+	p.Preamble, p.Epilogue = q.Preamble, q.Epilogue
+	p.PreambleLen, p.EpilogueLen = q.PreambleLen, q.EpilogueLen
+	p.Errors, p.SkippedRegions = q.Errors, q.SkippedRegions
+	p.Thumbnail, p.UUEncoded, p.Truncated = q.Thumbnail, q.UUEncoded, q.Truncated
+	p.ps, p.boundary, p.reader = q.ps, q.boundary, q.reader
+	p.content, p.encoded, p.bound = q.content, q.encoded, q.bound
+	p.closeNoEOL, p.decodedHeader = q.closeNoEOL, q.decodedHeader
+	p.streamLines, p.storeRef, p.fieldOrder = q.streamLines, q.storeRef, q.fieldOrder
+	for _, s := range p.Subparts {
+		s.Parent = p
+	}
+	for _, u := range p.UUEncoded {
+		u.Parent = p
+	}
+	// The cached indexes of p and its ancestors hold the Parts replaced
+	p.InvalidateIndex()
+	return nil
+}
+
+// HeaderAt returns a reader over the Part's header block exactly as it appeared in the original
+// input, including the blank line terminating it.  Unlike HeaderReader it may be read any number
+// of times.  For built Parts it covers the header block as Encode writes it.  Parts read with
+// ReadStructure return ErrNoContent.
+func (p *Part) HeaderAt() (*io.SectionReader, error) {
+	if p.rawReader != nil {
+		return p.sectionReader(p.HeaderExtent()), nil
+	}
+	if p.ps != nil {
+		// Parsed, but the input was not retained
+		return nil, ErrNoContent
+	}
+	header := &bytes.Buffer{}
+	w := bufio.NewWriter(header)
+	if err := writeHeader(w, p.Header, p.fieldOrder); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(bytes.NewReader(header.Bytes()), 0, int64(header.Len())), nil
+}
+
+// RawHeaderBytes returns a copy of the Part's unmodified header block, see HeaderAt.
+func (p *Part) RawHeaderBytes() ([]byte, error) {
+	r, err := p.HeaderAt()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, r.Size())
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	return b, nil
+}
+
 func (p *Part) RawReader() io.Reader {
+	if p.HeaderReader == nil {
+		return p
+	}
 	return io.MultiReader(p.HeaderReader, p)
 }
 
+// SetHeader sets the header field name to value, replacing any existing values.  Names and values
+// containing CR, LF or other control characters are rejected with a *HeaderFieldError.
+func (p *Part) SetHeader(name, value string) error {
+	if err := ValidateHeaderField(name, value); err != nil {
+		return err
+	}
+	if p.Header == nil {
+		p.Header = make(textproto.MIMEHeader)
+	}
+	p.Header.Set(name, value)
+	p.InvalidateIndex()
+	return nil
+}
+
+// AddHeader appends value to the header field name, see SetHeader for validation rules.
+func (p *Part) AddHeader(name, value string) error {
+	if err := ValidateHeaderField(name, value); err != nil {
+		return err
+	}
+	if p.Header == nil {
+		p.Header = make(textproto.MIMEHeader)
+	}
+	p.Header.Add(name, value)
+	p.InvalidateIndex()
+	return nil
+}
+
+// Decode returns a reader over the Part's content with its Content-Transfer-Encoding removed and,
+// unless HasAttachmentHeader returns true and the Parser was not configured with
+// WithAttachmentCharsetConversion, its charset converted to UTF-8.  If the encoding is neither
+// built in nor added with RegisterTransferEncoding, or the charset cannot be converted, Decode
+// returns a *DecodeError.  The reader is nil in that case unless the Parser was configured with
+// WithBestEffortDecode, when it is the content decoded as far as was possible.  The reader
+// implements io.WriterTo for efficient use with io.Copy.
 func (p *Part) Decode() (io.Reader, error) {
+	return p.decode(p.parser().attachmentCharsets || !p.HasAttachmentHeader())
+}
+
+// HasAttachmentHeader returns true if the Part's header marks it as an attachment for Decode: it
+// has a Content-Disposition of attachment or inline, or the nonstandard Content-Type: attachment.
+func (p *Part) HasAttachmentHeader() bool {
+	return detectAttachmentHeader(p.Header)
+}
+
+// DecodeRaw returns a reader over the Part's content with its Content-Transfer-Encoding removed,
+// but without charset conversion, so that text Parts yield the exact bytes that were encoded.
+// This is the content to hash, scan or verify signatures over.  Errors are reported as for
+// Decode.  TransferDecoded is an alias.
+func (p *Part) DecodeRaw() (io.Reader, error) {
+	return p.decode(false)
+}
+
+// Raw returns a reader over the Part's body exactly as it appears in the message, still transfer
+// encoded; for multiparts it includes the Subparts with their headers and boundaries.  Unlike Read,
+// which consumes the body, it starts from the beginning each time.  Parts read with ReadStructure
+// return ErrNoContent.
+func (p *Part) Raw() (io.Reader, error) {
+	if p.rawReader != nil || p.encoded != nil || p.bound != nil {
+		return p.encodedBody(), nil
+	}
+	if ra, ok := p.reader.(io.ReaderAt); ok {
+		// Built multipart, rendered by finishBuilt
+		return io.NewSectionReader(ra, 0, int64(p.Size)), nil
+	}
+	return nil, ErrNoContent
+}
+
+// TransferDecoded is an alias for DecodeRaw, named to sit alongside Raw and Text.
+func (p *Part) TransferDecoded() (io.Reader, error) {
+	return p.DecodeRaw()
+}
+
+// Text returns a reader over the Part's content with its Content-Transfer-Encoding removed and its
+// charset converted to UTF-8.  Unlike Decode, it converts the charset of attachments regardless of
+// WithAttachmentCharsetConversion.  Errors are reported as for Decode.
+func (p *Part) Text() (io.Reader, error) {
+	return p.decode(true)
+}
+
+// decode implements Decode, converting the charset of text content to UTF-8 if convert is true.
+func (p *Part) decode(convert bool) (io.Reader, error) {
+	if p.reader == nil {
+		return nil, ErrNoContent
+	}
 	valid := true
 	r := p.reader
-
-	// Allow later access to Base64 errors
-	var b64cleaner *base64Cleaner
+	if p.rawReader != nil || p.encoded != nil || p.bound != nil {
+		// Start from the beginning of the content, so Decode may be called repeatedly
+		r = p.encodedBody()
+	}
+	var derr *DecodeError
 
 	// Build content decoding reader
 	encoding := p.Header.Get(hnContentEncoding)
 	switch strings.ToLower(encoding) {
 	case "quoted-printable":
-		r = newQPCleaner(r)
-		r = quotedprintable.NewReader(r)
+		qc := newQPCleanerSize(r, p.Size)
+		qc.part = p
+		r = quotedprintable.NewReader(qc)
 	case "base64":
-		b64cleaner = newBase64Cleaner(r)
-		r = base64.NewDecoder(base64.RawStdEncoding, b64cleaner)
+		r = base64.NewDecoder(base64.RawStdEncoding, newBase64Cleaner(r))
 	case "8bit", "7bit", "binary", "":
 		// No decoding required
+	case ctTransferUUEncode, "x-uue", "uuencode":
+		r = newUUDecoder(r)
 	default:
+		if fn := registeredTransferDecoder(strings.ToLower(encoding)); fn != nil {
+			r = fn(r)
+			break
+		}
 		// Unknown encoding
 		valid = false
-		log.Printf("%s: unrecognized Content-Transfer-Encoding type %q", ErrorContentEncoding, encoding)
-		//p.addWarning(
-		//	ErrorContentEncoding,
-		//	"Unrecognized Content-Transfer-Encoding type %q",
-		//	encoding)
+		derr = p.decodeError(
+			ErrorContentEncoding, "unrecognized Content-Transfer-Encoding type %q", encoding)
+	}
+
+	if valid && p.parser().verifyContentMD5 {
+		if sum := p.Header.Get(hnContentMD5); sum != "" {
+			r = newMD5Verifier(p, r, sum)
+		}
 	}
 
-	if valid && !detectAttachmentHeader(p.Header) {
+	if valid && convert {
 		// decodedReader is good; build character set conversion reader
 		if p.Charset != "" {
-			if reader, err := newCharsetReader(p.Charset, r); err == nil {
+			if reader, err := newCharsetReaderSize(p.Charset, r, p.Size); err == nil {
 				r = reader
 			} else {
 				// Try to parse charset again here to see if we can salvage some badly formed ones
@@ -130,26 +473,33 @@ func (p *Part) Decode() (io.Reader, error) {
 				charsetp := strings.Split(p.Charset, "=")
 				if strings.ToLower(charsetp[0]) == "charset" && len(charsetp) > 1 {
 					p.Charset = charsetp[1]
-					if reader, err := newCharsetReader(p.Charset, r); err == nil {
+					p.Provenance |= CharsetRepaired
+					if reader, err := newCharsetReaderSize(p.Charset, r, p.Size); err == nil {
 						r = reader
 					} else {
 						// Failed to get a conversion reader
-						//p.addWarning(ErrorCharsetConversion, err.Error())
-						log.Print(ErrorCharsetConversion)
+						derr = p.decodeError(ErrorCharsetConversion, "%v", err)
 					}
 				} else {
 					// Failed to get a conversion reader
-					//p.addWarning(ErrorCharsetConversion, err.Error())
-					log.Print(ErrorCharsetConversion)
+					derr = p.decodeError(ErrorCharsetConversion, "%v", err)
 				}
 			}
 		}
 	}
 
+	if max := p.parser().maxDecodedPartSize; max > 0 {
+		r = &limitReader{r: r, n: max, err: ErrDecodedTooLarge}
+	}
+	r = &decodedReader{r: r}
+
+	if derr != nil {
+		if !p.parser().bestEffortDecode {
+			return nil, derr
+		}
+		return r, derr
+	}
 	return r, nil
-	//if b64cleaner != nil {
-	//	p.Errors = append(p.Errors, b64cleaner.Errors...)
-	//}
 }
 
 type PartVisitor func(p *Part) error
@@ -166,60 +516,78 @@ func (p *Part) Walk(v PartVisitor) error {
 	return nil
 }
 
+// ContentParam returns the Content-Type parameter name, see Params.Param.
+func (p *Part) ContentParam(name string) (string, bool) {
+	return p.ContentParams.Param(name)
+}
+
+// DispositionParam returns the Content-Disposition parameter name, see Params.Param.
+func (p *Part) DispositionParam(name string) (string, bool) {
+	return p.DispositionParams.Param(name)
+}
+
 func (p *Part) String() string {
 	return fmt.Sprintf("%s <%s>", p.Descriptor, p.ContentType)
 }
 
+// Read reads the Part's body still transfer encoded, as Raw does, but consuming it: once read,
+// further calls return io.EOF.
 func (p *Part) Read(b []byte) (int, error) {
+	if p.reader == nil {
+		return 0, io.EOF
+	}
 	return p.reader.Read(b)
 }
 
-func (p *Part) readPart(r io.Reader, offset int) error {
+// readPart reads the Part, and any Subparts, from r.  An error is returned as a *ParseError
+// locating the innermost Part that failed.
+func (p *Part) readPart(r io.Reader, offset int) (err error) {
 	cr := countingReader{Reader: r}
-	br := bufio.NewReader(&cr)
+	// Subparts are read by the time readPart returns, no reference to br outlives it
+	br := getPeekReader(&cr, p.parser().readAhead)
+	defer putPeekReader(br)
+	defer func() {
+		if err != nil {
+			err = p.parseError(err, p.PartOffset+cr.N-br.Buffered())
+		}
+	}()
 
-	header, err := readHeader(br)
+	if err := p.checkLimits(); err != nil {
+		return err
+	}
+	maxHeader := p.parser().maxHeaderSize
+	header, fields, warnings, err := readHeaderLimit(br, maxHeader)
 	if err != nil {
 		return err
 	}
+	p.addWarnings(warnings)
+	p.fieldOrder = fields
 
 	p.HeaderLen = cr.N - br.Buffered()
-	p.Header = header
-
-	// Content-Type, default is text/plain us-ascii according to RFC 2046
-	// https://tools.ietf.org/html/rfc2046#section-5.1
-	mediatype := "text/plain"
-	params := map[string]string{
-		"charset": "us-ascii",
+	if maxHeader > 0 && p.HeaderLen > maxHeader {
+		return ErrHeaderTooLarge
 	}
-	ctype := header.Get(hnContentType)
-	if ctype == "" {
-		//p.addWarning(
-		//	ErrorMissingContentType,
-		//	"MIME parts should have a Content-Type header")
-		log.Printf("%s: MIME parts should have a Content-Type header", p.Descriptor)
-	} else {
-		// Parse Content-Type header
-		mediatype, params, err = parseMediaType(ctype)
-		if err != nil {
-			return err
-		}
+	if err := p.setupHeader(header); err != nil {
+		return err
 	}
-	p.ContentType = strings.ToLower(mediatype)
-	p.ContentParams = params
-	p.Charset = strings.ToLower(params[hpCharset])
 
-	// Set disposition, filename, charset if available
-	p.setupContentHeaders(params)
-	p.boundary = params[hpBoundary]
-
-	if p.boundary != "" {
+	if p.boundary != "" && !p.sharesParentBoundary() {
 		// Content is another multipart
 		err = parseParts(p, br, &cr, p.PartOffset)
 		if err != nil {
 			return err
 		}
+	} else if p.boundary != "" {
+		// The parent's boundary reader stops at our first delimiter, parseParts reads our Subparts
+		// from it once we return
+		preamble := &retainBuffer{limit: p.parser().preambleEpilogueLimit}
+		if _, err := io.Copy(preamble, br); err != nil {
+			return err
+		}
+		p.Preamble, p.PreambleLen = preamble.buf, preamble.n
 	} else {
+		// Count the lines of the content as it is read, for IMAP BODYSTRUCTURE
+		lr := &lineCountingReader{r: br}
 		if p.ContentType == ContentTypeMessageRfc822 {
 			pp := NewPart(p)
 			pp.PartOffset = p.PartOffset + p.HeaderLen
@@ -227,15 +595,25 @@ func (p *Part) readPart(r io.Reader, offset int) error {
 				p.Descriptor = "1"
 			}
 			pp.Descriptor = p.Descriptor
-			err = pp.readPart(br, offset)
+			if encoding := p.Header.Get(hnContentEncoding); p.parser().decodeMessageHeaders &&
+				isBinaryToTextEncoding(encoding) {
+				err = pp.readEncodedMessage(lr, encoding)
+			} else {
+				err = pp.readPart(lr, offset)
+			}
 			if err != nil {
 				return err
 			}
+		} else if p.stream != nil {
+			if err := p.streamContent(lr); err != nil {
+				return err
+			}
 		} else {
-			if _, err := io.Copy(ioutil.Discard, br); err != nil {
+			if _, err := io.Copy(ioutil.Discard, lr); err != nil {
 				return err
 			}
 		}
+		p.Lines = lr.n
 	}
 
 	// Insert this Part into the MIME tree
@@ -243,18 +621,128 @@ func (p *Part) readPart(r io.Reader, offset int) error {
 		p.Parent.Subparts = append(p.Parent.Subparts, p)
 	}
 
-	p.PartLen = cr.N - br.Buffered()
-	p.Size = p.PartLen - p.HeaderLen
+	p.setPartLen(cr.N - br.Buffered())
+	if p.ContentTypeDefaulted && !p.isEmpty() {
+		p.addWarning(ErrorMissingContentType, "MIME parts should have a Content-Type header")
+	}
+	p.makeThumbnail()
+	p.findUUEncoded()
+	return nil
+}
 
-	p.reader = io.NewSectionReader(
-		p.rawReader, int64(p.PartOffset+p.HeaderLen), int64(p.PartLen-p.HeaderLen))
-	p.HeaderReader = io.NewSectionReader(
-		p.rawReader, int64(p.PartOffset), int64(p.HeaderLen))
+// isEmpty returns true for a Part with no header fields and no content, such as one with nothing
+// or only a blank line between its delimiters.
+func (p *Part) isEmpty() bool {
+	return len(p.Header) == 0 && p.Size == 0
+}
+
+// setupHeader sets the Part's Header and the fields derived from it.
+func (p *Part) setupHeader(header textproto.MIMEHeader) error {
+	p.Header = header
+	p.ContentID = parseContentID(StripComments(header.Get(hnContentID)))
+	p.MIMEVersion, p.HasMIMEVersion = parseMIMEVersion(header)
+
+	// Content-Type, default is text/plain us-ascii according to RFC 2046
+	// https://tools.ietf.org/html/rfc2046#section-5.1
+	mediatype := "text/plain"
+	params := map[string]string{
+		"charset": "us-ascii",
+	}
+	ctype := header.Get(hnContentType)
+	if ctype == "" {
+		p.ContentTypeDefaulted = true
+		p.Provenance |= ContentTypeDefault
+		if ps := p.parser(); ps.defaultMediaType != "" {
+			mediatype = ps.defaultMediaType
+			params = make(map[string]string, len(ps.defaultParams))
+			for k, v := range ps.defaultParams {
+				params[k] = v
+			}
+		}
+	} else {
+		// Parse Content-Type header
+		var (
+			repairs []Repair
+			err     error
+		)
+		mediatype, params, repairs, err = ParseMediaType(ctype)
+		if err != nil {
+			return err
+		}
+		if len(repairs) > 0 {
+			p.Provenance |= ContentTypeRepaired
+		}
+		for _, r := range repairs {
+			p.addWarningAt(p.fieldOffset(hnContentType), ErrorMalformedMediaType, "%s: %s",
+				hnContentType, r)
+		}
+		if hasExtendedParam(ctype, hpCharset) {
+			p.Provenance |= CharsetRFC2231
+		}
+		p.ContentParamsRaw, p.ContentParamList = splitMediaParams(ctype)
+		for _, mp := range p.ContentParamList {
+			if strings.EqualFold(mp.Name, hpCharset) && mp.Value != params[hpCharset] {
+				// The value had a stray prefix, e.g. charset="charset=utf-8"
+				p.Provenance |= CharsetRepaired
+			}
+		}
+	}
+	p.ContentType = strings.ToLower(mediatype)
+	p.ContentParams = params
+	p.Charset = strings.ToLower(params[hpCharset])
+	if p.ContentTypeDefaulted && p.Charset != "" {
+		p.Provenance |= CharsetDefault
+	}
+
+	// Set disposition, filename, charset if available
+	p.setupContentHeaders(params)
+	p.setupBoundary(params)
 
+	isMessage := p.Parent == nil || p.Parent.ContentType == ContentTypeMessageRfc822
+	if isMessage && !p.HasMIMEVersion && (ctype != "" || header.Get(hnContentEncoding) != "") {
+		p.addWarning(ErrorMissingMIMEVersion, "message uses MIME headers without MIME-Version")
+	}
 	return nil
 }
 
+// setPartLen sets the length of the Part, and the fields derived from it.
+func (p *Part) setPartLen(n int) {
+	p.PartLen = n
+	p.Size = p.PartLen - p.HeaderLen
+	p.AbsoluteHeaderOffset = p.HeaderExtent().Offset
+	p.AbsoluteOffset = p.ContentExtent().Offset
+
+	if p.rawReader != nil {
+		p.reader = io.NewSectionReader(
+			p.rawReader, int64(p.PartOffset+p.HeaderLen), int64(p.PartLen-p.HeaderLen))
+		p.HeaderReader = io.NewSectionReader(
+			p.rawReader, int64(p.PartOffset), int64(p.HeaderLen))
+	}
+}
+
+// markTruncated marks the root Part of a message Truncated if any of its Parts are, or if err,
+// which ended its input early, is not nil.
+func (p *Part) markTruncated(err error) {
+	if err != nil {
+		p.Truncated = true
+		p.addWarning(ErrorTruncated, "input ended early: %v", err)
+	}
+	p.Walk(func(s *Part) error {
+		p.Truncated = p.Truncated || s.Truncated
+		return nil
+	})
+}
+
+// sharesParentBoundary returns true for a multipart Part that reuses the boundary of its parent.
+func (p *Part) sharesParentBoundary() bool {
+	return p.Parent != nil && p.boundary != "" && p.boundary == p.Parent.boundary
+}
+
 // parseParts recursively parses a mime multipart document and sets each Part's Descriptor.
+//
+// A multipart Part reusing its parent's boundary can not be told apart from its siblings by the
+// boundary alone.  Its Subparts are taken to be the parts following it, up to the first close
+// delimiter, after which the parent continues with any remaining parts.
 func parseParts(parent *Part, reader *bufio.Reader, cr *countingReader, offset int) error {
 	firstRecursion := parent.Parent == nil
 	// Set root Descriptor
@@ -265,14 +753,54 @@ func parseParts(parent *Part, reader *bufio.Reader, cr *countingReader, offset i
 	var indexDescriptor int
 
 	// Loop over MIME parts
+	limit := parent.parser().preambleEpilogueLimit
 	br := newBoundaryReader(reader, parent.boundary)
+	br.tolerant = parent.parser().truncationTolerant
+	preamble := &retainBuffer{limit: limit}
+	if parent.sharesParentBoundary() {
+		// readPart read the preamble up to the line break preceding the first delimiter, which
+		// Next adds to it
+		preamble.buf, preamble.n = parent.Preamble, parent.PreambleLen
+	}
+	br.preamble = preamble
+	// empty is the last Part read if it had no header block, and emptyEnd the end of its content
+	var (
+		empty    *Part
+		emptyEnd int
+	)
 	for {
 		indexDescriptor++
 
 		next, err := br.Next()
+		if empty != nil {
+			if err == io.EOF {
+				// Next consumed the remainder of the input looking for a boundary
+				emptyEnd = offset + (cr.N - reader.Buffered())
+			}
+			parent.addSkippedRegion(empty.PartOffset, emptyEnd, ErrEmptyHeaderBlock)
+			switch {
+			case next:
+				parent.addWarningAt(empty.PartOffset, ErrEmptyHeaderBlock,
+					"part %s has no header block and was skipped", empty.Descriptor)
+			case err == nil:
+				// The close delimiter followed
+			case strings.HasSuffix(err.Error(), "EOF"):
+				// There are no more Parts, but the error belongs to a sibling or parent, because
+				// the empty Part doesn't actually exist.
+				parent.addWarningAt(empty.PartOffset, ErrorMissingBoundary,
+					"boundary %q was not closed correctly", parent.boundary)
+				err = nil
+			default:
+				return fmt.Errorf("error at boundary %v: %w", parent.boundary, err)
+			}
+			empty = nil
+		}
 		if err != nil && err != io.EOF {
 			return err
 		}
+		if indexDescriptor == 1 {
+			parent.Preamble, parent.PreambleLen = preamble.buf, preamble.n
+		}
 		if !next {
 			break
 		}
@@ -289,30 +817,50 @@ func parseParts(parent *Part, reader *bufio.Reader, cr *countingReader, offset i
 		}
 
 		err = p.readPart(br, offset)
-		if err == ErrEmptyHeaderBlock {
+		if errors.Is(err, ErrEmptyHeaderBlock) {
 			// Empty header probably means the part didn't use the correct trailing "--" syntax to
-			// close its boundary.
-			if _, err = br.Next(); err != nil {
-				if err == io.EOF || strings.HasSuffix(err.Error(), "EOF") {
-					// There are no more Parts, but the error belongs to a sibling or parent,
-					// because this Part doesn't actually exist.
-					// TODO
-					log.Printf("%v: boundary %q was not closed correctly", ErrorMissingBoundary, parent.boundary)
-					break
-				}
-				return fmt.Errorf("error at boundary %v: %v", parent.boundary, err)
-			}
+			// close its boundary.  Skip it, leaving the next delimiter for Next so that any
+			// siblings following it are still read.
+			_, _ = io.Copy(ioutil.Discard, br)
+			empty, emptyEnd = p, offset+(cr.N-reader.Buffered())
+		} else if err != nil && br.truncated {
+			// The input ended within the Part, leaving too little of it to parse
+			parent.addSkippedRegion(p.PartOffset, offset+(cr.N-reader.Buffered()), ErrorTruncated)
+			break
 		} else if err != nil {
-			return errors.Wrap(err, "error reading part")
+			return fmt.Errorf("error reading part: %w", err)
+		} else if p.sharesParentBoundary() {
+			if err := parseParts(p, reader, cr, offset); err != nil {
+				return err
+			}
+			p.setPartLen(offset + (cr.N - reader.Buffered()) - p.PartOffset)
+		}
+		if br.truncated {
+			p.Truncated = true
 		}
 	}
+	parent.closeNoEOL = br.finished && !br.closeEOL
+	if br.closeJunk != nil {
+		parent.addWarningAt(offset+(cr.N-reader.Buffered())-br.closeLen, ErrorMissingBoundary,
+			"close delimiter of boundary %q is followed by %q", parent.boundary, br.closeJunk)
+	}
+	if br.truncated {
+		parent.Truncated = true
+		parent.addWarning(ErrorTruncated, "input ended before boundary %q was closed",
+			parent.boundary)
+	}
 
-	// Store any content following the closing boundary marker into the epilogue
-	epilogue := new(bytes.Buffer)
-	if _, err := io.Copy(epilogue, reader); err != nil {
+	// Store any content following the closing boundary marker into the epilogue, which for a Part
+	// sharing its parent's boundary ends at the parent's next delimiter
+	var rest io.Reader = reader
+	if parent.sharesParentBoundary() {
+		rest = br
+	}
+	epilogue := &retainBuffer{limit: limit}
+	if _, err := io.Copy(epilogue, rest); err != nil {
 		return err
 	}
-	parent.Epilogue = epilogue.Bytes()
+	parent.Epilogue, parent.EpilogueLen = epilogue.buf, epilogue.n
 
 	// If a Part is "multipart/" Content-Type, it will have .0 appended to its Descriptor
 	// i.e. it is the root of its MIME Part subtree
@@ -323,27 +871,110 @@ func parseParts(parent *Part, reader *bufio.Reader, cr *countingReader, offset i
 	return nil
 }
 
+// addSkippedRegion records the input from start to end as skipped for reason, if the Parser was
+// configured WithSkippedRegions.
+func (p *Part) addSkippedRegion(start, end int, reason error) {
+	if !p.parser().skippedRegions || end <= start {
+		return
+	}
+	p.SkippedRegions = append(p.SkippedRegions, SkippedRegion{
+		Offset: start,
+		Len:    end - start,
+		Reason: reason,
+	})
+}
+
+// setupBoundary sets the boundary of multipart Parts, leaving it empty for Parts whose content
+// should not be split into Subparts.  Any multipart subtype with a boundary parameter is split,
+// unless the Parser was configured WithOpaqueUnknownMultipart and the subtype is not known.  The
+// boundary is looked up with Params.Param, so that it may be split into RFC 2231 continuations.
+func (p *Part) setupBoundary(params Params) {
+	if !strings.HasPrefix(p.ContentType, ctMultipartPrefix) {
+		return
+	}
+	boundary, _ := params.Param(hpBoundary)
+	if boundary == "" {
+		p.addWarningAt(p.fieldOffset(hnContentType), ErrorMissingBoundary,
+			"%s has no boundary parameter", p.ContentType)
+		return
+	}
+	if p.parser().opaqueUnknownMultipart && !knownMultipartSubtypes[p.ContentType] {
+		return
+	}
+	for a := p.Parent; a != nil; a = a.Parent {
+		if a.boundary == boundary {
+			p.addWarningAt(p.fieldOffset(hnContentType), ErrorNestedBoundary,
+				"boundary %q is already used by enclosing part %s", boundary, a.Descriptor)
+			break
+		}
+	}
+	p.boundary = boundary
+}
+
 // setupContentHeaders uses Content-Type media params and Content-Disposition headers to populate
 // the disposition, filename, and charset fields.
 func (p *Part) setupContentHeaders(mediaParams map[string]string) {
 	// Determine content disposition, filename, character set
-	disposition, dparams, err := parseMediaType(p.Header.Get(hnContentDisposition))
+	cdisp := p.Header.Get(hnContentDisposition)
+	disposition, dparams, repairs, err := ParseMediaType(cdisp)
+	for _, r := range repairs {
+		p.addWarningAt(p.fieldOffset(hnContentDisposition), ErrorMalformedMediaType, "%s: %s",
+			hnContentDisposition, r)
+	}
 	if err == nil {
 		// Disposition is optional
 		p.Disposition = disposition
-		p.Filename = decodeHeader(dparams[hpFilename])
-	}
-	if p.Filename == "" && mediaParams[hpName] != "" {
-		p.Filename = decodeHeader(mediaParams[hpName])
+		p.DispositionParams = dparams
+		p.setFilename(dparams[hpFilename], hasExtendedParam(cdisp, hpFilename))
 	}
-	if p.Filename == "" && mediaParams[hpFile] != "" {
-		p.Filename = decodeHeader(mediaParams[hpFile])
+	ctype := p.Header.Get(hnContentType)
+	for _, param := range []string{hpName, hpFile} {
+		if p.Filename == "" && mediaParams[param] != "" {
+			p.setFilename(mediaParams[param], hasExtendedParam(ctype, param))
+			p.Provenance |= FilenameFromContentType
+		}
 	}
 	if p.Charset == "" {
 		p.Charset = strings.ToLower(mediaParams[hpCharset])
 	}
 }
 
+// setFilename sets Filename from a parameter value, decoding any RFC 2047 encoded-words.
+// extended indicates the value was RFC 2231 decoded by parseStrictMediaType.
+func (p *Part) setFilename(value string, extended bool) {
+	if value == "" {
+		return
+	}
+	p.Filename = decodeHeader(value)
+	if extended {
+		p.Provenance |= FilenameRFC2231
+	}
+	if p.Filename != value {
+		p.Provenance |= FilenameRFC2047
+	}
+}
+
+// lineCountingReader counts the newlines read from r.
+type lineCountingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read method for io.Reader interface.
+func (lr *lineCountingReader) Read(b []byte) (int, error) {
+	n, err := lr.r.Read(b)
+	lr.n += bytes.Count(b[:n], []byte{'\n'})
+	return n, err
+}
+
+// bufferLine returns the line, counting from 1, holding offset in the input held by r, see
+// ParseError.
+func bufferLine(r io.ReaderAt, offset int) int {
+	lr := &lineCountingReader{r: io.NewSectionReader(r, 0, int64(offset))}
+	_, _ = io.Copy(ioutil.Discard, lr)
+	return lr.n + 1
+}
+
 type countingReader struct {
 	io.Reader
 	N int
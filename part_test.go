@@ -1,6 +1,15 @@
 package mime_test
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/cardamaro/mime"
@@ -917,3 +926,533 @@ func TestBadBoundaryTerm(t *testing.T) {
 	want = "An HTML section"
 	test.ContentEqualsString(t, p2, want)
 }
+
+func TestPartReparse(t *testing.T) {
+	r := test.OpenTestData("parts", "nestedmulti.raw")
+	root, err := mime.ReadParts(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	p := root.Subparts[1]
+	p.ContentType = "text/plain"
+	p.Subparts = nil
+	p.Header.Del("Content-Type")
+
+	if err := p.Reparse(); err != nil {
+		t.Fatal(err)
+	}
+	if root.Subparts[1] != p {
+		t.Fatal("Reparse replaced Part in parent")
+	}
+	wantp := &mime.Part{
+		Parent: test.PartExists,
+		Subparts: []*mime.Part{
+			test.PartExists, test.PartExists, test.PartExists},
+		ContentType: "multipart/related",
+		Descriptor:  "2.0",
+	}
+	test.ComparePart(t, p, wantp)
+	if p.Parent != root {
+		t.Errorf("Parent == %v, want %v", p.Parent, root)
+	}
+
+	for i, s := range p.Subparts {
+		if s.Parent != p {
+			t.Errorf("Subparts[%d].Parent == %v, want %v", i, s.Parent, p)
+		}
+	}
+	wantp = &mime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/plain",
+		Disposition: "inline",
+		Filename:    "attach.txt",
+		Descriptor:  "2.2",
+	}
+	test.ComparePart(t, p.Subparts[1], wantp)
+	test.ContentEqualsString(t, p.Subparts[1], "An inline text attachment")
+
+	// Reparsing the root keeps its Descriptor
+	if err := root.Reparse(); err != nil {
+		t.Fatal(err)
+	}
+	if root.Descriptor != "0" || len(root.Subparts) != 2 {
+		t.Errorf("root reparsed as %v with %d Subparts", root, len(root.Subparts))
+	}
+
+	built := &mime.Part{}
+	if err := built.Reparse(); err != mime.ErrNoContent {
+		t.Errorf("Reparse() on built Part == %v, want %v", err, mime.ErrNoContent)
+	}
+}
+
+func TestPartReparseIndex(t *testing.T) {
+	r := test.OpenTestData("parts", "nestedmulti.raw")
+	root, err := mime.ReadParts(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	p := root.Subparts[1]
+	old := root.Index().Descriptor("2.1")
+	p.Index()
+	if err := p.Reparse(); err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []*mime.PartIndex{root.Index(), p.Index()} {
+		if got := x.Descriptor("2.1"); got == old || got != p.Subparts[0] {
+			t.Errorf("Descriptor(%q) == %p, want the reparsed %p, not %p", "2.1", got,
+				p.Subparts[0], old)
+		}
+	}
+}
+
+func TestPartReparseMaxParts(t *testing.T) {
+	r := test.OpenTestData("parts", "nestedmulti.raw")
+	root, err := mime.ReadParts(r, mime.WithMaxParts(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	// The replaced Parts are not counted twice
+	for i := 0; i < 3; i++ {
+		if err := root.Subparts[1].Reparse(); err != nil {
+			t.Fatalf("Reparse() #%d error %v", i, err)
+		}
+	}
+	if err := root.Subparts[1].Reparse(mime.WithMaxParts(5)); !errors.Is(err, mime.ErrPartLimit) {
+		t.Errorf("Reparse() error %v, want %v", err, mime.ErrPartLimit)
+	}
+	// The failed Reparse leaves the count as it was
+	if err := root.Subparts[1].Reparse(); err != nil {
+		t.Errorf("Reparse() after failure error %v", err)
+	}
+}
+
+func TestPartExtentBytes(t *testing.T) {
+	for _, name := range []string{"nestedmulti.raw", "multirfc822.raw", "singlerfc822.raw"} {
+		raw, err := ioutil.ReadFile(filepath.Join("testdata", "parts", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := mime.ReadParts(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root.Walk(func(p *mime.Part) error {
+			header, err := ioutil.ReadAll(p.HeaderReader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			he := p.HeaderExtent()
+			if got := raw[he.Offset:he.End()]; !bytes.Equal(got, header) {
+				t.Errorf("%s %v: header at HeaderExtent() == %q, want %q", name, p, got, header)
+			}
+			content, err := ioutil.ReadAll(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ce := p.ContentExtent()
+			if got := raw[ce.Offset:ce.End()]; !bytes.Equal(got, content) {
+				t.Errorf("%s %v: content at ContentExtent() == %q, want %q", name, p, got, content)
+			}
+			if p.AbsoluteHeaderOffset != he.Offset || p.AbsoluteOffset != ce.Offset {
+				t.Errorf("%s %v: AbsoluteHeaderOffset, AbsoluteOffset == %d, %d, want %d, %d", name,
+					p, p.AbsoluteHeaderOffset, p.AbsoluteOffset, he.Offset, ce.Offset)
+			}
+			return nil
+		})
+		root.Close()
+	}
+}
+
+func TestPartRawHeaderBytes(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", "parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := mime.ReadParts(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	root.Walk(func(p *mime.Part) error {
+		he := p.HeaderExtent()
+		want := raw[he.Offset:he.End()]
+		for i := 0; i < 2; i++ {
+			got, err := p.RawHeaderBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%v: RawHeaderBytes() #%d == %q, want %q", p, i, got, want)
+			}
+		}
+		r, err := p.HeaderAt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err := r.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, want[:4]) {
+			t.Errorf("%v: HeaderAt().ReadAt() == %q, %v, want %q", p, buf, err, want[:4])
+		}
+		return nil
+	})
+
+	structure, err := mime.ReadStructure(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := structure.RawHeaderBytes(); err != mime.ErrNoContent {
+		t.Errorf("RawHeaderBytes() from ReadStructure == %v, want %v", err, mime.ErrNoContent)
+	}
+
+	built := &mime.Part{}
+	built.SetHeader("Content-Type", "text/plain")
+	got, err := built.RawHeaderBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Content-Type: text/plain\r\n\r\n"; string(got) != want {
+		t.Errorf("RawHeaderBytes() on built Part == %q, want %q", got, want)
+	}
+}
+
+func TestPartDecodeRaw(t *testing.T) {
+	raw := "Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9"
+	p, err := mime.ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ttable := []struct {
+		decode func() (io.Reader, error)
+		want   string
+	}{
+		{p.DecodeRaw, "Caf\xe9"},
+		{p.Decode, "Café"},
+		{p.DecodeRaw, "Caf\xe9"},
+	}
+	for _, tt := range ttable {
+		r, err := tt.decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestPartReaders(t *testing.T) {
+	raw := "Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Disposition: attachment; filename=cafe.txt\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9"
+	p, err := mime.ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ttable := []struct {
+		name   string
+		reader func() (io.Reader, error)
+		want   string
+	}{
+		{"Raw", p.Raw, "Caf=E9"},
+		{"TransferDecoded", p.TransferDecoded, "Caf\xe9"},
+		{"Text", p.Text, "Café"},
+		{"Decode", p.Decode, "Caf\xe9"},
+		{"Raw", p.Raw, "Caf=E9"},
+	}
+	for _, tt := range ttable {
+		r, err := tt.reader()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	built, err := mime.NewAlternative("text", "<p>html</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := built.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(r)
+	if len(got) != built.Size || !strings.Contains(string(got), "<p>html</p>") {
+		t.Errorf("Raw() on built multipart == %q", got)
+	}
+
+	p, err = mime.ReadStructure(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Raw(); err != mime.ErrNoContent {
+		t.Errorf("Raw() on structure error %v, want %v", err, mime.ErrNoContent)
+	}
+}
+
+func TestAttachmentCharsetConversion(t *testing.T) {
+	raw := "Content-Type: text/csv; charset=iso-8859-1\r\n" +
+		"Content-Disposition: attachment; filename=cafe.csv\r\n" +
+		"\r\n" +
+		"caf\xe9,1"
+	ttable := []struct {
+		opts []mime.Option
+		want string
+	}{
+		{nil, "caf\xe9,1"},
+		{[]mime.Option{mime.WithAttachmentCharsetConversion()}, "café,1"},
+	}
+	for _, tt := range ttable {
+		p, err := mime.ReadParts(strings.NewReader(raw), tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.HasAttachmentHeader() {
+			t.Error("HasAttachmentHeader() == false, want true")
+		}
+		r, err := p.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.ContentEqualsString(t, r, tt.want)
+	}
+
+	p, err := mime.ReadParts(strings.NewReader("Content-Type: text/plain\r\n\r\nbody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.HasAttachmentHeader() {
+		t.Error("HasAttachmentHeader() == true for a body Part, want false")
+	}
+}
+
+// chunkWriter records the largest Write it receives.
+type chunkWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *chunkWriter) Write(b []byte) (int, error) {
+	if len(b) > w.max {
+		w.max = len(b)
+	}
+	return w.Buffer.Write(b)
+}
+
+func TestPartDecodeWriterTo(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 16*1024)
+	raw := "Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(content)
+	p, err := mime.ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := p.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.(io.WriterTo); !ok {
+		t.Fatalf("Decode() reader %T does not implement io.WriterTo", r)
+	}
+	// Hide bytes.Buffer's ReadFrom
+	w := &chunkWriter{}
+	if _, err := io.Copy(struct{ io.Writer }{w}, r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), content) {
+		t.Error("content was altered")
+	}
+	if w.max <= 4096 {
+		t.Errorf("largest write was %d bytes, want more than 4096", w.max)
+	}
+
+	r, err = p.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if n, err := io.Copy(buf, r); err != nil || n != int64(len(content)) {
+		t.Errorf("io.Copy() == %d, %v, want %d, nil", n, err, len(content))
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Error("content was altered")
+	}
+}
+
+// smallPartsMessage returns a multipart message with n small quoted-printable parts.
+func smallPartsMessage(n int) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("Content-Type: multipart/mixed; boundary=b\r\n\r\n")
+	for i := 0; i < n; i++ {
+		buf.WriteString("--b\r\n" +
+			"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Caf=E9 cr=E8me br=FBl=E9e, p=E2tisserie et th=E9 =\r\n" +
+			"pour la r=E9union de l'=E9quipe.\r\n")
+	}
+	buf.WriteString("--b--\r\n")
+	return buf.Bytes()
+}
+
+func BenchmarkDecodeSmallParts(b *testing.B) {
+	root, err := mime.ReadParts(bytes.NewReader(smallPartsMessage(1000)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer root.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, p := range root.Subparts {
+			d, err := p.Decode()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Copy(ioutil.Discard, d); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestConcurrentDecode(t *testing.T) {
+	// Small messages are buffered in memory, large ones in a temporary file
+	for _, size := range []int{1024, 64 * 1024} {
+		content := make([][]byte, 8)
+		buf := &bytes.Buffer{}
+		buf.WriteString("Content-Type: multipart/mixed; boundary=b\r\n\r\n")
+		for i := range content {
+			content[i] = bytes.Repeat([]byte{'a' + byte(i)}, size)
+			buf.WriteString("--b\r\n")
+			if i%2 == 0 {
+				buf.WriteString("Content-Type: text/plain; charset=iso-8859-1\r\n" +
+					"Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+				qp := quotedprintable.NewWriter(buf)
+				qp.Write(content[i])
+				qp.Close()
+			} else {
+				buf.WriteString("Content-Type: application/octet-stream\r\n" +
+					"Content-Transfer-Encoding: base64\r\n\r\n")
+				buf.WriteString(base64.StdEncoding.EncodeToString(content[i]))
+			}
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("--b--\r\n")
+
+		p, err := mime.ReadParts(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		for i, s := range p.Subparts {
+			go func(s *mime.Part, want []byte) {
+				for n := 0; n < 10; n++ {
+					d, err := s.Decode()
+					if err != nil {
+						done <- err
+						return
+					}
+					got, err := ioutil.ReadAll(d)
+					if err != nil {
+						done <- err
+						return
+					}
+					if !bytes.Equal(got, want) {
+						done <- fmt.Errorf("%v decoded to %d bytes, want %d", s, len(got), len(want))
+						return
+					}
+					if _, err := s.RawHeaderBytes(); err != nil {
+						done <- err
+						return
+					}
+				}
+				done <- nil
+			}(s, content[i])
+		}
+		for range p.Subparts {
+			if err := <-done; err != nil {
+				t.Errorf("size %d: %v", size, err)
+			}
+		}
+		p.Close()
+	}
+}
+
+func TestEmptyParts(t *testing.T) {
+	text := "Content-Type: text/plain\r\n\r\nx\r\n"
+	ttable := []struct {
+		name, body string
+		empty      []int // Indexes of the empty Subparts
+		parts      int
+	}{
+		{"nothing first", "--b\r\n--b\r\n" + text + "--b--\r\n", []int{0}, 2},
+		{"nothing last", "--b\r\n" + text + "--b\r\n--b--\r\n", []int{1}, 2},
+		{"nothing only", "--b\r\n--b--\r\n", []int{0}, 1},
+		{"nothing between", "--b\r\n" + text + "--b\r\n--b\r\n" + text + "--b--\r\n", []int{1}, 3},
+		{"CRLF first", "--b\r\n\r\n--b\r\n" + text + "--b--\r\n", []int{0}, 2},
+		{"CRLF last", "--b\r\n" + text + "--b\r\n\r\n--b--\r\n", []int{1}, 2},
+		{"CRLFs", "--b\r\n\r\n\r\n--b\r\n" + text + "--b--\r\n", []int{0}, 2},
+		{"white space", "--b\r\n \r\n--b--\r\n", []int{0}, 1},
+	}
+	for _, tt := range ttable {
+		raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" + tt.body
+		p, err := mime.ReadParts(strings.NewReader(raw))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(p.Subparts) != tt.parts {
+			t.Errorf("%s: got %d Subparts, want %d", tt.name, len(p.Subparts), tt.parts)
+			continue
+		}
+		for _, i := range tt.empty {
+			s := p.Subparts[i]
+			if len(s.Header) != 0 || s.Size != 0 || s.ContentType != "text/plain" ||
+				len(s.Errors) != 0 {
+				t.Errorf("%s: Subpart %d has Header %v, Size %d, ContentType %q, Errors %v",
+					tt.name, i, s.Header, s.Size, s.ContentType, s.Errors)
+			}
+			test.ContentEqualsString(t, s, "")
+		}
+	}
+
+	// Empty Parts are the same when nested
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: multipart/mixed; boundary=c\r\n\r\n--c\r\n--c--\r\n--b--\r\n"
+	p, err := mime.ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := p.Subparts[0].Subparts
+	if len(nested) != 1 || len(nested[0].Header) != 0 || nested[0].Size != 0 {
+		t.Errorf("got nested Subparts %v", nested)
+	}
+}
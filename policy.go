@@ -0,0 +1,208 @@
+package mime
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Verdict is the outcome of checking an attachment against an AttachmentPolicy.
+type Verdict int
+
+// Verdicts in increasing order of severity
+const (
+	VerdictAllow Verdict = iota
+	VerdictWarn
+	VerdictBlock
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case VerdictAllow:
+		return "allow"
+	case VerdictWarn:
+		return "warn"
+	case VerdictBlock:
+		return "block"
+	}
+	return "unknown"
+}
+
+// executableExtensions are filename extensions Windows, or a common runtime, will execute when
+// opened.
+var executableExtensions = []string{
+	".app", ".application", ".bat", ".cmd", ".com", ".cpl", ".dll", ".exe", ".gadget", ".hta",
+	".inf", ".jar", ".js", ".jse", ".lnk", ".msc", ".msi", ".msp", ".pif", ".ps1", ".psm1",
+	".reg", ".scf", ".scr", ".sct", ".sys", ".vb", ".vbe", ".vbs", ".wsc", ".wsf", ".wsh",
+}
+
+// macroExtensions are the macro-enabled Office Open XML formats.
+var macroExtensions = []string{
+	".docm", ".dotm", ".potm", ".ppam", ".ppsm", ".pptm", ".sldm", ".xlam", ".xlsm", ".xltm",
+}
+
+// bidiOverrides are the Unicode bidirectional embedding, override and isolate characters.
+const bidiOverrides = "\u202a\u202b\u202d\u202e\u2066\u2067\u2068"
+
+// executableTypes are the media types detectContentType sniffs for executable binaries.
+var executableTypes = map[string]bool{
+	ctAppExecutable:             true,
+	"application/x-executable":  true,
+	"application/x-mach-binary": true,
+}
+
+// ctTextScript is the media type detectContentType sniffs for content starting with "#!".  Shell
+// scripts and source files are routinely mailed, so it only warns by default.
+const ctTextScript = "text/x-script"
+
+// AttachmentPolicy classifies attachments by their filename extensions and their declared and
+// detected content types.  The zero value allows everything; NewAttachmentPolicy returns a policy
+// with the defaults described for each field.
+type AttachmentPolicy struct {
+	// Extensions maps lowercase filename extensions, including the dot, to verdicts.  Blocks
+	// executable extensions, and warns of macro-enabled Office formats, by default.
+	Extensions map[string]Verdict
+	// Types maps lowercase media types, without parameters, to verdicts.  They are matched
+	// against both the declared and detected types.  Blocks executable binaries, and warns of
+	// "#!" scripts, by default.
+	Types map[string]Verdict
+	// DoubleExtension applies to filenames hiding an extension with a verdict behind another,
+	// such as "invoice.pdf.exe", or padding it with trailing dots or spaces.  Block by default.
+	DoubleExtension Verdict
+	// Disguised applies to executable binaries whose filename extension is not executable, such
+	// as a Windows executable named "invoice.pdf", or which have no filename.  Block by default.
+	Disguised Verdict
+	// MacroEnabled applies to macro-enabled Office content types.  Warn by default.
+	MacroEnabled Verdict
+	// BidiOverride applies to filenames containing Unicode bidirectional overrides, which can
+	// make "invoice<U+202E>gpj.exe" display as "invoiceexe.jpg".  Block by default.
+	BidiOverride Verdict
+	// Encrypted applies to attachments DetectEncryption finds to be encrypted, which content
+	// scanners can not inspect.  Warn by default.  DetectEncryption is only run if this is not
+	// VerdictAllow.
+	Encrypted Verdict
+}
+
+// PolicyResult is the verdict of an AttachmentPolicy on an attachment.
+type PolicyResult struct {
+	Attachment AttachmentInfo
+	Verdict    Verdict  // The most severe verdict of any rule
+	Reasons    []string // Description of each rule with a verdict other than VerdictAllow
+}
+
+// NewAttachmentPolicy returns an AttachmentPolicy with the default rules.
+func NewAttachmentPolicy() *AttachmentPolicy {
+	pol := &AttachmentPolicy{
+		Extensions:      make(map[string]Verdict),
+		Types:           make(map[string]Verdict),
+		DoubleExtension: VerdictBlock,
+		Disguised:       VerdictBlock,
+		MacroEnabled:    VerdictWarn,
+		BidiOverride:    VerdictBlock,
+		Encrypted:       VerdictWarn,
+	}
+	for _, ext := range executableExtensions {
+		pol.Extensions[ext] = VerdictBlock
+	}
+	for _, ext := range macroExtensions {
+		pol.Extensions[ext] = VerdictWarn
+	}
+	for t := range executableTypes {
+		pol.Types[t] = VerdictBlock
+	}
+	pol.Types[ctTextScript] = VerdictWarn
+	return pol
+}
+
+// CheckAll checks each of the Attachments of the Part tree rooted at root.
+func (pol *AttachmentPolicy) CheckAll(root *Part) []PolicyResult {
+	var results []PolicyResult
+	for _, a := range Attachments(root) {
+		results = append(results, pol.Check(a))
+	}
+	return results
+}
+
+// Check applies the policy to an attachment.
+func (pol *AttachmentPolicy) Check(a AttachmentInfo) PolicyResult {
+	res := PolicyResult{Attachment: a}
+	apply := func(v Verdict, reason string) {
+		if v == VerdictAllow {
+			return
+		}
+		if v > res.Verdict {
+			res.Verdict = v
+		}
+		res.Reasons = append(res.Reasons, reason)
+	}
+
+	name := strings.ToLower(a.Filename)
+	if strings.ContainsAny(name, bidiOverrides) {
+		apply(pol.BidiOverride, "filename contains a bidirectional override")
+	}
+	trimmed := strings.TrimRight(name, ". ")
+	ext := filepath.Ext(trimmed)
+	if v, ok := pol.Extensions[ext]; ok {
+		apply(v, "extension "+ext)
+		if trimmed != name {
+			apply(pol.DoubleExtension, "extension "+ext+" padded with dots or spaces")
+		} else if inner := filepath.Ext(strings.TrimSuffix(trimmed, ext)); v != VerdictAllow &&
+			isPlausibleExtension(inner) {
+			apply(pol.DoubleExtension, "extension "+ext+" hidden behind "+inner)
+		}
+	}
+
+	declared := strings.ToLower(a.ContentType)
+	detected := strings.ToLower(a.DetectedType)
+	if i := strings.IndexByte(detected, ';'); i != -1 {
+		detected = strings.TrimSpace(detected[:i])
+	}
+	for i, t := range []string{declared, detected} {
+		if i == 1 && t == declared {
+			break
+		}
+		if v, ok := pol.Types[t]; ok && t != "" {
+			apply(v, "content type "+t)
+		}
+		if strings.Contains(t, "macroenabled") {
+			apply(pol.MacroEnabled, "macro-enabled content type "+t)
+		}
+	}
+	if executableTypes[detected] && !isExecutableExtension(ext) {
+		if a.Filename == "" {
+			apply(pol.Disguised, "executable content without a filename")
+		} else {
+			apply(pol.Disguised, "executable content named "+a.Filename)
+		}
+	}
+
+	if pol.Encrypted != VerdictAllow && a.Part != nil {
+		if format, encrypted, err := a.Part.DetectEncryption(); err == nil && encrypted {
+			apply(pol.Encrypted, "encrypted "+string(format))
+		}
+	}
+	return res
+}
+
+// isExecutableExtension returns true for the extensions in executableExtensions.
+func isExecutableExtension(ext string) bool {
+	for _, e := range executableExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// isPlausibleExtension returns true if ext, including the dot, looks like a filename extension
+// rather than part of a name such as "v1.2".
+func isPlausibleExtension(ext string) bool {
+	if len(ext) < 3 || len(ext) > 5 {
+		return false
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return strings.IndexAny(ext[1:], "abcdefghijklmnopqrstuvwxyz") != -1
+}
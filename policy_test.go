@@ -0,0 +1,83 @@
+package mime
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// peExecutable returns the start of a minimal Windows executable.
+func peExecutable() []byte {
+	b := make([]byte, 0x100)
+	copy(b, "MZ")
+	b[0x3c] = 0x80
+	copy(b[0x80:], "PE\x00\x00")
+	return b
+}
+
+func TestAttachmentPolicy(t *testing.T) {
+	ttable := []struct {
+		filename, ctype, content string
+		want                     Verdict
+		wantReasons              int
+	}{
+		{"report.pdf", "application/pdf", "%PDF-1.4\n", VerdictAllow, 0},
+		{"setup.exe", ctAppOctetStream, string(peExecutable()), VerdictBlock, 2},
+		{"invoice.pdf.exe", ctAppOctetStream, "x", VerdictBlock, 2},
+		{"invoice.exe. . ", ctAppOctetStream, "x", VerdictBlock, 2},
+		{"invoice.pdf", "application/pdf", string(peExecutable()), VerdictBlock, 2},
+		{"photo\u202egpj.exe", "image/jpeg", "x", VerdictBlock, 2},
+		{"budget.xlsm", "application/vnd.ms-excel.sheet.macroEnabled.12", "PK", VerdictWarn, 2},
+		{"release.v1.tar", "application/x-tar", "x", VerdictAllow, 0},
+		{"run.sh", "text/plain", "#!/bin/sh\n", VerdictWarn, 1},
+		{"notes.txt", "text/plain", "#!/usr/bin/env python\n", VerdictWarn, 1},
+		{"secret.zip", "application/zip", string(zipArchive(t, 10, true)), VerdictWarn, 1},
+	}
+	pol := NewAttachmentPolicy()
+	for _, tt := range ttable {
+		raw := "Content-Type: " + tt.ctype + "\r\n" +
+			"Content-Disposition: attachment; filename=\"" + tt.filename + "\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n\r\n" +
+			base64.StdEncoding.EncodeToString([]byte(tt.content))
+		p, err := ReadParts(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := pol.CheckAll(p)
+		if len(results) != 1 {
+			t.Fatalf("%q: got %d results, want 1", tt.filename, len(results))
+		}
+		res := results[0]
+		if res.Verdict != tt.want || len(res.Reasons) != tt.wantReasons {
+			t.Errorf("%q: got %v %q, want %v with %d reasons", tt.filename, res.Verdict,
+				res.Reasons, tt.want, tt.wantReasons)
+		}
+	}
+
+	// Unnamed executables are disguised too
+	res := pol.Check(AttachmentInfo{ContentType: ctAppOctetStream, DetectedType: ctAppExecutable})
+	if res.Verdict != VerdictBlock || len(res.Reasons) != 2 ||
+		res.Reasons[1] != "executable content without a filename" {
+		t.Errorf("unnamed executable got %v %q, want block", res.Verdict, res.Reasons)
+	}
+
+	// The zero value allows everything
+	var zero AttachmentPolicy
+	res = zero.Check(AttachmentInfo{Filename: "setup.exe", DetectedType: ctAppExecutable})
+	if res.Verdict != VerdictAllow || res.Reasons != nil {
+		t.Errorf("zero policy got %v %q, want allow", res.Verdict, res.Reasons)
+	}
+}
+
+func TestVerdictString(t *testing.T) {
+	for v, want := range map[Verdict]string{
+		VerdictAllow: "allow",
+		VerdictWarn:  "warn",
+		VerdictBlock: "block",
+		Verdict(9):   "unknown",
+	} {
+		if got := v.String(); got != want {
+			t.Errorf("Verdict(%d).String() == %q, want %q", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package mime
+
+import (
+	"strings"
+)
+
+// Provenance is a set of flags recording how the ContentType, Charset and Filename fields of a
+// Part were derived, where they did not come verbatim from its headers.
+type Provenance uint16
+
+const (
+	// ContentTypeDefault indicates there was no Content-Type header; see ContentTypeDefaulted
+	ContentTypeDefault Provenance = 1 << iota
+	// ContentTypeRepaired indicates the Content-Type header was malformed and was repaired
+	ContentTypeRepaired
+	// CharsetDefault indicates Charset is the default for a Part without a Content-Type header
+	CharsetDefault
+	// CharsetRepaired indicates a malformed charset parameter was repaired when parsed or by Decode
+	CharsetRepaired
+	// CharsetRFC2231 indicates Charset was decoded from RFC 2231 parameter value continuations
+	CharsetRFC2231
+	// FilenameFromContentType indicates Filename came from the Content-Type name or file
+	// parameter, rather than the Content-Disposition filename parameter
+	FilenameFromContentType
+	// FilenameRFC2231 indicates Filename was decoded from RFC 2231 parameter value continuations
+	// or an extended parameter value
+	FilenameRFC2231
+	// FilenameRFC2047 indicates Filename was decoded from RFC 2047 encoded-words, which mail
+	// clients commonly misuse in parameter values
+	FilenameRFC2047
+)
+
+// Has returns true if all of the flags in f are set.
+func (pv Provenance) Has(f Provenance) bool {
+	return pv&f == f
+}
+
+// hasExtendedParam returns true if the media type value v has an RFC 2231 extended or continued
+// parameter named param, e.g. filename* or filename*0.
+func hasExtendedParam(v, param string) bool {
+	_, list := splitMediaParams(v)
+	for _, mp := range list {
+		name := strings.ToLower(mp.Name)
+		if strings.HasPrefix(name, param+"*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package mime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	ttable := []struct {
+		desc   string
+		header string
+		want   Provenance
+	}{
+		{"verbatim", "Content-Type: text/plain; charset=utf-8\r\n" +
+			"Content-Disposition: attachment; filename=a.txt\r\n", 0},
+		{"defaulted", "X-Empty: 1\r\n", ContentTypeDefault | CharsetDefault},
+		{"repaired", "Content-Type: text/plain charset=utf-8 name=a.txt\r\n",
+			ContentTypeRepaired | FilenameFromContentType},
+		{"name param", "Content-Type: application/pdf; name=a.pdf\r\n", FilenameFromContentType},
+		{"file param", "Content-Type: application/pdf; file=a.pdf\r\n", FilenameFromContentType},
+		{"rfc2231 filename", "Content-Type: application/pdf\r\n" +
+			"Content-Disposition: attachment; filename*=utf-8''caf%C3%A9.pdf\r\n", FilenameRFC2231},
+		{"rfc2231 continuation", "Content-Type: application/pdf\r\n" +
+			"Content-Disposition: attachment; filename*0=\"a\"; filename*1=\".pdf\"\r\n",
+			FilenameRFC2231},
+		{"rfc2231 charset", "Content-Type: text/plain; charset*=us-ascii''utf-8\r\n", CharsetRFC2231},
+		{"rfc2047 filename", "Content-Type: application/pdf\r\n" +
+			"Content-Disposition: attachment; filename=\"=?utf-8?q?caf=C3=A9.pdf?=\"\r\n",
+			FilenameRFC2047},
+	}
+	for _, tt := range ttable {
+		p, err := ReadParts(strings.NewReader(tt.header + "\r\nbody"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.desc, err)
+		}
+		if p.Provenance != tt.want {
+			t.Errorf("%s: Provenance == %b, want %b", tt.desc, p.Provenance, tt.want)
+		}
+		if !p.Provenance.Has(tt.want) {
+			t.Errorf("%s: Has(%b) == false", tt.desc, tt.want)
+		}
+	}
+}
+
+func TestProvenanceCharsetRepaired(t *testing.T) {
+	p, err := ReadParts(strings.NewReader(
+		"Content-Type: text/plain; charset=\"charset=utf-8\"\r\n\r\nbody"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Provenance.Has(CharsetRepaired) {
+		t.Errorf("Provenance == %b, want CharsetRepaired", p.Provenance)
+	}
+}
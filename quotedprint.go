@@ -2,24 +2,34 @@ package mime
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 )
 
 // qpCleaner scans quoted printable content for invalid characters and encodes them so that
 // Go's quoted-printable decoder does not abort with an error.
 type qpCleaner struct {
-	in *bufio.Reader
+	in       *bufio.Reader
+	part     *Part // Receives warnings, if set
+	lfWarned bool
 }
 
+// maxSoftBreakPadding is the amount of whitespace tolerated between an = and the end of its line.
+const maxSoftBreakPadding = 76
+
 // Assert qpCleaner implements io.Reader
 var _ io.Reader = &qpCleaner{}
 
-// newBase64Cleaner returns a Base64Cleaner object for the specified reader.  Base64Cleaner
-// implements the io.Reader interface.
+// newQPCleaner returns a qpCleaner for the specified reader.  qpCleaner implements the io.Reader
+// interface.
 func newQPCleaner(r io.Reader) *qpCleaner {
+	return newQPCleanerSize(r, 0)
+}
+
+// newQPCleanerSize returns a qpCleaner buffering enough of r for sizeHint bytes of content, see
+// bufSize.
+func newQPCleanerSize(r io.Reader, sizeHint int) *qpCleaner {
 	return &qpCleaner{
-		in: bufio.NewReader(r),
+		in: bufio.NewReaderSize(r, bufSize(sizeHint)),
 	}
 }
 
@@ -29,6 +39,23 @@ func (qp *qpCleaner) Read(dest []byte) (n int, err error) {
 	destLen := len(dest) - 3
 	// Loop over bytes in qp.in ByteReader
 	for n < destLen {
+		// Copy runs of acceptable characters directly from the buffer
+		if buffered := qp.in.Buffered(); buffered > 0 {
+			if buffered > destLen-n {
+				buffered = destLen - n
+			}
+			chunk, _ := qp.in.Peek(buffered)
+			run := 0
+			for run < len(chunk) && isQPPlain(chunk[run]) {
+				run++
+			}
+			if run > 0 {
+				n += copy(dest[n:], chunk[:run])
+				qp.in.Discard(run)
+				continue
+			}
+		}
+
 		b, err := qp.in.ReadByte()
 		if err != nil {
 			return n, err
@@ -36,6 +63,18 @@ func (qp *qpCleaner) Read(dest []byte) (n int, err error) {
 		// Test character type
 		switch {
 		case b == '=':
+			if padding, lf := qp.softBreak(); lf || padding > 0 {
+				// Normalize soft line breaks to =CRLF, dropping any trailing whitespace
+				qp.in.Discard(padding)
+				dest[n] = b
+				n++
+				if lf {
+					qp.in.Discard(1)
+					n += copy(dest[n:], "\r\n")
+					qp.warnBareLF()
+				}
+				continue
+			}
 			// pass valid hex bytes through
 			hexBytes, err := qp.in.Peek(2)
 			if err != nil && err != io.EOF {
@@ -45,26 +84,76 @@ func (qp *qpCleaner) Read(dest []byte) (n int, err error) {
 				dest[n] = b
 				n++
 			} else {
-				s := fmt.Sprintf("=%02X", b)
-				n += copy(dest[n:], s)
+				n += qpEscape(dest[n:], b)
 			}
-		case b == '\t' || b == '\r' || b == '\n':
-			// Valid special characters
-			dest[n] = b
-			n++
-		case b < ' ' || '~' < b:
-			// Invalid character, render quoted-printable into buffer
-			s := fmt.Sprintf("=%02X", b)
-			n += copy(dest[n:], s)
-		default:
+		case isQPPlain(b):
 			// Acceptable character
 			dest[n] = b
 			n++
+		default:
+			// Invalid character, render quoted-printable into buffer
+			n += qpEscape(dest[n:], b)
 		}
 	}
 	return
 }
 
+// isQPPlain returns true for bytes that may appear unencoded in quoted-printable content.
+func isQPPlain(b byte) bool {
+	return b == '\t' || b == '\r' || b == '\n' || (' ' <= b && b <= '~' && b != '=')
+}
+
+const upperHex = "0123456789ABCDEF"
+
+// qpEscape writes b to dest as an =XX escape, returning the 3 bytes written.
+func qpEscape(dest []byte, b byte) int {
+	dest[0] = '='
+	dest[1] = upperHex[b>>4]
+	dest[2] = upperHex[b&0x0f]
+	return 3
+}
+
+// softBreak reports whether the = just read ends its line, returning the number of spaces and tabs
+// following it and whether the line ends in a bare LF rather than CRLF.  padding is 0 if the = is
+// not a soft line break.
+func (qp *qpCleaner) softBreak() (padding int, lf bool) {
+	for padding <= maxSoftBreakPadding {
+		b, err := qp.in.Peek(padding + 1)
+		if len(b) <= padding {
+			if err == io.EOF && padding > 0 {
+				// Trailing whitespace at end of content
+				return padding, false
+			}
+			return 0, false
+		}
+		switch b[padding] {
+		case ' ', '\t':
+			padding++
+		case '\n':
+			return padding, true
+		case '\r':
+			if next, _ := qp.in.Peek(padding + 2); len(next) == padding+2 && next[padding+1] == '\n' {
+				return padding, false
+			}
+			return 0, false
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// warnBareLF records a warning on the Part the first time a soft line break ends in a bare LF, see
+// addDecodeWarning.
+func (qp *qpCleaner) warnBareLF() {
+	if qp.part == nil || qp.lfWarned {
+		return
+	}
+	qp.lfWarned = true
+	qp.part.addDecodeWarning(ErrorMalformedQuotedPrintable,
+		"soft line break ended with LF rather than CRLF")
+}
+
 func isValidHexByte(b byte) bool {
 	switch {
 	case b >= '0' && b <= '9':
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
@@ -22,6 +23,11 @@ func TestQPCleaner(t *testing.T) {
 		{"Stuffs’s", "Stuffs=E2=80=99s"},
 		{"=", "=3D"},
 		{"=a", "=3Da"},
+		{"soft=\nbreak", "soft=\r\nbreak"},
+		{"soft=\r\nbreak", "soft=\r\nbreak"},
+		{"padded= \t\r\nbreak", "padded=\r\nbreak"},
+		{"padded=  \nbreak", "padded=\r\nbreak"},
+		{"= \rx", "=3D \rx"},
 	}
 
 	for _, tc := range ttable {
@@ -66,6 +72,37 @@ func TestQPCleanerOverflow(t *testing.T) {
 	}
 }
 
+func TestQPCleanerBareLFWarning(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\nContent-Type: text/plain\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"caf=C3=A9 =\nau lait=\nfini=3D\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	// Decoding again does not repeat the warning
+	for i := 0; i < 2; i++ {
+		d, err := p.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "café au laitfini=\n"; string(got) != want {
+			t.Errorf("Got: %q, want: %q", got, want)
+		}
+	}
+	if len(p.Errors) != 1 {
+		t.Fatalf("Got %d errors, want 1: %v", len(p.Errors), p.Errors)
+	}
+	if e := p.Errors[0].(*Error); e.Name != ErrorMalformedQuotedPrintable.Error() || e.Severe {
+		t.Errorf("Got error %v, want warning %q", e, ErrorMalformedQuotedPrintable)
+	}
+}
+
 var ErrPeek = errors.New("enmime test peek error")
 
 type peekBreakReader string
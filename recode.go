@@ -0,0 +1,73 @@
+package mime
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Recode changes the Content-Transfer-Encoding of a leaf Part to newEncoding, one of 7bit, 8bit,
+// binary, quoted-printable or base64, decoding its content and storing it encoded anew, e.g. to
+// pass 8bit content through a relay without 8BITMIME as quoted-printable.  The header, Encoding,
+// Size and Lines are updated, and Encode writes the new encoding.  Content that 7bit or 8bit
+// cannot represent, such as NULs or overlong lines, is an error wrapping ErrorContentEncoding.
+func Recode(p *Part, newEncoding string) error {
+	if p.boundary != "" || len(p.Subparts) > 0 {
+		return fmt.Errorf("%s: cannot recode %s content", p.Descriptor, p.ContentType)
+	}
+	encoding := strings.ToLower(newEncoding)
+	switch encoding {
+	case "7bit", "8bit", "binary", "quoted-printable", "base64":
+	default:
+		return fmt.Errorf("%s: %w: unrecognized Content-Transfer-Encoding type %q",
+			p.Descriptor, ErrorContentEncoding, newEncoding)
+	}
+
+	r, err := p.DecodeRaw()
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.Descriptor, err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.Descriptor, err)
+	}
+	if !representable(encoding, content) {
+		return fmt.Errorf("%s: %w: content cannot be represented as %s",
+			p.Descriptor, ErrorContentEncoding, encoding)
+	}
+	return p.reencode(encoding, content)
+}
+
+// reencode stores content as the body of a leaf Part, transfer encoded with encoding, and sets the
+// Content-Transfer-Encoding header to match.
+func (p *Part) reencode(encoding string, content []byte) error {
+	encoded, err := encodeContent(encoding, content)
+	if err != nil {
+		return err
+	}
+	p.Header.Set(hnContentEncoding, encoding)
+	p.Encoding = encoding
+	p.setEncoded(encoded)
+	return nil
+}
+
+// representable returns true if content may be sent unencoded as the 7bit or 8bit
+// Content-Transfer-Encoding: without NULs, with lines of at most maxLineLen bytes, and for 7bit
+// only US-ASCII.  Content is always representable by the other encodings.
+func representable(encoding string, content []byte) bool {
+	if encoding != "7bit" && encoding != "8bit" {
+		return true
+	}
+	for _, line := range bytes.Split(content, []byte{'\n'}) {
+		if len(bytes.TrimSuffix(line, []byte{'\r'})) > maxLineLen {
+			return false
+		}
+		for _, c := range line {
+			if c == 0 || (c >= 0x80 && encoding == "7bit") {
+				return false
+			}
+		}
+	}
+	return true
+}
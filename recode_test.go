@@ -0,0 +1,78 @@
+package mime
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRecode(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n" +
+		"café au lait\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"cGxhaW4gdGV4dA==\r\n" +
+		"--b--\r\n"
+	ttable := []struct {
+		index            int
+		encoding         string
+		want, wantHeader string
+		wantErr          error
+	}{
+		{0, "Quoted-Printable", "café au lait", "quoted-printable", nil},
+		{0, "base64", "café au lait", "base64", nil},
+		{0, "7bit", "", "", ErrorContentEncoding},
+		{0, "x-uuencode", "", "", ErrorContentEncoding},
+		{1, "7bit", "plain text", "7bit", nil},
+	}
+	for _, tt := range ttable {
+		root, err := ReadParts(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := root.Subparts[tt.index]
+		err = Recode(p, tt.encoding)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Recode(%v, %q) error %v, want %v", p, tt.encoding, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Recode(%v, %q): %v", p, tt.encoding, err)
+		}
+		if p.Size != len(p.encoded) || p.Lines != bytes.Count(p.encoded, []byte{'\n'}) {
+			t.Errorf("%q: Size %d, Lines %d for encoded %q", tt.encoding, p.Size, p.Lines, p.encoded)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := root.Encode(buf); err != nil {
+			t.Fatal(err)
+		}
+		q, err := ReadParts(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := q.Subparts[tt.index]
+		if got := s.Header.Get(hnContentEncoding); got != tt.wantHeader {
+			t.Errorf("%q: Content-Transfer-Encoding %q, want %q", tt.encoding, got, tt.wantHeader)
+		}
+		r, err := s.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ioutil.ReadAll(r); string(got) != tt.want {
+			t.Errorf("%q: decoded %q, want %q", tt.encoding, got, tt.want)
+		}
+	}
+
+	root, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Recode(root, "base64"); err == nil {
+		t.Errorf("Recode(%v) succeeded", root)
+	}
+}
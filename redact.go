@@ -0,0 +1,153 @@
+package mime
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+)
+
+// structuralFields are the header fields the structure of a message depends upon, which header
+// redaction never removes.
+var structuralFields = map[string]bool{
+	textproto.CanonicalMIMEHeaderKey(hnContentType):     true,
+	textproto.CanonicalMIMEHeaderKey(hnContentEncoding): true,
+	textproto.CanonicalMIMEHeaderKey(hnMIMEVersion):     true,
+}
+
+// RemoveHeaders deletes the header fields named by names from every Part of the tree rooted at
+// root, including the headers of embedded messages, for scrubbing private data before passing a
+// message on with Encode.  Content-Type, Content-Transfer-Encoding and MIME-Version are never
+// removed, as re-serializing the message depends upon them.  Only Header is modified; fields
+// such as Filename and ContentID derived from it when parsing, and the raw header bytes of
+// HeaderAt and RawReader, are unchanged.
+//
+// A message/rfc822 Part that is base64 or quoted-printable encoded holds its embedded message
+// only in encoded form, or just its header WithDecodedMessageHeaders.  The whole embedded message
+// is decoded and parsed to be scrubbed, then encoded again as the Part's content; the Part then
+// encloses a Part holding the message's Header if it was read WithDecodedMessageHeaders, and none
+// otherwise.  An embedded message that cannot be decoded or parsed is left as it was, and the
+// error returned names the first such Part once the rest of the tree has been scrubbed.
+func RemoveHeaders(root *Part, names ...string) error {
+	remove := make(map[string]bool, len(names))
+	for _, name := range names {
+		remove[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	return redactHeaders(root, func(key string) bool {
+		return remove[key]
+	})
+}
+
+// KeepOnlyHeaders deletes every header field not named by names from every Part of the tree rooted
+// at root, except for Content-Type, Content-Transfer-Encoding and MIME-Version, see RemoveHeaders.
+func KeepOnlyHeaders(root *Part, names ...string) error {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	return redactHeaders(root, func(key string) bool {
+		return !keep[key]
+	})
+}
+
+// redactHeaders deletes the header fields for which remove returns true from every Part of the
+// tree rooted at root, sparing structuralFields.  Header keys are compared in canonical form.
+func redactHeaders(root *Part, remove func(key string) bool) error {
+	return redactParts(root, func(p *Part) {
+		for k := range p.Header {
+			key := textproto.CanonicalMIMEHeaderKey(k)
+			if !structuralFields[key] && remove(key) {
+				delete(p.Header, k)
+			}
+		}
+	})
+}
+
+// redactParts calls redact with every Part of the tree rooted at root, and with every Part of the
+// messages embedded in it transfer encoded, which are encoded again afterwards; see RemoveHeaders.
+func redactParts(root *Part, redact func(p *Part)) error {
+	var first error
+	root.Walk(func(p *Part) error {
+		redact(p)
+		if p.ContentType != ContentTypeMessageRfc822 ||
+			!isBinaryToTextEncoding(p.Header.Get(hnContentEncoding)) {
+			return nil
+		}
+		if err := p.redactEncodedMessage(redact); err != nil && first == nil {
+			first = fmt.Errorf("%s: embedded message not redacted: %w", p.Descriptor, err)
+		}
+		return nil
+	})
+	return first
+}
+
+// redactEncodedMessage decodes and parses the message embedded in a transfer encoded
+// message/rfc822 Part, calls redactParts on it, and replaces the Part's content with the result,
+// encoded again.
+func (p *Part) redactEncodedMessage(redact func(p *Part)) error {
+	if p.rawReader == nil && p.encoded == nil && p.bound == nil {
+		return ErrNoContent
+	}
+	encoding := p.Header.Get(hnContentEncoding)
+	m, err := p.parser().ReadParts(newTransferDecoder(p.encodedBody(), encoding))
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if err := redactParts(m, redact); err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := m.Encode(buf); err != nil {
+		return err
+	}
+	encoded, err := encodeContent(encoding, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if p.hasDecodedMessage() {
+		p.Subparts[0].Header, p.Subparts[0].fieldOrder = m.Header, m.fieldOrder
+	} else {
+		p.Subparts = nil
+	}
+	p.setEncoded(encoded)
+	p.InvalidateIndex()
+	return nil
+}
+
+// LimitTraceHeaders keeps only the topmost, most recently added, max values of each trace field in
+// every Part of the tree rooted at root, see RemoveHeaders, so that a forwarding service may hide
+// the hops a message took before reaching it.  The trace fields are those SplitDeliveryHeaders
+// separates, Received, Return-Path, Delivered-To and the like, and the fields naming the sender's
+// IP address that SenderIPs reads, such as X-Originating-IP.  Kept values remain in their original
+// order, and a max of zero removes the fields entirely.
+func LimitTraceHeaders(root *Part, max int) error {
+	if max < 0 {
+		max = 0
+	}
+	return redactParts(root, func(p *Part) {
+		for k, vs := range p.Header {
+			if !isTraceField(textproto.CanonicalMIMEHeaderKey(k)) || len(vs) <= max {
+				continue
+			}
+			if max == 0 {
+				delete(p.Header, k)
+			} else {
+				p.Header[k] = vs[:max:max]
+			}
+		}
+	})
+}
+
+// isTraceField returns true if key, in canonical form, names a trace field for LimitTraceHeaders.
+func isTraceField(key string) bool {
+	if deliveryFields[key] {
+		return true
+	}
+	for _, k := range senderIPFields {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
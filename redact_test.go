@@ -0,0 +1,210 @@
+package mime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// redactionMessage returns a message with a plain and a base64 encoded message/rfc822 attachment.
+func redactionMessage() string {
+	inner := "From: inner@example.com\r\nSubject: inner\r\nX-Originating-IP: [192.0.2.1]\r\n" +
+		"Content-Type: text/plain\r\n\r\ninner body\r\n"
+	return "From: outer@example.com\r\nSubject: outer\r\nReceived: from secret.example.com\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nX-Originating-IP: [192.0.2.2]\r\n\r\nbody\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" + inner +
+		"--b\r\nContent-Type: message/rfc822\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(inner)) + "\r\n" +
+		"--b--\r\n"
+}
+
+// encodeAndReparse returns the encoding of the tree rooted at root, and its Part tree when parsed
+// again.
+func encodeAndReparse(t *testing.T, root *Part) (string, *Part) {
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadParts(bytes.NewReader(buf.Bytes()), WithDecodedMessageHeaders())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), p
+}
+
+func TestRemoveHeaders(t *testing.T) {
+	root, err := ReadParts(strings.NewReader(redactionMessage()), WithDecodedMessageHeaders())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveHeaders(root, "from", "X-Originating-Ip", "RECEIVED", "Content-Type"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, p := encodeAndReparse(t, root)
+	for _, secret := range []string{"example.com", "192.0.2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("encoded message contains %q:\n%s", secret, out)
+		}
+	}
+	if len(p.Subparts) != 3 || p.Subparts[0].ContentType != ctTextPlain ||
+		p.Subparts[1].Message() == nil || p.Subparts[2].Message() == nil {
+		t.Fatalf("got Subparts %v", p.Subparts)
+	}
+	for _, s := range p.Subparts[1:] {
+		if subject := s.MessageSubject(); subject != "inner" {
+			t.Errorf("%v: MessageSubject() == %q, want %q", s, subject, "inner")
+		}
+	}
+	r, err := p.Subparts[2].DecodeRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, _ := ioutil.ReadAll(r)
+	if !bytes.HasSuffix(inner, []byte("\r\n\r\ninner body\r\n")) {
+		t.Errorf("decoded embedded message %q", inner)
+	}
+}
+
+func TestRemoveHeadersEncodedMessage(t *testing.T) {
+	inner := "From: inner@example.com\r\nSubject: inner\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=i\r\n\r\n" +
+		"--i\r\nContent-Type: text/plain\r\nX-Originating-IP: [192.0.2.1]\r\n\r\ninner body\r\n" +
+		"--i--\r\n"
+	raw := "From: outer@example.com\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nbody\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(inner)) + "\r\n" +
+		"--b--\r\n"
+
+	for _, opts := range [][]Option{nil, {WithDecodedMessageHeaders()}} {
+		root, err := ReadParts(strings.NewReader(raw), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := RemoveHeaders(root, "from", "X-Originating-Ip"); err != nil {
+			t.Fatal(err)
+		}
+		if m := root.Subparts[1].Message(); len(opts) > 0 && (m == nil ||
+			m.Header.Get("Subject") != "inner" || m.Header.Get("From") != "") {
+			t.Errorf("%d options: enclosed Part %v", len(opts), m)
+		}
+
+		_, p := encodeAndReparse(t, root)
+		r, err := p.Subparts[1].DecodeRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, _ := ioutil.ReadAll(r)
+		for _, secret := range []string{"example.com", "192.0.2"} {
+			if bytes.Contains(decoded, []byte(secret)) {
+				t.Errorf("%d options: embedded message contains %q:\n%s", len(opts), secret, decoded)
+			}
+		}
+		m, err := ReadParts(bytes.NewReader(decoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Header.Get("Subject") != "inner" || len(m.Subparts) != 1 {
+			t.Fatalf("%d options: embedded message reparsed as %v %v", len(opts), m.Header,
+				m.Subparts)
+		}
+		if b, _ := ioutil.ReadAll(m.Subparts[0]); string(b) != "inner body" {
+			t.Errorf("%d options: embedded message body %q", len(opts), b)
+		}
+	}
+
+	// Without content the embedded message cannot be scrubbed
+	root, err := ReadStructure(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveHeaders(root, "from"); !errors.Is(err, ErrNoContent) {
+		t.Errorf("RemoveHeaders() of a structure error %v, want %v", err, ErrNoContent)
+	}
+	if root.Header.Get("From") != "" {
+		t.Errorf("RemoveHeaders() of a structure kept From")
+	}
+}
+
+func TestKeepOnlyHeaders(t *testing.T) {
+	root, err := ReadParts(strings.NewReader(redactionMessage()), WithDecodedMessageHeaders())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := KeepOnlyHeaders(root, "subject"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, p := encodeAndReparse(t, root)
+	p.Walk(func(s *Part) error {
+		for k := range s.Header {
+			switch k {
+			case "Subject", "Content-Type", "Content-Transfer-Encoding", "Mime-Version":
+			default:
+				t.Errorf("%v: kept %s", s, k)
+			}
+		}
+		return nil
+	})
+	if got := p.Header.Get("Subject"); got != "outer" {
+		t.Errorf("Subject == %q, want %q", got, "outer")
+	}
+}
+
+func TestLimitTraceHeaders(t *testing.T) {
+	raw := "Received: from mx.example.org\r\nReceived: from relay.example.net\r\n" +
+		"Received: from secret.example.com\r\nReturn-Path: <a@example.com>\r\n" +
+		"X-Originating-IP: [192.0.2.1]\r\nSubject: hi\r\n\r\nbody\r\n"
+	ttable := []struct {
+		max      int
+		received []string
+		kept     bool
+	}{
+		{2, []string{"from mx.example.org", "from relay.example.net"}, true},
+		{5, []string{"from mx.example.org", "from relay.example.net", "from secret.example.com"},
+			true},
+		{0, nil, false},
+	}
+	for _, tt := range ttable {
+		root, err := ReadParts(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := LimitTraceHeaders(root, tt.max); err != nil {
+			t.Fatal(err)
+		}
+
+		_, p := encodeAndReparse(t, root)
+		if got := p.Header["Received"]; strings.Join(got, "\n") != strings.Join(tt.received, "\n") {
+			t.Errorf("LimitTraceHeaders(%d) kept Received %q, want %q", tt.max, got, tt.received)
+		}
+		for _, k := range []string{"Return-Path", "X-Originating-Ip"} {
+			if _, ok := p.Header[k]; ok != tt.kept {
+				t.Errorf("LimitTraceHeaders(%d) kept %s: %v, want %v", tt.max, k, ok, tt.kept)
+			}
+		}
+		if got := p.Header.Get("Subject"); got != "hi" {
+			t.Errorf("LimitTraceHeaders(%d) left Subject %q", tt.max, got)
+		}
+	}
+
+	root, err := ReadParts(strings.NewReader(redactionMessage()), WithDecodedMessageHeaders())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LimitTraceHeaders(root, 0); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := encodeAndReparse(t, root)
+	for _, secret := range []string{"secret.example.com", "192.0.2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("encoded message contains %q:\n%s", secret, out)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package mime
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// DecodeRFC2047 decodes the RFC 2047 encoded-words in s, such as a Subject header or a filename
+// received over another protocol, converting them to UTF-8 with the same charset support as
+// header decoding.  White space between adjacent encoded-words is removed, and the content of
+// adjacent words in the same charset is joined before conversion, so characters split between
+// them survive.  Each word that cannot be decoded is left as it was, and described by a warning,
+// an *Error as found in Part.Errors.
+func DecodeRFC2047(s string) (string, []error) {
+	if !strings.Contains(s, "=?") {
+		// Don't scan if there is nothing to do here
+		return s, nil
+	}
+
+	var errs []error
+	out := &strings.Builder{}
+	out.Grow(len(s))
+	// run holds the decoded content of adjacent encoded-words in one charset, and input[raw:rawEnd]
+	// their text; word holds the content of the word being decoded
+	input := s
+	var run, word []byte
+	var runCharset string
+	raw, rawEnd := -1, -1
+	flush := func() {
+		if raw == -1 {
+			return
+		}
+		text, err := convertToUTF8String(runCharset, run)
+		if err != nil {
+			errs = append(errs, newWarning(ErrorCharsetConversion, "%q: %v", input[raw:rawEnd], err))
+			text = input[raw:rawEnd]
+		}
+		out.WriteString(text)
+		run, runCharset, raw = run[:0], "", -1
+	}
+
+	// afterWord is true following an encoded-word, when white space alone is removed
+	afterWord := false
+	for {
+		start := strings.Index(s, "=?")
+		if start == -1 {
+			break
+		}
+		charset, encoding, text, n := parseEncodedWord(s[start:])
+		if n == 0 {
+			// Not an encoded-word
+			flush()
+			out.WriteString(s[:start+2])
+			s = s[start+2:]
+			afterWord = false
+			continue
+		}
+		var err error
+		word, err = decodeWordText(word[:0], encoding, text)
+		ok := err == nil
+		offset := len(input) - len(s)
+		gap, w := s[:start], s[start:start+n]
+		s = s[start+n:]
+		if !afterWord || strings.Trim(gap, " \t\r\n") != "" {
+			flush()
+			out.WriteString(gap)
+		} else if raw != -1 && ok && strings.EqualFold(charset, runCharset) {
+			// The gap is dropped, but kept in the text of the run
+		} else {
+			flush()
+		}
+		afterWord = ok
+		if !ok {
+			errs = append(errs, newWarning(ErrorMalformedHeader, "malformed encoded-word %q", w))
+			out.WriteString(w)
+			continue
+		}
+		run = append(run, word...)
+		runCharset = charset
+		if raw == -1 {
+			raw = offset + start
+		}
+		rawEnd = offset + start + n
+	}
+	flush()
+	out.WriteString(s)
+	return out.String(), errs
+}
+
+// parseEncodedWord parses the encoded-word at the start of s, returning its charset without any
+// RFC 2231 language, its encoding and encoded-text, and its length n.  n is 0 if s does not start
+// with an encoded-word.
+func parseEncodedWord(s string) (charset string, encoding byte, text string, n int) {
+	// =?charset?encoding?encoded-text?=
+	q1 := strings.IndexByte(s[2:], '?') + 2
+	if q1 < 3 || len(s) < q1+3 || s[q1+2] != '?' {
+		return "", 0, "", 0
+	}
+	end := strings.Index(s[q1+3:], "?=")
+	if end == -1 {
+		return "", 0, "", 0
+	}
+	end += q1 + 3
+	if strings.ContainsAny(s[2:end], " \t\r\n") {
+		return "", 0, "", 0
+	}
+	charset = s[2:q1]
+	if i := strings.IndexByte(charset, '*'); i != -1 {
+		charset = charset[:i]
+	}
+	return charset, s[q1+1], s[q1+3 : end], end + 2
+}
+
+// decodeWordText appends the content of the encoded-text of an encoded-word in the B or Q
+// encoding to dst.
+func decodeWordText(dst []byte, encoding byte, text string) ([]byte, error) {
+	switch encoding {
+	case 'B', 'b':
+		text = strings.TrimRight(text, "=")
+		n := len(dst)
+		dst = append(dst, make([]byte, base64.RawStdEncoding.DecodedLen(len(text)))...)
+		m, err := base64.RawStdEncoding.Decode(dst[n:], []byte(text))
+		return dst[:n+m], err
+	case 'Q', 'q':
+		return decodeQWord(dst, text)
+	}
+	return dst, fmt.Errorf("unknown encoding %q", encoding)
+}
+
+// decodeQWord appends the content of text in the RFC 2047 Q encoding, in which "_" is a space, to
+// dst.
+func decodeQWord(dst []byte, text string) ([]byte, error) {
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '_':
+			dst = append(dst, ' ')
+		case c != '=':
+			dst = append(dst, c)
+		case i+2 < len(text) && ishex(text[i+1]) && ishex(text[i+2]):
+			dst = append(dst, unhex(text[i+1])<<4|unhex(text[i+2]))
+			i += 2
+		default:
+			return dst, fmt.Errorf("invalid escape %q", text[i:])
+		}
+	}
+	return dst, nil
+}
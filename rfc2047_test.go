@@ -0,0 +1,43 @@
+package mime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeRFC2047(t *testing.T) {
+	ttable := []struct {
+		in, want string
+		wantErrs []error
+	}{
+		{"plain text", "plain text", nil},
+		{"(=?ISO-8859-1?Q?a?= b)", "(a b)", nil},
+		{"(=?ISO-8859-1?Q?a?=\r\n  =?ISO-8859-1?Q?b?=)", "(ab)", nil},
+		{"(=?ISO-8859-1?Q?a?= =?ISO-8859-2?Q?_b?=)", "(a b)", nil},
+		{"=?iso-8859-1?q?caf=E9?=.txt", "café.txt", nil},
+		{"=?utf-8?q?caf=C3?= =?UTF-8?Q?=A9?=", "café", nil},
+		{"=?utf-8?B?w6k?= =?utf-8?b?w6k=?=", "éé", nil},
+		{"=?utf-8*en?q?hello?=", "hello", nil},
+		{"a =? b ?= c", "a =? b ?= c", nil},
+		{"=?utf-8?q?ok?= =?x-unknown?q?a?= =?x-unknown?q?b?=",
+			"ok=?x-unknown?q?a?= =?x-unknown?q?b?=", []error{ErrorCharsetConversion}},
+		{"=?utf-8?b?!!!?= =?utf-8?q?ok?=", "=?utf-8?b?!!!?= ok", []error{ErrorMalformedHeader}},
+		{"=?utf-8?x?abc?=", "=?utf-8?x?abc?=", []error{ErrorMalformedHeader}},
+		{"=?utf-8?q?a=Z?=", "=?utf-8?q?a=Z?=", []error{ErrorMalformedHeader}},
+	}
+	for _, tt := range ttable {
+		got, errs := DecodeRFC2047(tt.in)
+		if got != tt.want {
+			t.Errorf("DecodeRFC2047(%q) == %q, want %q", tt.in, got, tt.want)
+		}
+		if len(errs) != len(tt.wantErrs) {
+			t.Errorf("DecodeRFC2047(%q) errors %v, want %v", tt.in, errs, tt.wantErrs)
+			continue
+		}
+		for i, err := range errs {
+			if !errors.Is(err, tt.wantErrs[i]) {
+				t.Errorf("DecodeRFC2047(%q) error %v, want %v", tt.in, err, tt.wantErrs[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package mime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RoundTripReport describes how faithfully a message survives being parsed, written with Encode
+// and parsed again, see VerifyRoundTrip.
+type RoundTripReport struct {
+	// Identical is set when Encode reproduced the message byte for byte.  Equivalent is set when
+	// the reparsed message has the same Parts, header fields in the same order, and content,
+	// though its header fields may have been refolded.
+	Identical, Equivalent bool
+
+	OriginalSize, EncodedSize int
+
+	Parts       []RoundTripPart // Each Part of the original message, in tree order
+	Differences []RoundTripDifference
+}
+
+// RoundTripPart is a Part of the original message in a RoundTripReport.
+type RoundTripPart struct {
+	Descriptor  string
+	ContentType string
+	// ContentHash is the hex encoded SHA-256 of the content of a leaf Part with its
+	// Content-Transfer-Encoding removed, or "" for Parts with Subparts
+	ContentHash string
+	Match       bool // The reparsed Part has no Differences
+}
+
+// RoundTripDifference is a way in which a reparsed Part differs from the original Part in the
+// same position of the tree.
+type RoundTripDifference struct {
+	Descriptor string // Of the original Part, or of the reparsed Part if it has no counterpart
+	// Field is what differs: "part" for a Part present in only one message, "Descriptor",
+	// "header order" for header fields named, ordered or spelled differently, a header field
+	// name, "content", "preamble" or "epilogue"
+	Field string
+	// Original and Reencoded are the differing values, header field values and names joined by
+	// newlines and content as its ContentHash
+	Original, Reencoded string
+}
+
+// VerifyRoundTrip parses the message raw with opts, writes it with Encode, parses the result and
+// compares the two, Part by Part, so that a message may be trusted to survive being rewritten,
+// e.g. for archiving.  An error parsing, encoding, reparsing or reading the content of the
+// message is returned with the report as far as it was made.
+func VerifyRoundTrip(raw []byte, opts ...Option) (RoundTripReport, error) {
+	report := RoundTripReport{OriginalSize: len(raw)}
+	ps := NewParser(opts...)
+	orig, err := ps.ReadPartsFromReaderAt(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return report, err
+	}
+	defer orig.Close()
+	encoded := &bytes.Buffer{}
+	if err := orig.Encode(encoded); err != nil {
+		return report, fmt.Errorf("error encoding message: %w", err)
+	}
+	report.EncodedSize = encoded.Len()
+	report.Identical = bytes.Equal(encoded.Bytes(), raw)
+
+	reparsed, err := ps.ReadPartsFromReaderAt(bytes.NewReader(encoded.Bytes()),
+		int64(encoded.Len()))
+	if err != nil {
+		return report, fmt.Errorf("error reparsing message: %w", err)
+	}
+	defer reparsed.Close()
+	if err := report.compare(orig, reparsed); err != nil {
+		return report, err
+	}
+	report.Equivalent = len(report.Differences) == 0
+	return report, nil
+}
+
+// compare records the Parts of the tree rooted at orig, and their Differences from those of the
+// tree rooted at reparsed.
+func (report *RoundTripReport) compare(orig, reparsed *Part) error {
+	var as, bs []*Part
+	orig.Walk(func(p *Part) error {
+		as = append(as, p)
+		return nil
+	})
+	reparsed.Walk(func(p *Part) error {
+		bs = append(bs, p)
+		return nil
+	})
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if i >= len(as) {
+			report.addDifference(bs[i].Descriptor, "part", "", bs[i].ContentType)
+			continue
+		}
+		a := as[i]
+		hash, err := contentHash(a)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.Descriptor, err)
+		}
+		n := len(report.Differences)
+		if i >= len(bs) {
+			report.addDifference(a.Descriptor, "part", a.ContentType, "")
+		} else if err := report.comparePart(a, bs[i], hash); err != nil {
+			return err
+		}
+		report.Parts = append(report.Parts, RoundTripPart{
+			Descriptor:  a.Descriptor,
+			ContentType: a.ContentType,
+			ContentHash: hash,
+			Match:       len(report.Differences) == n,
+		})
+	}
+	return nil
+}
+
+// comparePart records the Differences of the reparsed Part b from the original Part a, whose
+// contentHash is hash.
+func (report *RoundTripReport) comparePart(a, b *Part, hash string) error {
+	d := a.Descriptor
+	if a.Descriptor != b.Descriptor {
+		report.addDifference(d, "Descriptor", a.Descriptor, b.Descriptor)
+	}
+	if ao, bo := headerOrder(a), headerOrder(b); ao != bo {
+		report.addDifference(d, "header order", ao, bo)
+	}
+
+	keys := make(map[string]bool)
+	for k := range a.Header {
+		keys[k] = true
+	}
+	for k := range b.Header {
+		keys[k] = true
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		av, bv := strings.Join(a.Header[k], "\n"), strings.Join(b.Header[k], "\n")
+		if av != bv || len(a.Header[k]) != len(b.Header[k]) {
+			report.addDifference(d, k, av, bv)
+		}
+	}
+
+	if bhash, err := contentHash(b); err != nil {
+		return fmt.Errorf("%s: %w", b.Descriptor, err)
+	} else if hash != bhash {
+		report.addDifference(d, "content", hash, bhash)
+	}
+	if !bytes.Equal(a.Preamble, b.Preamble) {
+		report.addDifference(d, "preamble", string(a.Preamble), string(b.Preamble))
+	}
+	if !bytes.Equal(a.Epilogue, b.Epilogue) {
+		report.addDifference(d, "epilogue", string(a.Epilogue), string(b.Epilogue))
+	}
+	return nil
+}
+
+// headerOrder returns the names of the Part's header fields as written, in their order, joined by
+// newlines.
+func headerOrder(p *Part) string {
+	names := make([]string, len(p.fieldOrder))
+	for i, f := range p.fieldOrder {
+		names[i] = f.Name
+	}
+	return strings.Join(names, "\n")
+}
+
+func (report *RoundTripReport) addDifference(descriptor, field, original, reencoded string) {
+	report.Differences = append(report.Differences, RoundTripDifference{
+		Descriptor: descriptor,
+		Field:      field,
+		Original:   original,
+		Reencoded:  reencoded,
+	})
+}
+
+// contentHash returns the ContentHash of a Part for a RoundTripReport.  Content in an
+// unrecognized Content-Transfer-Encoding is hashed as it is.
+func contentHash(p *Part) (string, error) {
+	if p.boundary != "" || len(p.Subparts) > 0 {
+		return "", nil
+	}
+	r, err := p.DecodeRaw()
+	var derr *DecodeError
+	if errors.As(err, &derr) {
+		r, err = p.Raw()
+	}
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
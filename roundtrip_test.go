@@ -0,0 +1,95 @@
+package mime
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRoundTrip(t *testing.T) {
+	// Header fields already in the folded form Encode writes
+	canonical := "Content-Type: multipart/mixed; boundary=b\r\nSubject: hello\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--b\r\nContent-Transfer-Encoding: base64\r\nContent-Type: application/pdf\r\n\r\n" +
+		"JVBERi0xLjQ=\r\n" +
+		"--b--\r\n"
+	report, err := VerifyRoundTrip([]byte(canonical))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Identical || !report.Equivalent || report.EncodedSize != len(canonical) {
+		t.Errorf("got Identical %v, Equivalent %v, EncodedSize %d, want true, true, %d",
+			report.Identical, report.Equivalent, report.EncodedSize, len(canonical))
+	}
+
+	reordered := "Subject: hello\r\n\tworld\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"pre\r\n--b\r\nContent-Type: multipart/alternative; boundary=c\r\n\r\n" +
+		"--c\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+		"--c\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n--c--\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"JVBERi0xLjQ=\r\n" +
+		"--b--\r\nepi\r\n"
+	report, err = VerifyRoundTrip([]byte(reordered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Identical || !report.Equivalent || len(report.Differences) != 0 {
+		t.Errorf("got Identical %v, Equivalent %v, Differences %v, want false, true, none",
+			report.Identical, report.Equivalent, report.Differences)
+	}
+	var got []string
+	for _, p := range report.Parts {
+		got = append(got, fmt.Sprintf("%s %s %.8s %v", p.Descriptor, p.ContentType,
+			p.ContentHash, p.Match))
+	}
+	want := []string{
+		"0 multipart/mixed  true",
+		"1.0 multipart/alternative  true",
+		"1.1 text/plain a116c9ed true",
+		"1.2 text/html 23ecabe4 true",
+		"2 application/pdf e16fa5d9 true",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got Parts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Differences between two messages, as if one were the other reencoded
+	orig, err := ReadParts(strings.NewReader(reordered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.Replace(strings.Replace(reordered, "\tworld", "\tthere", 1),
+		"<p>html</p>", "<p>HTML</p>", 1)
+	changed = strings.Replace(changed,
+		"Content-Type: application/pdf\r\nContent-Transfer-Encoding: base64",
+		"Content-Transfer-Encoding: base64\r\nContent-Type: application/pdf", 1)
+	changed = strings.Replace(changed, "--b--",
+		"--b\r\nContent-Type: text/plain\r\n\r\nextra\r\n--b--", 1)
+	reparsed, err := ReadParts(strings.NewReader(changed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report = RoundTripReport{}
+	if err := report.compare(orig, reparsed); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, d := range report.Differences {
+		got = append(got, fmt.Sprintf("%s %s %.11q %.11q", d.Descriptor, d.Field, d.Original,
+			d.Reencoded))
+	}
+	want = []string{
+		`0 Subject "hello world" "hello there"`,
+		`1.2 content "23ecabe46a8" "9adaa4bd85a"`,
+		`2 header order "Content-Typ" "Content-Tra"`,
+		`3 part "" "text/plain"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got Differences:\n%s\nwant:\n%s", strings.Join(got, "\n"),
+			strings.Join(want, "\n"))
+	}
+	if len(report.Parts) != 5 || report.Parts[0].Match || !report.Parts[1].Match ||
+		report.Parts[3].Match || report.Parts[4].Match {
+		t.Errorf("got Parts %v, want 0, 1.2 and 2 not to Match", report.Parts)
+	}
+}
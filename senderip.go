@@ -0,0 +1,100 @@
+package mime
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// hnReceivedSPF is the RFC 7208 field recording the SPF check made by a receiving server
+const hnReceivedSPF = "Received-Spf"
+
+// senderIPFields are the vendor fields recording the IP address of the client that submitted a
+// message, such as a webmail user's browser, in order of precedence.
+var senderIPFields = []string{
+	"X-Originating-Ip", // Microsoft, Yahoo and many webmail services
+	"X-Sender-Ip",
+	"X-Source-Ip", // cPanel
+	"X-Mailgun-Sending-Ip",
+	"X-Client-Ip",
+}
+
+// SenderIP is evidence of the IP address that sent a message, from a single header field.
+type SenderIP struct {
+	Field string // Canonical name of the header field, e.g. "Received-Spf" or "X-Originating-Ip"
+	IP    net.IP // IPv4 addresses are 4 bytes long
+
+	// Fields of a Received-SPF header, empty for other fields
+	Result       string // Lowercase SPF result, e.g. "pass" or "softfail"
+	Receiver     string // Host that performed the check
+	EnvelopeFrom string // Envelope sender checked
+	Helo         string // HELO or EHLO name given by the client
+}
+
+// SenderIPs extracts the sending IP evidence from header: the client-ip of each RFC 7208
+// Received-SPF field, topmost and so most recently added first, followed by the addresses from
+// the vendor fields listed in senderIPFields.  Fields without a valid IP address are skipped, and
+// nil is returned if there are none.  Like the Received chain, these fields are only as
+// trustworthy as the servers that added them.
+func SenderIPs(header textproto.MIMEHeader) []SenderIP {
+	var ips []SenderIP
+	for _, v := range header[hnReceivedSPF] {
+		if s, ok := parseReceivedSPF(v); ok {
+			ips = append(ips, s)
+		}
+	}
+	for _, k := range senderIPFields {
+		for _, v := range header[k] {
+			if ip := parseSenderIP(v); ip != nil {
+				ips = append(ips, SenderIP{Field: k, IP: ip})
+			}
+		}
+	}
+	return ips
+}
+
+// parseReceivedSPF parses a Received-SPF value such as
+// `pass (example.org: domain of a@example.com designates 192.0.2.1 as permitted sender)
+// receiver=example.org; client-ip=192.0.2.1; envelope-from="a@example.com"; helo=mta.example.com`,
+// returning false if it has no valid client-ip.
+func parseReceivedSPF(v string) (SenderIP, bool) {
+	v = StripComments(v)
+	s := SenderIP{Field: hnReceivedSPF}
+	i := strings.IndexAny(v, " \t;")
+	if i == -1 {
+		i = len(v)
+	}
+	s.Result = strings.ToLower(v[:i])
+	for _, kv := range strings.Split(v[i:], ";") {
+		j := strings.IndexByte(kv, '=')
+		if j == -1 {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(kv[j+1:]), `"`)
+		switch strings.ToLower(strings.TrimSpace(kv[:j])) {
+		case "client-ip":
+			s.IP = parseSenderIP(value)
+		case "receiver":
+			s.Receiver = value
+		case "envelope-from":
+			s.EnvelopeFrom = value
+		case "helo":
+			s.Helo = value
+		}
+	}
+	return s, s.IP != nil
+}
+
+// parseSenderIP parses an IP address as written in sender IP fields, e.g. "[192.0.2.1]" or
+// "IPv6:2001:db8::1", returning nil if it is not valid.
+func parseSenderIP(v string) net.IP {
+	v = strings.Trim(StripComments(v), "[]")
+	if len(v) > 5 && strings.EqualFold(v[:5], "ipv6:") {
+		v = v[5:]
+	}
+	ip := net.ParseIP(v)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
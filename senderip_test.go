@@ -0,0 +1,46 @@
+package mime
+
+import (
+	"net/textproto"
+	"testing"
+)
+
+func TestSenderIPs(t *testing.T) {
+	header := textproto.MIMEHeader{
+		"Received-Spf": {
+			"pass (mx.example.org: domain of a@example.com designates 192.0.2.1 as permitted " +
+				"sender) receiver=mx.example.org; client-ip=192.0.2.1; " +
+				"envelope-from=\"a@example.com\"; helo=mta.example.com;",
+			"SoftFail client-ip=2001:DB8::1; helo=(comment) relay.example.net",
+			"none (no client-ip given)",
+		},
+		"X-Originating-Ip": {"[198.51.100.7]", "not an address"},
+		"X-Source-Ip":      {"IPv6:2001:db8::2"},
+		"X-Client-Ip":      {"::ffff:203.0.113.9"},
+	}
+	want := []SenderIP{
+		{Field: "Received-Spf", IP: []byte{192, 0, 2, 1}, Result: "pass",
+			Receiver: "mx.example.org", EnvelopeFrom: "a@example.com", Helo: "mta.example.com"},
+		{Field: "Received-Spf", IP: parseSenderIP("2001:db8::1"), Result: "softfail",
+			Helo: "relay.example.net"},
+		{Field: "X-Originating-Ip", IP: []byte{198, 51, 100, 7}},
+		{Field: "X-Source-Ip", IP: parseSenderIP("2001:db8::2")},
+		{Field: "X-Client-Ip", IP: []byte{203, 0, 113, 9}},
+	}
+	got := SenderIPs(header)
+	if len(got) != len(want) {
+		t.Fatalf("got %d SenderIPs, want %d: %+v", len(got), len(want), got)
+	}
+	for i, g := range got {
+		w := want[i]
+		if g.Field != w.Field || !g.IP.Equal(w.IP) || len(g.IP) != len(w.IP) ||
+			g.Result != w.Result || g.Receiver != w.Receiver ||
+			g.EnvelopeFrom != w.EnvelopeFrom || g.Helo != w.Helo {
+			t.Errorf("got %+v, want %+v", g, w)
+		}
+	}
+
+	if ips := SenderIPs(textproto.MIMEHeader{"Subject": {"hi"}}); ips != nil {
+		t.Errorf("got %+v, want nil", ips)
+	}
+}
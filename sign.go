@@ -0,0 +1,154 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	ctMultipartSigned = "multipart/signed"
+
+	hpMicalg   = "micalg"
+	hpProtocol = "protocol"
+)
+
+// HeaderSigner is handed the exact bytes of a serialized message and returns a complete header
+// field, such as "DKIM-Signature: v=1; ...", to be prepended to it.  The message bytes are written
+// out unmodified after the field.
+type HeaderSigner func(message []byte) (field string, err error)
+
+// PartSigner is handed the exact bytes of the serialized content entity of a message and returns
+// the detached signature Part, and the protocol and micalg parameters describing it, for use in
+// an RFC 1847 multipart/signed such as S/MIME.
+type PartSigner func(content []byte) (signature *Part, protocol, micalg string, err error)
+
+// WithHeaderSigner adds a HeaderSigner to be run over the output of Encode.  Multiple header
+// signers are applied in order, each signing the output of the previous.
+func WithHeaderSigner(signer HeaderSigner) EncodeOption {
+	return func(e *encoder) {
+		e.headerSigners = append(e.headerSigners, signer)
+	}
+}
+
+// WithPartSigner wraps the content of the Part being encoded in a multipart/signed, using signer
+// to generate the signature.  Fields not beginning with "Content-" remain in the top level header.
+// When combined with WithHeaderSigner, the header signers see the multipart/signed output.
+func WithPartSigner(signer PartSigner) EncodeOption {
+	return func(e *encoder) {
+		e.partSigner = signer
+	}
+}
+
+// encodeSigned encodes p into memory so that signers may be handed the exact output bytes.
+func (e *encoder) encodeSigned(w io.Writer, p *Part) error {
+	buf := &bytes.Buffer{}
+	bw := bufio.NewWriter(buf)
+	var err error
+	if e.partSigner != nil {
+		err = e.encodePartSigned(bw, p)
+	} else {
+		err = p.encode(bw)
+	}
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	message := buf.Bytes()
+	for _, signer := range e.headerSigners {
+		field, err := signer(message)
+		if err != nil {
+			return fmt.Errorf("error signing message: %w", err)
+		}
+		if !strings.HasSuffix(field, "\r\n") {
+			field += "\r\n"
+		}
+		if err := validateSignatureField(field); err != nil {
+			return err
+		}
+		message = append([]byte(field), message...)
+	}
+	_, err = w.Write(message)
+	return err
+}
+
+// encodePartSigned writes p as a multipart/signed containing p's content entity and the
+// signature returned by the PartSigner.
+func (e *encoder) encodePartSigned(w *bufio.Writer, p *Part) error {
+	// Split the header: Content-* fields describe the signed entity, the rest the message
+	content := make(textproto.MIMEHeader)
+	outer := make(textproto.MIMEHeader)
+	for k, v := range p.Header {
+		switch {
+		case strings.HasPrefix(k, "Content-"):
+			content[k] = v
+		case strings.EqualFold(k, hnMIMEVersion):
+			// Header map keys are canonical, "Mime-Version", unless set directly
+		default:
+			outer[k] = v
+		}
+	}
+
+	entity := &bytes.Buffer{}
+	ew := bufio.NewWriter(entity)
+	if err := p.encodeWithHeader(ew, content); err != nil {
+		return err
+	}
+	if err := ew.Flush(); err != nil {
+		return err
+	}
+	signature, protocol, micalg, err := e.partSigner(entity.Bytes())
+	if err != nil {
+		return fmt.Errorf("error signing content: %w", err)
+	}
+	if signature == nil {
+		return errors.New("signer returned no signature part")
+	}
+
+	boundary, err := randomBoundary()
+	if err != nil {
+		return err
+	}
+	params := map[string]string{hpBoundary: boundary, hpProtocol: protocol}
+	if micalg != "" {
+		params[hpMicalg] = micalg
+	}
+	signed := NewPart(nil)
+	signed.Header = outer
+	if err := signed.setContentType(ctMultipartSigned, params); err != nil {
+		return err
+	}
+	signed.Header.Set(hnMIMEVersion, "1.0")
+
+	// The content entity must be written exactly as signed, so it is not re-encoded here
+	if err := writeHeader(w, signed.Header, p.fieldOrder); err != nil {
+		return err
+	}
+	w.WriteString("--" + boundary + "\r\n")
+	w.Write(entity.Bytes())
+	w.WriteString("\r\n--" + boundary + "\r\n")
+	if err := signature.encode(w); err != nil {
+		return err
+	}
+	_, err = w.WriteString("\r\n--" + boundary + "--\r\n")
+	return err
+}
+
+// validateSignatureField checks a possibly folded field returned by a HeaderSigner.
+func validateSignatureField(field string) error {
+	unfolded := strings.TrimSuffix(field, "\r\n")
+	unfolded = strings.Replace(unfolded, "\r\n ", " ", -1)
+	unfolded = strings.Replace(unfolded, "\r\n\t", "\t", -1)
+	i := strings.IndexByte(unfolded, ':')
+	if i < 1 {
+		return &HeaderFieldError{Name: unfolded, Reason: "signer returned a malformed field"}
+	}
+	return ValidateHeaderField(unfolded[:i], unfolded[i+1:])
+}
@@ -0,0 +1,167 @@
+package mime_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cardamaro/mime"
+	"github.com/cardamaro/mime/internal/test"
+)
+
+func buildSigningTestMessage(t *testing.T) *mime.Part {
+	t.Helper()
+	b := mime.NewBuilder()
+	b.SetHeader("From", "alice@example.com")
+	b.SetHeader("Subject", "Signed")
+	b.SetText("Signed content\n")
+	root, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestEncodeHeaderSigner(t *testing.T) {
+	root := buildSigningTestMessage(t)
+	plain := &bytes.Buffer{}
+	if err := root.Encode(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	var signed []byte
+	signer := func(message []byte) (string, error) {
+		signed = append([]byte(nil), message...)
+		sum := sha256.Sum256(message)
+		return "X-Test-Signature: v=1;\r\n\tbh=" + hex.EncodeToString(sum[:]), nil
+	}
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf, mime.WithHeaderSigner(signer)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signed, plain.Bytes()) {
+		t.Errorf("signer saw:\n%q\nwant:\n%q", signed, plain.Bytes())
+	}
+	if !bytes.HasSuffix(buf.Bytes(), plain.Bytes()) {
+		t.Errorf("signed output does not end with the signed bytes:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "X-Test-Signature: v=1;\r\n\tbh=") {
+		t.Errorf("signature field not prepended:\n%s", buf.String())
+	}
+
+	p, err := mime.ReadParts(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Header.Get("X-Test-Signature") == "" {
+		t.Error("X-Test-Signature missing after parse")
+	}
+}
+
+func TestEncodeHeaderSignerInjection(t *testing.T) {
+	root := buildSigningTestMessage(t)
+	signer := func(message []byte) (string, error) {
+		return "X-Test-Signature: ok\r\nBcc: victim@example.com", nil
+	}
+	err := root.Encode(&bytes.Buffer{}, mime.WithHeaderSigner(signer))
+	if _, ok := err.(*mime.HeaderFieldError); !ok {
+		t.Errorf("Encode error == %v, want *HeaderFieldError", err)
+	}
+
+	failing := func(message []byte) (string, error) {
+		return "", errors.New("no key")
+	}
+	if err := root.Encode(&bytes.Buffer{}, mime.WithHeaderSigner(failing)); err == nil {
+		t.Error("Encode should return signer errors")
+	}
+}
+
+func TestEncodePartSigner(t *testing.T) {
+	root := buildSigningTestMessage(t)
+
+	var signed []byte
+	signer := func(content []byte) (*mime.Part, string, string, error) {
+		signed = append([]byte(nil), content...)
+		sig, err := mime.NewBuilder().Build()
+		if err != nil {
+			return nil, "", "", err
+		}
+		sig.SetHeader("Content-Type", "application/pkcs7-signature; name=smime.p7s")
+		delete(sig.Header, "Mime-Version")
+		return sig, "application/pkcs7-signature", "sha-256", nil
+	}
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf, mime.WithPartSigner(signer)); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := mime.ReadParts(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ComparePart(t, p, &mime.Part{
+		Subparts:    []*mime.Part{test.PartExists, test.PartExists},
+		ContentType: "multipart/signed",
+		Descriptor:  "0",
+	})
+	if got, want := p.ContentParams["protocol"], "application/pkcs7-signature"; got != want {
+		t.Errorf("protocol == %q, want: %q", got, want)
+	}
+	if got, want := p.ContentParams["micalg"], "sha-256"; got != want {
+		t.Errorf("micalg == %q, want: %q", got, want)
+	}
+	if got, want := p.Header.Get("Subject"), "Signed"; got != want {
+		t.Errorf("Subject == %q, want: %q", got, want)
+	}
+
+	// The first subpart must be byte-for-byte what was signed
+	first := p.Subparts[0]
+	if !bytes.Contains(buf.Bytes(), signed) {
+		t.Errorf("signed entity not present verbatim in output")
+	}
+	if first.Header.Get("Subject") != "" {
+		t.Error("Subject should not be part of the signed entity")
+	}
+	test.ContentEqualsString(t, first, "Signed content\r\n")
+	test.ComparePart(t, p.Subparts[1], &mime.Part{
+		Parent:      test.PartExists,
+		ContentType: "application/pkcs7-signature",
+		Filename:    "smime.p7s",
+		Descriptor:  "2",
+	})
+}
+
+func TestEncodePartSignerMIMEVersion(t *testing.T) {
+	root := buildSigningTestMessage(t)
+	root.Header.Set("MIME-Version", "1.0 (produced by test)")
+	root.Header["MIME-Version"] = []string{"1.0 (set directly)"}
+
+	signer := func(content []byte) (*mime.Part, string, string, error) {
+		if bytes.Contains(bytes.ToLower(content), []byte("mime-version")) {
+			t.Errorf("signed entity %q holds MIME-Version", content)
+		}
+		sig, err := mime.NewBuilder().Build()
+		if err != nil {
+			return nil, "", "", err
+		}
+		delete(sig.Header, "Mime-Version")
+		return sig, "application/pkcs7-signature", "sha-256", nil
+	}
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf, mime.WithPartSigner(signer)); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(bytes.ToLower(buf.Bytes()), []byte("mime-version:")); n != 1 {
+		t.Errorf("got %d MIME-Version fields in:\n%s\nwant 1", n, buf)
+	}
+	p, err := mime.ReadParts(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MIMEVersion != "1.0" {
+		t.Errorf("MIMEVersion == %q, want %q", p.MIMEVersion, "1.0")
+	}
+}
@@ -0,0 +1,253 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// Splitter reads a stream of concatenated messages, such as an mbox file, the output of
+// formail -s or a batch SMTP (BSMTP) file, parsing each in turn with ReadParts.  A single buffer
+// is used to read the whole stream, and the messages are passed to the Parser without copying.
+type Splitter struct {
+	ps          *Parser
+	br          *bufio.Reader
+	started     bool
+	bsmtp       bool  // The stream is batch SMTP rather than mbox
+	fromSkipped bool  // The "From " line starting the next mbox message has been read
+	err         error // Sticky error reading the stream, io.EOF at its end
+}
+
+// NewSplitter returns a Splitter reading messages from r, parsed with a Parser configured by opts.
+func NewSplitter(r io.Reader, opts ...Option) *Splitter {
+	return NewParser(opts...).NewSplitter(r)
+}
+
+// NewSplitter returns a Splitter reading messages from r, parsed with this Parser.
+//
+// The format of the stream is recognized from its first line.  If that is an SMTP command, such as
+// HELO or MAIL FROM, the stream is batch SMTP: each message is the dot-stuffed content following a
+// DATA command, up to the line holding a single dot, and other commands are ignored.  Otherwise the
+// messages are separated by mbox "From " lines, which are dropped along with the blank line before
+// each; a first message without one is read as well.  Quoted ">From " lines are left as they are.
+func (ps *Parser) NewSplitter(r io.Reader) *Splitter {
+	return &Splitter{ps: ps, br: bufio.NewReader(r)}
+}
+
+// Next reads the next message from the stream, returning io.EOF when there are no more.  An error
+// parsing one message is returned for it alone, and Next may be called again to read the next.
+func (s *Splitter) Next() (*Part, error) {
+	if !s.started {
+		s.bsmtp = s.isSMTPCommand()
+		s.started = true
+	}
+	var mr io.Reader
+	var err error
+	if s.bsmtp {
+		mr, err = s.nextData()
+	} else {
+		mr, err = s.nextMbox()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.ps.ReadParts(mr)
+	// Skip the rest of a message the Parser did not read, on error
+	if _, cerr := io.Copy(ioutil.Discard, mr); err == nil && cerr != nil {
+		err = cerr
+	}
+	return p, err
+}
+
+// smtpCommands are the commands recognized at the start of a batch SMTP stream
+var smtpCommands = [][]byte{
+	[]byte("HELO "), []byte("EHLO "), []byte("MAIL FROM:"), []byte("RSET"), []byte("DATA"),
+}
+
+// isSMTPCommand returns true if the stream starts with an SMTP command.
+func (s *Splitter) isSMTPCommand() bool {
+	line, _ := s.br.Peek(len("MAIL FROM:"))
+	for _, cmd := range smtpCommands {
+		if len(line) >= len(cmd) && bytes.EqualFold(line[:len(cmd)], cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextMbox skips the "From " line starting the next message of an mbox stream, if there is one,
+// and returns a reader over the message.
+func (s *Splitter) nextMbox() (io.Reader, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if _, err := s.br.Peek(1); err != nil {
+		s.err = err
+		return nil, err
+	}
+	if line, _ := s.br.Peek(len("From ")); !s.fromSkipped && isFromLine(line) {
+		if err := s.skipLine(); err != nil {
+			return nil, err
+		}
+	}
+	s.fromSkipped = false
+	return &mboxReader{s: s, bol: true}, nil
+}
+
+// nextData skips the batch SMTP commands preceding the next message, up to DATA, and returns a
+// reader over the message.
+func (s *Splitter) nextData() (io.Reader, error) {
+	for s.err == nil {
+		line, _ := s.br.Peek(len("DATA\r\n"))
+		isData := len(line) >= 4 && bytes.EqualFold(line[:4], []byte("DATA")) &&
+			(len(line) == 4 || line[4] == '\r' || line[4] == '\n')
+		if err := s.skipLine(); err != nil {
+			return nil, err
+		}
+		if isData {
+			return &dataReader{s: s, bol: true}, nil
+		}
+	}
+	return nil, s.err
+}
+
+// skipLine discards the rest of the current line.
+func (s *Splitter) skipLine() error {
+	for {
+		_, err := s.br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			s.err = err
+		}
+		return err
+	}
+}
+
+// readLine returns the next line of the stream or, when it is longer than the buffer, the next
+// part of it.  The slice is only valid until the next read.  At the end of the stream it sets
+// s.err and returns nil.
+func (s *Splitter) readLine() []byte {
+	if s.err != nil {
+		return nil
+	}
+	line, err := s.br.ReadSlice('\n')
+	if err != nil && err != bufio.ErrBufferFull {
+		s.err = err
+	}
+	if len(line) == 0 {
+		return nil
+	}
+	return line
+}
+
+// readErr returns the error ending a message: io.EOF, unless reading the stream failed.
+func (s *Splitter) readErr() error {
+	if s.err != nil {
+		return s.err
+	}
+	return io.EOF
+}
+
+// isFromLine returns true for an mbox "From " separator line.
+func isFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+// isBlankLine returns true for an empty line.
+func isBlankLine(line []byte) bool {
+	return len(line) > 0 && len(bytes.TrimRight(line, "\r\n")) == 0
+}
+
+// mboxReader reads a message from an mbox stream, up to the blank line and "From " line starting
+// the next.
+type mboxReader struct {
+	s       *Splitter
+	pending []byte // Bytes read but not yet returned
+	blank   []byte // A blank line held back, as it may precede a "From " line
+	bol     bool   // At the beginning of a line
+	done    bool
+}
+
+func (mr *mboxReader) Read(b []byte) (int, error) {
+	for len(mr.pending) == 0 && !mr.done {
+		mr.fill()
+	}
+	if len(mr.pending) == 0 {
+		return 0, mr.s.readErr()
+	}
+	n := copy(b, mr.pending)
+	mr.pending = mr.pending[n:]
+	return n, nil
+}
+
+// fill reads the next line into pending, or finishes the message.
+func (mr *mboxReader) fill() {
+	bol := mr.bol
+	line := mr.s.readLine()
+	if line == nil {
+		// The blank line at the end of the stream belongs to the mbox format
+		mr.done = true
+		return
+	}
+	mr.bol = line[len(line)-1] == '\n'
+	switch {
+	case bol && mr.blank != nil && isFromLine(line):
+		// The "From " line of the next message
+		mr.done = true
+		mr.s.fromSkipped = true
+		if !mr.bol {
+			mr.s.skipLine()
+		}
+	case bol && isBlankLine(line):
+		mr.pending = mr.blank
+		mr.blank = append([]byte(nil), line...)
+	case mr.blank != nil:
+		mr.pending = append(mr.blank, line...)
+		mr.blank = nil
+	default:
+		mr.pending = line
+	}
+}
+
+// dataReader reads a dot-stuffed message following a batch SMTP DATA command, up to the line
+// holding a single dot.
+type dataReader struct {
+	s       *Splitter
+	pending []byte // Bytes read but not yet returned
+	bol     bool   // At the beginning of a line
+	done    bool
+}
+
+func (dr *dataReader) Read(b []byte) (int, error) {
+	for len(dr.pending) == 0 && !dr.done {
+		dr.fill()
+	}
+	if len(dr.pending) == 0 {
+		return 0, dr.s.readErr()
+	}
+	n := copy(b, dr.pending)
+	dr.pending = dr.pending[n:]
+	return n, nil
+}
+
+// fill reads the next line into pending, or finishes the message.
+func (dr *dataReader) fill() {
+	bol := dr.bol
+	line := dr.s.readLine()
+	if line == nil {
+		dr.done = true
+		return
+	}
+	dr.bol = line[len(line)-1] == '\n'
+	if bol && line[0] == '.' {
+		if len(bytes.TrimRight(line, "\r\n")) == 1 && dr.bol {
+			dr.done = true
+			return
+		}
+		line = line[1:]
+	}
+	dr.pending = line
+}
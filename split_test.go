@@ -0,0 +1,87 @@
+package mime
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// splitAll returns the Subject and decoded body of each message read by s.
+func splitAll(t *testing.T, s *Splitter) (subjects, bodies []string) {
+	for {
+		p, err := s.Next()
+		if err == io.EOF {
+			return subjects, bodies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := p.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(r)
+		subjects = append(subjects, p.Header.Get("Subject"))
+		bodies = append(bodies, string(body))
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	ttable := []struct {
+		name, in string
+		subjects []string
+		bodies   []string
+	}{
+		{
+			"mbox",
+			"From a@example.com Mon Jan  2 15:04:05 2006\nSubject: one\n\nbody one\n\n" +
+				"From b@example.com Mon Jan  2 15:04:06 2006\nSubject: two\n\nbody\n" +
+				"From here, no separator\n>From quoted\n\n\n" +
+				"From c@example.com Mon Jan  2 15:04:07 2006\nSubject: " + long + "\n\n" + long + "\n",
+			[]string{"one", "two", long},
+			[]string{"body one\n", "body\nFrom here, no separator\n>From quoted\n\n", long + "\n"},
+		},
+		{
+			"no From line",
+			"Subject: one\r\n\r\nbody\r\n\r\nFrom b@example.com\r\nSubject: two\r\n\r\nbody",
+			[]string{"one", "two"},
+			[]string{"body\r\n", "body"},
+		},
+		{
+			"bsmtp",
+			"HELO mta.example.com\r\nMAIL FROM:<a@example.com>\r\nRCPT TO:<b@example.com>\r\n" +
+				"DATA\r\nSubject: one\r\n\r\n..leading dot\r\n.\r\n" +
+				"MAIL FROM:<a@example.com>\r\nRCPT TO:<c@example.com>\r\ndata\r\n" +
+				"Subject: two\r\n\r\nbody\r\n.\r\nQUIT\r\n",
+			[]string{"one", "two"},
+			[]string{".leading dot\r\n", "body\r\n"},
+		},
+	}
+	for _, tt := range ttable {
+		subjects, bodies := splitAll(t, NewSplitter(strings.NewReader(tt.in)))
+		if strings.Join(subjects, "\n") != strings.Join(tt.subjects, "\n") {
+			t.Errorf("%s: got subjects %q, want %q", tt.name, subjects, tt.subjects)
+		}
+		if strings.Join(bodies, "\x00") != strings.Join(tt.bodies, "\x00") {
+			t.Errorf("%s: got bodies %q, want %q", tt.name, bodies, tt.bodies)
+		}
+	}
+
+	if _, err := NewSplitter(strings.NewReader("")).Next(); err != io.EOF {
+		t.Errorf("Next() on empty stream error %v, want %v", err, io.EOF)
+	}
+
+	errBoom := errors.New("boom")
+	r := io.MultiReader(strings.NewReader("Subject: one\n\nbody"), iotest.ErrReader(errBoom))
+	s := NewSplitter(r)
+	if _, err := s.Next(); !errors.Is(err, errBoom) {
+		t.Errorf("Next() error %v, want %v", err, errBoom)
+	}
+	if _, err := s.Next(); !errors.Is(err, errBoom) {
+		t.Errorf("second Next() error %v, want %v", err, errBoom)
+	}
+}
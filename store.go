@@ -0,0 +1,146 @@
+package mime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ErrStoreMismatch is returned by Rehydrate when content from a PartStore does not match the hash
+// it was stored under.
+var ErrStoreMismatch = errors.New("stored part content does not match its hash")
+
+// PartStore is content-addressable storage for the decoded content of Parts, keyed by the
+// lowercase hex SHA-256 of the content.  Since identical content always has the same hash, Put
+// may discard content it already holds.
+type PartStore interface {
+	Put(hash string, r io.Reader) error
+	Get(hash string) (io.ReadCloser, error)
+}
+
+// Deduplicate moves the content of each of the Attachments of the Part tree rooted at root to
+// store, replacing it with a reference in an X-Mime-Store-Ref header field, see StoreRef.  The
+// Parts are left without content: Read returns io.EOF and Decode returns ErrNoContent, and Encode
+// writes a skeleton of the message.  Rehydrate restores the content.
+//
+// X-Mime-Store-Ref fields Deduplicate did not set itself, which anyone sending a message can
+// forge, are removed, so that a skeleton only refers to content of its own message.  The tree is
+// only changed once all of the content has been stored; if store fails it is left as it was.
+func Deduplicate(root *Part, store PartStore) error {
+	type move struct {
+		p    *Part
+		hash string
+	}
+	var moves []move
+	stored := make(map[string]bool)
+	for _, a := range Attachments(root) {
+		p := a.Part
+		if p.storeRef != "" && p.StoreRef() == p.storeRef {
+			continue
+		}
+		hash, err := p.contentHash()
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Descriptor, err)
+		}
+		if !stored[hash] {
+			r, err := p.DecodeRaw()
+			if err != nil {
+				return fmt.Errorf("%s: %w", p.Descriptor, err)
+			}
+			if err := store.Put(hash, r); err != nil {
+				return fmt.Errorf("%s: storing content: %w", p.Descriptor, err)
+			}
+			stored[hash] = true
+		}
+		moves = append(moves, move{p, hash})
+	}
+
+	root.Walk(func(p *Part) error {
+		if ref := p.StoreRef(); ref != "" && ref != p.storeRef {
+			p.Header.Del(hnStoreRef)
+			p.storeRef = ""
+			p.InvalidateIndex()
+		}
+		return nil
+	})
+	for _, m := range moves {
+		m.p.Header.Set(hnStoreRef, m.hash)
+		m.p.storeRef = m.hash
+		m.p.InvalidateIndex()
+		m.p.setEncoded(nil)
+	}
+	return nil
+}
+
+// Rehydrate restores the content of each Part in the tree rooted at root with a StoreRef from
+// store, transfer encoding it as before, and removes the references.  It also accepts skeletons
+// read back with ReadParts.  Only rehydrate trees and skeletons that Deduplicate produced: since
+// a message may carry forged references to any content in store, those of a message that has not
+// been through Deduplicate must not be followed.
+func Rehydrate(root *Part, store PartStore) error {
+	return root.Walk(func(p *Part) error {
+		hash := p.StoreRef()
+		if hash == "" {
+			return nil
+		}
+		rc, err := store.Get(hash)
+		if err != nil {
+			return fmt.Errorf("%s: fetching content: %w", p.Descriptor, err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: fetching content: %w", p.Descriptor, err)
+		}
+		if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != hash {
+			return fmt.Errorf("%s: %w", p.Descriptor, ErrStoreMismatch)
+		}
+		encoded, err := encodeContent(p.Header.Get(hnContentEncoding), content)
+		if err != nil {
+			return err
+		}
+		p.Header.Del(hnStoreRef)
+		p.storeRef = ""
+		p.setEncoded(encoded)
+		return nil
+	})
+}
+
+// StoreRef returns the hash under which Deduplicate stored the Part's content in a PartStore, or
+// "" if the Part holds its own content.
+func (p *Part) StoreRef() string {
+	return p.Header.Get(hnStoreRef)
+}
+
+// contentHash returns the lowercase hex SHA-256 of the Part's decoded content.
+func (p *Part) contentHash() (string, error) {
+	r, err := p.DecodeRaw()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// setEncoded replaces the transfer encoded content of a leaf Part, which has none if encoded is
+// nil.
+func (p *Part) setEncoded(encoded []byte) {
+	p.content = nil
+	p.encoded = encoded
+	p.bound = nil
+	p.reader = nil
+	if encoded == nil {
+		p.encoded = []byte{}
+	} else {
+		p.reader = bytes.NewReader(encoded)
+	}
+	p.Size = len(encoded)
+	p.Lines = bytes.Count(encoded, []byte{'\n'})
+}
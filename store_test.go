@@ -0,0 +1,201 @@
+package mime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// mapStore is a PartStore holding content in memory, counting calls to Put.  Put fails once
+// failAfter is reached, if that is positive.
+type mapStore struct {
+	content   map[string][]byte
+	puts      int
+	failAfter int
+}
+
+func (s *mapStore) Put(hash string, r io.Reader) error {
+	if s.failAfter > 0 && s.puts == s.failAfter {
+		return errors.New("store full")
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.content[hash] = b
+	s.puts++
+	return nil
+}
+
+func (s *mapStore) Get(hash string) (io.ReadCloser, error) {
+	b, ok := s.content[hash]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func TestDeduplicate(t *testing.T) {
+	data := bytes.Repeat([]byte("attachment data\x00\x01"), 100)
+	b64, _ := encodeContent("base64", data)
+	qp, _ := encodeContent("quoted-printable", data)
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=a.bin\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" + string(b64) + "\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=b.bin\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" + string(qp) + "\r\n" +
+		"--b--\r\n"
+
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &bytes.Buffer{}
+	if err := p.Encode(want); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &mapStore{content: make(map[string][]byte)}
+	if err := Deduplicate(p, store); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.content) != 1 || store.puts != 1 {
+		t.Fatalf("stored %d items with %d puts, want 1", len(store.content), store.puts)
+	}
+	for _, s := range p.Subparts[1:] {
+		if s.StoreRef() == "" {
+			t.Errorf("%v has no StoreRef", s)
+		}
+		if _, err := s.Decode(); err != ErrNoContent {
+			t.Errorf("%v: Decode error %v, want %v", s, err, ErrNoContent)
+		}
+	}
+	if p.Subparts[0].StoreRef() != "" {
+		t.Errorf("body was deduplicated")
+	}
+
+	// Deduplicating again stores nothing more
+	if err := Deduplicate(p, store); err != nil || store.puts != 1 {
+		t.Errorf("second Deduplicate: %v, %d puts", err, store.puts)
+	}
+
+	skeleton := &bytes.Buffer{}
+	if err := p.Encode(skeleton); err != nil {
+		t.Fatal(err)
+	}
+	if skeleton.Len() >= len(data) {
+		t.Errorf("skeleton is %d bytes, content %d", skeleton.Len(), len(data))
+	}
+
+	q, err := ReadParts(bytes.NewReader(skeleton.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rehydrate(q, store); err != nil {
+		t.Fatal(err)
+	}
+	got := &bytes.Buffer{}
+	if err := q.Encode(got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("rehydrated:\n%s\nwant:\n%s", got, want)
+	}
+	d, err := q.Subparts[2].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadAll(d); err != nil || !bytes.Equal(content, data) {
+		t.Errorf("rehydrated content %q, %v", content, err)
+	}
+
+	// Content altered in the store is detected
+	for hash := range store.content {
+		store.content[hash] = []byte("tampered")
+	}
+	r, err := ReadParts(bytes.NewReader(skeleton.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rehydrate(r, store); !errors.Is(err, ErrStoreMismatch) {
+		t.Errorf("got error %v, want %v", err, ErrStoreMismatch)
+	}
+}
+
+func TestDeduplicateForgedStoreRef(t *testing.T) {
+	secret := []byte("someone else's attachment")
+	store := &mapStore{content: make(map[string][]byte)}
+	hash := fmt.Sprintf("%x", sha256.Sum256(secret))
+	store.content[hash] = secret
+
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nX-Mime-Store-Ref: " + hash + "\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=a.bin\r\n" +
+		"X-Mime-Store-Ref: " + hash + "\r\n\r\nmine\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Deduplicate(p, store); err != nil {
+		t.Fatal(err)
+	}
+	if ref := p.Subparts[0].StoreRef(); ref != "" {
+		t.Errorf("body StoreRef() == %q, want none", ref)
+	}
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte("mine")))
+	if ref := p.Subparts[1].StoreRef(); ref != want {
+		t.Errorf("attachment StoreRef() == %q, want %q", ref, want)
+	}
+
+	skeleton := &bytes.Buffer{}
+	if err := p.Encode(skeleton); err != nil {
+		t.Fatal(err)
+	}
+	q, err := ReadParts(bytes.NewReader(skeleton.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rehydrate(q, store); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadAll(q.Subparts[1]); err != nil || string(content) != "mine" {
+		t.Errorf("rehydrated content %q, %v, want %q", content, err, "mine")
+	}
+}
+
+func TestDeduplicateStoreFailure(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: application/pdf; name=a.pdf\r\n\r\nfirst\r\n" +
+		"--b\r\nContent-Type: application/pdf; name=b.pdf\r\n\r\nsecond\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &bytes.Buffer{}
+	if err := p.Encode(want); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &mapStore{content: make(map[string][]byte), failAfter: 1}
+	if err := Deduplicate(p, store); err == nil {
+		t.Fatal("Deduplicate succeeded with a failing store")
+	}
+	got := &bytes.Buffer{}
+	if err := p.Encode(got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("after failed Deduplicate:\n%s\nwant:\n%s", got, want)
+	}
+}
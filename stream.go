@@ -0,0 +1,61 @@
+package mime
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// StreamHandler receives each leaf Part of a message read with Stream, with its header fields
+// parsed, and a reader r over its content as Decode would return it.  r is only valid during the
+// call; content left unread is discarded.  Sizes and lengths are not yet known, and the Part has
+// not been added to its Parent's Subparts.  Returning an error stops the parse.
+type StreamHandler func(p *Part, r io.Reader) error
+
+// Stream reads a MIME message from r, calling fn for each leaf Part, see Parser.Stream.
+func Stream(r io.Reader, fn StreamHandler, opts ...Option) (*Part, error) {
+	return NewParser(opts...).Stream(r, fn)
+}
+
+// Stream reads the MIME message from r without buffering it, calling fn with the content of each
+// leaf Part, in order, as it is read, so that messages too large to stage may be processed.  The
+// Part tree is returned as from ReadStructure once the message has been read, without content.
+// Content that cannot be decoded is passed to fn still transfer encoded, or decoded as far as
+// possible WithBestEffortDecode, with the failure recorded in the Part's Errors.  An error returned
+// by fn is returned wrapped.
+func (ps *Parser) Stream(r io.Reader, fn StreamHandler) (*Part, error) {
+	root := NewPart(nil)
+	root.ps = ps
+	root.stream = fn
+	tr := &truncatingReader{r: r, tolerant: ps.truncationTolerant}
+	root.streamLines = &lineCountingReader{r: ps.limitMessageSize(tr)}
+	if err := root.readPart(root.streamLines, 0); err != nil {
+		return nil, fmt.Errorf("error reading part: %w", err)
+	}
+	root.streamLines = nil
+	root.markTruncated(tr.err)
+	return root, nil
+}
+
+// streamContent passes the content of the leaf Part, read from r, to its StreamHandler, then
+// discards whatever the handler left unread.
+func (p *Part) streamContent(r io.Reader) error {
+	p.reader = r
+	defer func() {
+		p.reader = nil
+	}()
+	body, err := p.Decode()
+	if derr, ok := err.(*DecodeError); ok {
+		p.addWarning(derr.Err, "%s", derr.Detail)
+	} else if err != nil {
+		return err
+	}
+	if body == nil {
+		body = r
+	}
+	if err := p.stream(p, body); err != nil {
+		return err
+	}
+	_, err = io.Copy(ioutil.Discard, r)
+	return err
+}
@@ -0,0 +1,76 @@
+package mime
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStream(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\nCaf=E9\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n" +
+		"\r\naGVsbG8gd29ybGQ=\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: x-unknown\r\n\r\n" +
+		"%PDF\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\nSubject: fwd\r\n\r\nforwarded\r\n" +
+		"--b--\r\n"
+	var got []string
+	root, err := Stream(iotest.OneByteReader(strings.NewReader(raw)), func(p *Part,
+		r io.Reader) error {
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		got = append(got, p.Descriptor+" "+p.ContentType+" "+string(content))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"1 text/plain Café",
+		"2 application/octet-stream hello world",
+		"3 application/pdf %PDF",
+		"4 text/plain forwarded",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Stream() handled %q, want %q", got, want)
+	}
+
+	if len(root.Subparts) != 4 || root.Subparts[1].Size != 16 {
+		t.Fatalf("Stream() returned %v", root.Subparts)
+	}
+	if _, err := root.Subparts[0].Decode(); err != ErrNoContent {
+		t.Errorf("Decode() error %v, want %v", err, ErrNoContent)
+	}
+	if errs := root.Subparts[2].Errors; len(errs) != 1 || !errors.Is(errs[0], ErrorContentEncoding) {
+		t.Errorf("Errors == %v, want %v", errs, ErrorContentEncoding)
+	}
+
+	// Unread content is skipped, and errors stop the parse
+	n := 0
+	_, err = Stream(strings.NewReader(raw), func(*Part, io.Reader) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 4 {
+		t.Errorf("Stream() called the handler %d times with error %v, want 4", n, err)
+	}
+	errStop := errors.New("stop")
+	n = 0
+	_, err = Stream(strings.NewReader(raw), func(*Part, io.Reader) error {
+		if n++; n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || n != 2 {
+		t.Errorf("Stream() called the handler %d times with error %v, want 2, %v", n, err,
+			errStop)
+	}
+}
@@ -0,0 +1,81 @@
+package mime
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TextExtractor writes the text of the Part p, from its decoded content r, to w as UTF-8, see
+// ExtractText.  For example an extractor for application/pdf might run a PDF parser over r.
+type TextExtractor func(p *Part, r io.Reader, w io.Writer) error
+
+// TextExtractors is a registry of TextExtractors by media type, such as "application/pdf" or
+// "text/*" for every text subtype without its own entry.
+type TextExtractors map[string]TextExtractor
+
+// lookup returns the TextExtractor registered for the lowercase mediatype, or nil.
+func (x TextExtractors) lookup(mediatype string) TextExtractor {
+	if fn := x[mediatype]; fn != nil {
+		return fn
+	}
+	if i := strings.IndexByte(mediatype, '/'); i > 0 {
+		return x[mediatype[:i]+"/*"]
+	}
+	return nil
+}
+
+// ExtractText writes the text of the message rooted at root to w for search indexing: the text of
+// each leaf Part, attachments and attached messages included, in tree order and separated by blank
+// lines.  A Part's text is written by the TextExtractor registered in extractors for its media
+// type, which for application/octet-stream is detected from its content and filename as for
+// AttachmentInfo.DetectedType.  text/plain Parts without one are written as Text returns them,
+// and other Parts are skipped, as are the signatures of multipart/signed Parts.  Content is
+// streamed from the message to the extractors without being held in memory.  The first error
+// decoding a Part, from an extractor or writing to w is returned.
+func ExtractText(root *Part, w io.Writer, extractors TextExtractors) error {
+	first := true
+	return root.Walk(func(p *Part) error {
+		if len(p.Subparts) > 0 || p.boundary != "" || p.isSignature() || p.isEmpty() {
+			return nil
+		}
+		r, err := p.Text()
+		if err == ErrNoContent {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		mediatype := p.ContentType
+		if mediatype == ctAppOctetStream {
+			br := bufio.NewReaderSize(r, sniffLen)
+			head, _ := br.Peek(sniffLen)
+			mediatype, _, _ = parseMediaType(detectContentType(p.Filename, head))
+			r = br
+		}
+		fn := extractors.lookup(mediatype)
+		if fn == nil && mediatype == ctTextPlain {
+			fn = copyText
+		}
+		if fn == nil {
+			return nil
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, "\r\n\r\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := fn(p, r, w); err != nil {
+			return fmt.Errorf("%s: %w", p.Descriptor, err)
+		}
+		return nil
+	})
+}
+
+// copyText is the TextExtractor for text/plain, copying the decoded content as it is.
+func copyText(_ *Part, r io.Reader, w io.Writer) error {
+	_, err := io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,67 @@
+package mime
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestExtractText(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: multipart/alternative; boundary=a\r\n\r\n" +
+		"--a\r\nContent-Type: text/plain; charset=iso-8859-1\r\n\r\nCaf\xe9\r\n" +
+		"--a\r\nContent-Type: text/html\r\n\r\n<p>Caf&eacute;</p>\r\n" +
+		"--a--\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=menu.pdf\r\n\r\nJVBERi0xLjQgbWVudQ==\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=scan\r\n\r\n%PDF-1.4 scan\r\n" +
+		"--b\r\nContent-Type: image/png\r\n\r\npng\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\nSubject: fwd\r\n\r\nforwarded\r\n" +
+		"--b--\r\n"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := func(p *Part, r io.Reader, w io.Writer) error {
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "pdf:"+strings.TrimPrefix(string(content), "%PDF-1.4 "))
+		return err
+	}
+	html := func(p *Part, r io.Reader, w io.Writer) error {
+		_, err := io.WriteString(w, "html")
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	err = ExtractText(p, buf, TextExtractors{"application/pdf": pdf, "text/*": html})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "html\r\n\r\nhtml\r\n\r\npdf:menu\r\n\r\npdf:scan\r\n\r\nhtml"
+	if buf.String() != want {
+		t.Errorf("ExtractText() wrote %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := ExtractText(p, buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Café\r\n\r\nforwarded"; buf.String() != want {
+		t.Errorf("ExtractText() without extractors wrote %q, want %q", buf.String(), want)
+	}
+
+	errBroken := errors.New("broken pdf")
+	err = ExtractText(p, ioutil.Discard, TextExtractors{
+		"application/pdf": func(*Part, io.Reader, io.Writer) error { return errBroken },
+	})
+	if !errors.Is(err, errBroken) || !strings.HasPrefix(err.Error(), "2: ") {
+		t.Errorf("ExtractText() error %v, want %v", err, errBroken)
+	}
+}
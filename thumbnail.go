@@ -0,0 +1,40 @@
+package mime
+
+import (
+	"io"
+	"strings"
+)
+
+// Thumbnail is a preview of an image Part made by a Thumbnailer.  A Thumbnailer may return the
+// preview itself in Data, or store it elsewhere and return a reference to it in Ref.
+type Thumbnail struct {
+	Data      []byte // Encoded preview image
+	MediaType string // Media type of Data, e.g. "image/jpeg"
+	Ref       string // Where the preview was stored, e.g. a URL or storage key
+}
+
+// Thumbnailer makes a Thumbnail of the image Part p from its decoded content r, see
+// WithThumbnailer.  It may return nil for images it declines to preview.  It must not retain r,
+// which is only valid during the call.
+type Thumbnailer func(p *Part, r io.Reader) (*Thumbnail, error)
+
+// makeThumbnail sets the Thumbnail of an image Part with the Parser's Thumbnailer, recording any
+// failure as an ErrorThumbnail warning.
+func (p *Part) makeThumbnail() {
+	thumbnailer := p.parser().thumbnailer
+	if thumbnailer == nil || !strings.HasPrefix(p.ContentType, ctImagePrefix) ||
+		len(p.Subparts) > 0 || p.reader == nil {
+		return
+	}
+	r, err := p.DecodeRaw()
+	if err != nil {
+		p.addWarning(ErrorThumbnail, "%v", err)
+		return
+	}
+	t, err := thumbnailer(p, r)
+	if err != nil {
+		p.addWarning(ErrorThumbnail, "%v", err)
+		return
+	}
+	p.Thumbnail = t
+}
@@ -0,0 +1,58 @@
+package mime
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestThumbnailer(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: image/png\r\nContent-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: inline\r\n\r\naW1hZ2U=\r\n" +
+		"--b\r\nContent-Type: image/gif\r\nContent-Disposition: attachment; filename=a.gif\r\n\r\n" +
+		"broken\r\n" +
+		"--b--\r\n"
+	errBroken := errors.New("unsupported image")
+	var seen []string
+	thumbnailer := func(p *Part, r io.Reader) (*Thumbnail, error) {
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		seen = append(seen, p.Descriptor)
+		if string(content) == "broken" {
+			return nil, errBroken
+		}
+		return &Thumbnail{Data: []byte("small " + string(content)), MediaType: "image/jpeg"}, nil
+	}
+
+	p, err := ReadParts(strings.NewReader(raw), WithThumbnailer(thumbnailer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(seen, " "); got != "2 3" {
+		t.Errorf("thumbnailer called for %q, want %q", got, "2 3")
+	}
+	text, png, gif := p.Subparts[0], p.Subparts[1], p.Subparts[2]
+	if text.Thumbnail != nil || gif.Thumbnail != nil {
+		t.Errorf("got Thumbnails %v and %v, want nil", text.Thumbnail, gif.Thumbnail)
+	}
+	if png.Thumbnail == nil || string(png.Thumbnail.Data) != "small image" {
+		t.Errorf("got Thumbnail %+v", png.Thumbnail)
+	}
+	if len(gif.Errors) != 1 || !errors.Is(gif.Errors[0], ErrorThumbnail) {
+		t.Errorf("got Errors %v, want a %q warning", gif.Errors, ErrorThumbnail)
+	}
+
+	seen = nil
+	if _, err := ReadStructure(strings.NewReader(raw), WithThumbnailer(thumbnailer)); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 0 {
+		t.Errorf("thumbnailer called for %q when reading the structure", seen)
+	}
+}
@@ -0,0 +1,68 @@
+package mime
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+)
+
+// ConvertToUTF8 converts the content of every text Part in the tree rooted at root to UTF-8,
+// labeling it charset=utf-8 and choosing its Content-Transfer-Encoding afresh as the Builder
+// would, so that Encode writes a message normalized for storage that indexes only UTF-8.  Text
+// without a charset is taken to be UTF-8, and is an error wrapping ErrorCharsetConversion if it is
+// not valid, as is text in an unsupported charset.  A Content-MD5 field is updated to match.
+func ConvertToUTF8(root *Part) error {
+	return root.Walk(func(p *Part) error {
+		if !strings.HasPrefix(p.ContentType, "text/") || p.boundary != "" || len(p.Subparts) > 0 {
+			return nil
+		}
+		if err := p.convertToUTF8(); err != nil {
+			return fmt.Errorf("%s: %w", p.Descriptor, err)
+		}
+		return nil
+	})
+}
+
+// convertToUTF8 converts the content of a leaf text Part to UTF-8.
+func (p *Part) convertToUTF8() error {
+	r, err := p.DecodeRaw()
+	if err == ErrNoContent {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if p.Charset != "" {
+		cr, err := newCharsetReaderSize(p.Charset, bytes.NewReader(content), len(content))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrorCharsetConversion, err)
+		}
+		if content, err = ioutil.ReadAll(cr); err != nil {
+			return fmt.Errorf("%w: %v", ErrorCharsetConversion, err)
+		}
+	} else if !utf8.Valid(content) {
+		return fmt.Errorf("%w: text without a charset is not UTF-8", ErrorCharsetConversion)
+	}
+
+	params := make(map[string]string)
+	if ctype := p.Header.Get(hnContentType); ctype != "" {
+		if _, params, _, err = ParseMediaType(ctype); err != nil {
+			return err
+		}
+	}
+	params[hpCharset] = "utf-8"
+	if err := p.setContentType(p.ContentType, params); err != nil {
+		return err
+	}
+	if p.Header.Get(hnContentMD5) != "" {
+		p.Header.Set(hnContentMD5, contentMD5(content))
+	}
+	_, encoding := chooseTextEncoding(content)
+	return p.reencode(encoding, content)
+}
@@ -0,0 +1,87 @@
+package mime
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestConvertToUTF8(t *testing.T) {
+	raw := "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=iso-8859-1; format=flowed\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\nContent-MD5: yd8bPDyisZKO7m4Il8eI0Q==\r\n\r\n" +
+		"caf=E9 au lait\r\n" +
+		"--b\r\nContent-Type: text/html; charset=windows-1252\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n\r\n" +
+		"<p>\x93quoted\x94</p>\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\n" +
+		"plain\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"6Q==\r\n" +
+		"--b--\r\n"
+	root, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ConvertToUTF8(root); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := root.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadParts(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Subparts) != 4 {
+		t.Fatalf("got Subparts %v", p.Subparts)
+	}
+	ttable := []struct {
+		p                       *Part
+		charset, encoding, want string
+	}{
+		{p.Subparts[0], "utf-8", "quoted-printable", "café au lait"},
+		{p.Subparts[1], "utf-8", "quoted-printable", "<p>“quoted”</p>"},
+		{p.Subparts[2], "utf-8", "7bit", "plain"},
+		{p.Subparts[3], "", "base64", "\xe9"},
+	}
+	for _, tt := range ttable {
+		if tt.p.Charset != tt.charset {
+			t.Errorf("%v: charset %q, want %q", tt.p, tt.p.Charset, tt.charset)
+		}
+		if got := tt.p.Header.Get(hnContentEncoding); got != tt.encoding {
+			t.Errorf("%v: Content-Transfer-Encoding %q, want %q", tt.p, got, tt.encoding)
+		}
+		r, err := tt.p.DecodeRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ioutil.ReadAll(r); string(got) != tt.want {
+			t.Errorf("%v: decoded %q, want %q", tt.p, got, tt.want)
+		}
+	}
+	if got, _ := p.Subparts[0].ContentParams.Param("format"); got != "flowed" {
+		t.Errorf("format %q, want %q", got, "flowed")
+	}
+	want := contentMD5([]byte("café au lait"))
+	if got := p.Subparts[0].Header.Get(hnContentMD5); got != want {
+		t.Errorf("Content-MD5 %q, want %q", got, want)
+	}
+
+	for _, raw := range []string{
+		"Content-Type: text/plain; charset=x-unknown\r\n\r\nbody\r\n",
+		"Content-Type: text/plain\r\n\r\ncaf\xe9\r\n",
+	} {
+		root, err := ReadParts(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ConvertToUTF8(root); !errors.Is(err, ErrorCharsetConversion) {
+			t.Errorf("%q: ConvertToUTF8() error %v, want %v", raw, err, ErrorCharsetConversion)
+		}
+	}
+}
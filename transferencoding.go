@@ -0,0 +1,51 @@
+package mime
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// TransferDecoder returns a reader over the content of r with a Content-Transfer-Encoding removed,
+// see RegisterTransferEncoding.  Errors in the content are returned by the reader.
+type TransferDecoder func(r io.Reader) io.Reader
+
+// transferDecoders holds the TransferDecoders added with RegisterTransferEncoding, by lowercase
+// encoding name.
+var transferDecoders = struct {
+	sync.RWMutex
+	m map[string]TransferDecoder
+}{m: make(map[string]TransferDecoder)}
+
+// RegisterTransferEncoding adds fn as the decoder of the Content-Transfer-Encoding name, such as
+// x-uuencode or a vendor-specific encoding, so that Decode, DecodeRaw, Text and Recode remove it
+// rather than failing with ErrorContentEncoding.  Names are case-insensitive, and a nil fn removes
+// the decoder.  The encodings Decode handles itself, 7bit, 8bit, binary, quoted-printable, base64
+// and x-uuencode, cannot be replaced.  It is safe to call while other goroutines decode Parts.
+func RegisterTransferEncoding(name string, fn TransferDecoder) error {
+	name = strings.ToLower(name)
+	switch name {
+	case "":
+		return fmt.Errorf("empty Content-Transfer-Encoding name")
+	case "7bit", "8bit", "binary", "quoted-printable", "base64", ctTransferUUEncode, "x-uue",
+		"uuencode":
+		return fmt.Errorf("built in Content-Transfer-Encoding %q cannot be replaced", name)
+	}
+	transferDecoders.Lock()
+	defer transferDecoders.Unlock()
+	if fn == nil {
+		delete(transferDecoders.m, name)
+	} else {
+		transferDecoders.m[name] = fn
+	}
+	return nil
+}
+
+// registeredTransferDecoder returns the TransferDecoder registered for the lowercase encoding
+// name, or nil.
+func registeredTransferDecoder(name string) TransferDecoder {
+	transferDecoders.RLock()
+	defer transferDecoders.RUnlock()
+	return transferDecoders.m[name]
+}
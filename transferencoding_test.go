@@ -0,0 +1,80 @@
+package mime
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// rot13Reader decodes the x-rot13 test encoding.
+type rot13Reader struct{ r io.Reader }
+
+func (r rot13Reader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	for i, c := range b[:n] {
+		switch {
+		case c >= 'a' && c <= 'z':
+			b[i] = 'a' + (c-'a'+13)%26
+		case c >= 'A' && c <= 'Z':
+			b[i] = 'A' + (c-'A'+13)%26
+		}
+	}
+	return n, err
+}
+
+func rot13(r io.Reader) io.Reader {
+	return rot13Reader{r}
+}
+
+func TestRegisterTransferEncoding(t *testing.T) {
+	raw := "Content-Type: text/plain\r\nContent-Transfer-Encoding: X-Rot13\r\n\r\nUryyb jbeyq"
+	p, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Decode(); !errors.Is(err, ErrorContentEncoding) {
+		t.Fatalf("Decode() of unregistered encoding got %v, want %v", err, ErrorContentEncoding)
+	}
+
+	if err := RegisterTransferEncoding("x-ROT13", rot13); err != nil {
+		t.Fatal(err)
+	}
+	defer RegisterTransferEncoding("x-rot13", nil)
+	for _, name := range []string{"", "Base64", "7bit"} {
+		if err := RegisterTransferEncoding(name, rot13); err == nil {
+			t.Errorf("RegisterTransferEncoding(%q) got no error", name)
+		}
+	}
+
+	r, err := p.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(r); string(content) != "Hello world" {
+		t.Errorf("Decode() got %q, want %q", content, "Hello world")
+	}
+	if err := Recode(p, "7bit"); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := p.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(encoded); string(content) != "Hello world" {
+		t.Errorf("Recode() got %q, want %q", content, "Hello world")
+	}
+
+	RegisterTransferEncoding("x-rot13", nil)
+	if _, err := p.Decode(); err != nil {
+		t.Errorf("Decode() after Recode got %v", err)
+	}
+	q, err := ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Decode(); !errors.Is(err, ErrorContentEncoding) {
+		t.Errorf("Decode() after removing the decoder got %v, want %v", err, ErrorContentEncoding)
+	}
+}
@@ -0,0 +1,125 @@
+// transformReader is adapted from transform.Reader in golang.org/x/text, distributed under the
+// following license.
+//
+// Copyright (c) 2009 The Go Authors. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//    * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//    * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//    * Neither the name of Google Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package mime
+
+import (
+	"errors"
+	"io"
+
+	"golang.org/x/text/transform"
+)
+
+var errInconsistentByteCount = errors.New("transform: inconsistent byte count returned")
+
+// transformReader wraps a transform.Transformer as an io.Reader, like transform.Reader but with
+// buffers sized by bufSize rather than always 4096 bytes.  Read is adapted from transform.Reader.
+type transformReader struct {
+	r   io.Reader
+	t   transform.Transformer
+	err error
+
+	dst        []byte
+	dst0, dst1 int
+
+	src        []byte
+	src0, src1 int
+
+	transformComplete bool
+}
+
+func newTransformReader(r io.Reader, t transform.Transformer, sizeHint int) *transformReader {
+	t.Reset()
+	size := bufSize(sizeHint)
+	buf := make([]byte, 2*size)
+	return &transformReader{
+		r:   r,
+		t:   t,
+		dst: buf[:size:size],
+		src: buf[size:],
+	}
+}
+
+// Read method for io.Reader interface.
+func (r *transformReader) Read(p []byte) (int, error) {
+	n, err := 0, error(nil)
+	for {
+		// Copy out any transformed bytes and return the final error if we are done
+		if r.dst0 != r.dst1 {
+			n = copy(p, r.dst[r.dst0:r.dst1])
+			r.dst0 += n
+			if r.dst0 == r.dst1 && r.transformComplete {
+				return n, r.err
+			}
+			return n, nil
+		} else if r.transformComplete {
+			return 0, r.err
+		}
+
+		// Try to transform some source bytes, or to flush the transformer if we are out of source
+		// bytes.  We do this even if r.r.Read returned an error.
+		if r.src0 != r.src1 || r.err != nil {
+			r.dst0 = 0
+			r.dst1, n, err = r.t.Transform(r.dst, r.src[r.src0:r.src1], r.err == io.EOF)
+			r.src0 += n
+
+			switch {
+			case err == nil:
+				if r.src0 != r.src1 {
+					r.err = errInconsistentByteCount
+				}
+				// We are complete if we cannot read more bytes into src
+				r.transformComplete = r.err != nil
+				continue
+			case err == transform.ErrShortDst && (r.dst1 != 0 || n != 0):
+				// Make room in dst by copying out, and try again
+				continue
+			case err == transform.ErrShortSrc && r.src1-r.src0 != len(r.src) && r.err == nil:
+				// Read more bytes into src via the code below, and try again
+			default:
+				r.transformComplete = true
+				// The reader error takes precedence over the transformer error unless it is nil
+				// or io.EOF
+				if r.err == nil || r.err == io.EOF {
+					r.err = err
+				}
+				continue
+			}
+		}
+
+		// Move any untransformed source bytes to the start of the buffer and read more bytes
+		if r.src0 != 0 {
+			r.src0, r.src1 = 0, copy(r.src, r.src[r.src0:r.src1])
+		}
+		n, r.err = r.r.Read(r.src[r.src1:])
+		r.src1 += n
+	}
+}
@@ -0,0 +1,167 @@
+package mime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ctTransferUUEncode is the Content-Transfer-Encoding of the Parts in UUEncoded, also known as
+// x-uue and uuencode
+const ctTransferUUEncode = "x-uuencode"
+
+// findUUEncoded sets the UUEncoded Parts of a text/plain Part, see WithUUEncodeDetection.
+func (p *Part) findUUEncoded() {
+	if !p.parser().uuencode || p.ContentType != ctTextPlain || len(p.Subparts) > 0 ||
+		p.reader == nil {
+		return
+	}
+	r, err := p.DecodeRaw()
+	if err != nil {
+		return
+	}
+	br := bufio.NewReader(r)
+	var (
+		block    *bytes.Buffer // The begin line and the uuencoded lines following it so far
+		filename string
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		body := bytes.TrimRight(line, "\r\n")
+		end := bytes.Equal(body, []byte("end"))
+		if block != nil && (end || isUULine(body)) {
+			block.Write(line)
+			if end {
+				p.addUUEncoded(filename, block.Bytes())
+				block = nil
+			}
+		} else {
+			if block != nil {
+				// The end line is missing, the file ends with the last uuencoded line
+				p.addUUEncoded(filename, block.Bytes())
+				block = nil
+			}
+			if name, ok := parseUUBegin(body); ok {
+				block, filename = &bytes.Buffer{}, name
+				block.Write(line)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if block != nil {
+		p.addUUEncoded(filename, block.Bytes())
+	}
+}
+
+// addUUEncoded appends a Part holding the uuencoded file filename, block being its lines from
+// begin to end, to the UUEncoded Parts of p.
+func (p *Part) addUUEncoded(filename string, block []byte) {
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(newUUDecoder(bytes.NewReader(block)), head)
+	mediatype, params, err := parseMediaType(detectContentType(filename, head[:n]))
+	if err != nil {
+		mediatype, params = ctAppOctetStream, make(map[string]string)
+	}
+
+	q := NewPart(p)
+	q.Descriptor = joinSection(p.Descriptor, strconv.Itoa(len(p.UUEncoded)+1))
+	if q.setContentType(mediatype, params) != nil ||
+		q.setDisposition(cdAttachment, map[string]string{hpFilename: filename}) != nil ||
+		q.SetHeader(hnContentEncoding, ctTransferUUEncode) != nil {
+		return
+	}
+	q.Encoding = ctTransferUUEncode
+	q.setEncoded(append([]byte(nil), block...))
+	p.UUEncoded = append(p.UUEncoded, q)
+}
+
+// parseUUBegin returns the filename of a uuencode begin line, "begin <octal mode> <filename>".
+func parseUUBegin(line []byte) (filename string, ok bool) {
+	fields := bytes.SplitN(line, []byte{' '}, 3)
+	if len(fields) != 3 || string(fields[0]) != "begin" || len(fields[1]) < 3 ||
+		len(fields[1]) > 4 {
+		return "", false
+	}
+	for _, c := range fields[1] {
+		if c < '0' || c > '7' {
+			return "", false
+		}
+	}
+	filename = string(bytes.TrimSpace(fields[2]))
+	return filename, filename != ""
+}
+
+// isUULine returns true for a line of uuencoded data: a length character followed by at least
+// enough characters to encode that many bytes, all in the uuencode alphabet.
+func isUULine(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+	for _, c := range line {
+		if c < ' ' || c > '`' {
+			return false
+		}
+	}
+	n := int(line[0]-' ') & 63
+	return len(line)-1 >= (n*4+2)/3
+}
+
+// uuDecoder decodes uuencoded content, skipping lines until the begin line and stopping at the
+// end line.
+type uuDecoder struct {
+	r       *bufio.Reader
+	buf     []byte // Decoded bytes not yet returned
+	started bool   // The begin line has been read
+	err     error  // Returned once buf is empty
+}
+
+// newUUDecoder returns a reader decoding the uuencoded content of r.
+func newUUDecoder(r io.Reader) io.Reader {
+	return &uuDecoder{r: bufio.NewReader(r)}
+}
+
+func (d *uuDecoder) Read(b []byte) (int, error) {
+	for len(d.buf) == 0 && d.err == nil {
+		line, err := d.r.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case !d.started:
+			_, d.started = parseUUBegin(line)
+		case bytes.Equal(line, []byte("end")):
+			d.err = io.EOF
+		case len(line) > 0 && isUULine(line):
+			d.buf = decodeUULine(line)
+		case len(line) > 0:
+			d.err = fmt.Errorf("%w: malformed uuencoded line %q", ErrorContentEncoding, line)
+		}
+		if err != nil && d.err == nil {
+			d.err = err
+		}
+	}
+	n := copy(b, d.buf)
+	d.buf = d.buf[n:]
+	if len(d.buf) == 0 {
+		return n, d.err
+	}
+	return n, nil
+}
+
+// decodeUULine returns the bytes encoded by a line for which isUULine is true.
+func decodeUULine(line []byte) []byte {
+	n := int(line[0]-' ') & 63
+	out := make([]byte, 0, n+2)
+	for i := 1; len(out) < n; i += 4 {
+		var c [4]byte
+		for j := range c {
+			if i+j < len(line) {
+				c[j] = (line[i+j] - ' ') & 63
+			}
+		}
+		out = append(out, c[0]<<2|c[1]>>4, c[1]<<4|c[2]>>2, c[2]<<6|c[3])
+	}
+	return out[:n]
+}
@@ -0,0 +1,86 @@
+package mime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestUUEncodeDetection(t *testing.T) {
+	text := "Here are the files.\r\n\r\n" +
+		"begin 644 hello.txt\r\n,:&5L;&\\@=V]R;&0*\r\n`\r\nend\r\n\r\n" +
+		"And the data:\r\n" +
+		"begin 600 data.bin\r\n" +
+		"M``$\"`P0%!@<(\"0H+#`T.#Q`1$A,4%187&!D:&QP='A\\@(2(C)\"4F)R@I*BLL\r\n" +
+		"/+2XO,#$R,S0U-C<X.3H[\r\n" +
+		"Regards\r\n"
+	raw := "Content-Type: text/plain\r\n\r\n" + text
+	data := make([]byte, 60)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	p, err := ReadParts(strings.NewReader(raw), WithUUEncodeDetection())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		filename, contentType string
+		content               []byte
+	}{
+		{"hello.txt", "text/plain", []byte("hello world\n")},
+		{"data.bin", ctAppOctetStream, data},
+	}
+	if len(p.UUEncoded) != len(want) {
+		t.Fatalf("got %d UUEncoded Parts, want %d", len(p.UUEncoded), len(want))
+	}
+	for i, w := range want {
+		q := p.UUEncoded[i]
+		if q.Filename != w.filename || q.ContentType != w.contentType || q.Parent != p ||
+			!q.isAttachment() {
+			t.Errorf("UUEncoded[%d] got %q %q, want %q %q", i, q.Filename, q.ContentType,
+				w.filename, w.contentType)
+		}
+		r, err := q.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(content, w.content) {
+			t.Errorf("UUEncoded[%d] decoded %q, %v, want %q", i, content, err, w.content)
+		}
+	}
+
+	// The text is untouched, and remains the body
+	r, err := p.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(r); string(content) != text {
+		t.Errorf("Text() got %q, want %q", content, text)
+	}
+	if b := findBody(p, ctTextPlain); b != p || len(Attachments(p)) != 0 {
+		t.Errorf("got body %v, Attachments %v, want the text Part alone", b, Attachments(p))
+	}
+
+	p, err = ReadParts(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.UUEncoded) != 0 {
+		t.Errorf("got %d UUEncoded Parts without WithUUEncodeDetection", len(p.UUEncoded))
+	}
+
+	// A MIME Part with the x-uuencode Content-Transfer-Encoding
+	raw = "Content-Type: text/plain\r\nContent-Transfer-Encoding: X-UUE\r\n\r\n" +
+		"begin 644 hello.txt\r\n,:&5L;&\\@=V]R;&0*\r\n`\r\nend\r\n"
+	if p, err = ReadParts(strings.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = p.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(r); string(content) != "hello world\n" {
+		t.Errorf("Decode() of x-uue got %q, want %q", content, "hello world\n")
+	}
+}